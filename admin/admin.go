@@ -0,0 +1,417 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cgroups"
+	"github.com/pivotal-cf/cf-redis-broker/diagnostics"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+type InstanceManager interface {
+	InstanceExists(instanceID string) (bool, error)
+	InstanceState(instanceID string) (string, error)
+	Suspend(instanceID string) error
+	Resume(instanceID string) error
+}
+
+type EventJournal interface {
+	events.Recorder
+	Events(instanceID string) ([]events.Event, error)
+}
+
+type InstanceLocker interface {
+	LockInstance(instanceID string) (func(), error)
+	TryLockInstance(instanceID string) (func(), bool, error)
+}
+
+type LeaseManager interface {
+	InstanceLocks() ([]redis.InstanceLock, error)
+	InstanceLock(instanceID string) (*redis.InstanceLock, error)
+	ForceUnlock(instanceID string) error
+}
+
+type PressureReader interface {
+	Pressure(instanceID string) (cgroups.Pressure, error)
+}
+
+type DiagnosticsCollector interface {
+	Collect(instanceID string) (diagnostics.Bundle, error)
+}
+
+type InstanceResponse struct {
+	InstanceID string `json:"instance_id"`
+	State      string `json:"state"`
+}
+
+type EventsResponse struct {
+	InstanceID string         `json:"instance_id"`
+	Events     []events.Event `json:"events"`
+}
+
+type PressureResponse struct {
+	InstanceID string `json:"instance_id"`
+	cgroups.Pressure
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the operator-only admin API. It is mounted by the broker
+// underneath /admin and is protected by the broker's basic auth credentials.
+type Handler struct {
+	Instances   InstanceManager
+	Events      EventJournal
+	Locks       InstanceLocker
+	Leases      LeaseManager
+	Pressure    PressureReader
+	Diagnostics DiagnosticsCollector
+	Credentials brokerconfig.AuthConfiguration
+	Logger      lager.Logger
+
+	routes []route
+}
+
+type route struct {
+	method  string
+	pattern []string
+	handle  func(res http.ResponseWriter, req *http.Request, instanceID string)
+}
+
+func NewHandler(instances InstanceManager, journal EventJournal, credentials brokerconfig.AuthConfiguration, logger lager.Logger) *Handler {
+	handler := &Handler{
+		Instances:   instances,
+		Events:      journal,
+		Credentials: credentials,
+		Logger:      logger,
+	}
+
+	handler.routes = []route{
+		{"GET", []string{"instances", ":id"}, handler.showInstance},
+		{"POST", []string{"instances", ":id", "suspend"}, handler.suspendInstance},
+		{"POST", []string{"instances", ":id", "resume"}, handler.resumeInstance},
+		{"GET", []string{"instances", ":id", "events"}, handler.showEvents},
+		{"GET", []string{"locks"}, handler.listLocks},
+		{"GET", []string{"instances", ":id", "lock"}, handler.showLock},
+		{"DELETE", []string{"instances", ":id", "lock"}, handler.releaseLock},
+		{"GET", []string{"instances", ":id", "pressure"}, handler.showPressure},
+		{"POST", []string{"instances", ":id", "diagnostics"}, handler.collectDiagnostics},
+	}
+
+	return handler
+}
+
+func (handler *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Add("Content-Type", "application/json")
+
+	if !handler.Credentials.Authorized(req) {
+		res.Header().Set("WWW-Authenticate", `Basic realm="redis-broker-admin"`)
+		handler.respond(res, http.StatusUnauthorized, ErrorResponse{"not authorized"})
+		return
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	for _, r := range handler.routes {
+		instanceID, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+
+		if req.Method != r.method {
+			continue
+		}
+
+		if instanceID != "" {
+			err := broker.ValidateID("instance", instanceID)
+			if err != nil {
+				handler.respond(res, http.StatusBadRequest, ErrorResponse{err.Error()})
+				return
+			}
+		}
+
+		r.handle(res, req, instanceID)
+		return
+	}
+
+	handler.respond(res, http.StatusNotFound, ErrorResponse{"not found"})
+}
+
+func (handler *Handler) showInstance(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	handler.respondWithState(res, instanceID)
+}
+
+func (handler *Handler) suspendInstance(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	unlock, err := handler.lockInstance(instanceID)
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+	defer unlock()
+
+	err = handler.Instances.Suspend(instanceID)
+	if err != nil {
+		handler.Logger.Error("admin-suspend-instance", err, lager.Data{
+			"instance_id": instanceID,
+		})
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.Events.Record(instanceID, events.Suspended, events.ActorAdmin, nil)
+	handler.respondWithState(res, instanceID)
+}
+
+func (handler *Handler) resumeInstance(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	unlock, err := handler.lockInstance(instanceID)
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+	defer unlock()
+
+	err = handler.Instances.Resume(instanceID)
+	if err == redis.ErrInstanceNotResumable {
+		handler.respond(res, http.StatusConflict, ErrorResponse{err.Error()})
+		return
+	}
+
+	if err != nil {
+		handler.Logger.Error("admin-resume-instance", err, lager.Data{
+			"instance_id": instanceID,
+		})
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.Events.Record(instanceID, events.Resumed, events.ActorAdmin, nil)
+	handler.respondWithState(res, instanceID)
+}
+
+// showEvents does not require the instance to exist, so that the history of
+// deprovisioned instances can still be inspected.
+func (handler *Handler) showEvents(res http.ResponseWriter, req *http.Request, instanceID string) {
+	instanceEvents, err := handler.Events.Events(instanceID)
+	if os.IsNotExist(err) {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"no events recorded for instance"})
+		return
+	}
+
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respond(res, http.StatusOK, EventsResponse{
+		InstanceID: instanceID,
+		Events:     instanceEvents,
+	})
+}
+
+func (handler *Handler) listLocks(res http.ResponseWriter, req *http.Request, _ string) {
+	locks, err := handler.Leases.InstanceLocks()
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respond(res, http.StatusOK, locks)
+}
+
+func (handler *Handler) showLock(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	lock, err := handler.Leases.InstanceLock(instanceID)
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	if lock == nil {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"instance is not locked"})
+		return
+	}
+
+	handler.respond(res, http.StatusOK, lock)
+}
+
+// releaseLock removes a lock left behind by a broker that died while
+// provisioning or deprovisioning, handing the instance back to the process
+// monitor. Locks of operations that are still running are not released: the
+// broker holds the instance's lock for as long as it changes the instance.
+func (handler *Handler) releaseLock(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	if handler.Locks != nil {
+		unlock, acquired, err := handler.Locks.TryLockInstance(instanceID)
+		if err != nil {
+			handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+			return
+		}
+
+		if !acquired {
+			handler.respond(res, http.StatusConflict, ErrorResponse{"instance is being changed by the broker"})
+			return
+		}
+		defer unlock()
+	}
+
+	err := handler.Leases.ForceUnlock(instanceID)
+	if err != nil {
+		handler.Logger.Error("admin-release-lock", err, lager.Data{
+			"instance_id": instanceID,
+		})
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respondWithState(res, instanceID)
+}
+
+// showPressure reports how long the instance's redis-server has been stalled
+// waiting for CPU, memory and IO in its cgroup.
+func (handler *Handler) showPressure(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if handler.Pressure == nil {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"resource isolation is not enabled"})
+		return
+	}
+
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	pressure, err := handler.Pressure.Pressure(instanceID)
+	if os.IsNotExist(err) {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"instance has no cgroup"})
+		return
+	}
+
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respond(res, http.StatusOK, PressureResponse{
+		InstanceID: instanceID,
+		Pressure:   pressure,
+	})
+}
+
+// collectDiagnostics writes a diagnostics bundle for support and reports
+// where it can be found.
+func (handler *Handler) collectDiagnostics(res http.ResponseWriter, req *http.Request, instanceID string) {
+	if handler.Diagnostics == nil {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"diagnostics are not enabled"})
+		return
+	}
+
+	if !handler.ensureInstanceExists(res, instanceID) {
+		return
+	}
+
+	bundle, err := handler.Diagnostics.Collect(instanceID)
+	if err != nil {
+		handler.Logger.Error("admin-collect-diagnostics", err, lager.Data{
+			"instance_id": instanceID,
+		})
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respond(res, http.StatusCreated, bundle)
+}
+
+func (handler *Handler) ensureInstanceExists(res http.ResponseWriter, instanceID string) bool {
+	exists, err := handler.Instances.InstanceExists(instanceID)
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return false
+	}
+
+	if !exists {
+		handler.respond(res, http.StatusNotFound, ErrorResponse{"instance does not exist"})
+		return false
+	}
+
+	return true
+}
+
+func (handler *Handler) lockInstance(instanceID string) (func(), error) {
+	if handler.Locks == nil {
+		return func() {}, nil
+	}
+
+	return handler.Locks.LockInstance(instanceID)
+}
+
+func (handler *Handler) respondWithState(res http.ResponseWriter, instanceID string) {
+	state, err := handler.Instances.InstanceState(instanceID)
+	if err != nil {
+		handler.respond(res, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	handler.respond(res, http.StatusOK, InstanceResponse{
+		InstanceID: instanceID,
+		State:      state,
+	})
+}
+
+func (handler *Handler) respond(res http.ResponseWriter, status int, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(status)
+	res.Write(payload)
+}
+
+func (r route) match(segments []string) (string, bool) {
+	if len(segments) != len(r.pattern) {
+		return "", false
+	}
+
+	instanceID := ""
+	for i, part := range r.pattern {
+		if part == ":id" {
+			if segments[i] == "" {
+				return "", false
+			}
+			instanceID = segments[i]
+			continue
+		}
+
+		if part != segments[i] {
+			return "", false
+		}
+	}
+
+	return instanceID, true
+}
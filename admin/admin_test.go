@@ -0,0 +1,413 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/admin"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cgroups"
+	"github.com/pivotal-cf/cf-redis-broker/diagnostics"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInstanceManager struct {
+	states     map[string]string
+	locks      map[string]*redis.InstanceLock
+	suspendErr error
+}
+
+func (manager *fakeInstanceManager) InstanceLocks() ([]redis.InstanceLock, error) {
+	locks := []redis.InstanceLock{}
+	for _, lock := range manager.locks {
+		locks = append(locks, *lock)
+	}
+	return locks, nil
+}
+
+func (manager *fakeInstanceManager) InstanceLock(instanceID string) (*redis.InstanceLock, error) {
+	return manager.locks[instanceID], nil
+}
+
+func (manager *fakeInstanceManager) ForceUnlock(instanceID string) error {
+	delete(manager.locks, instanceID)
+	return nil
+}
+
+func (manager *fakeInstanceManager) InstanceExists(instanceID string) (bool, error) {
+	_, ok := manager.states[instanceID]
+	return ok, nil
+}
+
+func (manager *fakeInstanceManager) InstanceState(instanceID string) (string, error) {
+	return manager.states[instanceID], nil
+}
+
+func (manager *fakeInstanceManager) Suspend(instanceID string) error {
+	if manager.suspendErr != nil {
+		return manager.suspendErr
+	}
+	manager.states[instanceID] = broker.InstanceStateSuspended
+	return nil
+}
+
+func (manager *fakeInstanceManager) Resume(instanceID string) error {
+	if manager.states[instanceID] != broker.InstanceStateSuspended {
+		return redis.ErrInstanceNotResumable
+	}
+	manager.states[instanceID] = broker.InstanceStateRunning
+	return nil
+}
+
+type fakeDiagnostics struct {
+	bundle diagnostics.Bundle
+	err    error
+}
+
+func (fake *fakeDiagnostics) Collect(instanceID string) (diagnostics.Bundle, error) {
+	fake.bundle.InstanceID = instanceID
+	return fake.bundle, fake.err
+}
+
+var _ = Describe("Admin API", func() {
+	var (
+		recorder *httptest.ResponseRecorder
+		handler  http.Handler
+		manager  *fakeInstanceManager
+		journal  *events.Journal
+	)
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		manager = &fakeInstanceManager{
+			states: map[string]string{"an-instance": broker.InstanceStateRunning},
+			locks:  map[string]*redis.InstanceLock{},
+		}
+		eventDir, err := os.MkdirTemp("", "admin-events")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, eventDir)
+
+		journal = events.NewJournal(eventDir, lagertest.NewTestLogger("events"))
+		handler = admin.NewHandler(
+			manager,
+			journal,
+			brokerconfig.AuthConfiguration{Username: "admin", Password: "secret"},
+			lagertest.NewTestLogger("admin"),
+		)
+		handler.(*admin.Handler).Leases = manager
+	})
+
+	serve := func(method, path string) {
+		request, err := http.NewRequest(method, "http://localhost"+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth("admin", "secret")
+		handler.ServeHTTP(recorder, request)
+	}
+
+	readInstance := func() admin.InstanceResponse {
+		var response admin.InstanceResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		return response
+	}
+
+	It("rejects requests without the broker credentials", func() {
+		request, err := http.NewRequest("GET", "http://localhost/instances/an-instance", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth("admin", "wrong")
+		handler.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("responds with a 404 for unknown paths", func() {
+		serve("GET", "/unknown")
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("responds with a 400 for invalid instance IDs", func() {
+		serve("DELETE", "/instances/../lock")
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(ContainSubstring(`invalid instance ID`))
+	})
+
+	Describe("GET /instances/:id", func() {
+		It("reports the state of the instance", func() {
+			serve("GET", "/instances/an-instance")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(readInstance()).To(Equal(admin.InstanceResponse{
+				InstanceID: "an-instance",
+				State:      broker.InstanceStateRunning,
+			}))
+		})
+
+		It("responds with a 404 when the instance does not exist", func() {
+			serve("GET", "/instances/missing")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /instances/:id/suspend", func() {
+		It("suspends the instance", func() {
+			serve("POST", "/instances/an-instance/suspend")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(readInstance().State).To(Equal(broker.InstanceStateSuspended))
+		})
+
+		It("responds with a 500 when suspending fails", func() {
+			manager.suspendErr = errors.New("kill failed")
+			serve("POST", "/instances/an-instance/suspend")
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring("kill failed"))
+		})
+
+		It("waits for changes the broker is making to the instance", func() {
+			lockSet := locks.New(journal.Directory)
+			handler.(*admin.Handler).Locks = lockSet
+
+			unlock, err := lockSet.LockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				serve("POST", "/instances/an-instance/suspend")
+				close(done)
+			}()
+
+			Consistently(done, 50*time.Millisecond).ShouldNot(BeClosed())
+			unlock()
+			Eventually(done).Should(BeClosed())
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(readInstance().State).To(Equal(broker.InstanceStateSuspended))
+		})
+
+		It("does not accept GET", func() {
+			serve("GET", "/instances/an-instance/suspend")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /instances/:id/resume", func() {
+		It("resumes a suspended instance", func() {
+			manager.states["an-instance"] = broker.InstanceStateSuspended
+			serve("POST", "/instances/an-instance/resume")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(readInstance().State).To(Equal(broker.InstanceStateRunning))
+		})
+
+		It("responds with a 409 when the instance is not suspended", func() {
+			serve("POST", "/instances/an-instance/resume")
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("GET /instances/:id/events", func() {
+		readEvents := func() admin.EventsResponse {
+			var response admin.EventsResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			return response
+		}
+
+		It("lists the recorded events of the instance in order", func() {
+			journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+			serve("POST", "/instances/an-instance/suspend")
+			recorder = httptest.NewRecorder()
+
+			serve("GET", "/instances/an-instance/events")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			response := readEvents()
+			Expect(response.InstanceID).To(Equal("an-instance"))
+			Expect(response.Events).To(HaveLen(2))
+			Expect(response.Events[0].Type).To(Equal(events.Provisioned))
+			Expect(response.Events[1].Type).To(Equal(events.Suspended))
+			Expect(response.Events[1].Actor).To(Equal(events.ActorAdmin))
+		})
+
+		It("lists events of instances that no longer exist", func() {
+			journal.Record("gone", events.Deprovisioned, events.ActorBroker, nil)
+			serve("GET", "/instances/gone/events")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(readEvents().Events).To(HaveLen(1))
+		})
+
+		It("responds with a 404 when nothing was recorded for the instance", func() {
+			serve("GET", "/instances/missing/events")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("instance locks", func() {
+		BeforeEach(func() {
+			manager.locks["an-instance"] = &redis.InstanceLock{
+				InstanceID: "an-instance",
+				OwnerPid:   1234,
+				Purpose:    redis.LockPurposeProvision,
+				Stale:      true,
+			}
+		})
+
+		It("lists the locks of all instances", func() {
+			serve("GET", "/locks")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var locks []redis.InstanceLock
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &locks)).To(Succeed())
+			Expect(locks).To(ConsistOf(*manager.locks["an-instance"]))
+		})
+
+		It("shows the lock of an instance", func() {
+			serve("GET", "/instances/an-instance/lock")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var lock redis.InstanceLock
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &lock)).To(Succeed())
+			Expect(lock.OwnerPid).To(Equal(1234))
+			Expect(lock.Stale).To(BeTrue())
+		})
+
+		It("responds with a 404 when the instance is not locked", func() {
+			delete(manager.locks, "an-instance")
+			serve("GET", "/instances/an-instance/lock")
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("releases the lock of an instance by force", func() {
+			serve("DELETE", "/instances/an-instance/lock")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(manager.locks).NotTo(HaveKey("an-instance"))
+		})
+
+		It("does not release locks of instances that do not exist", func() {
+			serve("DELETE", "/instances/missing/lock")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("does not release the lock of an instance the broker is still changing", func() {
+			lockSet := locks.New(journal.Directory)
+			handler.(*admin.Handler).Locks = lockSet
+
+			unlock, err := lockSet.LockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			serve("DELETE", "/instances/an-instance/lock")
+			unlock()
+
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+			Expect(manager.locks).To(HaveKey("an-instance"))
+
+			recorder = httptest.NewRecorder()
+			serve("DELETE", "/instances/an-instance/lock")
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(manager.locks).NotTo(HaveKey("an-instance"))
+		})
+	})
+
+	Describe("GET /instances/:id/pressure", func() {
+		var cgroupRoot string
+
+		BeforeEach(func() {
+			var err error
+			cgroupRoot, err = os.MkdirTemp("", "admin-cgroup")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, cgroupRoot)
+
+			handler.(*admin.Handler).Pressure = cgroups.NewManager(cgroupRoot, cgroups.Limits{})
+		})
+
+		It("reports the pressure stats of the instance's cgroup", func() {
+			instanceCgroup := filepath.Join(cgroupRoot, "an-instance")
+			Expect(os.Mkdir(instanceCgroup, 0755)).To(Succeed())
+			for _, name := range []string{"cpu.pressure", "memory.pressure", "io.pressure"} {
+				stats := "some avg10=0.50 avg60=0.25 avg300=0.00 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=7\n"
+				Expect(os.WriteFile(filepath.Join(instanceCgroup, name), []byte(stats), 0644)).To(Succeed())
+			}
+
+			serve("GET", "/instances/an-instance/pressure")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var response admin.PressureResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.InstanceID).To(Equal("an-instance"))
+			Expect(response.Memory.Some.Avg10).To(Equal(0.5))
+			Expect(response.IO.Full.Total).To(Equal(uint64(7)))
+		})
+
+		It("responds with a 404 when the instance has no cgroup", func() {
+			serve("GET", "/instances/an-instance/pressure")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("responds with a 404 when resource isolation is not enabled", func() {
+			handler.(*admin.Handler).Pressure = nil
+			serve("GET", "/instances/an-instance/pressure")
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(ContainSubstring("resource isolation is not enabled"))
+		})
+	})
+
+	Describe("POST /instances/:id/diagnostics", func() {
+		var collector *fakeDiagnostics
+
+		BeforeEach(func() {
+			collector = &fakeDiagnostics{bundle: diagnostics.Bundle{
+				Path:     "/var/vcap/data/redis-diagnostics/an-instance-diagnostics-20261019T075200Z.tar.gz",
+				Location: "s3://redis-diagnostics/an-instance-diagnostics-20261019T075200Z.tar.gz",
+			}}
+			handler.(*admin.Handler).Diagnostics = collector
+		})
+
+		It("reports where the bundle was written", func() {
+			serve("POST", "/instances/an-instance/diagnostics")
+
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			var response diagnostics.Bundle
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.InstanceID).To(Equal("an-instance"))
+			Expect(response.Path).To(Equal(collector.bundle.Path))
+			Expect(response.Location).To(Equal(collector.bundle.Location))
+		})
+
+		It("responds with a 500 when the bundle cannot be collected", func() {
+			collector.err = errors.New("disk full")
+			serve("POST", "/instances/an-instance/diagnostics")
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring("disk full"))
+		})
+
+		It("responds with a 404 when the instance does not exist", func() {
+			serve("POST", "/instances/missing/diagnostics")
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("responds with a 404 when diagnostics are not enabled", func() {
+			handler.(*admin.Handler).Diagnostics = nil
+			serve("POST", "/instances/an-instance/diagnostics")
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(ContainSubstring("diagnostics are not enabled"))
+		})
+	})
+})
@@ -2,26 +2,46 @@ package broker
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+
 	brokerapi "github.com/pivotal-cf/brokerapi/v10/domain"
 	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+	"github.com/pivotal-cf/brokerapi/v10/middlewares"
 
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
 const (
 	PlanNameShared = "shared-vm"
 )
 
+const (
+	InstanceStateRunning   = "running"
+	InstanceStateSuspended = "suspended"
+	InstanceStateFailed    = "failed"
+)
+
+var ErrInstanceSuspended = brokerapiresponses.NewFailureResponseBuilder(
+	errors.New("instance is suspended"), http.StatusUnprocessableEntity, "instance-suspended",
+).WithErrorKey("InstanceSuspended").Build()
+
 type InstanceCredentials struct {
 	Host     string
 	Port     int
 	Password string
 }
 
+// InstanceCreator creates instances. config holds the redis.conf directives
+// the tenant passed as parameters.
 type InstanceCreator interface {
-	Create(instanceID string) error
+	Create(instanceID string, config redisconf.Conf) error
 	Destroy(instanceID string) error
 	InstanceExists(instanceID string) (bool, error)
 }
@@ -30,12 +50,44 @@ type InstanceBinder interface {
 	Bind(instanceID string, bindingID string) (InstanceCredentials, error)
 	Unbind(instanceID string, bindingID string) error
 	InstanceExists(instanceID string) (bool, error)
+	InstanceState(instanceID string) (string, error)
+}
+
+// InstanceDetails is what the platform told the broker about an instance when
+// it was provisioned.
+type InstanceDetails struct {
+	PlanID           string
+	OrganizationGUID string
+	SpaceGUID        string
+	Parameters       json.RawMessage
+	Context          json.RawMessage
+}
+
+type InstanceDetailsSaver interface {
+	SaveInstanceDetails(instanceID string, details InstanceDetails) error
+}
+
+// InstanceLocker serializes changes to instances. The global lock must be
+// taken before any instance lock.
+type InstanceLocker interface {
+	LockAll() (func(), error)
+	LockInstance(instanceID string) (func(), error)
+}
+
+// ParameterValidator checks the redis.conf directives a tenant passed as
+// parameters against the redis-server the instances run.
+type ParameterValidator interface {
+	ValidateParameters(config redisconf.Conf) error
 }
 
 type RedisServiceBroker struct {
 	InstanceCreators map[string]InstanceCreator
 	InstanceBinders  map[string]InstanceBinder
 	Config           brokerconfig.Config
+	Events           events.Recorder
+	Locks            InstanceLocker
+	Details          InstanceDetailsSaver
+	Parameters       ParameterValidator
 }
 
 func (redisServiceBroker *RedisServiceBroker) Services(ctx context.Context) ([]brokerapi.Service, error) {
@@ -51,6 +103,8 @@ func (redisServiceBroker *RedisServiceBroker) Services(ctx context.Context) ([]b
 			Description: redisServiceBroker.Config.RedisConfiguration.Description,
 			Bindable:    true,
 			Plans:       planList,
+
+			InstancesRetrievable: true,
 			Metadata: &brokerapi.ServiceMetadata{
 				DisplayName:         redisServiceBroker.Config.RedisConfiguration.DisplayName,
 				LongDescription:     redisServiceBroker.Config.RedisConfiguration.LongDescription,
@@ -71,6 +125,25 @@ func (redisServiceBroker *RedisServiceBroker) Services(ctx context.Context) ([]b
 func (redisServiceBroker *RedisServiceBroker) Provision(ctx context.Context, instanceID string, serviceDetails brokerapi.ProvisionDetails, asyncAllowed bool) (spec brokerapi.ProvisionedServiceSpec, err error) {
 	spec = brokerapi.ProvisionedServiceSpec{}
 
+	err = validateIDs(instanceID)
+	if err != nil {
+		return spec, err
+	}
+
+	// the instance limit and the instance ID can only be checked while no
+	// other instance is being provisioned
+	unlockAll, err := redisServiceBroker.lockAll()
+	if err != nil {
+		return spec, err
+	}
+	defer unlockAll()
+
+	unlock, err := redisServiceBroker.lockInstance(instanceID)
+	if err != nil {
+		return spec, err
+	}
+	defer unlock()
+
 	if redisServiceBroker.instanceExists(instanceID) {
 		return spec, brokerapiresponses.ErrInstanceAlreadyExists
 	}
@@ -96,21 +169,57 @@ func (redisServiceBroker *RedisServiceBroker) Provision(ctx context.Context, ins
 		return spec, errors.New("instance creator not found for plan")
 	}
 
-	err = instanceCreator.Create(instanceID)
+	config, err := redisServiceBroker.parameters(serviceDetails.RawParameters)
+	if err != nil {
+		return spec, err
+	}
+
+	err = instanceCreator.Create(instanceID, config)
 	if err != nil {
 		return spec, err
 	}
 
+	// an instance without its details would be missing its plan and
+	// parameters forever, so it is destroyed and the platform can retry
+	err = redisServiceBroker.saveDetails(instanceID, serviceDetails)
+	if err != nil {
+		if destroyErr := instanceCreator.Destroy(instanceID); destroyErr != nil {
+			return spec, errors.Join(err, destroyErr)
+		}
+		return spec, err
+	}
+
+	redisServiceBroker.record(ctx, instanceID, events.Provisioned, map[string]string{
+		"plan_id": serviceDetails.PlanID,
+	})
+
 	return spec, nil
 }
 
 func (redisServiceBroker *RedisServiceBroker) Deprovision(ctx context.Context, instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (brokerapi.DeprovisionServiceSpec, error) {
 	spec := brokerapi.DeprovisionServiceSpec{}
 
+	err := validateIDs(instanceID)
+	if err != nil {
+		return spec, err
+	}
+
+	unlock, err := redisServiceBroker.lockInstance(instanceID)
+	if err != nil {
+		return spec, err
+	}
+	defer unlock()
+
 	for _, instanceCreator := range redisServiceBroker.InstanceCreators {
 		instanceExists, _ := instanceCreator.InstanceExists(instanceID)
 		if instanceExists {
-			return spec, instanceCreator.Destroy(instanceID)
+			err = instanceCreator.Destroy(instanceID)
+			if err != nil {
+				return spec, err
+			}
+
+			redisServiceBroker.record(ctx, instanceID, events.Deprovisioned, nil)
+			return spec, nil
 		}
 	}
 	return spec, brokerapiresponses.ErrInstanceDoesNotExist
@@ -119,9 +228,29 @@ func (redisServiceBroker *RedisServiceBroker) Deprovision(ctx context.Context, i
 func (redisServiceBroker *RedisServiceBroker) Bind(ctx context.Context, instanceID, bindingID string, details brokerapi.BindDetails, asyncAllowed bool) (brokerapi.Binding, error) {
 	binding := brokerapi.Binding{}
 
+	err := validateIDs(instanceID, bindingID)
+	if err != nil {
+		return binding, err
+	}
+
+	unlock, err := redisServiceBroker.lockInstance(instanceID)
+	if err != nil {
+		return binding, err
+	}
+	defer unlock()
+
 	for _, repo := range redisServiceBroker.InstanceBinders {
 		instanceExists, _ := repo.InstanceExists(instanceID)
 		if instanceExists {
+			state, err := repo.InstanceState(instanceID)
+			if err != nil {
+				return binding, err
+			}
+
+			if state == InstanceStateSuspended {
+				return binding, ErrInstanceSuspended
+			}
+
 			instanceCredentials, err := repo.Bind(instanceID, bindingID)
 			if err != nil {
 				return binding, err
@@ -133,6 +262,10 @@ func (redisServiceBroker *RedisServiceBroker) Bind(ctx context.Context, instance
 			}
 
 			binding.Credentials = credentialsMap
+
+			redisServiceBroker.record(ctx, instanceID, events.Bound, map[string]string{
+				"binding_id": bindingID,
+			})
 			return binding, nil
 		}
 	}
@@ -140,6 +273,17 @@ func (redisServiceBroker *RedisServiceBroker) Bind(ctx context.Context, instance
 }
 
 func (redisServiceBroker *RedisServiceBroker) Unbind(ctx context.Context, instanceID, bindingID string, details brokerapi.UnbindDetails, asyncAllowed bool) (brokerapi.UnbindSpec, error) {
+	err := validateIDs(instanceID, bindingID)
+	if err != nil {
+		return brokerapi.UnbindSpec{}, err
+	}
+
+	unlock, err := redisServiceBroker.lockInstance(instanceID)
+	if err != nil {
+		return brokerapi.UnbindSpec{}, err
+	}
+	defer unlock()
+
 	for _, repo := range redisServiceBroker.InstanceBinders {
 		instanceExists, _ := repo.InstanceExists(instanceID)
 		if instanceExists {
@@ -147,6 +291,10 @@ func (redisServiceBroker *RedisServiceBroker) Unbind(ctx context.Context, instan
 			if err != nil {
 				return brokerapi.UnbindSpec{}, brokerapiresponses.ErrBindingDoesNotExist
 			}
+
+			redisServiceBroker.record(ctx, instanceID, events.Unbound, map[string]string{
+				"binding_id": bindingID,
+			})
 			return brokerapi.UnbindSpec{}, nil
 		}
 	}
@@ -186,6 +334,91 @@ func (redisServiceBroker *RedisServiceBroker) instanceExists(instanceID string)
 	return false
 }
 
+func (redisServiceBroker *RedisServiceBroker) lockAll() (func(), error) {
+	if redisServiceBroker.Locks == nil {
+		return func() {}, nil
+	}
+
+	return redisServiceBroker.Locks.LockAll()
+}
+
+func (redisServiceBroker *RedisServiceBroker) lockInstance(instanceID string) (func(), error) {
+	if redisServiceBroker.Locks == nil {
+		return func() {}, nil
+	}
+
+	return redisServiceBroker.Locks.LockInstance(instanceID)
+}
+
+// parameters decodes and validates the parameters of a request, so that bad
+// ones are rejected before anything is created or saved.
+func (redisServiceBroker *RedisServiceBroker) parameters(raw json.RawMessage) (redisconf.Conf, error) {
+	config, err := redisconf.ParseParameters(raw)
+	if err == nil && redisServiceBroker.Parameters != nil {
+		err = redisServiceBroker.Parameters.ValidateParameters(config)
+	}
+	if err != nil {
+		return nil, brokerapiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-parameters")
+	}
+
+	return config, nil
+}
+
+func (redisServiceBroker *RedisServiceBroker) saveDetails(instanceID string, serviceDetails brokerapi.ProvisionDetails) error {
+	if redisServiceBroker.Details == nil {
+		return nil
+	}
+
+	return redisServiceBroker.Details.SaveInstanceDetails(instanceID, InstanceDetails{
+		PlanID:           serviceDetails.PlanID,
+		OrganizationGUID: serviceDetails.OrganizationGUID,
+		SpaceGUID:        serviceDetails.SpaceGUID,
+		Parameters:       serviceDetails.RawParameters,
+		Context:          serviceDetails.RawContext,
+	})
+}
+
+func (redisServiceBroker *RedisServiceBroker) record(ctx context.Context, instanceID, eventType string, data map[string]string) {
+	if redisServiceBroker.Events == nil {
+		return
+	}
+
+	redisServiceBroker.Events.Record(instanceID, eventType, actor(ctx), data)
+}
+
+// actor identifies who asked for a change. Platforms pass the originating
+// user as "<platform> <base64 encoded JSON>"; requests without one are
+// attributed to the broker itself.
+func actor(ctx context.Context) string {
+	if ctx == nil {
+		return events.ActorBroker
+	}
+
+	identity, _ := ctx.Value(middlewares.OriginatingIdentityKey).(string)
+	if identity == "" {
+		return events.ActorBroker
+	}
+
+	parts := strings.SplitN(identity, " ", 2)
+	if len(parts) != 2 {
+		return identity
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return identity
+	}
+
+	var value struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(decoded, &value); err != nil || value.UserID == "" {
+		return parts[0]
+	}
+
+	return parts[0] + ":" + value.UserID
+}
+
 // LastOperation ...
 // If the broker provisions asynchronously, the Cloud Controller will poll this endpoint
 // for the status of the provisioning operation.
@@ -202,7 +435,39 @@ func (redisServiceBroker *RedisServiceBroker) GetBinding(ctx context.Context, in
 }
 
 func (redisServiceBroker *RedisServiceBroker) GetInstance(ctx context.Context, instanceID string, details brokerapi.FetchInstanceDetails) (brokerapi.GetInstanceDetailsSpec, error) {
-	return brokerapi.GetInstanceDetailsSpec{}, errors.New("not implemented")
+	err := validateIDs(instanceID)
+	if err != nil {
+		return brokerapi.GetInstanceDetailsSpec{}, err
+	}
+
+	plans := redisServiceBroker.plans()
+
+	for planIdentifier, repo := range redisServiceBroker.InstanceBinders {
+		instanceExists, _ := repo.InstanceExists(instanceID)
+		if !instanceExists {
+			continue
+		}
+
+		state, err := repo.InstanceState(instanceID)
+		if err != nil {
+			return brokerapi.GetInstanceDetailsSpec{}, err
+		}
+
+		spec := brokerapi.GetInstanceDetailsSpec{
+			ServiceID: redisServiceBroker.Config.RedisConfiguration.ServiceID,
+			Metadata: brokerapi.InstanceMetadata{
+				Attributes: map[string]string{"state": state},
+			},
+		}
+
+		if plan, ok := plans[planIdentifier]; ok {
+			spec.PlanID = plan.ID
+		}
+
+		return spec, nil
+	}
+
+	return brokerapi.GetInstanceDetailsSpec{}, brokerapiresponses.ErrInstanceDoesNotExist
 }
 
 func (redisServiceBroker *RedisServiceBroker) LastBindingOperation(ctx context.Context, instanceID, bindingID string, details brokerapi.PollDetails) (brokerapi.LastOperation, error) {
@@ -1,31 +1,42 @@
 package broker_test
 
 import (
+	"context"
 	"errors"
 	brokerapi "github.com/pivotal-cf/brokerapi/v10/domain"
 	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+	"github.com/pivotal-cf/brokerapi/v10/middlewares"
+	"net/http"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/events/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
 type fakeInstanceCreatorAndBinder struct {
 	createErr            error
 	createdInstanceIds   []string
+	createdConfigs       []redisconf.Conf
 	destroyErr           error
 	destroyedInstanceIds []string
 	instanceCredentials  broker.InstanceCredentials
 	bindingExists        bool
+	instanceState        string
+	savedDetails         map[string]broker.InstanceDetails
+	saveDetailsErr       error
 }
 
-func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Create(instanceID string) error {
+func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Create(instanceID string, config redisconf.Conf) error {
 	if fakeInstanceCreatorAndBinder.createErr != nil {
 		return fakeInstanceCreatorAndBinder.createErr
 	}
 	fakeInstanceCreatorAndBinder.createdInstanceIds = append(fakeInstanceCreatorAndBinder.createdInstanceIds, instanceID)
+	fakeInstanceCreatorAndBinder.createdConfigs = append(fakeInstanceCreatorAndBinder.createdConfigs, config)
 	return nil
 }
 
@@ -57,6 +68,30 @@ func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) InstanceExists
 	return false, nil
 }
 
+func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) InstanceState(instanceID string) (string, error) {
+	if fakeInstanceCreatorAndBinder.instanceState == "" {
+		return broker.InstanceStateRunning, nil
+	}
+	return fakeInstanceCreatorAndBinder.instanceState, nil
+}
+
+func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) SaveInstanceDetails(instanceID string, details broker.InstanceDetails) error {
+	if fakeInstanceCreatorAndBinder.saveDetailsErr != nil {
+		return fakeInstanceCreatorAndBinder.saveDetailsErr
+	}
+	if fakeInstanceCreatorAndBinder.savedDetails == nil {
+		fakeInstanceCreatorAndBinder.savedDetails = map[string]broker.InstanceDetails{}
+	}
+	fakeInstanceCreatorAndBinder.savedDetails[instanceID] = details
+	return nil
+}
+
+type parameterValidatorFunc func(config redisconf.Conf) error
+
+func (validate parameterValidatorFunc) ValidateParameters(config redisconf.Conf) error {
+	return validate(config)
+}
+
 var _ = Describe("Redis service broker", func() {
 
 	const instanceID = "instanceID"
@@ -107,6 +142,51 @@ var _ = Describe("Redis service broker", func() {
 				Expect(someCreatorAndBinder.createdInstanceIds[0]).To(Equal(instanceID))
 			})
 
+			It("creates the instance with the directives given as parameters", func() {
+				_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{
+					PlanID:        sharedPlanID,
+					RawParameters: []byte(`{"timeout":300}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(someCreatorAndBinder.createdConfigs).To(Equal([]redisconf.Conf{
+					redisconf.New(redisconf.Param{Key: "timeout", Value: "300"}),
+				}))
+			})
+
+			It("rejects parameters that are not directives as a bad request", func() {
+				_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{
+					PlanID:        sharedPlanID,
+					RawParameters: []byte(`["timeout"]`),
+				}, false)
+				Expect(err).To(BeAssignableToTypeOf(&brokerapiresponses.FailureResponse{}))
+				Expect(err.(*brokerapiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+
+				Expect(someCreatorAndBinder.createdInstanceIds).To(BeEmpty())
+			})
+
+			Context("when the parameters are invalid", func() {
+				BeforeEach(func() {
+					redisBroker.Details = someCreatorAndBinder
+					redisBroker.Parameters = parameterValidatorFunc(func(config redisconf.Conf) error {
+						return errors.New("dir: cannot be set for an instance")
+					})
+				})
+
+				It("rejects them as a bad request before anything is created or saved", func() {
+					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{
+						PlanID:        sharedPlanID,
+						RawParameters: []byte(`{"dir":"/etc"}`),
+					}, false)
+					Expect(err).To(MatchError("dir: cannot be set for an instance"))
+					Expect(err).To(BeAssignableToTypeOf(&brokerapiresponses.FailureResponse{}))
+					Expect(err.(*brokerapiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+
+					Expect(someCreatorAndBinder.createdInstanceIds).To(BeEmpty())
+					Expect(someCreatorAndBinder.savedDetails).To(BeEmpty())
+				})
+			})
+
 			Context("when the instance already exists", func() {
 				BeforeEach(func() {
 					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
@@ -129,6 +209,54 @@ var _ = Describe("Redis service broker", func() {
 					Expect(err).To(MatchError("something went bad"))
 				})
 			})
+
+			Context("when instance details are saved", func() {
+				BeforeEach(func() {
+					redisBroker.Details = someCreatorAndBinder
+				})
+
+				It("saves the plan, organization, space, parameters and context", func() {
+					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{
+						PlanID:           sharedPlanID,
+						OrganizationGUID: "org-guid",
+						SpaceGUID:        "space-guid",
+						RawParameters:    []byte(`{"maxmemory":"64mb"}`),
+						RawContext:       []byte(`{"platform":"cloudfoundry"}`),
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+
+					details := someCreatorAndBinder.savedDetails[instanceID]
+					Expect(details.PlanID).To(Equal(sharedPlanID))
+					Expect(details.OrganizationGUID).To(Equal("org-guid"))
+					Expect(details.SpaceGUID).To(Equal("space-guid"))
+					Expect(details.Parameters).To(MatchJSON(`{"maxmemory":"64mb"}`))
+					Expect(details.Context).To(MatchJSON(`{"platform":"cloudfoundry"}`))
+				})
+
+				It("returns an error when the details cannot be saved", func() {
+					someCreatorAndBinder.saveDetailsErr = errors.New("disk full")
+
+					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+					Expect(err).To(MatchError("disk full"))
+				})
+
+				It("destroys the instance when the details cannot be saved", func() {
+					someCreatorAndBinder.saveDetailsErr = errors.New("disk full")
+
+					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+					Expect(err).To(HaveOccurred())
+					Expect(someCreatorAndBinder.destroyedInstanceIds).To(ConsistOf(instanceID))
+				})
+
+				It("returns both errors when the instance cannot be destroyed either", func() {
+					someCreatorAndBinder.saveDetailsErr = errors.New("disk full")
+					someCreatorAndBinder.destroyErr = errors.New("destroy failed")
+
+					_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+					Expect(err).To(MatchError(ContainSubstring("disk full")))
+					Expect(err).To(MatchError(ContainSubstring("destroy failed")))
+				})
+			})
 		})
 
 		Context("when the plan is not recognized", func() {
@@ -179,7 +307,7 @@ var _ = Describe("Redis service broker", func() {
 	Describe(".Bind", func() {
 		Context("when the instance exists", func() {
 			BeforeEach(func() {
-				someCreatorAndBinder.Create(instanceID)
+				someCreatorAndBinder.Create(instanceID, nil)
 			})
 
 			It("returns credentials", func() {
@@ -202,6 +330,18 @@ var _ = Describe("Redis service broker", func() {
 			})
 		})
 
+		Context("when the instance is suspended", func() {
+			BeforeEach(func() {
+				someCreatorAndBinder.Create(instanceID, nil)
+				someCreatorAndBinder.instanceState = broker.InstanceStateSuspended
+			})
+
+			It("returns broker.ErrInstanceSuspended", func() {
+				_, err := redisBroker.Bind(nil, instanceID, "bindingID", brokerapi.BindDetails{}, false)
+				Expect(err).To(Equal(broker.ErrInstanceSuspended))
+			})
+		})
+
 		Context("when the instance does not exist", func() {
 			It("returns brokerapi.InstanceDoesNotExist", func() {
 				bindingID := "bindingID"
@@ -212,9 +352,45 @@ var _ = Describe("Redis service broker", func() {
 		})
 	})
 
+	Describe(".GetInstance", func() {
+		Context("when the instance exists", func() {
+			BeforeEach(func() {
+				someCreatorAndBinder.Create(instanceID, nil)
+			})
+
+			It("reports the plan and the running state", func() {
+				spec, err := redisBroker.GetInstance(nil, instanceID, brokerapi.FetchInstanceDetails{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.PlanID).To(Equal(sharedPlanID))
+				Expect(spec.Metadata.Attributes).To(Equal(map[string]string{"state": broker.InstanceStateRunning}))
+			})
+
+			Context("and it is suspended", func() {
+				BeforeEach(func() {
+					someCreatorAndBinder.instanceState = broker.InstanceStateSuspended
+				})
+
+				It("reports the suspended state", func() {
+					spec, err := redisBroker.GetInstance(nil, instanceID, brokerapi.FetchInstanceDetails{})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(spec.Metadata.Attributes["state"]).To(Equal(broker.InstanceStateSuspended))
+				})
+			})
+		})
+
+		Context("when the instance does not exist", func() {
+			It("returns brokerapi.InstanceDoesNotExist", func() {
+				_, err := redisBroker.GetInstance(nil, instanceID, brokerapi.FetchInstanceDetails{})
+				Expect(err).To(Equal(brokerapiresponses.ErrInstanceDoesNotExist))
+			})
+		})
+	})
+
 	Describe(".Unbind", func() {
 		BeforeEach(func() {
-			someCreatorAndBinder.Create(instanceID)
+			someCreatorAndBinder.Create(instanceID, nil)
 			_, err := redisBroker.Bind(nil, instanceID, "EXISTANT-BINDING", brokerapi.BindDetails{}, false)
 			Expect(err).NotTo(HaveOccurred())
 		})
@@ -231,4 +407,72 @@ var _ = Describe("Redis service broker", func() {
 			Expect(err).To(MatchError(brokerapiresponses.ErrBindingDoesNotExist))
 		})
 	})
+
+	Describe("lifecycle events", func() {
+		var recorder *fakes.FakeRecorder
+
+		BeforeEach(func() {
+			recorder = new(fakes.FakeRecorder)
+			redisBroker.Events = recorder
+			someCreatorAndBinder.bindingExists = true
+		})
+
+		recordedEvents := func() []string {
+			types := []string{}
+			for i := 0; i < recorder.RecordCallCount(); i++ {
+				recordedID, eventType, _, _ := recorder.RecordArgsForCall(i)
+				Expect(recordedID).To(Equal(instanceID))
+				types = append(types, eventType)
+			}
+			return types
+		}
+
+		It("records each transition of the instance lifecycle", func() {
+			_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = redisBroker.Bind(nil, instanceID, "bindingID", brokerapi.BindDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = redisBroker.Unbind(nil, instanceID, "bindingID", brokerapi.UnbindDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = redisBroker.Deprovision(nil, instanceID, brokerapi.DeprovisionDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(recordedEvents()).To(Equal([]string{
+				events.Provisioned,
+				events.Bound,
+				events.Unbound,
+				events.Deprovisioned,
+			}))
+		})
+
+		It("does not record operations that failed", func() {
+			someCreatorAndBinder.createErr = errors.New("something went bad")
+
+			_, err := redisBroker.Provision(nil, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+			Expect(err).To(HaveOccurred())
+
+			Expect(recorder.RecordCallCount()).To(BeZero())
+		})
+
+		It("attributes events to the broker when there is no originating identity", func() {
+			_, err := redisBroker.Provision(context.Background(), instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, actor, data := recorder.RecordArgsForCall(0)
+			Expect(actor).To(Equal(events.ActorBroker))
+			Expect(data).To(HaveKeyWithValue("plan_id", sharedPlanID))
+		})
+
+		It("attributes events to the originating user", func() {
+			// {"user_id":"683ea748-3092-4ff4-b656-39cacc4d5360"}
+			ctx := context.WithValue(context.Background(), middlewares.OriginatingIdentityKey,
+				"cloudfoundry eyJ1c2VyX2lkIjoiNjgzZWE3NDgtMzA5Mi00ZmY0LWI2NTYtMzljYWNjNGQ1MzYwIn0=")
+
+			_, err := redisBroker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, actor, _ := recorder.RecordArgsForCall(0)
+			Expect(actor).To(Equal("cloudfoundry:683ea748-3092-4ff4-b656-39cacc4d5360"))
+		})
+	})
 })
@@ -0,0 +1,217 @@
+package broker_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	brokerapi "github.com/pivotal-cf/brokerapi/v10/domain"
+	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// slowInstanceCreator checks the instance limit and whether an instance exists
+// the same way the local instance creator does: by looking first and creating
+// a little later.
+type slowInstanceCreator struct {
+	limit int
+
+	mutex     sync.Mutex
+	instances map[string]int
+	bindings  map[string]int
+	created   int
+	overLimit bool
+}
+
+func (creator *slowInstanceCreator) Create(instanceID string, config redisconf.Conf) error {
+	if creator.count() >= creator.limit {
+		return brokerapiresponses.ErrInstanceLimitMet
+	}
+
+	time.Sleep(time.Millisecond)
+
+	creator.mutex.Lock()
+	defer creator.mutex.Unlock()
+
+	creator.instances[instanceID]++
+	creator.created++
+	if len(creator.instances) > creator.limit {
+		creator.overLimit = true
+	}
+	return nil
+}
+
+func (creator *slowInstanceCreator) Destroy(instanceID string) error {
+	time.Sleep(time.Millisecond)
+
+	creator.mutex.Lock()
+	defer creator.mutex.Unlock()
+
+	if _, ok := creator.instances[instanceID]; !ok {
+		return errors.New("instance destroyed twice")
+	}
+	delete(creator.instances, instanceID)
+	return nil
+}
+
+func (creator *slowInstanceCreator) InstanceExists(instanceID string) (bool, error) {
+	creator.mutex.Lock()
+	defer creator.mutex.Unlock()
+
+	_, ok := creator.instances[instanceID]
+	return ok, nil
+}
+
+func (creator *slowInstanceCreator) InstanceState(instanceID string) (string, error) {
+	return broker.InstanceStateRunning, nil
+}
+
+func (creator *slowInstanceCreator) Bind(instanceID string, bindingID string) (broker.InstanceCredentials, error) {
+	creator.mutex.Lock()
+	bindings := creator.bindings[instanceID]
+	creator.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	creator.mutex.Lock()
+	creator.bindings[instanceID] = bindings + 1
+	creator.mutex.Unlock()
+
+	return broker.InstanceCredentials{}, nil
+}
+
+func (creator *slowInstanceCreator) Unbind(instanceID string, bindingID string) error {
+	return nil
+}
+
+func (creator *slowInstanceCreator) count() int {
+	creator.mutex.Lock()
+	defer creator.mutex.Unlock()
+
+	return len(creator.instances)
+}
+
+var _ = Describe("Redis service broker under concurrent requests", func() {
+	const (
+		sharedPlanID = "C210CA06-E7E5-4F5D-A5AA-7A2C51CC290E"
+		limit        = 3
+	)
+
+	var (
+		lockDir     string
+		creator     *slowInstanceCreator
+		redisBroker *broker.RedisServiceBroker
+	)
+
+	BeforeEach(func() {
+		var err error
+		lockDir, err = os.MkdirTemp("", "broker-locks")
+		Expect(err).NotTo(HaveOccurred())
+
+		creator = &slowInstanceCreator{
+			limit:     limit,
+			instances: map[string]int{},
+			bindings:  map[string]int{},
+		}
+
+		redisBroker = &broker.RedisServiceBroker{
+			InstanceCreators: map[string]broker.InstanceCreator{"shared": creator},
+			InstanceBinders:  map[string]broker.InstanceBinder{"shared": creator},
+			Config: brokerconfig.Config{
+				RedisConfiguration: brokerconfig.ServiceConfiguration{
+					SharedVMPlanID:       sharedPlanID,
+					ServiceInstanceLimit: limit,
+				},
+			},
+			Locks: locks.New(lockDir),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(lockDir)).To(Succeed())
+	})
+
+	hammer := func(requests int, request func(i int)) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				request(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	It("never provisions more instances than the limit", func() {
+		hammer(20, func(i int) {
+			redisBroker.Provision(nil, fmt.Sprintf("instance-%d", i), brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+		})
+
+		Expect(creator.overLimit).To(BeFalse())
+		Expect(creator.count()).To(Equal(limit))
+	})
+
+	It("provisions an instance ID only once", func() {
+		errs := make(chan error, 20)
+		hammer(20, func(int) {
+			_, err := redisBroker.Provision(nil, "same-instance", brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+			errs <- err
+		})
+		close(errs)
+
+		Expect(creator.created).To(Equal(1))
+
+		alreadyExists := 0
+		for err := range errs {
+			if err == brokerapiresponses.ErrInstanceAlreadyExists {
+				alreadyExists++
+			}
+		}
+		Expect(alreadyExists).To(Equal(19))
+	})
+
+	It("deprovisions an instance only once", func() {
+		_, err := redisBroker.Provision(nil, "an-instance", brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		errs := make(chan error, 10)
+		hammer(10, func(int) {
+			_, err := redisBroker.Deprovision(nil, "an-instance", brokerapi.DeprovisionDetails{}, false)
+			errs <- err
+		})
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			Expect(err).To(Equal(brokerapiresponses.ErrInstanceDoesNotExist))
+		}
+		Expect(succeeded).To(Equal(1))
+	})
+
+	It("serializes bindings of an instance", func() {
+		_, err := redisBroker.Provision(nil, "an-instance", brokerapi.ProvisionDetails{PlanID: sharedPlanID}, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		hammer(10, func(i int) {
+			_, err := redisBroker.Bind(nil, "an-instance", fmt.Sprintf("binding-%d", i), brokerapi.BindDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Expect(creator.bindings["an-instance"]).To(Equal(10))
+	})
+})
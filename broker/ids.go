@@ -0,0 +1,44 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+const maxIDLength = 255
+
+// Open Service Broker API IDs may only use the unreserved characters of
+// RFC 3986. Platforms normally send GUIDs.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// ValidateID returns a bad request failure for instance and binding IDs that
+// do not follow the Open Service Broker API rules, or that would name a
+// directory other than their own.
+func ValidateID(kind, id string) error {
+	if len(id) <= maxIDLength && validID.MatchString(id) && id != "." && id != ".." {
+		return nil
+	}
+
+	return brokerapiresponses.NewFailureResponse(
+		fmt.Errorf("invalid %s ID %q", kind, id), http.StatusBadRequest, "validate-id",
+	)
+}
+
+func validateIDs(instanceID string, bindingID ...string) error {
+	err := ValidateID("instance", instanceID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range bindingID {
+		err = ValidateID("binding", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package broker_test
+
+import (
+	"net/http"
+	"strings"
+
+	brokerapi "github.com/pivotal-cf/brokerapi/v10/domain"
+	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+var _ = Describe("ID validation", func() {
+	DescribeTable("accepts Open Service Broker API IDs",
+		func(id string) {
+			Expect(broker.ValidateID("instance", id)).To(Succeed())
+		},
+		Entry("a GUID", "1c9d4d8e-7b53-4b3a-9a5b-2b9b2d0a9a11"),
+		Entry("unreserved punctuation", "an_instance.v2~copy"),
+		Entry("the longest allowed ID", strings.Repeat("a", 255)),
+	)
+
+	DescribeTable("rejects other IDs with a bad request",
+		func(id string) {
+			err := broker.ValidateID("instance", id)
+			Expect(err).To(HaveOccurred())
+
+			failure, ok := err.(*brokerapiresponses.FailureResponse)
+			Expect(ok).To(BeTrue())
+			Expect(failure.ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+		},
+		Entry("an empty ID", ""),
+		Entry("the current directory", "."),
+		Entry("the parent directory", ".."),
+		Entry("a traversal", "../../x"),
+		Entry("a slash", "a/b"),
+		Entry("whitespace", "an instance"),
+		Entry("a nul byte", "an-instance\x00"),
+		Entry("an ID that is too long", strings.Repeat("a", 256)),
+	)
+
+	Context("at the broker boundary", func() {
+		var (
+			creatorAndBinder *fakeInstanceCreatorAndBinder
+			redisBroker      *broker.RedisServiceBroker
+		)
+
+		const planID = "C210CA06-E7E5-4F5D-A5AA-7A2C51CC290E"
+
+		BeforeEach(func() {
+			creatorAndBinder = &fakeInstanceCreatorAndBinder{
+				createdInstanceIds: []string{".."},
+				bindingExists:      true,
+			}
+
+			redisBroker = &broker.RedisServiceBroker{
+				InstanceCreators: map[string]broker.InstanceCreator{"shared": creatorAndBinder},
+				InstanceBinders:  map[string]broker.InstanceBinder{"shared": creatorAndBinder},
+				Config: brokerconfig.Config{
+					RedisConfiguration: brokerconfig.ServiceConfiguration{
+						SharedVMPlanID:       planID,
+						ServiceInstanceLimit: 3,
+					},
+				},
+			}
+		})
+
+		It("does not provision instances with invalid IDs", func() {
+			_, err := redisBroker.Provision(nil, "../../x", brokerapi.ProvisionDetails{PlanID: planID}, false)
+			Expect(err).To(MatchError(ContainSubstring(`invalid instance ID "../../x"`)))
+			Expect(creatorAndBinder.createdInstanceIds).To(Equal([]string{".."}))
+		})
+
+		It("does not deprovision instances with invalid IDs", func() {
+			_, err := redisBroker.Deprovision(nil, "..", brokerapi.DeprovisionDetails{}, false)
+			Expect(err).To(MatchError(ContainSubstring(`invalid instance ID ".."`)))
+			Expect(creatorAndBinder.destroyedInstanceIds).To(BeEmpty())
+		})
+
+		It("does not bind or unbind with invalid binding IDs", func() {
+			_, err := redisBroker.Bind(nil, "an-instance", "a/b", brokerapi.BindDetails{}, false)
+			Expect(err).To(MatchError(ContainSubstring(`invalid binding ID "a/b"`)))
+
+			_, err = redisBroker.Unbind(nil, "an-instance", "a/b", brokerapi.UnbindDetails{}, false)
+			Expect(err).To(MatchError(ContainSubstring(`invalid binding ID "a/b"`)))
+		})
+
+		It("does not look up instances with invalid IDs", func() {
+			_, err := redisBroker.GetInstance(nil, "..", brokerapi.FetchInstanceDetails{})
+			Expect(err).To(MatchError(ContainSubstring(`invalid instance ID ".."`)))
+		})
+	})
+})
@@ -1,8 +1,10 @@
 package brokerconfig
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/cloudfoundry-incubator/candiedyaml"
@@ -17,6 +19,7 @@ type Config struct {
 	RedisServerExecutablePath       string               `yaml:"redis_server_executable_path"`
 	AgentPort                       string               `yaml:"agent_port"`
 	ConsistencyVerificationInterval int                  `yaml:"consistency_check_interval_seconds"`
+	ConsistencyRepair               bool                 `yaml:"consistency_repair"`
 }
 
 type AuthConfiguration struct {
@@ -24,6 +27,20 @@ type AuthConfiguration struct {
 	Username string `yaml:"username"`
 }
 
+// Authorized reports whether the request carries these credentials as basic
+// auth. The credentials are compared in constant time.
+func (auth AuthConfiguration) Authorized(req *http.Request) bool {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(auth.Username)) == 1
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(auth.Password)) == 1
+
+	return usernameMatches && passwordMatches
+}
+
 type ServiceConfiguration struct {
 	ServiceName                 string `yaml:"service_name"`
 	ServiceID                   string `yaml:"service_id"`
@@ -31,10 +48,17 @@ type ServiceConfiguration struct {
 	Host                        string `yaml:"host"`
 	DefaultConfigPath           string `yaml:"redis_conf_path"`
 	ProcessCheckIntervalSeconds int    `yaml:"process_check_interval"`
+	ProcessCheckTimeoutSeconds  int    `yaml:"process_check_timeout"`
+	ProcessCheckConcurrency     int    `yaml:"process_check_concurrency"`
+	ProcessMonitorSocketPath    string `yaml:"process_monitor_socket"`
 	StartRedisTimeoutSeconds    int    `yaml:"start_redis_timeout"`
 	InstanceDataDirectory       string `yaml:"data_directory"`
 	PidfileDirectory            string `yaml:"pidfile_directory"`
 	InstanceLogDirectory        string `yaml:"log_directory"`
+	EventDirectory              string `yaml:"event_directory"`
+	LockDirectory               string `yaml:"lock_directory"`
+	LockLeaseSeconds            int    `yaml:"lock_lease_seconds"`
+	StateFile                   string `yaml:"state_file"`
 	ServiceInstanceLimit        int    `yaml:"service_instance_limit"`
 	Description                 string `yaml:"description"`
 	LongDescription             string `yaml:"long_description"`
@@ -43,6 +67,67 @@ type ServiceConfiguration struct {
 	SupportURL                  string `yaml:"support_url"`
 	DisplayName                 string `yaml:"display_name"`
 	IconImage                   string `yaml:"icon_image"`
+	CrashLoopThreshold          int    `yaml:"crash_loop_threshold"`
+	CrashLoopWindowSeconds      int    `yaml:"crash_loop_window_seconds"`
+	RestartBackoffSeconds       int    `yaml:"restart_backoff_seconds"`
+	MaxRestartBackoffSeconds    int    `yaml:"max_restart_backoff_seconds"`
+	PortRangeStart              int    `yaml:"port_range_start"`
+	PortRangeEnd                int    `yaml:"port_range_end"`
+	ExcludedPorts               []int  `yaml:"excluded_ports"`
+	PortReservationsFile        string `yaml:"port_reservations_file"`
+	Supervisor                  string `yaml:"supervisor"`
+	SystemdUnitDirectory        string `yaml:"systemd_unit_directory"`
+	CgroupRoot                  string `yaml:"cgroup_root"`
+	IsolateInstanceUsers        bool   `yaml:"isolate_instance_users"`
+	InstanceUserPrefix          string `yaml:"instance_user_prefix"`
+	MetricsIntervalSeconds      int    `yaml:"metrics_interval_seconds"`
+	SlowlogIntervalSeconds      int    `yaml:"slowlog_interval_seconds"`
+	ConfigDriftPolicy           string `yaml:"config_drift_policy"`
+	ConfigDriftIntervalSeconds  int    `yaml:"config_drift_interval_seconds"`
+
+	// SharedVMResources limits each instance of the shared-vm plan when
+	// CgroupRoot is set.
+	SharedVMResources ResourceLimits `yaml:"shared_vm_resources"`
+
+	// SharedVMConfig holds redis.conf directives, one per line, that every
+	// instance of the shared-vm plan gets on top of the template at
+	// DefaultConfigPath.
+	SharedVMConfig []string `yaml:"shared_vm_config"`
+
+	LogRotation LogRotationConfiguration `yaml:"log_rotation"`
+
+	Diagnostics DiagnosticsConfiguration `yaml:"diagnostics"`
+}
+
+// DiagnosticsConfiguration controls where the admin API writes diagnostics
+// bundles. Bundles are also uploaded to S3 when a bucket is configured.
+type DiagnosticsConfiguration struct {
+	Directory       string `yaml:"directory"`
+	LogLines        int    `yaml:"log_lines"`
+	EndpointURL     string `yaml:"endpoint_url"`
+	BucketName      string `yaml:"bucket_name"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	Path            string `yaml:"path"`
+}
+
+// LogRotationConfiguration controls how the process monitor rotates the
+// redis-server logs of shared instances. Logs are rotated when either limit
+// is reached; with neither set, logs are never rotated.
+type LogRotationConfiguration struct {
+	IntervalSeconds     int `yaml:"interval_seconds"`
+	MaxSizeMB           int `yaml:"max_size_mb"`
+	MaxAgeHours         int `yaml:"max_age_hours"`
+	InstanceRetentionMB int `yaml:"instance_retention_mb"`
+	TotalRetentionMB    int `yaml:"total_retention_mb"`
+}
+
+// ResourceLimits are applied to the cgroup of every instance of a plan. Zero
+// values leave the kernel defaults in place.
+type ResourceLimits struct {
+	MemoryMaxMB int `yaml:"memory_max_mb"`
+	CPUWeight   int `yaml:"cpu_weight"`
+	IOWeight    int `yaml:"io_weight"`
 }
 
 func (config *Config) SharedEnabled() bool {
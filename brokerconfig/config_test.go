@@ -1,6 +1,7 @@
 package brokerconfig_test
 
 import (
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
@@ -96,6 +97,15 @@ var _ = Describe("parsing the broker config file", func() {
 				Ω(config.RedisConfiguration.ProcessCheckIntervalSeconds).To(Equal(5))
 			})
 
+			It("loads the process check timeout and concurrency", func() {
+				Ω(config.RedisConfiguration.ProcessCheckTimeoutSeconds).To(Equal(20))
+				Ω(config.RedisConfiguration.ProcessCheckConcurrency).To(Equal(16))
+			})
+
+			It("loads the process monitor control socket path", func() {
+				Ω(config.RedisConfiguration.ProcessMonitorSocketPath).To(Equal("/tmp/redis/processmonitor.sock"))
+			})
+
 			It("loads instance data directory", func() {
 				Ω(config.RedisConfiguration.InstanceDataDirectory).To(Equal("/tmp/redis/data/directory"))
 			})
@@ -108,10 +118,101 @@ var _ = Describe("parsing the broker config file", func() {
 				Ω(config.RedisConfiguration.InstanceLogDirectory).To(Equal("/tmp/redis/log/directory"))
 			})
 
+			It("loads the event directory", func() {
+				Ω(config.RedisConfiguration.EventDirectory).To(Equal("/tmp/redis/events"))
+			})
+
+			It("loads the lock directory", func() {
+				Ω(config.RedisConfiguration.LockDirectory).To(Equal("/tmp/redis/locks"))
+			})
+
+			It("loads the instance lock lease", func() {
+				Ω(config.RedisConfiguration.LockLeaseSeconds).To(Equal(300))
+			})
+
+			It("loads the state file path", func() {
+				Ω(config.RedisConfiguration.StateFile).To(Equal("/tmp/redis/state.json"))
+			})
+
 			It("loads service instance limit", func() {
 				Ω(config.RedisConfiguration.ServiceInstanceLimit).To(Equal(3))
 			})
 
+			It("loads the crash loop settings", func() {
+				Ω(config.RedisConfiguration.CrashLoopThreshold).To(Equal(4))
+				Ω(config.RedisConfiguration.CrashLoopWindowSeconds).To(Equal(600))
+				Ω(config.RedisConfiguration.RestartBackoffSeconds).To(Equal(2))
+				Ω(config.RedisConfiguration.MaxRestartBackoffSeconds).To(Equal(120))
+			})
+
+			It("loads the port allocation settings", func() {
+				Ω(config.RedisConfiguration.PortRangeStart).To(Equal(7000))
+				Ω(config.RedisConfiguration.PortRangeEnd).To(Equal(7999))
+				Ω(config.RedisConfiguration.ExcludedPorts).To(Equal([]int{7001, 7002}))
+				Ω(config.RedisConfiguration.PortReservationsFile).To(Equal("/tmp/redis/port-reservations.json"))
+			})
+
+			It("loads the supervision settings", func() {
+				Ω(config.RedisConfiguration.Supervisor).To(Equal("systemd"))
+				Ω(config.RedisConfiguration.SystemdUnitDirectory).To(Equal("/tmp/redis/units"))
+			})
+
+			It("loads the log rotation settings", func() {
+				Ω(config.RedisConfiguration.LogRotation).To(Equal(brokerconfig.LogRotationConfiguration{
+					IntervalSeconds:     30,
+					MaxSizeMB:           64,
+					MaxAgeHours:         24,
+					InstanceRetentionMB: 256,
+					TotalRetentionMB:    4096,
+				}))
+			})
+
+			It("loads the metrics interval", func() {
+				Ω(config.RedisConfiguration.MetricsIntervalSeconds).To(Equal(15))
+			})
+
+			It("loads the slowlog interval", func() {
+				Ω(config.RedisConfiguration.SlowlogIntervalSeconds).To(Equal(120))
+			})
+
+			It("loads the config drift settings", func() {
+				Ω(config.RedisConfiguration.ConfigDriftPolicy).To(Equal("reapply"))
+				Ω(config.RedisConfiguration.ConfigDriftIntervalSeconds).To(Equal(600))
+			})
+
+			It("loads the diagnostics settings", func() {
+				Ω(config.RedisConfiguration.Diagnostics).To(Equal(brokerconfig.DiagnosticsConfiguration{
+					Directory:       "/tmp/redis/diagnostics",
+					LogLines:        500,
+					EndpointURL:     "http://s3url.com",
+					BucketName:      "redis-diagnostics",
+					AccessKeyID:     "ABCDEABCDEABCDEABCDE",
+					SecretAccessKey: "ABCDEABCDEABCDEABCDEABCDEABCDEABCDEABCDE",
+					Path:            "bundles",
+				}))
+			})
+
+			It("loads the instance user settings", func() {
+				Ω(config.RedisConfiguration.IsolateInstanceUsers).To(BeTrue())
+				Ω(config.RedisConfiguration.InstanceUserPrefix).To(Equal("tenant-"))
+			})
+
+			It("loads the resource isolation settings", func() {
+				Ω(config.RedisConfiguration.CgroupRoot).To(Equal("/tmp/redis/cgroup"))
+				Ω(config.RedisConfiguration.SharedVMResources).To(Equal(brokerconfig.ResourceLimits{
+					MemoryMaxMB: 512,
+					CPUWeight:   50,
+					IOWeight:    200,
+				}))
+			})
+
+			It("loads the shared-vm plan config", func() {
+				Ω(config.RedisConfiguration.SharedVMConfig).To(Equal([]string{
+					"maxmemory-policy allkeys-lru",
+					`rename-command KEYS ""`,
+				}))
+			})
+
 			It("loads the auth credendials", func() {
 				Ω(config.AuthConfiguration.Username).To(Equal("admin"))
 				Ω(config.AuthConfiguration.Password).To(Equal("secret"))
@@ -132,6 +233,10 @@ var _ = Describe("parsing the broker config file", func() {
 			It("loads the consistency verification interval", func() {
 				Ω(config.ConsistencyVerificationInterval).Should(Equal(123))
 			})
+
+			It("loads whether inconsistencies are repaired", func() {
+				Ω(config.ConsistencyRepair).Should(BeTrue())
+			})
 		})
 
 		Context("when the configuration is invalid", func() {
@@ -220,4 +325,28 @@ var _ = Describe("parsing the broker config file", func() {
 			})
 		})
 	})
+
+	Describe("AuthConfiguration.Authorized", func() {
+		auth := brokerconfig.AuthConfiguration{Username: "admin", Password: "secret"}
+
+		It("accepts the credentials", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.SetBasicAuth("admin", "secret")
+			Ω(auth.Authorized(req)).To(BeTrue())
+		})
+
+		It("rejects a wrong username or password", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.SetBasicAuth("admin", "wrong")
+			Ω(auth.Authorized(req)).To(BeFalse())
+
+			req.SetBasicAuth("someone", "secret")
+			Ω(auth.Authorized(req)).To(BeFalse())
+		})
+
+		It("rejects requests without basic auth", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			Ω(auth.Authorized(req)).To(BeFalse())
+		})
+	})
 })
@@ -0,0 +1,181 @@
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+)
+
+const bytesPerMB = 1024 * 1024
+
+// Limits are written to an instance's cgroup before its redis-server is
+// started in it or moved into it. Zero values are not written, so the kernel
+// defaults apply.
+type Limits struct {
+	MemoryMax int64
+	CPUWeight int
+	IOWeight  int
+}
+
+// Manager places each instance's redis-server in its own cgroup v2 group
+// below Root. Root must be a directory in the unified hierarchy that the
+// broker has been delegated, such as /sys/fs/cgroup/redis-instances.
+type Manager struct {
+	Root   string
+	Limits Limits
+}
+
+func NewManager(root string, limits Limits) *Manager {
+	return &Manager{
+		Root:   root,
+		Limits: limits,
+	}
+}
+
+// New builds a Manager for the shared-vm plan from the broker configuration.
+func New(config brokerconfig.ServiceConfiguration) *Manager {
+	return NewManager(config.CgroupRoot, Limits{
+		MemoryMax: int64(config.SharedVMResources.MemoryMaxMB) * bytesPerMB,
+		CPUWeight: config.SharedVMResources.CPUWeight,
+		IOWeight:  config.SharedVMResources.IOWeight,
+	})
+}
+
+// Path returns the cgroup directory of an instance.
+func (manager *Manager) Path(instanceID string) (string, error) {
+	return paths.NewResolver(manager.Root).Resolve(instanceID)
+}
+
+// Place creates the instance's cgroup if needed, applies the limits and moves
+// pid into it. Processes that redis forks, such as the one writing an RDB
+// snapshot, stay in the same cgroup.
+func (manager *Manager) Place(instanceID string, pid int) error {
+	dir, err := manager.create(instanceID)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(dir, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// Open creates the instance's cgroup if needed, applies the limits and opens
+// its directory, so that redis-server can be started inside it with
+// SysProcAttr.CgroupFD. The caller closes it once the process has started.
+func (manager *Manager) Open(instanceID string) (*os.File, error) {
+	dir, err := manager.create(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(dir)
+}
+
+func (manager *Manager) create(instanceID string) (string, error) {
+	dir, err := manager.Path(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(manager.Root, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = manager.enableControllers()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Mkdir(dir, 0755)
+	if err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	return dir, manager.applyLimits(dir)
+}
+
+// Remove deletes the instance's cgroup. The kernel refuses to remove a cgroup
+// that still has processes in it.
+func (manager *Manager) Remove(instanceID string) error {
+	dir, err := manager.Path(instanceID)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (manager *Manager) controllers() []string {
+	controllers := []string{}
+	if manager.Limits.CPUWeight > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if manager.Limits.MemoryMax > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if manager.Limits.IOWeight > 0 {
+		controllers = append(controllers, "+io")
+	}
+	return controllers
+}
+
+// enableControllers makes the limited controllers available to the instance
+// cgroups below Root.
+func (manager *Manager) enableControllers() error {
+	controllers := manager.controllers()
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	return writeFile(manager.Root, "cgroup.subtree_control", strings.Join(controllers, " "))
+}
+
+func (manager *Manager) applyLimits(dir string) error {
+	if manager.Limits.MemoryMax > 0 {
+		err := writeFile(dir, "memory.max", strconv.FormatInt(manager.Limits.MemoryMax, 10))
+		if err != nil {
+			return err
+		}
+	}
+
+	if manager.Limits.CPUWeight > 0 {
+		err := writeFile(dir, "cpu.weight", strconv.Itoa(manager.Limits.CPUWeight))
+		if err != nil {
+			return err
+		}
+	}
+
+	if manager.Limits.IOWeight > 0 {
+		err := writeFile(dir, "io.weight", "default "+strconv.Itoa(manager.Limits.IOWeight))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(dir, name, value string) error {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return fmt.Errorf("failed to write %q to %s: %w", value, pathErr.Path, pathErr.Err)
+		}
+		return err
+	}
+
+	return nil
+}
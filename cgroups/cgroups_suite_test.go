@@ -0,0 +1,15 @@
+package cgroups_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCgroups(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_cgroups.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Cgroups Suite", []Reporter{junitReporter})
+}
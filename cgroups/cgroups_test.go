@@ -0,0 +1,159 @@
+package cgroups_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cgroups"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cgroups", func() {
+	var (
+		root    string
+		manager *cgroups.Manager
+	)
+
+	readFile := func(names ...string) string {
+		contents, err := os.ReadFile(filepath.Join(append([]string{root}, names...)...))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	writeFile := func(contents string, names ...string) {
+		Expect(os.WriteFile(filepath.Join(append([]string{root}, names...)...), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = os.MkdirTemp("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		manager = cgroups.NewManager(root, cgroups.Limits{
+			MemoryMax: 512 * 1024 * 1024,
+			CPUWeight: 50,
+			IOWeight:  200,
+		})
+	})
+
+	It("derives the limits from the shared-vm plan resources", func() {
+		manager = cgroups.New(brokerconfig.ServiceConfiguration{
+			CgroupRoot: root,
+			SharedVMResources: brokerconfig.ResourceLimits{
+				MemoryMaxMB: 256,
+				CPUWeight:   10,
+				IOWeight:    20,
+			},
+		})
+
+		Expect(manager.Root).To(Equal(root))
+		Expect(manager.Limits).To(Equal(cgroups.Limits{
+			MemoryMax: 256 * 1024 * 1024,
+			CPUWeight: 10,
+			IOWeight:  20,
+		}))
+	})
+
+	Describe("Place", func() {
+		It("moves the process into a limited cgroup for the instance", func() {
+			Expect(manager.Place("an-instance", 4242)).To(Succeed())
+
+			Expect(readFile("cgroup.subtree_control")).To(Equal("+cpu +memory +io"))
+			Expect(readFile("an-instance", "memory.max")).To(Equal("536870912"))
+			Expect(readFile("an-instance", "cpu.weight")).To(Equal("50"))
+			Expect(readFile("an-instance", "io.weight")).To(Equal("default 200"))
+			Expect(readFile("an-instance", "cgroup.procs")).To(Equal("4242"))
+		})
+
+		It("reuses a cgroup left behind by a previous redis-server", func() {
+			Expect(manager.Place("an-instance", 4242)).To(Succeed())
+			Expect(manager.Place("an-instance", 4343)).To(Succeed())
+
+			Expect(readFile("an-instance", "cgroup.procs")).To(Equal("4343"))
+		})
+
+		It("only enables and writes the limits that are set", func() {
+			manager.Limits = cgroups.Limits{CPUWeight: 50}
+			Expect(manager.Place("an-instance", 4242)).To(Succeed())
+
+			Expect(readFile("cgroup.subtree_control")).To(Equal("+cpu"))
+			_, err := os.Stat(filepath.Join(root, "an-instance", "memory.max"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("refuses instance IDs that leave the cgroup root", func() {
+			err := manager.Place("..", 4242)
+			Expect(err).To(MatchError(paths.ErrOutsideRoot))
+		})
+	})
+
+	Describe("Open", func() {
+		It("opens a limited cgroup for the instance to start redis-server in", func() {
+			cgroup, err := manager.Open("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			defer cgroup.Close()
+
+			Expect(cgroup.Name()).To(Equal(filepath.Join(root, "an-instance")))
+			Expect(readFile("cgroup.subtree_control")).To(Equal("+cpu +memory +io"))
+			Expect(readFile("an-instance", "memory.max")).To(Equal("536870912"))
+			_, err = os.Stat(filepath.Join(root, "an-instance", "cgroup.procs"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("refuses instance IDs that leave the cgroup root", func() {
+			_, err := manager.Open("..")
+			Expect(err).To(MatchError(paths.ErrOutsideRoot))
+		})
+	})
+
+	Describe("Remove", func() {
+		It("removes the instance's cgroup", func() {
+			Expect(os.Mkdir(filepath.Join(root, "an-instance"), 0755)).To(Succeed())
+
+			Expect(manager.Remove("an-instance")).To(Succeed())
+
+			_, err := os.Stat(filepath.Join(root, "an-instance"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("does nothing when the instance has no cgroup", func() {
+			Expect(manager.Remove("an-instance")).To(Succeed())
+		})
+	})
+
+	Describe("Pressure", func() {
+		BeforeEach(func() {
+			Expect(os.Mkdir(filepath.Join(root, "an-instance"), 0755)).To(Succeed())
+			writeFile("some avg10=1.50 avg60=0.75 avg300=0.10 total=12345\n", "an-instance", "cpu.pressure")
+			writeFile("some avg10=0.00 avg60=0.00 avg300=0.00 total=10\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=5\n", "an-instance", "memory.pressure")
+			writeFile("some avg10=2.00 avg60=1.00 avg300=0.50 total=999\nfull avg10=1.00 avg60=0.50 avg300=0.25 total=500\n", "an-instance", "io.pressure")
+		})
+
+		It("reads the pressure of the instance's cgroup", func() {
+			pressure, err := manager.Pressure("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pressure.CPU.Some).To(Equal(cgroups.PressureStats{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 12345}))
+			Expect(pressure.CPU.Full).To(BeZero())
+			Expect(pressure.Memory.Full.Total).To(Equal(uint64(5)))
+			Expect(pressure.IO.Full).To(Equal(cgroups.PressureStats{Avg10: 1, Avg60: 0.5, Avg300: 0.25, Total: 500}))
+		})
+
+		It("returns a not exist error when the instance has no cgroup", func() {
+			_, err := manager.Pressure("another-instance")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("returns an error when a pressure file is malformed", func() {
+			writeFile("some avg10=lots\n", "an-instance", "io.pressure")
+
+			_, err := manager.Pressure("an-instance")
+			Expect(err).To(MatchError(ContainSubstring("io.pressure")))
+		})
+	})
+})
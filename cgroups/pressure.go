@@ -0,0 +1,127 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PressureStats is one line of a cgroup's pressure stall information. The
+// averages are the percentage of time that tasks were stalled, and Total is
+// the stall time in microseconds.
+type PressureStats struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// ResourcePressure reports how long some or all of a cgroup's tasks were
+// stalled waiting for a resource.
+type ResourcePressure struct {
+	Some PressureStats `json:"some"`
+	Full PressureStats `json:"full"`
+}
+
+type Pressure struct {
+	CPU    ResourcePressure `json:"cpu"`
+	Memory ResourcePressure `json:"memory"`
+	IO     ResourcePressure `json:"io"`
+}
+
+// Pressure reads the CPU, memory and IO pressure of the instance's cgroup. It
+// returns an error satisfying os.IsNotExist when the instance has no cgroup.
+func (manager *Manager) Pressure(instanceID string) (Pressure, error) {
+	dir, err := manager.Path(instanceID)
+	if err != nil {
+		return Pressure{}, err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil {
+		return Pressure{}, err
+	}
+
+	var pressure Pressure
+	for name, resource := range map[string]*ResourcePressure{
+		"cpu.pressure":    &pressure.CPU,
+		"memory.pressure": &pressure.Memory,
+		"io.pressure":     &pressure.IO,
+	} {
+		*resource, err = readPressure(filepath.Join(dir, name))
+		if err != nil {
+			return Pressure{}, err
+		}
+	}
+
+	return pressure, nil
+}
+
+// readPressure parses a PSI file, whose lines look like
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// Older kernels have no "full" line in cpu.pressure.
+func readPressure(path string) (ResourcePressure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ResourcePressure{}, err
+	}
+	defer file.Close()
+
+	var pressure ResourcePressure
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var stats *PressureStats
+		switch fields[0] {
+		case "some":
+			stats = &pressure.Some
+		case "full":
+			stats = &pressure.Full
+		default:
+			return ResourcePressure{}, fmt.Errorf("unexpected line in %s: %q", path, scanner.Text())
+		}
+
+		err := parseStats(fields[1:], stats)
+		if err != nil {
+			return ResourcePressure{}, fmt.Errorf("failed to parse %s: %s", path, err)
+		}
+	}
+
+	return pressure, scanner.Err()
+}
+
+func parseStats(fields []string, stats *PressureStats) error {
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("malformed field %q", field)
+		}
+
+		var err error
+		switch key {
+		case "avg10":
+			stats.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			stats.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			stats.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			stats.Total, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -8,11 +8,19 @@ import (
 
 	"code.cloudfoundry.org/lager/v3"
 	"github.com/pivotal-cf/brokerapi/v10"
+	"github.com/pivotal-cf/cf-redis-broker/admin"
 	"github.com/pivotal-cf/cf-redis-broker/availability"
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cgroups"
+	"github.com/pivotal-cf/cf-redis-broker/diagnostics"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+	"github.com/pivotal-cf/cf-redis-broker/logstream"
+	"github.com/pivotal-cf/cf-redis-broker/metrics"
 	"github.com/pivotal-cf/cf-redis-broker/process"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 	"github.com/pivotal-cf/cf-redis-broker/system"
 )
 
@@ -36,6 +44,22 @@ func main() {
 
 	localRepo := redis.NewLocalRepository(config.RedisConfiguration, brokerLogger)
 	setPidDir(localRepo)
+
+	localRepo.RedisVersion, err = redisconf.ServerVersion(config.RedisServerExecutablePath)
+	if err != nil {
+		brokerLogger.Info("redis-version-unknown", lager.Data{"error": err.Error()})
+	}
+	err = localRepo.ValidateTemplate()
+	if err != nil {
+		brokerLogger.Fatal("validate-redis-config", err)
+	}
+
+	err = localRepo.OpenState()
+	if err != nil {
+		brokerLogger.Fatal("open-state", err, lager.Data{
+			"state-file": localRepo.RedisConf.StateFile,
+		})
+	}
 	localRepo.AllInstancesVerbose()
 
 	processController := redis.NewOSProcessController(
@@ -47,9 +71,33 @@ func main() {
 		availability.Check,
 		"",
 	)
+	processController.Identities = redis.NewInstanceProcessIdentities(localRepo, new(process.ProcessChecker))
+	if localRepo.RedisConf.IsolateInstanceUsers {
+		localRepo.Users = system.NewUserManager(localRepo.RedisConf)
+		processController.Credentials = localRepo
+	}
+
+	var instanceCgroups *cgroups.Manager
+	if localRepo.RedisConf.CgroupRoot != "" {
+		instanceCgroups = cgroups.New(localRepo.RedisConf)
+		processController.Cgroups = instanceCgroups
+	}
+
+	supervisor, err := redis.NewSupervisor(localRepo.RedisConf, processController)
+	if err != nil {
+		brokerLogger.Fatal("supervisor", err)
+	}
+	processController.Supervisor = supervisor
+
+	if children, ok := supervisor.(*redis.ChildSupervisor); ok {
+		adoptInstances(children, processController, localRepo, brokerLogger)
+	}
+
+	portAllocator := system.NewPortAllocator(localRepo.RedisConf)
+	adoptInstancePorts(portAllocator, localRepo, brokerLogger)
 
 	localCreator := &redis.LocalInstanceCreator{
-		FindFreePort:            system.FindFreePort,
+		PortAllocator:           portAllocator,
 		RedisConfiguration:      config.RedisConfiguration,
 		ProcessController:       processController,
 		LocalInstanceRepository: localRepo,
@@ -64,6 +112,9 @@ func main() {
 		os.Exit(0)
 	}()
 
+	journal := events.NewJournal(localRepo.RedisConf.EventDirectory, brokerLogger.Session("events"))
+	instanceLocks := locks.New(localRepo.RedisConf.LockDirectory)
+
 	serviceBroker := &broker.RedisServiceBroker{
 		InstanceCreators: map[string]broker.InstanceCreator{
 			"shared": localCreator,
@@ -71,7 +122,11 @@ func main() {
 		InstanceBinders: map[string]broker.InstanceBinder{
 			"shared": localRepo,
 		},
-		Config: config,
+		Config:     config,
+		Events:     journal,
+		Locks:      instanceLocks,
+		Details:    localRepo,
+		Parameters: localRepo,
 	}
 
 	brokerCredentials := brokerapi.BrokerCredentials{
@@ -82,6 +137,22 @@ func main() {
 	brokerAPI := brokerapi.New(serviceBroker, brokerLogger, brokerCredentials)
 	http.Handle("/", brokerAPI)
 
+	adminAPI := admin.NewHandler(localCreator, journal, config.AuthConfiguration, brokerLogger.Session("admin"))
+	adminAPI.Locks = instanceLocks
+	adminAPI.Leases = localRepo
+	adminAPI.Diagnostics = diagnostics.NewCollector(config.RedisConfiguration, localRepo, brokerLogger.Session("diagnostics"))
+	if instanceCgroups != nil {
+		adminAPI.Pressure = instanceCgroups
+	}
+	http.Handle("/admin/", http.StripPrefix("/admin", adminAPI))
+
+	logsAPI := logstream.NewHandler(localRepo, localRepo, config.AuthConfiguration, brokerLogger.Session("logs"))
+	http.Handle("/logs/", http.StripPrefix("/logs", logsAPI))
+
+	metricsExporter := metrics.NewExporter(localRepo, config.AuthConfiguration, brokerLogger.Session("metrics"))
+	go metricsExporter.Run(metrics.Interval(config.RedisConfiguration), make(chan struct{}))
+	http.Handle("/metrics", metricsExporter)
+
 	brokerLogger.Fatal("http-listen", http.ListenAndServe(config.Host+":"+config.Port, nil))
 }
 
@@ -93,6 +164,46 @@ func configPath() string {
 	return brokerConfigYamlPath
 }
 
+// adoptInstancePorts reserves the ports of instances that were created before
+// ports were reserved, so that they are not handed out again.
+func adoptInstancePorts(allocator *system.PortAllocator, localRepo *redis.LocalRepository, logger lager.Logger) {
+	instances, _ := localRepo.AllInstances()
+	for _, instance := range instances {
+		err := allocator.Adopt(instance.ID, instance.Port)
+		if err != nil {
+			logger.Fatal("Reserving instance port", err, lager.Data{
+				"instance": instance.ID,
+				"port":     instance.Port,
+			})
+		}
+	}
+}
+
+// adoptInstances leaves the redis-servers that are still running from before
+// the broker started alone, rather than restarting every tenant whenever the
+// broker restarts. The process monitor keeps supervising them through their
+// pidfiles until the child supervisor starts them again.
+func adoptInstances(children *redis.ChildSupervisor, controller *redis.OSProcessController, localRepo *redis.LocalRepository, logger lager.Logger) {
+	instances, _ := localRepo.AllInstances()
+	for _, instance := range instances {
+		children.Disown(instance.ID)
+
+		state, err := localRepo.InstanceState(instance.ID)
+		if err != nil || state != broker.InstanceStateRunning {
+			continue
+		}
+
+		err = controller.AdoptRunning(instance)
+		if err != nil {
+			logger.Info("adopt-instance", lager.Data{
+				"instance_id": instance.ID,
+				"message":     "Leaving redis-server to the process monitor",
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
 func setPidDir(localRepo *redis.LocalRepository) {
 	pidDir := os.Getenv("SHARED_PID_DIR")
 	if pidDir != "" {
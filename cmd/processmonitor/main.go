@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -10,8 +11,18 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 	"github.com/pivotal-cf/cf-redis-broker/availability"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cgroups"
+	"github.com/pivotal-cf/cf-redis-broker/consistency"
+	"github.com/pivotal-cf/cf-redis-broker/drift"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+	"github.com/pivotal-cf/cf-redis-broker/logrotation"
 	"github.com/pivotal-cf/cf-redis-broker/process"
+	"github.com/pivotal-cf/cf-redis-broker/processmonitor"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/slowlog"
+	"github.com/pivotal-cf/cf-redis-broker/system"
 )
 
 func main() {
@@ -19,15 +30,6 @@ func main() {
 	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
 	logger.RegisterSink(lager.NewWriterSink(os.Stderr, lager.ERROR))
 
-	sigChannel := make(chan os.Signal, 1)
-	signal.Notify(sigChannel, syscall.SIGUSR1)
-	skipProcessCheck := false
-	go func() {
-		<-sigChannel
-		logger.Info("Trapped USR1, disabling process monitor")
-		skipProcessCheck = true
-	}()
-
 	config, err := brokerconfig.ParseConfig(configPath())
 	if err != nil {
 		logger.Fatal("could not parse config file", err, lager.Data{
@@ -39,6 +41,16 @@ func main() {
 
 	repo := redis.NewLocalRepository(config.RedisConfiguration, logger)
 	setPidDir(repo)
+	repo.RedisVersion, err = redisconf.ServerVersion(config.RedisServerExecutablePath)
+	if err != nil {
+		logger.Info("redis-version-unknown", lager.Data{"error": err.Error()})
+	}
+	err = repo.OpenState()
+	if err != nil {
+		logger.Fatal("open-state", err, lager.Data{
+			"state-file": repo.RedisConf.StateFile,
+		})
+	}
 	processController := redis.NewOSProcessController(
 		logger,
 		repo,
@@ -48,65 +60,126 @@ func main() {
 		availability.Check,
 		"",
 	)
+	processController.Identities = redis.NewInstanceProcessIdentities(repo, new(process.ProcessChecker))
+	if repo.RedisConf.IsolateInstanceUsers {
+		repo.Users = system.NewUserManager(repo.RedisConf)
+		processController.Credentials = repo
+	}
+	if repo.RedisConf.CgroupRoot != "" {
+		processController.Cgroups = cgroups.New(repo.RedisConf)
+	}
 
-	checkInterval := config.RedisConfiguration.ProcessCheckIntervalSeconds
+	monitor := processmonitor.New(
+		repo,
+		processController,
+		processmonitor.NewBackoffPolicy(config.RedisConfiguration),
+		logger,
+	)
+	monitor.Configure(config.RedisConfiguration)
+	monitor.Events = events.NewJournal(repo.RedisConf.EventDirectory, logger.Session("events"))
+	monitor.Locks = locks.New(repo.RedisConf.LockDirectory)
+	monitor.Owners = redis.NewSupervisorOwners(repo.RedisConf, new(process.ProcessChecker))
 
-	instances, _ := repo.AllInstancesVerbose()
+	sigChannel := make(chan os.Signal, 1)
+	signal.Notify(sigChannel, syscall.SIGUSR1)
+	go func() {
+		<-sigChannel
+		logger.Info("Trapped USR1, disabling process monitor")
+		monitor.Pause()
+	}()
 
-	for _, instance := range instances {
-		copyConfigFile(instance, repo, logger)
+	serveControlAPI(monitor, controlSocketPath(config, repo), logger)
+
+	rotator := logrotation.NewRotator(repo.RedisConf, repo, logger.Session("log-rotation"))
+	if rotator.Enabled() {
+		go rotator.Run(logrotation.Interval(repo.RedisConf), make(chan struct{}))
 	}
 
-	for {
-		if skipProcessCheck {
-			logger.Info("Skipping instance check")
-		} else {
-			instances, _ := repo.AllInstances()
+	drainer := slowlog.NewDrainer(repo, logger.Session("slowlog"))
+	go drainer.Run(slowlog.Interval(repo.RedisConf), make(chan struct{}))
 
-			for _, instance := range instances {
-				ensureRunningIfNotLocked(instance, repo, processController, logger)
-			}
-		}
+	detector, err := drift.NewDetector(repo.RedisConf, repo, logger.Session("config-drift"))
+	if err != nil {
+		logger.Fatal("config-drift", err)
+	}
+	detector.Locks = monitor.Locks
+	go detector.Run(drift.Interval(repo.RedisConf), make(chan struct{}))
 
-		time.Sleep(time.Second * time.Duration(checkInterval))
+	if config.ConsistencyVerificationInterval > 0 {
+		verifier := newVerifier(config, repo, monitor.Locks, logger)
+		verificationInterval := time.Second * time.Duration(config.ConsistencyVerificationInterval)
+		go verifier.Run(verificationInterval, make(chan struct{}))
 	}
-}
 
-func ensureRunningIfNotLocked(instance *redis.Instance, repo *redis.LocalRepository, processController *redis.OSProcessController, logger lager.Logger) {
-	_, err := os.Stat(filepath.Join(repo.InstanceBaseDir(instance.ID), "lock"))
-	if err != nil {
-		ensureRunning(instance, repo, processController, logger)
+	checkInterval := time.Second * time.Duration(config.RedisConfiguration.ProcessCheckIntervalSeconds)
+
+	instances, _ := repo.AllInstancesVerbose()
+
+	for _, instance := range instances {
+		copyConfigFile(instance, repo, logger)
 	}
+
+	monitor.Run(checkInterval, make(chan struct{}))
 }
 
+// copyConfigFile skips instances whose config cannot be written, so that one
+// broken instance does not keep the others from being supervised. They are
+// still supervised with the redis.conf they had.
 func copyConfigFile(instance *redis.Instance, repo *redis.LocalRepository, logger lager.Logger) {
 	err := repo.EnsureDirectoriesExist(instance)
 	if err != nil {
-		logger.Fatal("Error creating instance directories", err, lager.Data{
+		logger.Error("Error creating instance directories", err, lager.Data{
 			"instance": instance.ID,
 		})
+		return
+	}
+
+	err = repo.MigrateInstanceConfig(instance.ID)
+	if err != nil {
+		logger.Error("Error migrating redis config", err, lager.Data{
+			"instance": instance.ID,
+		})
+		return
 	}
 
 	err = repo.WriteConfigFile(instance)
 	if err != nil {
-		logger.Fatal("Error writing redis config", err, lager.Data{
+		logger.Error("Error writing redis config", err, lager.Data{
 			"instance": instance.ID,
 		})
 	}
 }
 
-func ensureRunning(instance *redis.Instance, repo *redis.LocalRepository, processController *redis.OSProcessController, logger lager.Logger) {
-	configPath := repo.InstanceConfigPath(instance.ID)
-	instanceDataDir := repo.InstanceDataDir(instance.ID)
-	pidfilePath := repo.InstancePidFilePath(instance.ID)
-	logfilePath := repo.InstanceLogFilePath(instance.ID)
+// newVerifier builds the consistency verifier. It shares the monitor's
+// instance locks, so that leftovers are never removed while the broker is
+// changing the instance they belong to.
+func newVerifier(config brokerconfig.Config, repo *redis.LocalRepository, locks consistency.InstanceLocker, logger lager.Logger) *consistency.Verifier {
+	verifier := consistency.NewVerifier(repo.RedisConf, repo, config.ConsistencyRepair, logger.Session("consistency"))
+	verifier.Locks = locks
+	return verifier
+}
 
-	err := processController.EnsureRunning(instance, configPath, instanceDataDir, pidfilePath, logfilePath)
+func serveControlAPI(monitor *processmonitor.Monitor, socketPath string, logger lager.Logger) {
+	listener, err := processmonitor.ListenControlSocket(socketPath)
 	if err != nil {
-		logger.Fatal("Error starting instance", err, lager.Data{
-			"instance": instance.ID,
+		logger.Fatal("Error listening on control socket", err, lager.Data{
+			"socket": socketPath,
 		})
 	}
+
+	logger.Info("Serving control API", lager.Data{"socket": socketPath})
+
+	go func() {
+		err := http.Serve(listener, processmonitor.NewControlHandler(monitor, logger.Session("control")))
+		logger.Error("Control API stopped", err)
+	}()
+}
+
+func controlSocketPath(config brokerconfig.Config, repo *redis.LocalRepository) string {
+	if config.RedisConfiguration.ProcessMonitorSocketPath != "" {
+		return config.RedisConfiguration.ProcessMonitorSocketPath
+	}
+	return filepath.Join(repo.RedisConf.PidfileDirectory, "processmonitor.sock")
 }
 
 func configPath() string {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("newVerifier", func() {
+	var (
+		config brokerconfig.Config
+		repo   *redis.LocalRepository
+		logger *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		baseDir, err := os.MkdirTemp("", "processmonitor")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, baseDir)
+
+		config = brokerconfig.Config{
+			ConsistencyRepair: true,
+			RedisConfiguration: brokerconfig.ServiceConfiguration{
+				InstanceDataDirectory: filepath.Join(baseDir, "data"),
+				InstanceLogDirectory:  filepath.Join(baseDir, "log"),
+				PidfileDirectory:      filepath.Join(baseDir, "pidfiles"),
+				LockDirectory:         filepath.Join(baseDir, "locks"),
+			},
+		}
+		for _, dir := range []string{
+			config.RedisConfiguration.InstanceDataDirectory,
+			config.RedisConfiguration.InstanceLogDirectory,
+			config.RedisConfiguration.PidfileDirectory,
+		} {
+			Expect(os.MkdirAll(dir, 0750)).To(Succeed())
+		}
+
+		logger = lagertest.NewTestLogger("process-monitor")
+		repo = redis.NewLocalRepository(config.RedisConfiguration, logger)
+		Expect(os.WriteFile(repo.InstancePidFilePath("removed"), []byte("4321"), 0640)).To(Succeed())
+	})
+
+	It("does not repair instances that the broker holds the lock of", func() {
+		unlock, err := locks.New(config.RedisConfiguration.LockDirectory).LockInstance("removed")
+		Expect(err).NotTo(HaveOccurred())
+
+		verifier := newVerifier(config, repo, locks.New(config.RedisConfiguration.LockDirectory), logger)
+		verifier.Verify()
+		Expect(repo.InstancePidFilePath("removed")).To(BeAnExistingFile())
+
+		unlock()
+		verifier.Verify()
+		Expect(repo.InstancePidFilePath("removed")).NotTo(BeAnExistingFile())
+	})
+})
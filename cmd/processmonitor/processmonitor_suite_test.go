@@ -0,0 +1,13 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestProcessmonitor(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Processmonitor Suite")
+}
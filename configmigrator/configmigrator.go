@@ -3,8 +3,8 @@ package configmigrator
 import (
 	"io/ioutil"
 	"os"
-	"path"
 
+	"github.com/pivotal-cf/cf-redis-broker/paths"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
@@ -19,12 +19,21 @@ type ConfigMigrator struct {
 
 func (migrator *ConfigMigrator) Migrate() error {
 	instanceDirs, _ := ioutil.ReadDir(migrator.RedisDataDir)
+	dataDir := paths.NewResolver(migrator.RedisDataDir)
 
 	for _, instanceDir := range instanceDirs {
-		redisInstanceDir := path.Join(migrator.RedisDataDir, instanceDir.Name())
-		redisPortFilePath := path.Join(redisInstanceDir, REDIS_PORT_FILENAME)
-		redisPasswordFilePath := path.Join(redisInstanceDir, REDIS_PASSWORD_FILENAME)
-		redisConfFilePath := path.Join(redisInstanceDir, "redis.conf")
+		redisPortFilePath, err := dataDir.Resolve(instanceDir.Name(), REDIS_PORT_FILENAME)
+		if err != nil {
+			return err
+		}
+		redisPasswordFilePath, err := dataDir.Resolve(instanceDir.Name(), REDIS_PASSWORD_FILENAME)
+		if err != nil {
+			return err
+		}
+		redisConfFilePath, err := dataDir.Resolve(instanceDir.Name(), "redis.conf")
+		if err != nil {
+			return err
+		}
 
 		if err := moveDataFor("port", redisPortFilePath, redisConfFilePath); err != nil {
 			return err
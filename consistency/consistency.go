@@ -0,0 +1,357 @@
+package consistency
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+	"github.com/pivotal-cf/cf-redis-broker/process"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	OrphanedPidfile = "orphaned-pidfile"
+	StalePidfile    = "stale-pidfile"
+	DuplicatePort   = "duplicate-port"
+	MissingConfig   = "missing-config"
+	OrphanedLogDir  = "orphaned-log-dir"
+	UnownedProcess  = "unowned-process"
+)
+
+type Finding struct {
+	Kind       string   `json:"kind"`
+	InstanceID string   `json:"instance_id,omitempty"`
+	Instances  []string `json:"instances,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	Pid        int      `json:"pid,omitempty"`
+	Port       int      `json:"port,omitempty"`
+	Repaired   bool     `json:"repaired"`
+}
+
+type InstanceLayout interface {
+	InstanceConfigPath(instanceID string) string
+	InstancePidFilePath(instanceID string) string
+	InstanceLogDir(instanceID string) string
+}
+
+// InstanceLocker is used to leave instances alone while the broker is
+// changing them.
+//
+//go:generate counterfeiter -o fakes/fake_instance_locker.go . InstanceLocker
+type InstanceLocker interface {
+	TryLockInstance(instanceID string) (func(), bool, error)
+}
+
+// Verifier cross-checks the instance directories, config files, pidfiles and
+// log directories of the shared instances against each other and against the
+// redis-server processes that are running.
+//
+// When Repair is set, leftovers that belong to no instance (pidfiles and log
+// directories) are removed. Everything else is only reported: a config file
+// cannot be regenerated without the instance's password, and a redis-server
+// that no instance owns may still be holding data someone cares about.
+//
+// Leftovers are only removed while holding the instance's lock, and only if
+// the instance still has no directory then, so that the directories of an
+// instance that is being provisioned are never taken for leftovers.
+type Verifier struct {
+	Config    brokerconfig.ServiceConfiguration
+	Layout    InstanceLayout
+	Processes ProcessLister
+	Alive     func(pid int) bool
+	Locks     InstanceLocker
+	Logger    lager.Logger
+	Repair    bool
+}
+
+func NewVerifier(config brokerconfig.ServiceConfiguration, layout InstanceLayout, repair bool, logger lager.Logger) *Verifier {
+	return &Verifier{
+		Config:    config,
+		Layout:    layout,
+		Processes: new(SigarProcessLister),
+		Alive:     new(process.ProcessChecker).Alive,
+		Logger:    logger,
+		Repair:    repair,
+	}
+}
+
+// Run verifies consistency every interval until stop is closed.
+func (verifier *Verifier) Run(interval time.Duration, stop <-chan struct{}) {
+	utils.Every(interval, stop, func() { verifier.Verify() })
+}
+
+func (verifier *Verifier) Verify() []Finding {
+	findings := []Finding{}
+
+	instanceIDs, err := subdirectories(verifier.Config.InstanceDataDirectory)
+	if err != nil {
+		verifier.Logger.Error("consistency-check", err, lager.Data{
+			"data-directory": verifier.Config.InstanceDataDirectory,
+		})
+		return findings
+	}
+
+	instances := map[string]bool{}
+	instancesByPort := map[int][]string{}
+
+	for _, instanceID := range instanceIDs {
+		instances[instanceID] = true
+
+		configPath := verifier.Layout.InstanceConfigPath(instanceID)
+		conf, err := redisconf.Load(configPath)
+		if err != nil {
+			findings = append(findings, Finding{
+				Kind:       MissingConfig,
+				InstanceID: instanceID,
+				Path:       configPath,
+			})
+			continue
+		}
+
+		port, err := strconv.Atoi(conf.Get("port"))
+		if err == nil {
+			instancesByPort[port] = append(instancesByPort[port], instanceID)
+		}
+	}
+
+	findings = append(findings, duplicatePorts(instancesByPort)...)
+
+	pidfileFindings, ownedPids := verifier.verifyPidfiles(instances)
+	findings = append(findings, pidfileFindings...)
+	findings = append(findings, verifier.verifyLogDirs(instances)...)
+	findings = append(findings, verifier.verifyProcesses(ownedPids, instancesByPort)...)
+
+	verifier.report(findings)
+
+	return findings
+}
+
+func (verifier *Verifier) verifyPidfiles(instances map[string]bool) ([]Finding, map[int]bool) {
+	findings := []Finding{}
+	ownedPids := map[int]bool{}
+
+	entries, err := ioutil.ReadDir(verifier.Config.PidfileDirectory)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			verifier.Logger.Error("consistency-check", err, lager.Data{
+				"pidfile-directory": verifier.Config.PidfileDirectory,
+			})
+		}
+		return findings, ownedPids
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pid") {
+			continue
+		}
+
+		instanceID := strings.TrimSuffix(entry.Name(), ".pid")
+		pidfilePath := filepath.Join(verifier.Config.PidfileDirectory, entry.Name())
+		pid, _ := process.ReadPID(pidfilePath)
+
+		if !instances[instanceID] {
+			findings = append(findings, Finding{
+				Kind:       OrphanedPidfile,
+				InstanceID: instanceID,
+				Path:       pidfilePath,
+				Pid:        pid,
+				Repaired:   verifier.removeOrphan(instanceID, pidfilePath),
+			})
+			continue
+		}
+
+		if pid == 0 || !verifier.Alive(pid) {
+			// the process monitor restarts the instance and redis-server
+			// rewrites its pidfile, so this is reported but left alone
+			findings = append(findings, Finding{
+				Kind:       StalePidfile,
+				InstanceID: instanceID,
+				Path:       pidfilePath,
+				Pid:        pid,
+			})
+			continue
+		}
+
+		ownedPids[pid] = true
+	}
+
+	return findings, ownedPids
+}
+
+func (verifier *Verifier) verifyLogDirs(instances map[string]bool) []Finding {
+	findings := []Finding{}
+
+	logDirs, err := subdirectories(verifier.Config.InstanceLogDirectory)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			verifier.Logger.Error("consistency-check", err, lager.Data{
+				"log-directory": verifier.Config.InstanceLogDirectory,
+			})
+		}
+		return findings
+	}
+
+	for _, instanceID := range logDirs {
+		if instances[instanceID] {
+			continue
+		}
+
+		logDir := verifier.Layout.InstanceLogDir(instanceID)
+		findings = append(findings, Finding{
+			Kind:       OrphanedLogDir,
+			InstanceID: instanceID,
+			Path:       logDir,
+			Repaired:   verifier.removeOrphan(instanceID, logDir),
+		})
+	}
+
+	return findings
+}
+
+func (verifier *Verifier) verifyProcesses(ownedPids map[int]bool, instancesByPort map[int][]string) []Finding {
+	findings := []Finding{}
+
+	processes, err := verifier.Processes.RedisServers()
+	if err != nil {
+		verifier.Logger.Error("consistency-check", err, lager.Data{
+			"message": "Error listing redis-server processes",
+		})
+		return findings
+	}
+
+	for _, redisServer := range processes {
+		if ownedPids[redisServer.Pid] {
+			continue
+		}
+
+		if _, ok := instancesByPort[redisServer.Port]; ok && redisServer.Port != 0 {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Kind: UnownedProcess,
+			Pid:  redisServer.Pid,
+			Port: redisServer.Port,
+		})
+	}
+
+	return findings
+}
+
+func (verifier *Verifier) removeOrphan(instanceID, path string) bool {
+	if !verifier.Repair {
+		return false
+	}
+
+	if verifier.Locks != nil {
+		unlock, acquired, err := verifier.Locks.TryLockInstance(instanceID)
+		if err != nil {
+			verifier.Logger.Error("consistency-repair", err, lager.Data{
+				"instance_id": instanceID,
+				"path":        path,
+			})
+			return false
+		}
+
+		if !acquired {
+			verifier.Logger.Info("consistency-repair", lager.Data{
+				"message":     "Skipping instance that is being changed",
+				"instance_id": instanceID,
+				"path":        path,
+			})
+			return false
+		}
+		defer unlock()
+	}
+
+	if verifier.instanceExists(instanceID) {
+		return false
+	}
+
+	err := os.RemoveAll(path)
+	if err != nil {
+		verifier.Logger.Error("consistency-repair", err, lager.Data{
+			"path": path,
+		})
+		return false
+	}
+
+	return true
+}
+
+// instanceExists checks again whether an instance has a directory, which it
+// gets as soon as it starts being provisioned.
+func (verifier *Verifier) instanceExists(instanceID string) bool {
+	instanceDir, err := paths.NewResolver(verifier.Config.InstanceDataDirectory).Resolve(instanceID)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(instanceDir)
+	return err == nil
+}
+
+func (verifier *Verifier) report(findings []Finding) {
+	if len(findings) == 0 {
+		verifier.Logger.Info("consistency-check", lager.Data{
+			"message": "No inconsistencies found",
+		})
+		return
+	}
+
+	for _, finding := range findings {
+		verifier.Logger.Info("consistency-check", lager.Data{
+			"message": "Inconsistency found",
+			"finding": finding,
+		})
+	}
+}
+
+func duplicatePorts(instancesByPort map[int][]string) []Finding {
+	ports := []int{}
+	for port, instanceIDs := range instancesByPort {
+		if len(instanceIDs) > 1 {
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+
+	findings := []Finding{}
+	for _, port := range ports {
+		instanceIDs := instancesByPort[port]
+		sort.Strings(instanceIDs)
+
+		findings = append(findings, Finding{
+			Kind:      DuplicatePort,
+			Instances: instanceIDs,
+			Port:      port,
+		})
+	}
+
+	return findings
+}
+
+func subdirectories(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
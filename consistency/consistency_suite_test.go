@@ -0,0 +1,13 @@
+package consistency_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestConsistency(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Consistency Suite")
+}
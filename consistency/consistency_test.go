@@ -0,0 +1,216 @@
+package consistency_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/consistency"
+	"github.com/pivotal-cf/cf-redis-broker/consistency/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Verifier", func() {
+	var (
+		baseDir   string
+		config    brokerconfig.ServiceConfiguration
+		repo      *redis.LocalRepository
+		processes *fakes.FakeProcessLister
+		logger    *lagertest.TestLogger
+		alivePids map[int]bool
+		verifier  *consistency.Verifier
+	)
+
+	createInstance := func(instanceID string, port int, pid int) {
+		Expect(os.MkdirAll(repo.InstanceDataDir(instanceID), 0750)).To(Succeed())
+		Expect(os.MkdirAll(repo.InstanceLogDir(instanceID), 0750)).To(Succeed())
+		Expect(os.WriteFile(
+			repo.InstanceConfigPath(instanceID),
+			[]byte("port "+strconv.Itoa(port)+"\n"),
+			0640,
+		)).To(Succeed())
+		Expect(os.WriteFile(repo.InstancePidFilePath(instanceID), []byte(strconv.Itoa(pid)), 0640)).To(Succeed())
+		alivePids[pid] = true
+	}
+
+	BeforeEach(func() {
+		var err error
+		baseDir, err = os.MkdirTemp("", "consistency")
+		Expect(err).NotTo(HaveOccurred())
+
+		config = brokerconfig.ServiceConfiguration{
+			InstanceDataDirectory: filepath.Join(baseDir, "data"),
+			InstanceLogDirectory:  filepath.Join(baseDir, "log"),
+			PidfileDirectory:      filepath.Join(baseDir, "pidfiles"),
+		}
+		for _, dir := range []string{config.InstanceDataDirectory, config.InstanceLogDirectory, config.PidfileDirectory} {
+			Expect(os.MkdirAll(dir, 0750)).To(Succeed())
+		}
+
+		logger = lagertest.NewTestLogger("consistency")
+		repo = redis.NewLocalRepository(config, logger)
+		processes = new(fakes.FakeProcessLister)
+		alivePids = map[int]bool{}
+
+		verifier = consistency.NewVerifier(config, repo, false, logger)
+		verifier.Processes = processes
+		verifier.Alive = func(pid int) bool { return alivePids[pid] }
+
+		createInstance("first", 6000, 100)
+		createInstance("second", 6001, 101)
+		processes.RedisServersReturns([]consistency.Process{
+			{Pid: 100, Port: 6000},
+			{Pid: 101, Port: 6001},
+		}, nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(baseDir)).To(Succeed())
+	})
+
+	It("finds nothing when everything is consistent", func() {
+		Expect(verifier.Verify()).To(BeEmpty())
+		Expect(logger).To(gbytes.Say("No inconsistencies found"))
+	})
+
+	It("reports instances that are missing a config file", func() {
+		Expect(os.Remove(repo.InstanceConfigPath("second"))).To(Succeed())
+
+		Expect(verifier.Verify()).To(ContainElement(consistency.Finding{
+			Kind:       consistency.MissingConfig,
+			InstanceID: "second",
+			Path:       repo.InstanceConfigPath("second"),
+		}))
+	})
+
+	It("reports instances that are configured with the same port", func() {
+		createInstance("third", 6000, 102)
+
+		Expect(verifier.Verify()).To(ConsistOf(consistency.Finding{
+			Kind:      consistency.DuplicatePort,
+			Instances: []string{"first", "third"},
+			Port:      6000,
+		}))
+	})
+
+	It("reports pidfiles of processes that are no longer running", func() {
+		alivePids[101] = false
+
+		findings := verifier.Verify()
+		Expect(findings).To(ContainElement(consistency.Finding{
+			Kind:       consistency.StalePidfile,
+			InstanceID: "second",
+			Path:       repo.InstancePidFilePath("second"),
+			Pid:        101,
+		}))
+		Expect(repo.InstancePidFilePath("second")).To(BeAnExistingFile())
+	})
+
+	It("reports redis-server processes that no instance owns", func() {
+		processes.RedisServersReturns([]consistency.Process{
+			{Pid: 100, Port: 6000},
+			{Pid: 101, Port: 6001},
+			{Pid: 200, Port: 7000},
+		}, nil)
+
+		Expect(verifier.Verify()).To(ConsistOf(consistency.Finding{
+			Kind: consistency.UnownedProcess,
+			Pid:  200,
+			Port: 7000,
+		}))
+	})
+
+	It("considers a process on an instance's port to be owned by the instance", func() {
+		processes.RedisServersReturns([]consistency.Process{
+			{Pid: 100, Port: 6000},
+			{Pid: 300, Port: 6001},
+		}, nil)
+
+		Expect(verifier.Verify()).To(BeEmpty())
+	})
+
+	Context("when an instance was only partially removed", func() {
+		BeforeEach(func() {
+			Expect(os.RemoveAll(repo.InstanceBaseDir("second"))).To(Succeed())
+			processes.RedisServersReturns([]consistency.Process{{Pid: 100, Port: 6000}}, nil)
+		})
+
+		It("reports the orphaned pidfile and log directory", func() {
+			Expect(verifier.Verify()).To(ConsistOf(
+				consistency.Finding{
+					Kind:       consistency.OrphanedPidfile,
+					InstanceID: "second",
+					Path:       repo.InstancePidFilePath("second"),
+					Pid:        101,
+				},
+				consistency.Finding{
+					Kind:       consistency.OrphanedLogDir,
+					InstanceID: "second",
+					Path:       repo.InstanceLogDir("second"),
+				},
+			))
+			Expect(logger).To(gbytes.Say("Inconsistency found"))
+
+			Expect(repo.InstancePidFilePath("second")).To(BeAnExistingFile())
+			Expect(repo.InstanceLogDir("second")).To(BeADirectory())
+		})
+
+		Context("and repairing is enabled", func() {
+			BeforeEach(func() {
+				verifier.Repair = true
+			})
+
+			It("removes the orphaned pidfile and log directory", func() {
+				findings := verifier.Verify()
+				Expect(findings).To(HaveLen(2))
+				for _, finding := range findings {
+					Expect(finding.Repaired).To(BeTrue())
+				}
+
+				Expect(repo.InstancePidFilePath("second")).NotTo(BeAnExistingFile())
+				Expect(repo.InstanceLogDir("second")).NotTo(BeADirectory())
+				Expect(repo.InstanceLogDir("first")).To(BeADirectory())
+			})
+
+			It("leaves instances alone while the broker is changing them", func() {
+				locker := new(fakes.FakeInstanceLocker)
+				locker.TryLockInstanceReturns(nil, false, nil)
+				verifier.Locks = locker
+
+				for _, finding := range verifier.Verify() {
+					Expect(finding.Repaired).To(BeFalse())
+				}
+
+				Expect(locker.TryLockInstanceArgsForCall(0)).To(Equal("second"))
+				Expect(repo.InstancePidFilePath("second")).To(BeAnExistingFile())
+				Expect(repo.InstanceLogDir("second")).To(BeADirectory())
+				Expect(logger).To(gbytes.Say("Skipping instance that is being changed"))
+			})
+
+			It("leaves instances alone that were provisioned since they were found", func() {
+				released := false
+				locker := new(fakes.FakeInstanceLocker)
+				locker.TryLockInstanceStub = func(instanceID string) (func(), bool, error) {
+					Expect(os.MkdirAll(repo.InstanceDataDir(instanceID), 0750)).To(Succeed())
+					return func() { released = true }, true, nil
+				}
+				verifier.Locks = locker
+
+				for _, finding := range verifier.Verify() {
+					Expect(finding.Repaired).To(BeFalse())
+				}
+
+				Expect(released).To(BeTrue())
+				Expect(repo.InstancePidFilePath("second")).To(BeAnExistingFile())
+				Expect(repo.InstanceLogDir("second")).To(BeADirectory())
+			})
+		})
+	})
+})
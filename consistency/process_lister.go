@@ -0,0 +1,67 @@
+package consistency
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/gosigar"
+)
+
+type Process struct {
+	Pid  int
+	Port int
+}
+
+//go:generate counterfeiter -o fakes/fake_process_lister.go . ProcessLister
+type ProcessLister interface {
+	RedisServers() ([]Process, error)
+}
+
+type SigarProcessLister struct{}
+
+// RedisServers lists every redis-server process on the VM. redis-server
+// replaces its command line with "redis-server <address>:<port>", which is
+// where the port is taken from.
+func (*SigarProcessLister) RedisServers() ([]Process, error) {
+	pids := sigar.ProcList{}
+	if err := pids.Get(); err != nil {
+		return nil, err
+	}
+
+	processes := []Process{}
+
+	for _, pid := range pids.List {
+		state := sigar.ProcState{}
+		if err := state.Get(pid); err != nil || state.Name != "redis-server" {
+			continue
+		}
+
+		args := sigar.ProcArgs{}
+		args.Get(pid)
+
+		processes = append(processes, Process{
+			Pid:  pid,
+			Port: listenPort(args.List),
+		})
+	}
+
+	return processes, nil
+}
+
+func listenPort(args []string) int {
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			separator := strings.LastIndex(field, ":")
+			if separator == -1 {
+				continue
+			}
+
+			port, err := strconv.Atoi(field[separator+1:])
+			if err == nil {
+				return port
+			}
+		}
+	}
+
+	return 0
+}
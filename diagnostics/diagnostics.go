@@ -0,0 +1,307 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/logstream"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/s3"
+)
+
+const (
+	defaultLogLines = 1000
+
+	bundleTimeFormat = "20060102T150405Z"
+)
+
+type InstanceRepository interface {
+	FindByID(instanceID string) (*redis.Instance, error)
+	InstanceConfigPath(instanceID string) string
+	InstanceLogFilePath(instanceID string) string
+}
+
+// Bundle is a diagnostics bundle that has been written to disk and, when a
+// bucket is configured, uploaded to S3. Errors lists what could not be
+// collected, for example because the instance was not running.
+type Bundle struct {
+	InstanceID string   `json:"instance_id"`
+	Path       string   `json:"path"`
+	Location   string   `json:"location,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// Collector gathers what support needs to look into a problem with an
+// instance into a single tar.gz: the output of INFO, CONFIG GET *, SLOWLOG
+// GET, LATENCY DOCTOR and CLIENT LIST, the instance's redis.conf and the end
+// of its redis-server log. The instance's password, password directives and
+// the names of renamed commands are redacted from every file.
+//
+// A bundle is written even when redis-server cannot be reached, since that is
+// often when one is needed most; what could not be collected is listed in
+// errors.txt.
+type Collector struct {
+	Repository InstanceRepository
+	Connect    redis.Connector
+	Directory  string
+	LogLines   int
+	Logger     lager.Logger
+	Now        func() time.Time
+
+	// Bucket returns the bucket bundles are uploaded to underneath
+	// UploadPath. Bundles are only kept on disk when it is nil.
+	Bucket     func() (s3.Bucket, error)
+	UploadPath string
+}
+
+type command struct {
+	file   string
+	name   string
+	args   []interface{}
+	format func(reply interface{}) (string, error)
+}
+
+var commands = []command{
+	{"info.txt", "INFO", []interface{}{"all"}, formatText},
+	{"config.txt", "CONFIG", []interface{}{"GET", "*"}, formatConfig},
+	{"slowlog.txt", "SLOWLOG", []interface{}{"GET", "128"}, formatSlowlog},
+	{"latency-doctor.txt", "LATENCY", []interface{}{"DOCTOR"}, formatText},
+	{"client-list.txt", "CLIENT", []interface{}{"LIST"}, formatText},
+}
+
+func NewCollector(config brokerconfig.ServiceConfiguration, repository InstanceRepository, logger lager.Logger) *Collector {
+	directory := config.Diagnostics.Directory
+	if directory == "" {
+		directory = filepath.Join(os.TempDir(), "redis-diagnostics")
+	}
+
+	collector := &Collector{
+		Repository: repository,
+		Connect:    redis.Connect,
+		Directory:  directory,
+		LogLines:   config.Diagnostics.LogLines,
+		Logger:     logger,
+		Now:        time.Now,
+		UploadPath: config.Diagnostics.Path,
+	}
+
+	if config.Diagnostics.BucketName != "" {
+		s3Client := s3.NewClient(
+			config.Diagnostics.EndpointURL,
+			config.Diagnostics.AccessKeyID,
+			config.Diagnostics.SecretAccessKey,
+			logger,
+		)
+		collector.Bucket = func() (s3.Bucket, error) {
+			return s3Client.GetOrCreateBucket(config.Diagnostics.BucketName)
+		}
+	}
+
+	return collector
+}
+
+// Collect writes a diagnostics bundle for the instance and uploads it when a
+// bucket is configured. The bundle is kept on disk when the upload fails.
+func (collector *Collector) Collect(instanceID string) (Bundle, error) {
+	instance, err := collector.Repository.FindByID(instanceID)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	name := fmt.Sprintf("%s-diagnostics-%s", instanceID, collector.Now().UTC().Format(bundleTimeFormat))
+	bundle := Bundle{
+		InstanceID: instanceID,
+		Path:       filepath.Join(collector.Directory, name+".tar.gz"),
+	}
+
+	files, failures := collector.collect(instance)
+	bundle.Errors = failures
+
+	if len(bundle.Errors) > 0 {
+		files = append(files, file{"errors.txt", strings.Join(bundle.Errors, "\n") + "\n"})
+	}
+
+	err = writeBundle(bundle.Path, name, files)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	collector.Logger.Info("wrote-diagnostics-bundle", lager.Data{
+		"instance_id": instanceID,
+		"path":        bundle.Path,
+		"errors":      len(bundle.Errors),
+	})
+
+	if collector.Bucket == nil {
+		return bundle, nil
+	}
+
+	bundle.Location, err = collector.upload(bundle.Path)
+	if err != nil {
+		return bundle, fmt.Errorf("diagnostics bundle was written to %s but could not be uploaded: %s", bundle.Path, err)
+	}
+
+	return bundle, nil
+}
+
+type file struct {
+	name     string
+	contents string
+}
+
+func (collector *Collector) collect(instance *redis.Instance) ([]file, []string) {
+	var (
+		files    []file
+		failures []string
+	)
+
+	aliases := map[string]string{}
+	var parsed redisconf.Conf
+
+	confPath := collector.Repository.InstanceConfigPath(instance.ID)
+	conf, err := os.ReadFile(confPath)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("redis.conf: %s", err))
+	} else {
+		parsed, _ = redisconf.LoadWithIncludes(confPath)
+		for name, alias := range parsed.CommandAliases() {
+			aliases[strings.ToUpper(name)] = alias
+		}
+		files = append(files, file{"redis.conf", string(conf)})
+	}
+
+	redisClient, err := collector.Connect(instance, aliases)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("connecting to redis-server: %s", err))
+	} else {
+		defer redisClient.Disconnect()
+
+		for _, cmd := range commands {
+			contents, err := cmd.run(redisClient, aliases)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", cmd.name, err))
+				continue
+			}
+			files = append(files, file{cmd.file, contents})
+		}
+	}
+
+	logLines := collector.LogLines
+	if logLines <= 0 {
+		logLines = defaultLogLines
+	}
+
+	lines, err := logstream.Tail(collector.Repository.InstanceLogFilePath(instance.ID), logLines)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("redis-server.log: %s", err))
+	} else {
+		files = append(files, file{"redis-server.log", strings.Join(lines, "\n") + "\n"})
+	}
+
+	redact := redisconf.NewRedactor(parsed, instance.Password)
+	for i := range files {
+		files[i].contents = redact(files[i].contents)
+	}
+
+	for i := range failures {
+		failures[i] = redact(failures[i])
+	}
+
+	return files, failures
+}
+
+func (cmd command) run(redisClient client.Client, aliases map[string]string) (string, error) {
+	name := cmd.name
+	if alias, renamed := aliases[name]; renamed {
+		if alias == "" {
+			return "", fmt.Errorf("command is disabled on this instance")
+		}
+		name = alias
+	}
+
+	reply, err := redisClient.Exec(name, cmd.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return cmd.format(reply)
+}
+
+// writeBundle writes the files into a tar.gz underneath a directory named
+// after the bundle. The bundle is written to a temporary file first so that a
+// partial bundle is never mistaken for a complete one.
+func writeBundle(bundlePath, name string, files []file) error {
+	err := os.MkdirAll(filepath.Dir(bundlePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(bundlePath), "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	defer temporary.Close()
+
+	compressed := gzip.NewWriter(temporary)
+	archive := tar.NewWriter(compressed)
+	modTime := time.Now()
+
+	for _, f := range files {
+		err = archive.WriteHeader(&tar.Header{
+			Name:    path.Join(name, f.name),
+			Mode:    0600,
+			Size:    int64(len(f.contents)),
+			ModTime: modTime,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = archive.Write([]byte(f.contents))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary.Name(), bundlePath)
+}
+
+func (collector *Collector) upload(bundlePath string) (string, error) {
+	bucket, err := collector.Bucket()
+	if err != nil {
+		return "", err
+	}
+
+	target := path.Join(collector.UploadPath, filepath.Base(bundlePath))
+
+	err = bucket.Upload(bundlePath, target)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", bucket.Name(), strings.TrimPrefix(target, "/")), nil
+}
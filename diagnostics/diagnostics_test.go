@@ -0,0 +1,279 @@
+package diagnostics_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	redisclient "github.com/gomodule/redigo/redis"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/diagnostics"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/s3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeRepository struct {
+	root string
+}
+
+func (repo fakeRepository) FindByID(instanceID string) (*redis.Instance, error) {
+	if instanceID != "an-instance" {
+		return nil, &os.PathError{Op: "open", Path: instanceID, Err: os.ErrNotExist}
+	}
+	return &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 6379, Password: "instance-secret"}, nil
+}
+
+func (repo fakeRepository) InstanceConfigPath(instanceID string) string {
+	return filepath.Join(repo.root, "data", instanceID, "redis.conf")
+}
+
+func (repo fakeRepository) InstanceLogFilePath(instanceID string) string {
+	return filepath.Join(repo.root, "log", instanceID, "redis-server.log")
+}
+
+type fakeBucket struct {
+	uploads   map[string]string
+	uploadErr error
+}
+
+func (bucket *fakeBucket) Upload(source, destination string) error {
+	if bucket.uploadErr != nil {
+		return bucket.uploadErr
+	}
+	bucket.uploads[destination] = source
+	return nil
+}
+
+func (bucket *fakeBucket) Name() string {
+	return "redis-diagnostics"
+}
+
+func readBundle(path string) map[string]string {
+	file, err := os.Open(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	Expect(err).NotTo(HaveOccurred())
+
+	files := map[string]string{}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files
+		}
+		Expect(err).NotTo(HaveOccurred())
+
+		contents, err := io.ReadAll(archive)
+		Expect(err).NotTo(HaveOccurred())
+		files[header.Name] = string(contents)
+	}
+}
+
+var _ = Describe("Collector", func() {
+	var (
+		root        string
+		fakeClient  *fakes.FakeClient
+		connectErr  error
+		collector   *diagnostics.Collector
+		bundleDir   string
+		bundleFiles func() map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = os.MkdirTemp("", "diagnostics")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		repo := fakeRepository{root: root}
+		Expect(os.MkdirAll(filepath.Dir(repo.InstanceConfigPath("an-instance")), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Dir(repo.InstanceLogFilePath("an-instance")), 0755)).To(Succeed())
+		Expect(os.WriteFile(repo.InstanceConfigPath("an-instance"), []byte(
+			"port 6379\n"+
+				"requirepass instance-secret\n"+
+				"rename-command CONFIG config-alias-123\n"+
+				"rename-command DEBUG \"\"\n"+
+				"user alice on >acl-secret #acl-secret-hash ~cache:* +get\n",
+		), 0640)).To(Succeed())
+		Expect(os.WriteFile(repo.InstanceLogFilePath("an-instance"), []byte(
+			"1:M 19 Oct 2026 07:52:00.000 * Ready to accept connections\n"+
+				"1:M 19 Oct 2026 07:52:01.000 # AUTH instance-secret failed\n",
+		), 0644)).To(Succeed())
+
+		fakeClient = new(fakes.FakeClient)
+		fakeClient.ExecStub = func(command string, args ...interface{}) (interface{}, error) {
+			switch command {
+			case "INFO":
+				return []byte("# Server\r\nredis_version:7.2.4\r\n# Commandstats\r\ncmdstat_config-alias-123:calls=1\r\n"), nil
+			case "config-alias-123":
+				return []interface{}{
+					[]byte("maxmemory"), []byte("0"),
+					[]byte("requirepass"), []byte("instance-secret"),
+					[]byte("masterauth"), []byte(""),
+				}, nil
+			case "SLOWLOG":
+				return []interface{}{
+					[]interface{}{
+						int64(7), int64(1792396320), int64(1500),
+						[]interface{}{[]byte("CONFIG"), []byte("SET"), []byte("requirepass"), []byte("new-secret")},
+						[]byte("10.0.0.1:50000"), []byte("worker"),
+					},
+				}, nil
+			case "LATENCY":
+				return []byte("I have no latency reports to show you"), nil
+			case "CLIENT":
+				return []byte("id=3 addr=10.0.0.1:50000 name=worker cmd=client|list\n"), nil
+			}
+			return nil, redisclient.Error("ERR unknown command")
+		}
+		connectErr = nil
+
+		bundleDir = filepath.Join(root, "bundles")
+		collector = diagnostics.NewCollector(brokerconfig.ServiceConfiguration{
+			Diagnostics: brokerconfig.DiagnosticsConfiguration{Directory: bundleDir},
+		}, repo, lagertest.NewTestLogger("diagnostics"))
+		collector.Connect = func(instance *redis.Instance, _ map[string]string) (client.Client, error) {
+			Expect(instance.Password).To(Equal("instance-secret"))
+			return fakeClient, connectErr
+		}
+		collector.Now = func() time.Time {
+			return time.Date(2026, 10, 19, 7, 52, 0, 0, time.UTC)
+		}
+
+		bundleFiles = func() map[string]string {
+			return readBundle(filepath.Join(bundleDir, "an-instance-diagnostics-20261019T075200Z.tar.gz"))
+		}
+	})
+
+	It("writes a timestamped bundle of the instance's state", func() {
+		bundle, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bundle.Path).To(Equal(filepath.Join(bundleDir, "an-instance-diagnostics-20261019T075200Z.tar.gz")))
+		Expect(bundle.Location).To(BeEmpty())
+		Expect(bundle.Errors).To(BeEmpty())
+
+		files := bundleFiles()
+		Expect(files).To(HaveLen(7))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/info.txt"]).To(ContainSubstring("redis_version:7.2.4"))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/config.txt"]).To(Equal(
+			"masterauth \"\"\nmaxmemory 0\nrequirepass [REDACTED]\n",
+		))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/slowlog.txt"]).To(Equal(
+			"id=7 time=2026-10-19T07:52:00Z duration=1500us client=10.0.0.1:50000 name=worker command=CONFIG SET requirepass [REDACTED]\n",
+		))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/latency-doctor.txt"]).To(ContainSubstring("no latency reports"))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/client-list.txt"]).To(ContainSubstring("name=worker"))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/redis.conf"]).To(ContainSubstring("port 6379\n"))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/redis-server.log"]).To(ContainSubstring("Ready to accept connections"))
+
+		info, err := os.Stat(bundle.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("uses the names of renamed commands", func() {
+		_, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+
+		command, args := fakeClient.ExecArgsForCall(1)
+		Expect(command).To(Equal("config-alias-123"))
+		Expect(args).To(Equal([]interface{}{"GET", "*"}))
+	})
+
+	It("scrubs passwords and command aliases from every file", func() {
+		_, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+
+		for name, contents := range bundleFiles() {
+			Expect(contents).NotTo(ContainSubstring("instance-secret"), name)
+			Expect(contents).NotTo(ContainSubstring("config-alias-123"), name)
+			Expect(contents).NotTo(ContainSubstring("acl-secret"), name)
+		}
+		Expect(bundleFiles()["an-instance-diagnostics-20261019T075200Z/redis.conf"]).To(ContainSubstring("rename-command DEBUG \"\"\n"))
+	})
+
+	It("still writes a bundle when redis-server cannot be reached", func() {
+		connectErr = errors.New("connection refused")
+
+		bundle, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.Errors).To(ConsistOf("connecting to redis-server: connection refused"))
+
+		files := bundleFiles()
+		Expect(files).To(HaveKey("an-instance-diagnostics-20261019T075200Z/redis.conf"))
+		Expect(files).To(HaveKey("an-instance-diagnostics-20261019T075200Z/redis-server.log"))
+		Expect(files["an-instance-diagnostics-20261019T075200Z/errors.txt"]).To(Equal("connecting to redis-server: connection refused\n"))
+	})
+
+	It("records commands that fail", func() {
+		fakeClient.ExecStub = nil
+		fakeClient.ExecReturns(nil, redisclient.Error("NOPERM this user has no permissions"))
+
+		bundle, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.Errors).To(ContainElement("SLOWLOG: NOPERM this user has no permissions"))
+		Expect(bundleFiles()).NotTo(HaveKey("an-instance-diagnostics-20261019T075200Z/slowlog.txt"))
+	})
+
+	It("does not follow a log that was replaced by a symlink", func() {
+		logPath := fakeRepository{root: root}.InstanceLogFilePath("an-instance")
+		Expect(os.Remove(logPath)).To(Succeed())
+		Expect(os.Symlink(collector.Repository.InstanceConfigPath("an-instance"), logPath)).To(Succeed())
+
+		bundle, err := collector.Collect("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.Errors).To(ContainElement(HavePrefix("redis-server.log:")))
+		Expect(bundleFiles()).NotTo(HaveKey("an-instance-diagnostics-20261019T075200Z/redis-server.log"))
+	})
+
+	It("returns an error for instances that do not exist", func() {
+		_, err := collector.Collect("missing-instance")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	Context("when a bucket is configured", func() {
+		var bucket *fakeBucket
+
+		BeforeEach(func() {
+			bucket = &fakeBucket{uploads: map[string]string{}}
+			collector.UploadPath = "bundles"
+			collector.Bucket = func() (s3.Bucket, error) {
+				return bucket, nil
+			}
+		})
+
+		It("uploads the bundle", func() {
+			bundle, err := collector.Collect("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(bucket.uploads).To(Equal(map[string]string{
+				"bundles/an-instance-diagnostics-20261019T075200Z.tar.gz": bundle.Path,
+			}))
+			Expect(bundle.Location).To(Equal("s3://redis-diagnostics/bundles/an-instance-diagnostics-20261019T075200Z.tar.gz"))
+		})
+
+		It("keeps the bundle when the upload fails", func() {
+			bucket.uploadErr = errors.New("access denied")
+
+			bundle, err := collector.Collect("an-instance")
+			Expect(err).To(MatchError(ContainSubstring("access denied")))
+			Expect(bundle.Path).To(BeAnExistingFile())
+			Expect(strings.Contains(err.Error(), bundle.Path)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package diagnostics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	redisclient "github.com/gomodule/redigo/redis"
+)
+
+func formatText(reply interface{}) (string, error) {
+	return redisclient.String(reply, nil)
+}
+
+// formatConfig writes one directive per line, as in redis.conf, so that the
+// same redaction applies to both.
+func formatConfig(reply interface{}) (string, error) {
+	values, err := redisclient.StringMap(reply, nil)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var config strings.Builder
+	for _, key := range keys {
+		value := values[key]
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(&config, "%s %s\n", key, value)
+	}
+
+	return config.String(), nil
+}
+
+// formatSlowlog writes one slowlog entry per line. The client address and
+// name are only reported by redis 4.0 and later.
+func formatSlowlog(reply interface{}) (string, error) {
+	entries, err := redisclient.Values(reply, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var slowlog strings.Builder
+	for _, entry := range entries {
+		fields, err := redisclient.Values(entry, nil)
+		if err != nil {
+			return "", err
+		}
+
+		if len(fields) < 4 {
+			return "", fmt.Errorf("unexpected slowlog entry with %d fields", len(fields))
+		}
+
+		id, _ := redisclient.Int64(fields[0], nil)
+		timestamp, _ := redisclient.Int64(fields[1], nil)
+		duration, _ := redisclient.Int64(fields[2], nil)
+		args, _ := redisclient.Strings(fields[3], nil)
+
+		fmt.Fprintf(&slowlog, "id=%d time=%s duration=%dus",
+			id,
+			time.Unix(timestamp, 0).UTC().Format(time.RFC3339),
+			duration,
+		)
+
+		if len(fields) >= 6 {
+			addr, _ := redisclient.String(fields[4], nil)
+			name, _ := redisclient.String(fields[5], nil)
+			fmt.Fprintf(&slowlog, " client=%s name=%s", addr, name)
+		}
+
+		fmt.Fprintf(&slowlog, " command=%s\n", strings.Join(args, " "))
+	}
+
+	return slowlog.String(), nil
+}
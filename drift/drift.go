@@ -0,0 +1,327 @@
+package drift
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	// PolicyReport only logs the differences.
+	PolicyReport = "report"
+	// PolicyReapply sets the live value back to the value in redis.conf.
+	PolicyReapply = "reapply"
+	// PolicyPersist writes the live value of redisconf.Tunable directives to
+	// redis.conf and reapplies the others. A tenant who can run CONFIG SET
+	// could otherwise make a change to them permanent.
+	PolicyPersist = "persist"
+
+	defaultInterval = 5 * time.Minute
+)
+
+// ignored directives cannot be compared with CONFIG GET: they are not
+// settable, are overridden on the command line, or are reported in a
+// different format.
+var ignored = map[string]bool{
+	"rename-command":             true,
+	"include":                    true,
+	"loadmodule":                 true,
+	"user":                       true,
+	"client-output-buffer-limit": true,
+	"dir":                        true,
+	"logfile":                    true,
+	"daemonize":                  true,
+}
+
+// secrets are logged as [REDACTED].
+var secrets = map[string]bool{
+	"requirepass": true,
+	"masterauth":  true,
+}
+
+var memorySize = regexp.MustCompile(`^(\d+)(k|kb|m|mb|g|gb)$`)
+
+var memoryUnits = map[string]int64{
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+type InstanceConfigs interface {
+	AllInstances() ([]*redis.Instance, []error)
+	InstanceConfigPath(instanceID string) string
+	PersistConfigValue(instanceID, key string, values ...string) error
+}
+
+// InstanceLocker is used to leave instances alone while the broker or the
+// process monitor is changing them, since persisting a value rewrites their
+// redis.conf.
+type InstanceLocker interface {
+	TryLockInstance(instanceID string) (func(), bool, error)
+}
+
+// Difference is a directive whose live value differs from redis.conf.
+type Difference struct {
+	Key    string `json:"key"`
+	File   string `json:"file"`
+	Live   string `json:"live"`
+	Action string `json:"action"`
+}
+
+// Detector compares the directives in the redis.conf of every shared instance
+// with the values the running redis-server reports through CONFIG GET. Values
+// change when a tenant or an operator uses CONFIG SET, and are lost when the
+// process monitor regenerates redis.conf and restarts the instance.
+//
+// Every difference is logged. Depending on Policy, the value in redis.conf is
+// then set on the server again, or the live value is written to redis.conf so
+// that it is kept from then on.
+type Detector struct {
+	Instances InstanceConfigs
+	Connect   redis.Connector
+	Policy    string
+	Locks     InstanceLocker
+	Logger    lager.Logger
+}
+
+func NewDetector(config brokerconfig.ServiceConfiguration, instances InstanceConfigs, logger lager.Logger) (*Detector, error) {
+	policy := config.ConfigDriftPolicy
+	if policy == "" {
+		policy = PolicyReport
+	}
+
+	if policy != PolicyReport && policy != PolicyReapply && policy != PolicyPersist {
+		return nil, fmt.Errorf("unknown config drift policy %q, expected one of %s, %s or %s", policy, PolicyReport, PolicyReapply, PolicyPersist)
+	}
+
+	return &Detector{
+		Instances: instances,
+		Connect:   redis.Connect,
+		Policy:    policy,
+		Logger:    logger,
+	}, nil
+}
+
+// Interval returns how often the instances should be checked for drift.
+func Interval(config brokerconfig.ServiceConfiguration) time.Duration {
+	if config.ConfigDriftIntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(config.ConfigDriftIntervalSeconds) * time.Second
+}
+
+// Run checks every instance every interval until stop is closed.
+func (detector *Detector) Run(interval time.Duration, stop <-chan struct{}) {
+	utils.Every(interval, stop, detector.CheckAll)
+}
+
+// CheckAll checks every instance. Instances that cannot be reached are
+// skipped.
+func (detector *Detector) CheckAll() {
+	instances, errs := detector.Instances.AllInstances()
+	for _, err := range errs {
+		detector.Logger.Error("list-instances", err)
+	}
+
+	for _, instance := range instances {
+		_, err := detector.Check(instance)
+		if err != nil {
+			detector.Logger.Error("check-config-drift", err, lager.Data{"instance_id": instance.ID})
+		}
+	}
+}
+
+// Check returns the differences between the instance's redis.conf and its
+// live config, after acting on them according to the policy. Instances that
+// are locked are skipped, and checked again on the next pass.
+func (detector *Detector) Check(instance *redis.Instance) ([]Difference, error) {
+	if detector.Locks != nil {
+		unlock, acquired, err := detector.Locks.TryLockInstance(instance.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !acquired {
+			detector.Logger.Info("instance-locked", lager.Data{
+				"instance_id": instance.ID,
+			})
+			return nil, nil
+		}
+		defer unlock()
+	}
+
+	conf, err := redisconf.LoadWithIncludes(detector.Instances.InstanceConfigPath(instance.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := conf.CommandAliases()
+	configCommand := "CONFIG"
+	for name, alias := range aliases {
+		if !strings.EqualFold(name, "CONFIG") {
+			continue
+		}
+		if alias == "" {
+			return nil, fmt.Errorf("CONFIG is disabled on this instance")
+		}
+		configCommand = alias
+	}
+
+	redisClient, err := detector.Connect(instance, aliases)
+	if err != nil {
+		detector.Logger.Debug("instance-unreachable", lager.Data{
+			"instance_id": instance.ID,
+			"error":       err.Error(),
+		})
+		return nil, nil
+	}
+	defer redisClient.Disconnect()
+
+	differences := []Difference{}
+	compared := map[string]bool{}
+
+	for _, param := range conf {
+		key := strings.ToLower(param.Key)
+		if key == "" || ignored[key] || compared[key] {
+			continue
+		}
+		compared[key] = true
+
+		// redis-server uses the last value of a directive that is set
+		// more than once, except for the snapshot rules of save
+		fileValue := conf.Get(key)
+		if key == "save" {
+			fileValue = strings.Join(conf.GetAll(key), " ")
+		}
+
+		live, err := redisClient.GetConfig(key)
+		if err != nil {
+			// directives that this version of redis-server does not
+			// report cannot drift
+			continue
+		}
+
+		if normalize(fileValue) == normalize(live) {
+			continue
+		}
+
+		difference := Difference{Key: key, File: fileValue, Live: live}
+		difference.Action, err = detector.resolve(instance, redisClient, configCommand, difference)
+		if err != nil {
+			detector.Logger.Error("resolve-config-drift", err, lager.Data{
+				"instance_id": instance.ID,
+				"key":         key,
+			})
+		}
+
+		detector.log(instance.ID, difference)
+		differences = append(differences, difference)
+	}
+
+	return differences, nil
+}
+
+// resolve acts on a difference according to the policy and returns what it
+// did.
+func (detector *Detector) resolve(instance *redis.Instance, redisClient client.Client, configCommand string, difference Difference) (string, error) {
+	switch {
+	case detector.Policy == PolicyReport:
+		return "reported", nil
+
+	case detector.Policy == PolicyPersist && redisconf.IsTunable(difference.Key):
+		err := detector.Instances.PersistConfigValue(instance.ID, difference.Key, fileValues(difference.Key, difference.Live)...)
+		if err != nil {
+			return "reported", err
+		}
+		return "persisted", nil
+
+	default:
+		_, err := redisClient.Exec(configCommand, "SET", difference.Key, unquote(difference.File))
+		if err != nil {
+			return "reported", err
+		}
+		return "reapplied", nil
+	}
+}
+
+func (detector *Detector) log(instanceID string, difference Difference) {
+	file, live := difference.File, difference.Live
+	if secrets[difference.Key] {
+		file, live = redisconf.Redacted, redisconf.Redacted
+	}
+
+	detector.Logger.Info("config-drift", lager.Data{
+		"instance_id": instanceID,
+		"key":         difference.Key,
+		"file":        file,
+		"live":        live,
+		"action":      difference.Action,
+	})
+}
+
+// fileValues splits a live value into the lines it takes up in redis.conf,
+// quoted so that redis-server reads back the same arguments. Versions of
+// redis-server before 7.0 only accept one snapshot rule per save line.
+func fileValues(key, live string) []string {
+	if key != "save" {
+		args := strings.Fields(live)
+		if redisconf.Directives[key].Type != redisconf.TypeArgs || len(args) == 0 {
+			return []string{redisconf.Quote(live)}
+		}
+
+		for i, arg := range args {
+			args[i] = redisconf.Quote(arg)
+		}
+		return []string{strings.Join(args, " ")}
+	}
+
+	fields := strings.Fields(live)
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return []string{`""`}
+	}
+
+	rules := []string{}
+	for i := 0; i < len(fields); i += 2 {
+		rules = append(rules, fields[i]+" "+fields[i+1])
+	}
+	return rules
+}
+
+// normalize puts values into the form CONFIG GET reports them in: without
+// quotes, in lower case, and with memory sizes in bytes.
+func normalize(value string) string {
+	fields := strings.Fields(unquote(value))
+	for i, field := range fields {
+		field = strings.ToLower(strings.Trim(field, `"'`))
+
+		if match := memorySize.FindStringSubmatch(field); match != nil {
+			size, err := strconv.ParseInt(match[1], 10, 64)
+			if err == nil {
+				field = strconv.FormatInt(size*memoryUnits[match[2]], 10)
+			}
+		}
+
+		fields[i] = field
+	}
+	return strings.Join(fields, " ")
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'') {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,334 @@
+package drift_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/drift"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeConfigs struct {
+	root      string
+	instances []*redis.Instance
+	persisted map[string][]string
+}
+
+func (fake *fakeConfigs) AllInstances() ([]*redis.Instance, []error) {
+	return fake.instances, nil
+}
+
+func (fake *fakeConfigs) InstanceConfigPath(instanceID string) string {
+	return filepath.Join(fake.root, instanceID, "redis.conf")
+}
+
+func (fake *fakeConfigs) PersistConfigValue(instanceID, key string, values ...string) error {
+	fake.persisted[key] = values
+	return nil
+}
+
+type fakeLocks struct {
+	locked   map[string]bool
+	released []string
+}
+
+func (fake *fakeLocks) TryLockInstance(instanceID string) (func(), bool, error) {
+	if fake.locked[instanceID] {
+		return nil, false, nil
+	}
+
+	return func() { fake.released = append(fake.released, instanceID) }, true, nil
+}
+
+var _ = Describe("Detector", func() {
+	var (
+		configs    *fakeConfigs
+		instance   *redis.Instance
+		live       map[string]string
+		setConfigs [][]interface{}
+		fakeClient *fakes.FakeClient
+		logger     *lagertest.TestLogger
+		detector   *drift.Detector
+	)
+
+	writeConf := func(contents string) {
+		Expect(os.MkdirAll(filepath.Join(configs.root, instance.ID), 0755)).To(Succeed())
+		Expect(os.WriteFile(configs.InstanceConfigPath(instance.ID), []byte(contents), 0640)).To(Succeed())
+	}
+
+	newDetector := func(policy string) {
+		var err error
+		detector, err = drift.NewDetector(brokerconfig.ServiceConfiguration{ConfigDriftPolicy: policy}, configs, logger)
+		Expect(err).NotTo(HaveOccurred())
+		detector.Connect = func(*redis.Instance, map[string]string) (client.Client, error) {
+			return fakeClient, nil
+		}
+	}
+
+	BeforeEach(func() {
+		root, err := os.MkdirTemp("", "drift")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		instance = &redis.Instance{ID: "an-instance", Port: 7000, Password: "instance-secret"}
+		configs = &fakeConfigs{
+			root:      root,
+			instances: []*redis.Instance{instance},
+			persisted: map[string][]string{},
+		}
+
+		writeConf("port 7000\n" +
+			"requirepass instance-secret\n" +
+			"maxmemory 100mb\n" +
+			"maxmemory-policy noeviction\n" +
+			"save 900 1\n" +
+			"save 300 10\n" +
+			"appendonly no\n" +
+			"dir /var/vcap/store/redis\n")
+
+		live = map[string]string{
+			"port":             "7000",
+			"requirepass":      "instance-secret",
+			"maxmemory":        "104857600",
+			"maxmemory-policy": "noeviction",
+			"save":             "900 1 300 10",
+			"appendonly":       "no",
+			"dir":              "/var/vcap/store/redis/an-instance/db",
+		}
+
+		setConfigs = nil
+		fakeClient = new(fakes.FakeClient)
+		fakeClient.GetConfigStub = func(key string) (string, error) {
+			value, ok := live[key]
+			if !ok {
+				return "", fmt.Errorf("Key '%s' not found", key)
+			}
+			return value, nil
+		}
+		fakeClient.ExecStub = func(command string, args ...interface{}) (interface{}, error) {
+			setConfigs = append(setConfigs, append([]interface{}{command}, args...))
+			return "OK", nil
+		}
+
+		logger = lagertest.NewTestLogger("drift")
+		newDetector("")
+	})
+
+	It("reports by default", func() {
+		Expect(detector.Policy).To(Equal(drift.PolicyReport))
+	})
+
+	It("rejects unknown policies", func() {
+		_, err := drift.NewDetector(brokerconfig.ServiceConfiguration{ConfigDriftPolicy: "ignore"}, configs, logger)
+		Expect(err).To(MatchError(ContainSubstring(`unknown config drift policy "ignore"`)))
+	})
+
+	It("finds no drift when the live config matches redis.conf", func() {
+		differences, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differences).To(BeEmpty())
+	})
+
+	Context("when values were changed with CONFIG SET", func() {
+		BeforeEach(func() {
+			live["maxmemory-policy"] = "allkeys-lru"
+			live["save"] = "3600 1"
+			live["requirepass"] = "chosen-by-tenant"
+		})
+
+		It("reports the differences", func() {
+			differences, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(differences).To(ConsistOf(
+				drift.Difference{Key: "requirepass", File: "instance-secret", Live: "chosen-by-tenant", Action: "reported"},
+				drift.Difference{Key: "maxmemory-policy", File: "noeviction", Live: "allkeys-lru", Action: "reported"},
+				drift.Difference{Key: "save", File: "900 1 300 10", Live: "3600 1", Action: "reported"},
+			))
+			Expect(setConfigs).To(BeEmpty())
+			Expect(configs.persisted).To(BeEmpty())
+
+			Expect(logger).To(gbytes.Say(`"message":"drift.config-drift".*"action":"reported","file":"noeviction","instance_id":"an-instance","key":"maxmemory-policy","live":"allkeys-lru"`))
+		})
+
+		It("does not log passwords", func() {
+			detector.CheckAll()
+
+			Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("instance-secret"))
+			Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("chosen-by-tenant"))
+		})
+
+		It("reapplies redis.conf when the policy is reapply", func() {
+			newDetector(drift.PolicyReapply)
+
+			differences, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(differences).To(HaveLen(3))
+			Expect(differences[0].Action).To(Equal("reapplied"))
+
+			Expect(setConfigs).To(ConsistOf(
+				[]interface{}{"CONFIG", "SET", "requirepass", "instance-secret"},
+				[]interface{}{"CONFIG", "SET", "maxmemory-policy", "noeviction"},
+				[]interface{}{"CONFIG", "SET", "save", "900 1 300 10"},
+			))
+		})
+
+		It("persists live values when the policy is persist, but reapplies protected ones", func() {
+			newDetector(drift.PolicyPersist)
+
+			_, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configs.persisted).To(Equal(map[string][]string{
+				"save": {"3600 1"},
+			}))
+			Expect(setConfigs).To(ConsistOf(
+				[]interface{}{"CONFIG", "SET", "requirepass", "instance-secret"},
+				[]interface{}{"CONFIG", "SET", "maxmemory-policy", "noeviction"},
+			))
+		})
+
+		It("uses the name of a renamed CONFIG command", func() {
+			writeConf("rename-command CONFIG config-alias\nmaxmemory-policy noeviction\n")
+			newDetector(drift.PolicyReapply)
+
+			_, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setConfigs).To(Equal([][]interface{}{
+				{"config-alias", "SET", "maxmemory-policy", "noeviction"},
+			}))
+		})
+	})
+
+	It("reapplies the memory limits of the plan when the policy is persist", func() {
+		live["maxmemory"] = "0"
+		newDetector(drift.PolicyPersist)
+
+		_, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs.persisted).To(BeEmpty())
+		Expect(setConfigs).To(Equal([][]interface{}{
+			{"CONFIG", "SET", "maxmemory", "100mb"},
+		}))
+	})
+
+	Context("when instances are locked while they are changed", func() {
+		var locks *fakeLocks
+
+		BeforeEach(func() {
+			live["maxmemory-policy"] = "allkeys-lru"
+			locks = &fakeLocks{locked: map[string]bool{}}
+			newDetector(drift.PolicyPersist)
+			detector.Locks = locks
+		})
+
+		It("holds the instance's lock while it acts on the differences", func() {
+			_, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locks.released).To(Equal([]string{"an-instance"}))
+		})
+
+		It("skips instances that are being changed", func() {
+			locks.locked["an-instance"] = true
+
+			differences, err := detector.Check(instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(differences).To(BeEmpty())
+			Expect(configs.persisted).To(BeEmpty())
+			Expect(setConfigs).To(BeEmpty())
+			Expect(fakeClient.GetConfigCallCount()).To(BeZero())
+			Expect(logger).To(gbytes.Say("instance-locked"))
+		})
+	})
+
+	It("quotes persisted values that are empty or contain spaces", func() {
+		writeConf("notify-keyspace-events Ex\nlatency-tracking-info-percentiles 50 99\n")
+		live = map[string]string{
+			"notify-keyspace-events":            "",
+			"latency-tracking-info-percentiles": "50 99.9",
+		}
+		newDetector(drift.PolicyPersist)
+
+		_, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs.persisted).To(Equal(map[string][]string{
+			"notify-keyspace-events":            {`""`},
+			"latency-tracking-info-percentiles": {"50 99.9"},
+		}))
+	})
+
+	It("reapplies directives tenants cannot set when the policy is persist", func() {
+		writeConf("masteruser replica\nenable-debug-command no\n")
+		live = map[string]string{
+			"masteruser":           "tenant",
+			"enable-debug-command": "yes",
+		}
+		newDetector(drift.PolicyPersist)
+
+		_, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs.persisted).To(BeEmpty())
+		Expect(setConfigs).To(ConsistOf(
+			[]interface{}{"CONFIG", "SET", "masteruser", "replica"},
+			[]interface{}{"CONFIG", "SET", "enable-debug-command", "no"},
+		))
+	})
+
+	It("persists snapshot rules one per line", func() {
+		live["save"] = "3600 1 60 10000"
+		newDetector(drift.PolicyPersist)
+
+		_, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs.persisted["save"]).To(Equal([]string{"3600 1", "60 10000"}))
+	})
+
+	It("treats quoted and empty values alike", func() {
+		writeConf("save \"\"\nnotify-keyspace-events \"\"\n")
+		live["save"] = ""
+		live["notify-keyspace-events"] = ""
+
+		differences, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differences).To(BeEmpty())
+	})
+
+	It("compares the values redis-server reads from included files", func() {
+		included := filepath.Join(configs.root, "tuning.conf")
+		Expect(os.WriteFile(included, []byte("maxmemory-policy allkeys-lru\n"), 0644)).To(Succeed())
+		writeConf("maxmemory-policy noeviction\ninclude " + included + "\n")
+		live["maxmemory-policy"] = "allkeys-lru"
+
+		differences, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differences).To(BeEmpty())
+	})
+
+	It("returns an error when CONFIG is disabled", func() {
+		writeConf("rename-command CONFIG \"\"\n")
+
+		_, err := detector.Check(instance)
+		Expect(err).To(MatchError("CONFIG is disabled on this instance"))
+	})
+
+	It("skips instances that cannot be reached", func() {
+		detector.Connect = func(*redis.Instance, map[string]string) (client.Client, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		differences, err := detector.Check(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differences).To(BeEmpty())
+	})
+})
@@ -0,0 +1,167 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	Provisioned   = "provisioned"
+	Deprovisioned = "deprovisioned"
+	Bound         = "bound"
+	Unbound       = "unbound"
+	Crashed       = "crashed"
+	Restarted     = "restarted"
+	Failed        = "failed"
+	Suspended     = "suspended"
+	Resumed       = "resumed"
+	CheckTimedOut = "check-timed-out"
+)
+
+const (
+	ActorBroker         = "broker"
+	ActorProcessMonitor = "process-monitor"
+	ActorAdmin          = "admin"
+)
+
+type Event struct {
+	Time       time.Time         `json:"time"`
+	InstanceID string            `json:"instance_id"`
+	Type       string            `json:"event"`
+	Actor      string            `json:"actor"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+//go:generate counterfeiter -o fakes/fake_recorder.go . Recorder
+type Recorder interface {
+	Record(instanceID, eventType, actor string, data map[string]string)
+}
+
+// Journal is an append-only log of lifecycle events with one file per
+// instance. Journals are kept outside the instance directories so that they
+// survive deprovisioning, and every event is a single JSON line so that the
+// broker and the process monitor can append to the same file.
+type Journal struct {
+	Directory string
+	Logger    lager.Logger
+	Now       func() time.Time
+
+	mutex sync.Mutex
+}
+
+func NewJournal(directory string, logger lager.Logger) *Journal {
+	return &Journal{
+		Directory: directory,
+		Logger:    logger,
+		Now:       time.Now,
+	}
+}
+
+// Record appends an event to the journal of an instance. Failing to record an
+// event must never fail the operation that caused it, so errors are only
+// logged.
+func (journal *Journal) Record(instanceID, eventType, actor string, data map[string]string) {
+	event := Event{
+		Time:       journal.Now().UTC(),
+		InstanceID: instanceID,
+		Type:       eventType,
+		Actor:      actor,
+		Data:       data,
+	}
+
+	err := journal.append(event)
+	if err != nil {
+		journal.Logger.Error("record-event", err, lager.Data{
+			"instance_id": instanceID,
+			"event":       eventType,
+		})
+	}
+}
+
+func (journal *Journal) Events(instanceID string) ([]Event, error) {
+	path, err := journal.path(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []Event{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// a torn final line from a crash mid-write is skipped rather than
+			// making the rest of the journal unreadable
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+func (journal *Journal) append(event Event) error {
+	path, err := journal.path(event.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	err = os.MkdirAll(journal.Directory, 0750)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// the broker and the process monitor append to the same files, so the
+	// tail is only repaired while no one else is appending
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	err = utils.TruncateTornLine(file)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(line)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func (journal *Journal) path(instanceID string) (string, error) {
+	return paths.NewResolver(journal.Directory).Resolve(instanceID + ".jsonl")
+}
@@ -0,0 +1,139 @@
+package events_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		eventDir string
+		logger   *lagertest.TestLogger
+		journal  *events.Journal
+		now      time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		eventDir, err = os.MkdirTemp("", "events")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("events")
+		now = time.Date(2016, 3, 14, 15, 9, 26, 0, time.UTC)
+
+		journal = events.NewJournal(filepath.Join(eventDir, "journal"), logger)
+		journal.Now = func() time.Time { return now }
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(eventDir)).To(Succeed())
+	})
+
+	It("returns the recorded events of an instance in order", func() {
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, map[string]string{"plan_id": "shared"})
+		now = now.Add(time.Minute)
+		journal.Record("an-instance", events.Bound, "cloudfoundry:a-user", nil)
+
+		recorded, err := journal.Events("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(Equal([]events.Event{
+			{
+				Time:       time.Date(2016, 3, 14, 15, 9, 26, 0, time.UTC),
+				InstanceID: "an-instance",
+				Type:       events.Provisioned,
+				Actor:      events.ActorBroker,
+				Data:       map[string]string{"plan_id": "shared"},
+			},
+			{
+				Time:       time.Date(2016, 3, 14, 15, 10, 26, 0, time.UTC),
+				InstanceID: "an-instance",
+				Type:       events.Bound,
+				Actor:      "cloudfoundry:a-user",
+			},
+		}))
+	})
+
+	It("keeps the events of each instance separate", func() {
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+		journal.Record("another-instance", events.Crashed, events.ActorProcessMonitor, nil)
+
+		recorded, err := journal.Events("another-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveLen(1))
+		Expect(recorded[0].Type).To(Equal(events.Crashed))
+	})
+
+	It("appends to the events written by another journal", func() {
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+
+		other := events.NewJournal(journal.Directory, logger)
+		other.Record("an-instance", events.Restarted, events.ActorProcessMonitor, nil)
+
+		recorded, err := journal.Events("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveLen(2))
+		Expect(recorded[1].Type).To(Equal(events.Restarted))
+	})
+
+	It("skips lines that were only partially written", func() {
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+
+		file, err := os.OpenFile(filepath.Join(journal.Directory, "an-instance.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = file.WriteString(`{"time":"2016-03-14T15:`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		recorded, err := journal.Events("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveLen(1))
+	})
+
+	It("keeps the events recorded after a partially written line", func() {
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+
+		file, err := os.OpenFile(filepath.Join(journal.Directory, "an-instance.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = file.WriteString(`{"time":"2016-03-14T15:`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		journal.Record("an-instance", events.Bound, events.ActorBroker, nil)
+
+		recorded, err := journal.Events("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveLen(2))
+		Expect(recorded[1].Type).To(Equal(events.Bound))
+	})
+
+	It("returns a not exist error for instances without events", func() {
+		_, err := journal.Events("missing")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("refuses instance IDs that would leave the journal directory", func() {
+		journal.Record("../escaped", events.Provisioned, events.ActorBroker, nil)
+		Expect(logger).To(gbytes.Say("record-event"))
+		Expect(filepath.Join(eventDir, "escaped.jsonl")).NotTo(BeAnExistingFile())
+
+		_, err := journal.Events("../escaped")
+		Expect(err).To(MatchError(paths.ErrOutsideRoot))
+	})
+
+	It("logs events that cannot be recorded", func() {
+		Expect(os.WriteFile(journal.Directory, []byte{}, 0644)).To(Succeed())
+
+		journal.Record("an-instance", events.Provisioned, events.ActorBroker, nil)
+		Expect(logger).To(gbytes.Say("record-event"))
+	})
+})
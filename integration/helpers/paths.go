@@ -13,12 +13,14 @@ const TestDataDir = "/tmp/redis-data-dir"
 const TestLogDir = "/tmp/redis-log-dir"
 const TestConfigDir = "/tmp/redis-config-dir"
 const TestPidfileDir = "/tmp/pidfiles"
+const TestStateFile = "/tmp/redis-state.json"
 
 func ResetTestDirs() {
 	removeAndRecreateDir(TestDataDir)
 	removeAndRecreateDir(TestLogDir)
 	removeAndRecreateDir(TestConfigDir)
 	removeAndRecreateDir(TestPidfileDir)
+	removeStateFile(TestStateFile)
 }
 
 func CreateTestDirs() (string, string, string) {
@@ -62,6 +64,15 @@ func removeAndRecreateDir(path string) {
 	Ω(err).ShouldNot(HaveOccurred())
 }
 
+func removeStateFile(path string) {
+	for _, file := range []string{path, path + ".journal", path + ".lock"} {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	}
+}
+
 func AssetPath(filename string) string {
 	path, err := filepath.Abs(filepath.Join("assets", filename))
 	Ω(err).ShouldNot(HaveOccurred())
@@ -0,0 +1,119 @@
+package locks
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const globalLockName = "global"
+
+// Locks serializes changes to instances, both between goroutines of one
+// process and between the broker and the process monitor. Every lock is an
+// in-process mutex paired with an flock on a file in Directory; the kernel
+// drops the flock when a process dies, so a crashed broker never leaves an
+// instance locked.
+//
+// Callers that need the global lock and an instance lock must take the global
+// lock first.
+type Locks struct {
+	Directory string
+
+	mutex   sync.Mutex
+	mutexes map[string]*sync.Mutex
+}
+
+func New(directory string) *Locks {
+	return &Locks{
+		Directory: directory,
+		mutexes:   map[string]*sync.Mutex{},
+	}
+}
+
+// LockAll takes the lock that guards decisions about the set of instances as
+// a whole, such as whether the instance limit has been reached.
+func (locks *Locks) LockAll() (func(), error) {
+	unlock, _, err := locks.lock(globalLockName, true)
+	return unlock, err
+}
+
+func (locks *Locks) LockInstance(instanceID string) (func(), error) {
+	unlock, _, err := locks.lock(instanceLockName(instanceID), true)
+	return unlock, err
+}
+
+// TryLockInstance takes the lock of an instance only if nobody holds it.
+func (locks *Locks) TryLockInstance(instanceID string) (func(), bool, error) {
+	return locks.lock(instanceLockName(instanceID), false)
+}
+
+func (locks *Locks) lock(name string, wait bool) (func(), bool, error) {
+	mutex := locks.mutexFor(name)
+
+	if wait {
+		mutex.Lock()
+	} else if !mutex.TryLock() {
+		return nil, false, nil
+	}
+
+	file, err := locks.flock(name, wait)
+	if err == syscall.EWOULDBLOCK {
+		mutex.Unlock()
+		return nil, false, nil
+	}
+	if err != nil {
+		mutex.Unlock()
+		return nil, false, err
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+		mutex.Unlock()
+	}, true, nil
+}
+
+func (locks *Locks) flock(name string, wait bool) (*os.File, error) {
+	path := filepath.Join(locks.Directory, name+".lock")
+
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	err = syscall.Flock(int(file.Fd()), how)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (locks *Locks) mutexFor(name string) *sync.Mutex {
+	locks.mutex.Lock()
+	defer locks.mutex.Unlock()
+
+	mutex, ok := locks.mutexes[name]
+	if !ok {
+		mutex = &sync.Mutex{}
+		locks.mutexes[name] = mutex
+	}
+
+	return mutex
+}
+
+func instanceLockName(instanceID string) string {
+	return filepath.Join("instances", instanceID)
+}
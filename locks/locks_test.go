@@ -0,0 +1,135 @@
+package locks_test
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/locks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Locks", func() {
+	var (
+		lockDir string
+		lockSet *locks.Locks
+	)
+
+	BeforeEach(func() {
+		var err error
+		lockDir, err = os.MkdirTemp("", "locks")
+		Expect(err).NotTo(HaveOccurred())
+
+		lockSet = locks.New(lockDir)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(lockDir)).To(Succeed())
+	})
+
+	It("lets only one goroutine hold the lock of an instance at a time", func() {
+		var holders, maxHolders int32
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				unlock, err := lockSet.LockInstance("an-instance")
+				Expect(err).NotTo(HaveOccurred())
+				defer unlock()
+
+				current := atomic.AddInt32(&holders, 1)
+				if current > atomic.LoadInt32(&maxHolders) {
+					atomic.StoreInt32(&maxHolders, current)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+			}()
+		}
+		wg.Wait()
+
+		Expect(maxHolders).To(Equal(int32(1)))
+	})
+
+	It("does not block instances on each other", func() {
+		unlock, err := lockSet.LockInstance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		defer unlock()
+
+		_, acquired, err := lockSet.TryLockInstance("another-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+	})
+
+	Describe("TryLockInstance", func() {
+		It("does not take a lock that is held", func() {
+			unlock, err := lockSet.LockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, acquired, err := lockSet.TryLockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(acquired).To(BeFalse())
+
+			unlock()
+
+			unlockAgain, acquired, err := lockSet.TryLockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(acquired).To(BeTrue())
+			unlockAgain()
+		})
+	})
+
+	Context("when another process holds a lock", func() {
+		var otherProcess *locks.Locks
+
+		BeforeEach(func() {
+			otherProcess = locks.New(lockDir)
+		})
+
+		It("does not take the instance lock until it is released", func() {
+			unlock, err := otherProcess.LockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, acquired, err := lockSet.TryLockInstance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(acquired).To(BeFalse())
+
+			locked := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				unlockMine, err := lockSet.LockInstance("an-instance")
+				Expect(err).NotTo(HaveOccurred())
+				close(locked)
+				unlockMine()
+			}()
+
+			Consistently(locked, 50*time.Millisecond).ShouldNot(BeClosed())
+			unlock()
+			Eventually(locked).Should(BeClosed())
+		})
+
+		It("waits for the global lock", func() {
+			unlock, err := otherProcess.LockAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			locked := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				unlockMine, err := lockSet.LockAll()
+				Expect(err).NotTo(HaveOccurred())
+				close(locked)
+				unlockMine()
+			}()
+
+			Consistently(locked, 50*time.Millisecond).ShouldNot(BeClosed())
+			unlock()
+			Eventually(locked).Should(BeClosed())
+		})
+	})
+})
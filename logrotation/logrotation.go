@@ -0,0 +1,374 @@
+package logrotation
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	defaultInterval = time.Minute
+	bytesPerMB      = 1024 * 1024
+
+	// segmentTimeFormat sorts lexically in the order segments were rotated.
+	segmentTimeFormat = "20060102T150405.000Z"
+	compressedSuffix  = ".gz"
+	temporarySuffix   = ".tmp"
+)
+
+type InstanceLayout interface {
+	InstanceLogFilePath(instanceID string) string
+}
+
+// Rotator rotates the redis-server log of every shared instance once it grows
+// past MaxSize or gets older than MaxAge. Rotated segments are kept next to
+// the log as <log>.<time>.gz and are deleted, oldest first, once an instance's
+// segments take up more than InstanceRetention or the segments of all
+// instances take up more than TotalRetention.
+//
+// redis-server is deliberately not signalled to reopen its log. Every release
+// from 2.6 through 7.x opens the log file in append mode for each line it
+// writes and closes it again, and ignores SIGHUP, so renaming the log is
+// enough for redis-server to start a new one. A segment is compressed on the
+// pass after it was rotated, so that a line that was being written while the
+// log was renamed is not lost.
+type Rotator struct {
+	LogDirectory      string
+	Layout            InstanceLayout
+	MaxSize           int64
+	MaxAge            time.Duration
+	InstanceRetention int64
+	TotalRetention    int64
+	Logger            lager.Logger
+	Now               func() time.Time
+
+	// firstSeen stands in for the last rotation of logs that have never
+	// been rotated.
+	firstSeen map[string]time.Time
+}
+
+type segment struct {
+	path       string
+	size       int64
+	rotatedAt  time.Time
+	compressed bool
+}
+
+func NewRotator(config brokerconfig.ServiceConfiguration, layout InstanceLayout, logger lager.Logger) *Rotator {
+	return &Rotator{
+		LogDirectory:      config.InstanceLogDirectory,
+		Layout:            layout,
+		MaxSize:           int64(config.LogRotation.MaxSizeMB) * bytesPerMB,
+		MaxAge:            time.Duration(config.LogRotation.MaxAgeHours) * time.Hour,
+		InstanceRetention: int64(config.LogRotation.InstanceRetentionMB) * bytesPerMB,
+		TotalRetention:    int64(config.LogRotation.TotalRetentionMB) * bytesPerMB,
+		Logger:            logger,
+		Now:               time.Now,
+		firstSeen:         map[string]time.Time{},
+	}
+}
+
+// Interval returns how often the logs should be checked.
+func Interval(config brokerconfig.ServiceConfiguration) time.Duration {
+	if config.LogRotation.IntervalSeconds <= 0 {
+		return defaultInterval
+	}
+
+	return time.Duration(config.LogRotation.IntervalSeconds) * time.Second
+}
+
+// Enabled reports whether any rotation limit or retention budget is
+// configured. Retention budgets are enforced on every pass, so segments left
+// by earlier rotations are pruned even when logs are no longer rotated.
+func (rotator *Rotator) Enabled() bool {
+	return rotator.MaxSize > 0 || rotator.MaxAge > 0 || rotator.InstanceRetention > 0 || rotator.TotalRetention > 0
+}
+
+// Run rotates the logs every interval until stop is closed.
+func (rotator *Rotator) Run(interval time.Duration, stop <-chan struct{}) {
+	utils.Every(interval, stop, rotator.RotateAll)
+}
+
+// RotateAll rotates the log of every instance that has a log directory and
+// then enforces the total retention budget.
+func (rotator *Rotator) RotateAll() {
+	entries, err := ioutil.ReadDir(rotator.LogDirectory)
+	if err != nil {
+		rotator.Logger.Error("list-log-directories", err, lager.Data{
+			"log-directory": rotator.LogDirectory,
+		})
+		return
+	}
+
+	all := []segment{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		segments, err := rotator.rotate(entry.Name())
+		if err != nil {
+			rotator.Logger.Error("rotate-log", err, lager.Data{
+				"instance": entry.Name(),
+			})
+		}
+		all = append(all, segments...)
+	}
+
+	rotator.enforceBudget(all, rotator.TotalRetention)
+}
+
+// Rotate compresses the instance's previously rotated segment, rotates its
+// log if a limit has been reached and enforces the instance's retention
+// budget.
+func (rotator *Rotator) Rotate(instanceID string) error {
+	_, err := rotator.rotate(instanceID)
+	return err
+}
+
+// rotate returns the segments of the instance that are kept.
+func (rotator *Rotator) rotate(instanceID string) ([]segment, error) {
+	logPath := rotator.Layout.InstanceLogFilePath(instanceID)
+	if logPath == "" {
+		return nil, nil
+	}
+
+	segments, err := rotator.segments(logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range segments {
+		if s.compressed {
+			continue
+		}
+
+		compressed, err := compress(s)
+		if err != nil {
+			return segments, err
+		}
+		segments[i] = compressed
+	}
+
+	rotated, err := rotator.rotateLog(logPath, segments)
+	if err != nil {
+		return segments, err
+	}
+
+	if rotated != nil {
+		rotator.Logger.Info("rotated-log", lager.Data{
+			"instance": instanceID,
+			"segment":  rotated.path,
+			"size":     rotated.size,
+		})
+		segments = append(segments, *rotated)
+	}
+
+	return rotator.enforceBudget(segments, rotator.InstanceRetention), nil
+}
+
+func (rotator *Rotator) rotateLog(logPath string, segments []segment) (*segment, error) {
+	info, err := os.Stat(logPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := rotator.Now()
+	if info.Size() == 0 || !rotator.due(logPath, info.Size(), segments, now) {
+		return nil, nil
+	}
+
+	rotated := segment{
+		path:      logPath + "." + now.UTC().Format(segmentTimeFormat),
+		size:      info.Size(),
+		rotatedAt: now,
+	}
+
+	err = os.Rename(logPath, rotated.path)
+	if err != nil {
+		return nil, err
+	}
+
+	rotator.firstSeen[logPath] = now
+	return &rotated, nil
+}
+
+func (rotator *Rotator) due(logPath string, size int64, segments []segment, now time.Time) bool {
+	if rotator.MaxSize > 0 && size >= rotator.MaxSize {
+		return true
+	}
+
+	if rotator.MaxAge <= 0 {
+		return false
+	}
+
+	started, ok := rotator.firstSeen[logPath]
+	if len(segments) > 0 {
+		started, ok = segments[len(segments)-1].rotatedAt, true
+	}
+	if !ok {
+		rotator.firstSeen[logPath] = now
+		return false
+	}
+
+	return now.Sub(started) >= rotator.MaxAge
+}
+
+// segments returns the rotated segments of a log, oldest first.
+func (rotator *Rotator) segments(logPath string) ([]segment, error) {
+	entries, err := ioutil.ReadDir(filepath.Dir(logPath))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(logPath) + "."
+	segments := []segment{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, temporarySuffix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressedSuffix)
+		rotatedAt, err := time.Parse(segmentTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, segment{
+			path:       filepath.Join(filepath.Dir(logPath), name),
+			size:       entry.Size(),
+			rotatedAt:  rotatedAt,
+			compressed: strings.HasSuffix(name, compressedSuffix),
+		})
+	}
+
+	sortOldestFirst(segments)
+	return segments, nil
+}
+
+// enforceBudget deletes the oldest segments until the rest fit in budget, and
+// returns the segments that are kept. A budget of zero keeps everything.
+func (rotator *Rotator) enforceBudget(segments []segment, budget int64) []segment {
+	if budget <= 0 {
+		return segments
+	}
+
+	sortOldestFirst(segments)
+
+	var total int64
+	for _, s := range segments {
+		total += s.size
+	}
+
+	kept := segments
+	for len(kept) > 0 && total > budget {
+		oldest := kept[0]
+		err := os.Remove(oldest.path)
+		if err != nil && !os.IsNotExist(err) {
+			rotator.Logger.Error("remove-log-segment", err, lager.Data{
+				"segment": oldest.path,
+			})
+			break
+		}
+
+		rotator.Logger.Info("removed-log-segment", lager.Data{
+			"segment": oldest.path,
+			"size":    oldest.size,
+		})
+		total -= oldest.size
+		kept = kept[1:]
+	}
+
+	return kept
+}
+
+// compress gzips a segment next to it and removes the original. The
+// compressed segment keeps the owner of the original, which is the instance's
+// user when instances run as their own user.
+func compress(s segment) (segment, error) {
+	source, err := os.Open(s.path)
+	if err != nil {
+		return s, err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return s, err
+	}
+
+	compressedPath := s.path + compressedSuffix
+	temporaryPath := compressedPath + temporarySuffix
+
+	destination, err := os.OpenFile(temporaryPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return s, err
+	}
+	defer os.Remove(temporaryPath)
+
+	writer := gzip.NewWriter(destination)
+	_, err = io.Copy(writer, source)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = destination.Sync()
+	}
+	closeErr := destination.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return s, err
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		err = os.Lchown(temporaryPath, int(stat.Uid), int(stat.Gid))
+		if err != nil {
+			return s, err
+		}
+	}
+
+	err = os.Rename(temporaryPath, compressedPath)
+	if err != nil {
+		return s, err
+	}
+
+	err = os.Remove(s.path)
+	if err != nil {
+		return s, err
+	}
+
+	compressedInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		return s, err
+	}
+
+	return segment{
+		path:       compressedPath,
+		size:       compressedInfo.Size(),
+		rotatedAt:  s.rotatedAt,
+		compressed: true,
+	}, nil
+}
+
+func sortOldestFirst(segments []segment) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].rotatedAt.Before(segments[j].rotatedAt)
+	})
+}
@@ -0,0 +1,13 @@
+package logrotation_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLogRotation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Log Rotation Suite")
+}
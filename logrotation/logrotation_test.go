@@ -0,0 +1,246 @@
+package logrotation_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/logrotation"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type logLayout struct {
+	root string
+}
+
+func (layout logLayout) InstanceLogFilePath(instanceID string) string {
+	return filepath.Join(layout.root, instanceID, "redis-server.log")
+}
+
+var _ = Describe("Rotator", func() {
+	var (
+		logDir  string
+		now     time.Time
+		logger  *lagertest.TestLogger
+		rotator *logrotation.Rotator
+	)
+
+	logPath := func(instanceID string) string {
+		return filepath.Join(logDir, instanceID, "redis-server.log")
+	}
+
+	writeLog := func(instanceID string, size int) {
+		Expect(os.MkdirAll(filepath.Join(logDir, instanceID), 0755)).To(Succeed())
+		Expect(os.WriteFile(logPath(instanceID), []byte(strings.Repeat("x", size)), 0644)).To(Succeed())
+	}
+
+	segments := func(instanceID string) []string {
+		matches, err := filepath.Glob(logPath(instanceID) + ".*")
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, match := range matches {
+			names = append(names, filepath.Base(match))
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		var err error
+		logDir, err = os.MkdirTemp("", "logrotation")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, logDir)
+
+		now = time.Date(2026, 10, 19, 7, 52, 0, 0, time.UTC)
+		logger = lagertest.NewTestLogger("log-rotation")
+
+		rotator = logrotation.NewRotator(brokerconfig.ServiceConfiguration{
+			InstanceLogDirectory: logDir,
+		}, logLayout{root: logDir}, logger)
+		rotator.MaxSize = 100
+		rotator.Now = func() time.Time { return now }
+	})
+
+	It("is built from the log rotation settings", func() {
+		rotator = logrotation.NewRotator(brokerconfig.ServiceConfiguration{
+			LogRotation: brokerconfig.LogRotationConfiguration{
+				MaxSizeMB:           64,
+				MaxAgeHours:         24,
+				InstanceRetentionMB: 256,
+				TotalRetentionMB:    4096,
+			},
+		}, logLayout{}, logger)
+
+		Expect(rotator.Enabled()).To(BeTrue())
+		Expect(rotator.MaxSize).To(Equal(int64(64 * 1024 * 1024)))
+		Expect(rotator.MaxAge).To(Equal(24 * time.Hour))
+		Expect(rotator.InstanceRetention).To(Equal(int64(256 * 1024 * 1024)))
+		Expect(rotator.TotalRetention).To(Equal(int64(4096 * 1024 * 1024)))
+	})
+
+	It("is enabled with only a retention budget", func() {
+		rotator = logrotation.NewRotator(brokerconfig.ServiceConfiguration{
+			InstanceLogDirectory: logDir,
+			LogRotation:          brokerconfig.LogRotationConfiguration{InstanceRetentionMB: 1},
+		}, logLayout{root: logDir}, logger)
+		Expect(rotator.Enabled()).To(BeTrue())
+
+		writeLog("an-instance", 10)
+		Expect(os.WriteFile(logPath("an-instance")+".20261017T000000.000Z.gz", []byte(strings.Repeat("x", 1024*1024)), 0644)).To(Succeed())
+		Expect(os.WriteFile(logPath("an-instance")+".20261018T000000.000Z.gz", []byte(strings.Repeat("x", 100)), 0644)).To(Succeed())
+
+		rotator.RotateAll()
+
+		Expect(segments("an-instance")).To(ConsistOf("redis-server.log.20261018T000000.000Z.gz"))
+		Expect(logPath("an-instance")).To(BeAnExistingFile())
+	})
+
+	It("is disabled without a size or age limit or a retention budget", func() {
+		rotator = logrotation.NewRotator(brokerconfig.ServiceConfiguration{}, logLayout{}, logger)
+		Expect(rotator.Enabled()).To(BeFalse())
+		Expect(logrotation.Interval(brokerconfig.ServiceConfiguration{})).To(Equal(time.Minute))
+	})
+
+	It("leaves logs below the size limit alone", func() {
+		writeLog("an-instance", 99)
+
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+		Expect(segments("an-instance")).To(BeEmpty())
+	})
+
+	It("rotates logs that reach the size limit", func() {
+		writeLog("an-instance", 100)
+
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+
+		Expect(segments("an-instance")).To(ConsistOf("redis-server.log.20261019T075200.000Z"))
+		_, err := os.Stat(logPath("an-instance"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(logger).To(gbytes.Say("rotated-log"))
+	})
+
+	It("starts a new log for the next line without signalling redis-server", func() {
+		writeLog("an-instance", 100)
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+
+		// redis-server 2.6 through 7.x open the log for every line they write
+		appendLine := func(line string) {
+			file, err := os.OpenFile(logPath("an-instance"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			_, err = file.WriteString(line + "\n")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		appendLine("1:M 19 Oct 2026 07:52:01.000 * Background saving started")
+
+		contents, err := os.ReadFile(logPath("an-instance"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("1:M 19 Oct 2026 07:52:01.000 * Background saving started\n"))
+
+		segment, err := os.ReadFile(logPath("an-instance") + ".20261019T075200.000Z")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(segment)).To(Equal(strings.Repeat("x", 100)))
+	})
+
+	It("compresses a segment on the next pass", func() {
+		writeLog("an-instance", 100)
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+
+		now = now.Add(time.Minute)
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+
+		Expect(segments("an-instance")).To(ConsistOf("redis-server.log.20261019T075200.000Z.gz"))
+
+		file, err := os.Open(logPath("an-instance") + ".20261019T075200.000Z.gz")
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		reader, err := gzip.NewReader(file)
+		Expect(err).NotTo(HaveOccurred())
+		contents, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(strings.Repeat("x", 100)))
+	})
+
+	Context("when logs are rotated by age", func() {
+		BeforeEach(func() {
+			rotator.MaxSize = 0
+			rotator.MaxAge = time.Hour
+			writeLog("an-instance", 10)
+		})
+
+		It("rotates logs once they are older than the age limit", func() {
+			Expect(rotator.Rotate("an-instance")).To(Succeed())
+			Expect(segments("an-instance")).To(BeEmpty())
+
+			now = now.Add(time.Hour)
+			Expect(rotator.Rotate("an-instance")).To(Succeed())
+			Expect(segments("an-instance")).To(HaveLen(1))
+		})
+
+		It("measures the age from the last rotation", func() {
+			Expect(os.WriteFile(logPath("an-instance")+".20261019T065300.000Z.gz", []byte("old"), 0644)).To(Succeed())
+
+			Expect(rotator.Rotate("an-instance")).To(Succeed())
+			Expect(segments("an-instance")).To(HaveLen(1))
+
+			now = time.Date(2026, 10, 19, 7, 53, 0, 0, time.UTC)
+			Expect(rotator.Rotate("an-instance")).To(Succeed())
+			Expect(segments("an-instance")).To(HaveLen(2))
+		})
+
+		It("does not rotate empty logs", func() {
+			writeLog("an-instance", 0)
+			now = now.Add(2 * time.Hour)
+
+			Expect(rotator.Rotate("an-instance")).To(Succeed())
+			Expect(segments("an-instance")).To(BeEmpty())
+		})
+	})
+
+	It("removes the oldest segments of an instance that exceed its retention budget", func() {
+		rotator.InstanceRetention = 250
+		for i, stamp := range []string{"20261017T000000.000Z", "20261018T000000.000Z", "20261019T000000.000Z"} {
+			Expect(os.MkdirAll(filepath.Join(logDir, "an-instance"), 0755)).To(Succeed())
+			Expect(os.WriteFile(logPath("an-instance")+"."+stamp+".gz", []byte(strings.Repeat("x", 100+i)), 0644)).To(Succeed())
+		}
+
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+
+		Expect(segments("an-instance")).To(ConsistOf(
+			"redis-server.log.20261018T000000.000Z.gz",
+			"redis-server.log.20261019T000000.000Z.gz",
+		))
+		Expect(logger).To(gbytes.Say("removed-log-segment"))
+	})
+
+	It("removes the oldest segments of all instances that exceed the total retention budget", func() {
+		rotator.TotalRetention = 250
+		Expect(os.MkdirAll(filepath.Join(logDir, "an-instance"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(logDir, "another-instance"), 0755)).To(Succeed())
+		Expect(os.WriteFile(logPath("an-instance")+".20261017T000000.000Z.gz", []byte(strings.Repeat("x", 100)), 0644)).To(Succeed())
+		Expect(os.WriteFile(logPath("another-instance")+".20261018T000000.000Z.gz", []byte(strings.Repeat("x", 100)), 0644)).To(Succeed())
+		Expect(os.WriteFile(logPath("an-instance")+".20261019T000000.000Z.gz", []byte(strings.Repeat("x", 100)), 0644)).To(Succeed())
+
+		rotator.RotateAll()
+
+		Expect(segments("an-instance")).To(ConsistOf("redis-server.log.20261019T000000.000Z.gz"))
+		Expect(segments("another-instance")).To(ConsistOf("redis-server.log.20261018T000000.000Z.gz"))
+	})
+
+	It("ignores files that are not segments of the log", func() {
+		writeLog("an-instance", 10)
+		rotator.InstanceRetention = 1
+		Expect(os.WriteFile(logPath("an-instance")+".notes", []byte("keep me"), 0644)).To(Succeed())
+
+		Expect(rotator.Rotate("an-instance")).To(Succeed())
+		Expect(segments("an-instance")).To(ConsistOf("redis-server.log.notes"))
+	})
+})
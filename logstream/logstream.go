@@ -0,0 +1,209 @@
+package logstream
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+const (
+	defaultLines        = 100
+	maxLines            = 10000
+	defaultPollInterval = 250 * time.Millisecond
+)
+
+var errInvalidLines = errors.New("lines must be a non-negative number")
+
+type InstanceFinder interface {
+	FindByID(instanceID string) (*redis.Instance, error)
+}
+
+type LogLayout interface {
+	InstanceLogFilePath(instanceID string) string
+	InstanceConfigPath(instanceID string) string
+}
+
+// Handler lets developers read the redis-server log of their instance
+// without shell access to the VM. It is mounted by the broker underneath
+// /logs and serves
+//
+//	GET /logs/<instance-id>?lines=<n>&follow=true
+//
+// Requests are authenticated either with the broker's credentials or with the
+// instance's password, which developers get from their binding, as the basic
+// auth password. The last lines of the log are returned as plain text, or as
+// server-sent events that keep following the log when follow is set.
+type Handler struct {
+	Instances    InstanceFinder
+	Layout       LogLayout
+	Credentials  brokerconfig.AuthConfiguration
+	Logger       lager.Logger
+	PollInterval time.Duration
+}
+
+func NewHandler(instances InstanceFinder, layout LogLayout, credentials brokerconfig.AuthConfiguration, logger lager.Logger) *Handler {
+	return &Handler{
+		Instances:    instances,
+		Layout:       layout,
+		Credentials:  credentials,
+		Logger:       logger,
+		PollInterval: defaultPollInterval,
+	}
+}
+
+func (handler *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	instanceID := strings.Trim(req.URL.Path, "/")
+	if instanceID == "" || strings.Contains(instanceID, "/") {
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := broker.ValidateID("instance", instanceID)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// instances that do not exist are reported as unauthorized, so that
+	// instance IDs cannot be probed without credentials
+	instance, err := handler.Instances.FindByID(instanceID)
+	if err != nil && !os.IsNotExist(err) {
+		handler.Logger.Error("find-instance", err, lager.Data{"instance_id": instanceID})
+		http.Error(res, "failed to find instance", http.StatusInternalServerError)
+		return
+	}
+
+	if !handler.authorized(req, instance) {
+		res.Header().Set("WWW-Authenticate", `Basic realm="redis-instance-logs"`)
+		http.Error(res, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	if instance == nil {
+		http.Error(res, "instance does not exist", http.StatusNotFound)
+		return
+	}
+
+	lines, err := parseLines(req.URL.Query().Get("lines"))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log, err := openLog(handler.Layout.InstanceLogFilePath(instanceID))
+	if os.IsNotExist(err) {
+		http.Error(res, "instance has no log", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handler.Logger.Error("open-instance-log", err, lager.Data{"instance_id": instanceID})
+		http.Error(res, "failed to open instance log", http.StatusInternalServerError)
+		return
+	}
+	defer log.Close()
+
+	tail, err := log.tail(lines)
+	if err != nil {
+		handler.Logger.Error("read-instance-log", err, lager.Data{"instance_id": instanceID})
+		http.Error(res, "failed to read instance log", http.StatusInternalServerError)
+		return
+	}
+
+	redact := newRedactor(instance, handler.Layout.InstanceConfigPath(instanceID))
+
+	if req.URL.Query().Get("follow") != "true" {
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range tail {
+			io.WriteString(res, redact(line)+"\n")
+		}
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		http.Error(res, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	send := func(lines []string) {
+		for _, line := range lines {
+			io.WriteString(res, "data: "+redact(line)+"\n\n")
+		}
+		flusher.Flush()
+	}
+	send(tail)
+
+	ticker := time.NewTicker(handler.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		lines, err := log.follow()
+		if err != nil {
+			handler.Logger.Error("follow-instance-log", err, lager.Data{"instance_id": instanceID})
+			return
+		}
+
+		if len(lines) > 0 {
+			send(lines)
+		}
+	}
+}
+
+// authorized accepts the broker's credentials, or any user name with the
+// instance's password.
+func (handler *Handler) authorized(req *http.Request, instance *redis.Instance) bool {
+	if handler.Credentials.Authorized(req) {
+		return true
+	}
+
+	_, password, ok := req.BasicAuth()
+	if !ok || instance == nil || instance.Password == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(password), []byte(instance.Password)) == 1
+}
+
+func parseLines(value string) (int, error) {
+	if value == "" {
+		return defaultLines, nil
+	}
+
+	lines, err := strconv.Atoi(value)
+	if err != nil || lines < 0 {
+		return 0, errInvalidLines
+	}
+
+	if lines > maxLines {
+		return maxLines, nil
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,13 @@
+package logstream_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLogStream(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Log Stream Suite")
+}
@@ -0,0 +1,250 @@
+package logstream_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/logstream"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInstances struct {
+	root      string
+	instances map[string]*redis.Instance
+}
+
+func (fake *fakeInstances) FindByID(instanceID string) (*redis.Instance, error) {
+	instance, ok := fake.instances[instanceID]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: instanceID, Err: os.ErrNotExist}
+	}
+	return instance, nil
+}
+
+func (fake *fakeInstances) InstanceLogFilePath(instanceID string) string {
+	return filepath.Join(fake.root, instanceID, "redis-server.log")
+}
+
+func (fake *fakeInstances) InstanceConfigPath(instanceID string) string {
+	return filepath.Join(fake.root, instanceID, "redis.conf")
+}
+
+var _ = Describe("Instance log streaming", func() {
+	var (
+		logDir    string
+		instances *fakeInstances
+		handler   *logstream.Handler
+		server    *httptest.Server
+	)
+
+	logPath := func() string {
+		return filepath.Join(logDir, "an-instance", "redis-server.log")
+	}
+
+	appendLog := func(contents string) {
+		file, err := os.OpenFile(logPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		_, err = file.WriteString(contents)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	get := func(path, username, password string) *http.Response {
+		request, err := http.NewRequest("GET", server.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth(username, password)
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		return response
+	}
+
+	body := func(response *http.Response) string {
+		defer response.Body.Close()
+		contents, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		var err error
+		logDir, err = os.MkdirTemp("", "logstream")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, logDir)
+		Expect(os.MkdirAll(filepath.Join(logDir, "an-instance"), 0755)).To(Succeed())
+
+		instances = &fakeInstances{
+			root: logDir,
+			instances: map[string]*redis.Instance{
+				"an-instance": {ID: "an-instance", Password: "instance-secret"},
+			},
+		}
+
+		handler = logstream.NewHandler(
+			instances,
+			instances,
+			brokerconfig.AuthConfiguration{Username: "admin", Password: "secret"},
+			lagertest.NewTestLogger("logstream"),
+		)
+		handler.PollInterval = 10 * time.Millisecond
+
+		server = httptest.NewServer(handler)
+		DeferCleanup(server.Close)
+
+		appendLog("1:M 19 Oct 2026 07:52:00.000 * Ready to accept connections\n")
+		appendLog("1:M 19 Oct 2026 07:52:01.000 * Background saving started\n")
+		appendLog("1:M 19 Oct 2026 07:52:02.000 * Background saving terminated with success\n")
+	})
+
+	It("returns the end of the instance's log to the instance's users", func() {
+		response := get("/an-instance?lines=2", "", "instance-secret")
+
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(body(response)).To(Equal(
+			"1:M 19 Oct 2026 07:52:01.000 * Background saving started\n" +
+				"1:M 19 Oct 2026 07:52:02.000 * Background saving terminated with success\n",
+		))
+	})
+
+	It("returns the log to operators", func() {
+		response := get("/an-instance", "admin", "secret")
+
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(body(response)).To(ContainSubstring("Ready to accept connections"))
+	})
+
+	It("rejects other credentials", func() {
+		response := get("/an-instance", "admin", "instance-secret-of-another-instance")
+		Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("does not reveal whether an instance exists without credentials", func() {
+		response := get("/missing-instance", "", "guess")
+		Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		response = get("/missing-instance", "admin", "secret")
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects invalid instance IDs", func() {
+		response := get("/..", "admin", "secret")
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects an invalid number of lines", func() {
+		response := get("/an-instance?lines=-1", "admin", "secret")
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("redacts secrets", func() {
+		appendLog(">>> 'requirepass \"instance-secret\"'\n")
+		appendLog(">>> 'masterauth other-secret'\n")
+		appendLog("AUTH instance-secret failed\n")
+
+		contents := body(get("/an-instance?lines=3", "admin", "secret"))
+
+		Expect(contents).NotTo(ContainSubstring("instance-secret"))
+		Expect(contents).NotTo(ContainSubstring("other-secret"))
+		Expect(contents).To(ContainSubstring("requirepass [REDACTED]"))
+		Expect(contents).To(ContainSubstring("masterauth [REDACTED]"))
+	})
+
+	It("redacts the passwords of ACL users and the names of renamed commands", func() {
+		Expect(os.WriteFile(filepath.Join(logDir, "an-instance", "redis.conf"), []byte(
+			"rename-command CONFIG config-alias-123\n",
+		), 0640)).To(Succeed())
+		appendLog(">>> 'user alice on >acl-secret #acl-secret-hash ~cache:* +get'\n")
+		appendLog("1:M 19 Oct 2026 07:52:03.000 # unknown command 'config-alias-123'\n")
+
+		contents := body(get("/an-instance?lines=2", "admin", "secret"))
+
+		Expect(contents).NotTo(ContainSubstring("acl-secret"))
+		Expect(contents).NotTo(ContainSubstring("config-alias-123"))
+		Expect(contents).To(ContainSubstring("user alice on >[REDACTED] #[REDACTED] ~cache:* +get"))
+	})
+
+	It("does not follow a log that was replaced by a symlink", func() {
+		secretPath := filepath.Join(logDir, "not-a-log")
+		Expect(os.WriteFile(secretPath, []byte("someone else's secret\n"), 0600)).To(Succeed())
+		Expect(os.Remove(logPath())).To(Succeed())
+		Expect(os.Symlink(secretPath, logPath())).To(Succeed())
+
+		response := get("/an-instance", "admin", "secret")
+		Expect(response.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(body(response)).NotTo(ContainSubstring("secret\n"))
+	})
+
+	Context("when following the log", func() {
+		var (
+			cancel context.CancelFunc
+			events *bufio.Reader
+		)
+
+		nextEvent := func() string {
+			line, err := events.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			blank, err := events.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blank).To(Equal("\n"))
+			return line
+		}
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			DeferCleanup(func() { cancel() })
+
+			request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/an-instance?lines=1&follow=true", nil)
+			Expect(err).NotTo(HaveOccurred())
+			request.SetBasicAuth("", "instance-secret")
+
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(response.Body.Close)
+
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+			events = bufio.NewReader(response.Body)
+		})
+
+		It("sends new lines as server-sent events", func() {
+			Expect(nextEvent()).To(Equal("data: 1:M 19 Oct 2026 07:52:02.000 * Background saving terminated with success\n"))
+
+			appendLog("1:M 19 Oct 2026 07:53:00.000 * DB saved on disk\n")
+			Expect(nextEvent()).To(Equal("data: 1:M 19 Oct 2026 07:53:00.000 * DB saved on disk\n"))
+		})
+
+		It("keeps following the log after it has been rotated", func() {
+			nextEvent()
+
+			appendLog("1:M 19 Oct 2026 07:53:00.000 * last line before rotation\n")
+			Expect(nextEvent()).To(ContainSubstring("last line before rotation"))
+
+			Expect(os.Rename(logPath(), logPath()+".20261019T075300.000Z")).To(Succeed())
+			appendLog("1:M 19 Oct 2026 07:53:01.000 * first line after rotation\n")
+
+			Expect(nextEvent()).To(ContainSubstring("first line after rotation"))
+		})
+
+		It("redacts the lines it sends", func() {
+			nextEvent()
+
+			appendLog("AUTH instance-secret\n")
+			Expect(nextEvent()).To(Equal("data: AUTH [REDACTED]\n"))
+
+			appendLog(">>> 'user alice on >acl-secret ~cache:* +get'\n")
+			Expect(nextEvent()).To(Equal("data: >>> 'user alice on >[REDACTED] ~cache:* +get'\n"))
+		})
+	})
+})
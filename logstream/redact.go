@@ -0,0 +1,15 @@
+package logstream
+
+import (
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// newRedactor returns a function that removes the instance's password, the
+// names of its renamed commands and the passwords of redis.conf directives
+// and ACL users from a log line. An instance whose config cannot be read
+// still has its password and directives redacted.
+func newRedactor(instance *redis.Instance, configPath string) func(string) string {
+	conf, _ := redisconf.LoadWithIncludes(configPath)
+	return redisconf.NewRedactor(conf, instance.Password)
+}
@@ -0,0 +1,207 @@
+package logstream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// maxTailBytes bounds how much of the end of a log is read to find its last
+// lines.
+const maxTailBytes = 1024 * 1024
+
+// logFile reads an instance's log and keeps reading it as it grows. The log
+// directory belongs to the instance's user when instances run as their own
+// user, so symlinks are never followed: a redis-server could otherwise point
+// its log at any file the broker can read.
+type logFile struct {
+	path    string
+	file    *os.File
+	offset  int64
+	partial []byte
+}
+
+func openLog(path string) (*logFile, error) {
+	file, err := openNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logFile{path: path, file: file}, nil
+}
+
+func openNoFollow(path string) (*os.File, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	return file, nil
+}
+
+// Tail returns the last n lines of the log at path. Like the handler, it
+// refuses to follow symlinks.
+func Tail(path string, n int) ([]string, error) {
+	log, err := openLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	return log.tail(n)
+}
+
+// tail returns the last n complete lines of the log and positions the log
+// after them.
+func (log *logFile) tail(n int) ([]string, error) {
+	info, err := log.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	start := info.Size() - maxTailBytes
+	if start < 0 {
+		start = 0
+	}
+
+	buffer := make([]byte, info.Size()-start)
+	_, err = log.file.ReadAt(buffer, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// a read that starts in the middle of the log starts in the middle of
+	// a line
+	if start > 0 {
+		if newline := bytes.IndexByte(buffer, '\n'); newline >= 0 {
+			buffer = buffer[newline+1:]
+		}
+	}
+
+	lines, partial := splitLines(buffer)
+	log.offset = info.Size() - int64(len(partial))
+
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return lines, nil
+}
+
+// follow returns the lines written since the last read. When the log has
+// been rotated, the rest of the rotated log is read before switching to the
+// new one.
+func (log *logFile) follow() ([]string, error) {
+	lines, err := log.readNew()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := os.Lstat(log.path)
+	if os.IsNotExist(err) {
+		return lines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	open, err := log.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if os.SameFile(current, open) {
+		return lines, nil
+	}
+
+	next, err := openNoFollow(log.path)
+	if os.IsNotExist(err) {
+		return lines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(log.partial) > 0 {
+		lines = append(lines, string(log.partial))
+	}
+
+	log.file.Close()
+	log.file = next
+	log.offset = 0
+	log.partial = nil
+
+	more, err := log.readNew()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lines, more...), nil
+}
+
+func (log *logFile) readNew() ([]string, error) {
+	info, err := log.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// the log was truncated
+	if info.Size() < log.offset {
+		log.offset = 0
+		log.partial = nil
+	}
+
+	if info.Size() == log.offset {
+		return nil, nil
+	}
+
+	buffer := make([]byte, info.Size()-log.offset)
+	read, err := log.file.ReadAt(buffer, log.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	log.offset += int64(read)
+
+	lines, partial := splitLines(append(log.partial, buffer[:read]...))
+	log.partial = partial
+
+	return lines, nil
+}
+
+func (log *logFile) Close() error {
+	return log.file.Close()
+}
+
+// splitLines returns the complete lines in buffer and what is left after the
+// last newline.
+func splitLines(buffer []byte) ([]string, []byte) {
+	end := bytes.LastIndexByte(buffer, '\n')
+	if end < 0 {
+		return nil, append([]byte(nil), buffer...)
+	}
+
+	lines := strings.Split(string(buffer[:end]), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines, append([]byte(nil), buffer[end+1:]...)
+}
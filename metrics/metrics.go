@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	defaultInterval   = 30 * time.Second
+	scrapeConcurrency = 8
+)
+
+type InstanceLister interface {
+	AllInstances() ([]*redis.Instance, []error)
+	InstanceConfigPath(instanceID string) string
+}
+
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	sample func(info map[string]string) (float64, bool)
+}
+
+// metrics are exported for every instance that could be scraped, labelled
+// with its instance_id and plan.
+var metrics = []metric{
+	{"redis_memory_used_bytes", "Bytes allocated by redis-server.", "gauge", field("used_memory")},
+	{"redis_instantaneous_ops_per_second", "Commands processed per second.", "gauge", field("instantaneous_ops_per_sec")},
+	{"redis_keyspace_hits_total", "Successful key lookups.", "counter", field("keyspace_hits")},
+	{"redis_keyspace_misses_total", "Failed key lookups.", "counter", field("keyspace_misses")},
+	{"redis_evicted_keys_total", "Keys evicted because of the maxmemory limit.", "counter", field("evicted_keys")},
+	{"redis_expired_keys_total", "Keys removed because they expired.", "counter", field("expired_keys")},
+	{"redis_connected_clients", "Client connections, excluding replicas.", "gauge", field("connected_clients")},
+	{"redis_rdb_changes_since_last_save", "Changes since the last RDB snapshot.", "gauge", field("rdb_changes_since_last_save")},
+	{"redis_rdb_last_save_timestamp_seconds", "Time of the last successful RDB snapshot.", "gauge", field("rdb_last_save_time")},
+	{"redis_rdb_last_bgsave_success", "Whether the last RDB snapshot succeeded.", "gauge", status("rdb_last_bgsave_status")},
+	{"redis_aof_enabled", "Whether the append only file is enabled.", "gauge", field("aof_enabled")},
+	{"redis_aof_last_write_success", "Whether the last write to the append only file succeeded.", "gauge", status("aof_last_write_status")},
+}
+
+// Exporter periodically reads INFO from every shared instance and serves
+// what it read in the Prometheus text format, so that platform dashboards
+// can show the health of each tenant's instance without access to the VM.
+// It is mounted by the broker at /metrics and is protected by the broker's
+// basic auth credentials.
+//
+// Instances are scraped in the background rather than on every request, so
+// that scraping /metrics often does not put load on the instances.
+type Exporter struct {
+	Instances   InstanceLister
+	Connect     redis.Connector
+	Plan        string
+	Credentials brokerconfig.AuthConfiguration
+	Logger      lager.Logger
+
+	mutex   sync.RWMutex
+	samples []sample
+}
+
+// sample is what was read from one instance; info is nil when the instance
+// could not be scraped.
+type sample struct {
+	instanceID string
+	info       map[string]string
+}
+
+func NewExporter(instances InstanceLister, credentials brokerconfig.AuthConfiguration, logger lager.Logger) *Exporter {
+	return &Exporter{
+		Instances:   instances,
+		Connect:     redis.Connect,
+		Plan:        broker.PlanNameShared,
+		Credentials: credentials,
+		Logger:      logger,
+	}
+}
+
+// Interval returns how often instances should be scraped.
+func Interval(config brokerconfig.ServiceConfiguration) time.Duration {
+	if config.MetricsIntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(config.MetricsIntervalSeconds) * time.Second
+}
+
+// Run scrapes every instance every interval until stop is closed.
+func (exporter *Exporter) Run(interval time.Duration, stop <-chan struct{}) {
+	utils.Every(interval, stop, exporter.Scrape)
+}
+
+// Scrape reads INFO from every instance and replaces the samples served by
+// the exporter.
+func (exporter *Exporter) Scrape() {
+	instances, errs := exporter.Instances.AllInstances()
+	for _, err := range errs {
+		exporter.Logger.Error("list-instances", err)
+	}
+
+	samples := make([]sample, len(instances))
+	slots := make(chan struct{}, scrapeConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i, instance := range instances {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, instance *redis.Instance) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			samples[i] = sample{
+				instanceID: instance.ID,
+				info:       exporter.scrape(instance),
+			}
+		}(i, instance)
+	}
+
+	wg.Wait()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].instanceID < samples[j].instanceID
+	})
+
+	exporter.mutex.Lock()
+	exporter.samples = samples
+	exporter.mutex.Unlock()
+}
+
+func (exporter *Exporter) scrape(instance *redis.Instance) map[string]string {
+	aliases := map[string]string{}
+	conf, err := redisconf.LoadWithIncludes(exporter.Instances.InstanceConfigPath(instance.ID))
+	if err == nil {
+		aliases = conf.CommandAliases()
+	}
+
+	redisClient, err := exporter.Connect(instance, aliases)
+	if err != nil {
+		exporter.Logger.Info("instance-unreachable", lager.Data{
+			"instance_id": instance.ID,
+			"error":       err.Error(),
+		})
+		return nil
+	}
+	defer redisClient.Disconnect()
+
+	info, err := redisClient.Info()
+	if err != nil {
+		exporter.Logger.Error("read-instance-info", err, lager.Data{"instance_id": instance.ID})
+		return nil
+	}
+
+	return info
+}
+
+func (exporter *Exporter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if !exporter.Credentials.Authorized(req) {
+		res.Header().Set("WWW-Authenticate", `Basic realm="redis-broker-metrics"`)
+		http.Error(res, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	exporter.mutex.RLock()
+	samples := exporter.samples
+	exporter.mutex.RUnlock()
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	exporter.write(res, samples)
+}
+
+func (exporter *Exporter) write(w io.Writer, samples []sample) {
+	writeHeader(w, "redis_up", "Whether INFO could be read from the instance.", "gauge")
+	for _, s := range samples {
+		up := 0.0
+		if s.info != nil {
+			up = 1
+		}
+		exporter.writeSample(w, "redis_up", s.instanceID, up)
+	}
+
+	for _, m := range metrics {
+		writeHeader(w, m.name, m.help, m.kind)
+		for _, s := range samples {
+			if s.info == nil {
+				continue
+			}
+			if value, ok := m.sample(s.info); ok {
+				exporter.writeSample(w, m.name, s.instanceID, value)
+			}
+		}
+	}
+
+	writeHeader(w, "redis_replication_role", "The replication role of the instance.", "gauge")
+	for _, s := range samples {
+		if role := s.info["role"]; role != "" {
+			exporter.writeSample(w, "redis_replication_role", s.instanceID, 1, "role", role)
+		}
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (exporter *Exporter) writeSample(w io.Writer, name, instanceID string, value float64, extraLabels ...string) {
+	labels := []string{"instance_id", instanceID, "plan", exporter.Plan}
+	labels = append(labels, extraLabels...)
+
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabelValue(labels[i+1])))
+	}
+
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func field(name string) func(map[string]string) (float64, bool) {
+	return func(info map[string]string) (float64, bool) {
+		value, err := strconv.ParseFloat(info[name], 64)
+		return value, err == nil
+	}
+}
+
+// status turns fields such as rdb_last_bgsave_status, which are "ok" or
+// "err", into 1 or 0.
+func status(name string) func(map[string]string) (float64, bool) {
+	return func(info map[string]string) (float64, bool) {
+		switch info[name] {
+		case "ok":
+			return 1, true
+		case "err":
+			return 0, true
+		}
+		return 0, false
+	}
+}
@@ -0,0 +1,188 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/metrics"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInstances struct {
+	root      string
+	instances []*redis.Instance
+}
+
+func (fake *fakeInstances) AllInstances() ([]*redis.Instance, []error) {
+	return fake.instances, nil
+}
+
+func (fake *fakeInstances) InstanceConfigPath(instanceID string) string {
+	return filepath.Join(fake.root, instanceID, "redis.conf")
+}
+
+var _ = Describe("Exporter", func() {
+	var (
+		instances *fakeInstances
+		infos     map[string]map[string]string
+		aliases   map[string]map[string]string
+		mutex     sync.Mutex
+		exporter  *metrics.Exporter
+	)
+
+	scrape := func(username, password string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "http://localhost/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth(username, password)
+		exporter.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		root, err := os.MkdirTemp("", "metrics")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		instances = &fakeInstances{
+			root: root,
+			instances: []*redis.Instance{
+				{ID: "instance-b", Port: 7001, Password: "b-secret"},
+				{ID: "instance-a", Port: 7000, Password: "a-secret"},
+			},
+		}
+
+		infos = map[string]map[string]string{
+			"instance-a": {
+				"used_memory":                 "1048576",
+				"instantaneous_ops_per_sec":   "42",
+				"keyspace_hits":               "100",
+				"keyspace_misses":             "7",
+				"evicted_keys":                "3",
+				"expired_keys":                "11",
+				"connected_clients":           "5",
+				"rdb_changes_since_last_save": "9",
+				"rdb_last_save_time":          "1792396320",
+				"rdb_last_bgsave_status":      "ok",
+				"aof_enabled":                 "1",
+				"aof_last_write_status":       "err",
+				"role":                        "master",
+			},
+		}
+		aliases = map[string]map[string]string{}
+
+		exporter = metrics.NewExporter(instances, brokerconfig.AuthConfiguration{
+			Username: "admin",
+			Password: "secret",
+		}, lagertest.NewTestLogger("metrics"))
+		exporter.Connect = func(instance *redis.Instance, instanceAliases map[string]string) (client.Client, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			aliases[instance.ID] = instanceAliases
+			info, ok := infos[instance.ID]
+			if !ok {
+				return nil, errors.New("connection refused")
+			}
+
+			fakeClient := new(fakes.FakeClient)
+			fakeClient.InfoReturns(info, nil)
+			return fakeClient, nil
+		}
+	})
+
+	It("exports the health of every instance labelled with its instance ID and plan", func() {
+		exporter.Scrape()
+		response := scrape("admin", "secret")
+
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+
+		body := response.Body.String()
+		Expect(body).To(ContainSubstring("# TYPE redis_keyspace_hits_total counter\n"))
+		Expect(body).To(ContainSubstring(`redis_memory_used_bytes{instance_id="instance-a",plan="shared-vm"} 1.048576e+06` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_instantaneous_ops_per_second{instance_id="instance-a",plan="shared-vm"} 42` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_keyspace_hits_total{instance_id="instance-a",plan="shared-vm"} 100` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_keyspace_misses_total{instance_id="instance-a",plan="shared-vm"} 7` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_evicted_keys_total{instance_id="instance-a",plan="shared-vm"} 3` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_expired_keys_total{instance_id="instance-a",plan="shared-vm"} 11` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_connected_clients{instance_id="instance-a",plan="shared-vm"} 5` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_rdb_last_bgsave_success{instance_id="instance-a",plan="shared-vm"} 1` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_aof_enabled{instance_id="instance-a",plan="shared-vm"} 1` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_aof_last_write_success{instance_id="instance-a",plan="shared-vm"} 0` + "\n"))
+		Expect(body).To(ContainSubstring(`redis_replication_role{instance_id="instance-a",plan="shared-vm",role="master"} 1` + "\n"))
+	})
+
+	It("reports instances that cannot be scraped as down", func() {
+		exporter.Scrape()
+		body := scrape("admin", "secret").Body.String()
+
+		Expect(body).To(ContainSubstring(
+			`redis_up{instance_id="instance-a",plan="shared-vm"} 1` + "\n" +
+				`redis_up{instance_id="instance-b",plan="shared-vm"} 0` + "\n",
+		))
+		Expect(body).NotTo(ContainSubstring(`redis_connected_clients{instance_id="instance-b"`))
+	})
+
+	It("does not export the instances' passwords", func() {
+		exporter.Scrape()
+		body := scrape("admin", "secret").Body.String()
+
+		Expect(body).NotTo(ContainSubstring("a-secret"))
+		Expect(body).NotTo(ContainSubstring("b-secret"))
+	})
+
+	It("connects using the commands renamed in the instance's config", func() {
+		Expect(os.MkdirAll(filepath.Join(instances.root, "instance-a"), 0755)).To(Succeed())
+		Expect(os.WriteFile(instances.InstanceConfigPath("instance-a"), []byte("rename-command INFO info-alias\n"), 0644)).To(Succeed())
+
+		exporter.Scrape()
+
+		Expect(aliases["instance-a"]).To(Equal(map[string]string{"INFO": "info-alias"}))
+		Expect(aliases["instance-b"]).To(BeEmpty())
+	})
+
+	It("exports nothing before the first scrape", func() {
+		body := scrape("admin", "secret").Body.String()
+		Expect(body).NotTo(ContainSubstring("instance_id"))
+	})
+
+	It("rejects requests without the broker credentials", func() {
+		exporter.Scrape()
+		Expect(scrape("admin", "wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("scrapes until it is stopped", func() {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			exporter.Run(10*time.Millisecond, stop)
+			close(done)
+		}()
+
+		Eventually(func() string {
+			return scrape("admin", "secret").Body.String()
+		}).Should(ContainSubstring(`redis_up{instance_id="instance-a",plan="shared-vm"} 1`))
+
+		close(stop)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("scrapes every 30 seconds by default", func() {
+		Expect(metrics.Interval(brokerconfig.ServiceConfiguration{})).To(Equal(30 * time.Second))
+		Expect(metrics.Interval(brokerconfig.ServiceConfiguration{MetricsIntervalSeconds: 15})).To(Equal(15 * time.Second))
+	})
+})
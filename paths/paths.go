@@ -0,0 +1,49 @@
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var ErrOutsideRoot = errors.New("path leaves its root directory")
+
+// Resolver builds paths below a root directory from names that may have come
+// from outside the broker, such as instance IDs. It refuses any name that
+// would resolve to the root itself or to anywhere outside of it.
+type Resolver struct {
+	Root string
+}
+
+func NewResolver(root string) Resolver {
+	return Resolver{Root: root}
+}
+
+// Resolve joins names onto the root. Each name must be a single path
+// component.
+func (resolver Resolver) Resolve(names ...string) (string, error) {
+	if len(names) == 0 {
+		return "", invalidPath(resolver.Root, "")
+	}
+
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, 0) {
+			return "", invalidPath(resolver.Root, name)
+		}
+	}
+
+	root := filepath.Clean(resolver.Root)
+	resolved := filepath.Join(append([]string{root}, names...)...)
+
+	relative, err := filepath.Rel(root, resolved)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", invalidPath(resolver.Root, filepath.Join(names...))
+	}
+
+	return resolved, nil
+}
+
+func invalidPath(root, name string) error {
+	return fmt.Errorf("%w: %q in %s", ErrOutsideRoot, name, root)
+}
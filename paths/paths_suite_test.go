@@ -0,0 +1,13 @@
+package paths_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Paths Suite")
+}
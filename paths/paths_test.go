@@ -0,0 +1,38 @@
+package paths_test
+
+import (
+	"errors"
+
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolver", func() {
+	resolver := paths.NewResolver("/var/vcap/store/redis/")
+
+	It("joins names onto the root", func() {
+		Expect(resolver.Resolve("an-instance")).To(Equal("/var/vcap/store/redis/an-instance"))
+		Expect(resolver.Resolve("an-instance", "db")).To(Equal("/var/vcap/store/redis/an-instance/db"))
+		Expect(resolver.Resolve("an-instance.pid")).To(Equal("/var/vcap/store/redis/an-instance.pid"))
+	})
+
+	DescribeTable("refuses names that leave the root",
+		func(names ...string) {
+			resolved, err := resolver.Resolve(names...)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, paths.ErrOutsideRoot)).To(BeTrue())
+			Expect(resolved).To(BeEmpty())
+		},
+		Entry("no name"),
+		Entry("an empty name", ""),
+		Entry("the current directory", "."),
+		Entry("the parent directory", ".."),
+		Entry("a traversal", "../../etc"),
+		Entry("a nested name", "an-instance/db"),
+		Entry("an absolute name", "/etc"),
+		Entry("a traversal after a valid name", "an-instance", ".."),
+		Entry("a nul byte", "an-instance\x00"),
+	)
+})
@@ -0,0 +1,114 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const redisServerCommand = "redis-server"
+
+var ErrUnexpectedProcess = errors.New("process is not the expected redis-server")
+
+// Identity describes the redis-server that an instance's pidfile should point
+// at. A StartTime of zero is not checked.
+type Identity struct {
+	ConfigPath string
+	DataDir    string
+	StartTime  uint64
+}
+
+// Verify checks in /proc that pid is a redis-server that was started for the
+// expected instance, so that a pidfile left behind by a reboot or a reused PID
+// is not mistaken for the instance. Redis rewrites its process title, so a
+// server whose command line no longer names its config file is recognised by
+// its working directory, which redis changes to its data directory.
+func (checker *ProcessChecker) Verify(pid int, expected Identity) error {
+	comm, err := ioutil.ReadFile(checker.procPath(pid, "comm"))
+	if err != nil {
+		return err
+	}
+
+	cmdline, err := ioutil.ReadFile(checker.procPath(pid, "cmdline"))
+	if err != nil {
+		return err
+	}
+
+	args := strings.FieldsFunc(string(cmdline), func(r rune) bool { return r == 0 || r == ' ' })
+
+	if strings.TrimSpace(string(comm)) != redisServerCommand && (len(args) == 0 || filepath.Base(args[0]) != redisServerCommand) {
+		return fmt.Errorf("%w: pid %d is %q", ErrUnexpectedProcess, pid, strings.TrimSpace(string(comm)))
+	}
+
+	if !containsArg(args, expected.ConfigPath) {
+		cwd, err := os.Readlink(checker.procPath(pid, "cwd"))
+		if err != nil || filepath.Clean(cwd) != filepath.Clean(expected.DataDir) {
+			return fmt.Errorf("%w: pid %d was not started with %s", ErrUnexpectedProcess, pid, expected.ConfigPath)
+		}
+	}
+
+	if expected.StartTime == 0 {
+		return nil
+	}
+
+	startTime, err := checker.StartTime(pid)
+	if err != nil {
+		return err
+	}
+
+	if startTime != expected.StartTime {
+		return fmt.Errorf("%w: pid %d started at %d, not %d", ErrUnexpectedProcess, pid, startTime, expected.StartTime)
+	}
+
+	return nil
+}
+
+// StartTime returns when a process started, in clock ticks since boot. Together
+// with the PID it identifies a process for as long as the machine is up.
+func (checker *ProcessChecker) StartTime(pid int) (uint64, error) {
+	stat, err := ioutil.ReadFile(checker.procPath(pid, "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	// the command name in the second field may contain spaces and parentheses
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	// starttime is the 22nd field, and the 20th after the command name
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+func (checker *ProcessChecker) procPath(pid int, name string) string {
+	root := checker.ProcRoot
+	if root == "" {
+		root = "/proc"
+	}
+
+	return filepath.Join(root, strconv.Itoa(pid), name)
+}
+
+func containsArg(args []string, arg string) bool {
+	if arg == "" {
+		return false
+	}
+
+	for _, candidate := range args {
+		if candidate == arg {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,116 @@
+package process_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pivotal-cf/cf-redis-broker/process"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("process identity", func() {
+	const pid = 4242
+
+	var (
+		procRoot string
+		checker  *process.ProcessChecker
+		expected process.Identity
+	)
+
+	writeProc := func(name, contents string) {
+		Expect(os.WriteFile(filepath.Join(procRoot, strconv.Itoa(pid), name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		procRoot, err = os.MkdirTemp("", "proc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(procRoot, strconv.Itoa(pid)), 0755)).To(Succeed())
+
+		writeProc("comm", "redis-server\n")
+		writeProc("cmdline", "/usr/bin/redis-server\x00/data/an-instance/redis.conf\x00--dir\x00/data/an-instance/db\x00")
+		writeProc("stat", "4242 (redis-server) S 1 4242 4242 0 -1 4194624 1 0 0 0 0 0 0 0 20 0 4 0 987654 0 0")
+
+		checker = &process.ProcessChecker{ProcRoot: procRoot}
+		expected = process.Identity{
+			ConfigPath: "/data/an-instance/redis.conf",
+			DataDir:    "/data/an-instance/db",
+			StartTime:  987654,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(procRoot)).To(Succeed())
+	})
+
+	It("reads the start time of the process", func() {
+		Expect(checker.StartTime(pid)).To(Equal(uint64(987654)))
+	})
+
+	It("reads the start time when the command name contains spaces and parentheses", func() {
+		writeProc("stat", "4242 (redis (server)) S 1 4242 4242 0 -1 4194624 1 0 0 0 0 0 0 0 20 0 4 0 123 0 0")
+		Expect(checker.StartTime(pid)).To(Equal(uint64(123)))
+	})
+
+	It("accepts the instance's redis-server", func() {
+		Expect(checker.Verify(pid, expected)).To(Succeed())
+	})
+
+	It("does not check the start time when none was recorded", func() {
+		expected.StartTime = 0
+		writeProc("stat", "4242 (redis-server) S 1 4242 4242 0 -1 4194624 1 0 0 0 0 0 0 0 20 0 4 0 1 0 0")
+		Expect(checker.Verify(pid, expected)).To(Succeed())
+	})
+
+	It("recognises a redis-server that rewrote its process title by its working directory", func() {
+		writeProc("cmdline", "/usr/bin/redis-server 127.0.0.1:6380\x00\x00\x00")
+		Expect(os.Symlink("/data/an-instance/db", filepath.Join(procRoot, strconv.Itoa(pid), "cwd"))).To(Succeed())
+
+		Expect(checker.Verify(pid, expected)).To(Succeed())
+	})
+
+	It("rejects processes that are not redis-server", func() {
+		writeProc("comm", "postgres\n")
+		writeProc("cmdline", "postgres\x00-D\x00/data\x00")
+
+		err := checker.Verify(pid, expected)
+		Expect(errors.Is(err, process.ErrUnexpectedProcess)).To(BeTrue())
+	})
+
+	It("rejects the redis-server of another instance", func() {
+		writeProc("cmdline", "/usr/bin/redis-server\x00/data/another-instance/redis.conf\x00")
+
+		err := checker.Verify(pid, expected)
+		Expect(errors.Is(err, process.ErrUnexpectedProcess)).To(BeTrue())
+	})
+
+	It("rejects a process that reused the PID of the instance", func() {
+		writeProc("stat", "4242 (redis-server) S 1 4242 4242 0 -1 4194624 1 0 0 0 0 0 0 0 20 0 4 0 1000000 0 0")
+
+		err := checker.Verify(pid, expected)
+		Expect(errors.Is(err, process.ErrUnexpectedProcess)).To(BeTrue())
+	})
+
+	It("reports processes that do not exist", func() {
+		err := checker.Verify(pid+1, expected)
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+
+	It("reads the real procfs by default", func() {
+		cmd := exec.Command("sleep", "60")
+		Expect(cmd.Start()).To(Succeed())
+		defer cmd.Process.Kill()
+
+		startTime, err := new(process.ProcessChecker).StartTime(cmd.Process.Pid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(startTime).NotTo(BeZero())
+
+		err = new(process.ProcessChecker).Verify(cmd.Process.Pid, expected)
+		Expect(errors.Is(err, process.ErrUnexpectedProcess)).To(BeTrue())
+	})
+})
@@ -8,7 +8,10 @@ import (
 	"syscall"
 )
 
-type ProcessChecker struct{}
+type ProcessChecker struct {
+	// ProcRoot is where procfs is mounted. It defaults to /proc.
+	ProcRoot string
+}
 type ProcessKiller struct{}
 
 func ReadPID(pidFilePath string) (int, error) {
@@ -0,0 +1,118 @@
+package processmonitor
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type Controllable interface {
+	Pause()
+	Resume()
+	PauseInstance(instanceID string)
+	ResumeInstance(instanceID string)
+	TriggerCheck()
+	State() State
+}
+
+// NewControlHandler exposes the supervision controls of a monitor over HTTP:
+//
+//	GET  /state                   current supervision state
+//	POST /pause, /resume          pause or resume supervision of all instances
+//	POST /instances/:id/pause     pause supervision of a single instance
+//	POST /instances/:id/resume    resume supervision of a single instance
+//	POST /check                   check all instances immediately
+//
+// The handler has no authentication of its own and is meant to be served on
+// the unix socket returned by ListenControlSocket.
+func NewControlHandler(monitor Controllable, logger lager.Logger) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("Content-Type", "application/json")
+
+		segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+		if req.Method == "GET" && len(segments) == 1 && segments[0] == "state" {
+			respond(res, monitor.State())
+			return
+		}
+
+		if req.Method != "POST" {
+			http.Error(res, "", http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case len(segments) == 1 && segments[0] == "pause":
+			logger.Info("control-pause")
+			monitor.Pause()
+		case len(segments) == 1 && segments[0] == "resume":
+			logger.Info("control-resume")
+			monitor.Resume()
+		case len(segments) == 1 && segments[0] == "check":
+			logger.Info("control-check")
+			monitor.TriggerCheck()
+		case len(segments) == 3 && segments[0] == "instances" && segments[1] != "" && segments[2] == "pause":
+			logger.Info("control-pause-instance", lager.Data{"instance": segments[1]})
+			monitor.PauseInstance(segments[1])
+		case len(segments) == 3 && segments[0] == "instances" && segments[1] != "" && segments[2] == "resume":
+			logger.Info("control-resume-instance", lager.Data{"instance": segments[1]})
+			monitor.ResumeInstance(segments[1])
+		default:
+			http.Error(res, "", http.StatusNotFound)
+			return
+		}
+
+		respond(res, monitor.State())
+	}
+}
+
+// ListenControlSocket listens on a unix socket that only the user running the
+// process monitor can connect to. A socket left behind by a previous run is
+// replaced.
+//
+// The socket is created with the process umask, so it is created and
+// restricted inside a private directory and only then moved into place.
+func ListenControlSocket(socketPath string) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(socketPath), 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDir, err := os.MkdirTemp(filepath.Dir(socketPath), ".control-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(privateDir)
+
+	privatePath := filepath.Join(privateDir, "control.sock")
+	listener, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(privatePath, 0600)
+	if err == nil {
+		err = os.Rename(privatePath, socketPath)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func respond(res http.ResponseWriter, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.Write(payload)
+}
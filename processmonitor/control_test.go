@@ -0,0 +1,160 @@
+package processmonitor_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/processmonitor"
+	"github.com/pivotal-cf/cf-redis-broker/processmonitor/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Control API", func() {
+	var (
+		repo     *fakes.FakeInstanceRepository
+		monitor  *processmonitor.Monitor
+		handler  http.Handler
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		repo = new(fakes.FakeInstanceRepository)
+		repo.AllInstancesReturns([]*redis.Instance{{ID: "an-instance"}}, nil)
+		logger := lagertest.NewTestLogger("control")
+		monitor = processmonitor.New(repo, new(fakes.FakeProcessController), processmonitor.BackoffPolicy{Threshold: 3}, logger)
+		handler = processmonitor.NewControlHandler(monitor, logger)
+		recorder = httptest.NewRecorder()
+	})
+
+	serve := func(method, path string) processmonitor.State {
+		request, err := http.NewRequest(method, "http://unix"+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(recorder, request)
+
+		var state processmonitor.State
+		if recorder.Code == http.StatusOK {
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &state)).To(Succeed())
+		}
+		return state
+	}
+
+	It("reports the current state", func() {
+		state := serve("GET", "/state")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(state.Paused).To(BeFalse())
+		Expect(state.PausedInstances).To(BeEmpty())
+	})
+
+	It("pauses and resumes supervision of all instances", func() {
+		state := serve("POST", "/pause")
+		Expect(state.Paused).To(BeTrue())
+		Expect(monitor.Paused()).To(BeTrue())
+
+		recorder = httptest.NewRecorder()
+		state = serve("POST", "/resume")
+		Expect(state.Paused).To(BeFalse())
+		Expect(monitor.Paused()).To(BeFalse())
+	})
+
+	It("pauses and resumes supervision of a single instance", func() {
+		state := serve("POST", "/instances/an-instance/pause")
+		Expect(state.PausedInstances).To(Equal([]string{"an-instance"}))
+
+		monitor.CheckAll()
+		Expect(repo.InstancePidCallCount()).To(Equal(0))
+
+		recorder = httptest.NewRecorder()
+		state = serve("POST", "/instances/an-instance/resume")
+		Expect(state.PausedInstances).To(BeEmpty())
+
+		monitor.CheckAll()
+		Expect(repo.InstancePidCallCount()).NotTo(BeZero())
+	})
+
+	It("triggers an immediate check", func() {
+		serve("POST", "/check")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("responds with a 404 for unknown paths and methods", func() {
+		serve("POST", "/unknown")
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+
+		recorder = httptest.NewRecorder()
+		serve("GET", "/pause")
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	Describe("ListenControlSocket", func() {
+		var socketDir string
+
+		BeforeEach(func() {
+			var err error
+			socketDir, err = ioutil.TempDir("", "processmonitor")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(socketDir)
+		})
+
+		It("serves the control API on a socket only the owner can use", func() {
+			socketPath := filepath.Join(socketDir, "run", "control.sock")
+
+			listener, err := processmonitor.ListenControlSocket(socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+
+			info, err := os.Stat(socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			go http.Serve(listener, handler)
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(context.Context, string, string) (net.Conn, error) {
+					return net.Dial("unix", socketPath)
+				},
+			}}
+
+			response, err := client.Post("http://unix/pause", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(monitor.Paused()).To(BeTrue())
+		})
+
+		It("moves the socket into place from a private directory", func() {
+			socketPath := filepath.Join(socketDir, "control.sock")
+
+			listener, err := processmonitor.ListenControlSocket(socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+
+			entries, err := os.ReadDir(socketDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name()).To(Equal("control.sock"))
+		})
+
+		It("replaces a socket left behind by a previous run", func() {
+			socketPath := filepath.Join(socketDir, "control.sock")
+			Expect(ioutil.WriteFile(socketPath, nil, 0600)).To(Succeed())
+
+			listener, err := processmonitor.ListenControlSocket(socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			listener.Close()
+		})
+	})
+})
@@ -0,0 +1,615 @@
+package processmonitor
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+const (
+	defaultCrashLoopThreshold = 5
+	defaultCrashLoopWindow    = 10 * time.Minute
+	defaultRestartBackoff     = time.Second
+	defaultMaxRestartBackoff  = 5 * time.Minute
+	defaultCheckInterval      = time.Second
+	defaultCheckTimeout       = 15 * time.Second
+	defaultCheckConcurrency   = 8
+)
+
+//go:generate counterfeiter -o fakes/fake_instance_repository.go . InstanceRepository
+type InstanceRepository interface {
+	AllInstances() ([]*redis.Instance, []error)
+	IsLocked(instanceID string) (bool, error)
+	IsSuspended(instanceID string) (bool, error)
+	IsFailed(instanceID string) (bool, error)
+	MarkFailed(instanceID string) error
+	InstancePid(instanceID string) (int, error)
+	InstanceConfigPath(instanceID string) string
+	InstanceDataDir(instanceID string) string
+	InstancePidFilePath(instanceID string) string
+	InstanceLogFilePath(instanceID string) string
+}
+
+//go:generate counterfeiter -o fakes/fake_process_controller.go . ProcessController
+type ProcessController interface {
+	EnsureRunning(instance *redis.Instance, configPath, instanceDataDir, pidfilePath, logfilePath string) error
+}
+
+// InstanceLocker is used to leave instances alone while the broker is
+// changing them.
+//
+//go:generate counterfeiter -o fakes/fake_instance_locker.go . InstanceLocker
+type InstanceLocker interface {
+	TryLockInstance(instanceID string) (func(), bool, error)
+}
+
+// InstanceOwners reports instances whose redis-server is restarted by another
+// supervisor, which the monitor leaves alone.
+//
+//go:generate counterfeiter -o fakes/fake_instance_owners.go . InstanceOwners
+type InstanceOwners interface {
+	Owns(instanceID string) bool
+}
+
+// BackoffPolicy controls how the monitor reacts to instances that keep
+// crashing. Every restart, whether redis-server came up or not, doubles the
+// time until the instance is checked again, up to Max. Restarts are counted
+// over a sliding Window, so a redis-server that starts and crashes again
+// seconds later is caught as well. After Threshold restarts within Window the
+// instance is marked as failed and no longer supervised. Once an instance has
+// stayed up for Window the count starts over.
+type BackoffPolicy struct {
+	Initial   time.Duration
+	Max       time.Duration
+	Threshold int
+	Window    time.Duration
+}
+
+func NewBackoffPolicy(config brokerconfig.ServiceConfiguration) BackoffPolicy {
+	policy := BackoffPolicy{
+		Initial:   time.Duration(config.RestartBackoffSeconds) * time.Second,
+		Max:       time.Duration(config.MaxRestartBackoffSeconds) * time.Second,
+		Threshold: config.CrashLoopThreshold,
+		Window:    time.Duration(config.CrashLoopWindowSeconds) * time.Second,
+	}
+
+	if policy.Initial <= 0 {
+		policy.Initial = defaultRestartBackoff
+	}
+
+	if policy.Max <= 0 {
+		policy.Max = defaultMaxRestartBackoff
+	}
+
+	if policy.Threshold <= 0 {
+		policy.Threshold = defaultCrashLoopThreshold
+	}
+
+	if policy.Window <= 0 {
+		policy.Window = defaultCrashLoopWindow
+	}
+
+	return policy
+}
+
+func (policy BackoffPolicy) delay(failures int) time.Duration {
+	delay := policy.Initial
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= policy.Max {
+			return policy.Max
+		}
+	}
+	return delay
+}
+
+func (policy BackoffPolicy) window() time.Duration {
+	if policy.Window <= 0 {
+		return defaultCrashLoopWindow
+	}
+	return policy.Window
+}
+
+var errCheckTimedOut = errors.New("check timed out")
+
+// failureRecord holds the restarts of an instance within the crash loop
+// window, oldest first.
+type failureRecord struct {
+	restarts    []time.Time
+	nextAttempt time.Time
+}
+
+func (record failureRecord) lastRestart() time.Time {
+	return record.restarts[len(record.restarts)-1]
+}
+
+// Monitor keeps the shared redis-server processes running. A problem with one
+// instance never stops the monitor from supervising the others.
+//
+// Instances are checked by a bounded pool of workers, and each check is given
+// CheckTimeout to complete so that a single hung redis-server cannot delay the
+// checks of every other tenant. A check that times out is left to finish on
+// its own and the instance is checked again on the next pass; the instance
+// lock keeps that check from acting while the hung one still holds it.
+type Monitor struct {
+	Repo         InstanceRepository
+	Controller   ProcessController
+	Logger       lager.Logger
+	Backoff      BackoffPolicy
+	Concurrency  int
+	CheckTimeout time.Duration
+	Events       events.Recorder
+	Locks        InstanceLocker
+	Owners       InstanceOwners
+	Now          func() time.Time
+
+	paused  int32
+	trigger chan struct{}
+
+	mutex           sync.Mutex
+	failures        map[string]*failureRecord
+	inFlight        map[string]uint64
+	checks          uint64
+	pausedInstances map[string]bool
+	lastCheck       time.Time
+}
+
+func New(repo InstanceRepository, controller ProcessController, backoff BackoffPolicy, logger lager.Logger) *Monitor {
+	return &Monitor{
+		Repo:         repo,
+		Controller:   controller,
+		Logger:       logger,
+		Backoff:      backoff,
+		Concurrency:  defaultCheckConcurrency,
+		CheckTimeout: defaultCheckTimeout,
+		Now:          time.Now,
+
+		trigger:         make(chan struct{}, 1),
+		failures:        map[string]*failureRecord{},
+		inFlight:        map[string]uint64{},
+		pausedInstances: map[string]bool{},
+	}
+}
+
+// Configure applies the process check settings of the broker config, keeping
+// the defaults for anything that is not set.
+func (monitor *Monitor) Configure(config brokerconfig.ServiceConfiguration) {
+	if config.ProcessCheckConcurrency > 0 {
+		monitor.Concurrency = config.ProcessCheckConcurrency
+	}
+
+	if config.ProcessCheckTimeoutSeconds > 0 {
+		monitor.CheckTimeout = time.Duration(config.ProcessCheckTimeoutSeconds) * time.Second
+	}
+}
+
+// Pause stops all instance checks until Resume is called. It is safe to call
+// from a signal handler while the monitor is running.
+func (monitor *Monitor) Pause() {
+	atomic.StoreInt32(&monitor.paused, 1)
+}
+
+func (monitor *Monitor) Resume() {
+	atomic.StoreInt32(&monitor.paused, 0)
+}
+
+func (monitor *Monitor) Paused() bool {
+	return atomic.LoadInt32(&monitor.paused) == 1
+}
+
+// PauseInstance stops supervision of a single instance, leaving the others
+// untouched.
+func (monitor *Monitor) PauseInstance(instanceID string) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.pausedInstances[instanceID] = true
+}
+
+func (monitor *Monitor) ResumeInstance(instanceID string) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	delete(monitor.pausedInstances, instanceID)
+}
+
+func (monitor *Monitor) InstancePaused(instanceID string) bool {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	return monitor.pausedInstances[instanceID]
+}
+
+// TriggerCheck makes a running monitor check all instances straight away
+// instead of waiting for the next interval.
+func (monitor *Monitor) TriggerCheck() {
+	select {
+	case monitor.trigger <- struct{}{}:
+	default:
+	}
+}
+
+type State struct {
+	Paused          bool           `json:"paused"`
+	PausedInstances []string       `json:"paused_instances"`
+	ChecksInFlight  []string       `json:"checks_in_flight"`
+	Failures        map[string]int `json:"failures"`
+	LastCheck       *time.Time     `json:"last_check,omitempty"`
+}
+
+func (monitor *Monitor) State() State {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	state := State{
+		Paused:          monitor.Paused(),
+		PausedInstances: []string{},
+		ChecksInFlight:  []string{},
+		Failures:        map[string]int{},
+	}
+
+	for instanceID := range monitor.pausedInstances {
+		state.PausedInstances = append(state.PausedInstances, instanceID)
+	}
+	sort.Strings(state.PausedInstances)
+
+	for instanceID := range monitor.inFlight {
+		state.ChecksInFlight = append(state.ChecksInFlight, instanceID)
+	}
+	sort.Strings(state.ChecksInFlight)
+
+	for instanceID, record := range monitor.failures {
+		state.Failures[instanceID] = len(record.restarts)
+	}
+
+	if !monitor.lastCheck.IsZero() {
+		lastCheck := monitor.lastCheck
+		state.LastCheck = &lastCheck
+	}
+
+	return state
+}
+
+// Run checks all instances straight away and then every interval until stop
+// is closed. The ticker is started after a random offset of at most a tenth
+// of the interval, so that monitors on different VMs do not check in
+// lockstep. Only the gap between the first two passes is stretched by the
+// offset; later passes start exactly one interval apart.
+func (monitor *Monitor) Run(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	monitor.CheckAll()
+
+	select {
+	case <-stop:
+		return
+	case <-monitor.trigger:
+		monitor.CheckAll()
+	case <-time.After(jitter(interval)):
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-monitor.trigger:
+		case <-ticker.C:
+		}
+
+		monitor.CheckAll()
+	}
+}
+
+func (monitor *Monitor) CheckAll() {
+	if monitor.Paused() {
+		monitor.Logger.Info("Skipping instance check")
+		return
+	}
+
+	monitor.mutex.Lock()
+	monitor.lastCheck = monitor.Now()
+	monitor.mutex.Unlock()
+
+	instances, _ := monitor.Repo.AllInstances()
+
+	workers := monitor.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(instances) {
+		workers = len(instances)
+	}
+
+	queue := make(chan *redis.Instance)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for instance := range queue {
+				monitor.checkWithDeadline(instance)
+			}
+		}()
+	}
+
+	for _, instance := range instances {
+		queue <- instance
+	}
+	close(queue)
+
+	wg.Wait()
+}
+
+func (monitor *Monitor) checkWithDeadline(instance *redis.Instance) {
+	check, ok := monitor.startCheck(instance.ID)
+	if !ok {
+		monitor.Logger.Info("Previous check of instance still in progress", lager.Data{
+			"instance": instance.ID,
+		})
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer monitor.finishCheck(instance.ID, check)
+		monitor.Check(instance)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(monitor.CheckTimeout):
+		monitor.Logger.Error("Instance check timed out", errCheckTimedOut, lager.Data{
+			"instance": instance.ID,
+			"timeout":  monitor.CheckTimeout.String(),
+		})
+		monitor.record(instance.ID, events.CheckTimedOut, map[string]string{
+			"timeout": monitor.CheckTimeout.String(),
+		})
+		monitor.finishCheck(instance.ID, check)
+	}
+}
+
+// startCheck returns a number for the check, so that a check that timed out
+// and finishes late does not end the check that replaced it.
+func (monitor *Monitor) startCheck(instanceID string) (uint64, bool) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if _, ok := monitor.inFlight[instanceID]; ok {
+		return 0, false
+	}
+
+	monitor.checks++
+	monitor.inFlight[instanceID] = monitor.checks
+	return monitor.checks, true
+}
+
+func (monitor *Monitor) finishCheck(instanceID string, check uint64) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if monitor.inFlight[instanceID] == check {
+		delete(monitor.inFlight, instanceID)
+	}
+}
+
+func (monitor *Monitor) Check(instance *redis.Instance) {
+	if !monitor.supervised(instance) {
+		return
+	}
+
+	now := monitor.Now()
+
+	record, failing := monitor.failureRecord(instance.ID)
+	if failing && now.Before(record.nextAttempt) {
+		monitor.Logger.Info("Backing off restart of instance", lager.Data{
+			"instance":     instance.ID,
+			"failures":     len(record.restarts),
+			"next_attempt": record.nextAttempt.Format(time.RFC3339),
+		})
+		return
+	}
+
+	if monitor.Locks != nil {
+		unlock, acquired, err := monitor.Locks.TryLockInstance(instance.ID)
+		if err != nil {
+			monitor.Logger.Error("Error locking instance", err, lager.Data{
+				"instance": instance.ID,
+			})
+			return
+		}
+
+		if !acquired {
+			monitor.Logger.Info("Skipping instance that is being changed", lager.Data{
+				"instance": instance.ID,
+			})
+			return
+		}
+		defer unlock()
+	}
+
+	pidBefore, pidBeforeErr := monitor.Repo.InstancePid(instance.ID)
+
+	err := monitor.Controller.EnsureRunning(
+		instance,
+		monitor.Repo.InstanceConfigPath(instance.ID),
+		monitor.Repo.InstanceDataDir(instance.ID),
+		monitor.Repo.InstancePidFilePath(instance.ID),
+		monitor.Repo.InstanceLogFilePath(instance.ID),
+	)
+
+	if err != nil {
+		monitor.Logger.Error("Error starting instance", err, lager.Data{
+			"instance": instance.ID,
+		})
+		monitor.record(instance.ID, events.Crashed, map[string]string{
+			"error": err.Error(),
+		})
+		monitor.recordRestart(instance, now)
+		return
+	}
+
+	// a pidfile that cannot be read says nothing about whether redis-server
+	// was restarted, so only a pid that changed counts as a restart
+	pidAfter, pidAfterErr := monitor.Repo.InstancePid(instance.ID)
+	restarted := pidBeforeErr == nil && pidAfterErr == nil && pidBefore != pidAfter
+
+	if restarted {
+		monitor.record(instance.ID, events.Crashed, nil)
+		monitor.record(instance.ID, events.Restarted, map[string]string{
+			"pid": strconv.Itoa(pidAfter),
+		})
+		monitor.recordRestart(instance, now)
+		return
+	}
+
+	if failing && now.Sub(record.lastRestart()) >= monitor.Backoff.window() {
+		monitor.mutex.Lock()
+		delete(monitor.failures, instance.ID)
+		monitor.mutex.Unlock()
+	}
+}
+
+func (monitor *Monitor) failureRecord(instanceID string) (failureRecord, bool) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	record, ok := monitor.failures[instanceID]
+	if !ok {
+		return failureRecord{}, false
+	}
+
+	return *record, true
+}
+
+func (monitor *Monitor) supervised(instance *redis.Instance) bool {
+	if monitor.InstancePaused(instance.ID) {
+		monitor.Logger.Info("Skipping paused instance", lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	locked, err := monitor.Repo.IsLocked(instance.ID)
+	if err != nil || locked {
+		return false
+	}
+
+	if monitor.Owners != nil && monitor.Owners.Owns(instance.ID) {
+		monitor.Logger.Info("Skipping instance restarted by its supervisor", lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	suspended, err := monitor.Repo.IsSuspended(instance.ID)
+	if err != nil {
+		monitor.Logger.Error("Error checking if instance is suspended", err, lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	if suspended {
+		monitor.Logger.Info("Skipping suspended instance", lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	failed, err := monitor.Repo.IsFailed(instance.ID)
+	if err != nil {
+		monitor.Logger.Error("Error checking if instance has failed", err, lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	if failed {
+		monitor.Logger.Info("Skipping failed instance", lager.Data{
+			"instance": instance.ID,
+		})
+		return false
+	}
+
+	return true
+}
+
+// recordRestart counts a restart of an instance, whether or not redis-server
+// came up, towards the backoff and the crash loop threshold. Restarts that
+// are older than the crash loop window are forgotten.
+func (monitor *Monitor) recordRestart(instance *redis.Instance, now time.Time) {
+	monitor.mutex.Lock()
+	record, ok := monitor.failures[instance.ID]
+	if !ok {
+		record = &failureRecord{}
+		monitor.failures[instance.ID] = record
+	}
+
+	restarts := []time.Time{}
+	for _, restart := range record.restarts {
+		if now.Sub(restart) < monitor.Backoff.window() {
+			restarts = append(restarts, restart)
+		}
+	}
+	record.restarts = append(restarts, now)
+	count := len(record.restarts)
+	record.nextAttempt = now.Add(monitor.Backoff.delay(count))
+
+	crashLooping := count >= monitor.Backoff.Threshold
+	if crashLooping {
+		delete(monitor.failures, instance.ID)
+	}
+	monitor.mutex.Unlock()
+
+	if crashLooping {
+		err := monitor.Repo.MarkFailed(instance.ID)
+		if err != nil {
+			monitor.Logger.Error("Error marking instance as failed", err, lager.Data{
+				"instance": instance.ID,
+			})
+			return
+		}
+
+		monitor.Logger.Info("Crash loop detected, no longer supervising instance", lager.Data{
+			"instance": instance.ID,
+			"failures": count,
+		})
+		monitor.record(instance.ID, events.Failed, map[string]string{
+			"failures": strconv.Itoa(count),
+		})
+	}
+}
+
+func (monitor *Monitor) record(instanceID, eventType string, data map[string]string) {
+	if monitor.Events == nil {
+		return
+	}
+
+	monitor.Events.Record(instanceID, eventType, events.ActorProcessMonitor, data)
+}
+
+func jitter(interval time.Duration) time.Duration {
+	maxJitter := int64(interval / 10)
+	if maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(maxJitter))
+}
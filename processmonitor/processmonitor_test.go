@@ -0,0 +1,503 @@
+package processmonitor_test
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/events"
+	eventfakes "github.com/pivotal-cf/cf-redis-broker/events/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/processmonitor"
+	"github.com/pivotal-cf/cf-redis-broker/processmonitor/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("BackoffPolicy", func() {
+	It("uses defaults when nothing is configured", func() {
+		policy := processmonitor.NewBackoffPolicy(brokerconfig.ServiceConfiguration{})
+
+		Expect(policy.Initial).To(Equal(time.Second))
+		Expect(policy.Max).To(Equal(5 * time.Minute))
+		Expect(policy.Threshold).To(Equal(5))
+		Expect(policy.Window).To(Equal(10 * time.Minute))
+	})
+
+	It("uses the configured values", func() {
+		policy := processmonitor.NewBackoffPolicy(brokerconfig.ServiceConfiguration{
+			RestartBackoffSeconds:    2,
+			MaxRestartBackoffSeconds: 60,
+			CrashLoopThreshold:       3,
+			CrashLoopWindowSeconds:   300,
+		})
+
+		Expect(policy.Initial).To(Equal(2 * time.Second))
+		Expect(policy.Max).To(Equal(time.Minute))
+		Expect(policy.Threshold).To(Equal(3))
+		Expect(policy.Window).To(Equal(5 * time.Minute))
+	})
+})
+
+var _ = Describe("Monitor", func() {
+	var (
+		repo       *fakes.FakeInstanceRepository
+		controller *fakes.FakeProcessController
+		logger     *lagertest.TestLogger
+		monitor    *processmonitor.Monitor
+		now        time.Time
+		instance   *redis.Instance
+		other      *redis.Instance
+	)
+
+	BeforeEach(func() {
+		repo = new(fakes.FakeInstanceRepository)
+		controller = new(fakes.FakeProcessController)
+		logger = lagertest.NewTestLogger("process-monitor")
+		now = time.Now()
+
+		instance = &redis.Instance{ID: "crashing"}
+		other = &redis.Instance{ID: "healthy"}
+		repo.AllInstancesReturns([]*redis.Instance{instance, other}, nil)
+		repo.InstancePidReturns(1234, nil)
+
+		monitor = processmonitor.New(repo, controller, processmonitor.BackoffPolicy{
+			Initial:   time.Second,
+			Max:       8 * time.Second,
+			Threshold: 3,
+			Window:    10 * time.Minute,
+		}, logger)
+		monitor.Now = func() time.Time { return now }
+	})
+
+	checkedInstances := func() []string {
+		ids := []string{}
+		for i := 0; i < controller.EnsureRunningCallCount(); i++ {
+			checked, _, _, _, _ := controller.EnsureRunningArgsForCall(i)
+			ids = append(ids, checked.ID)
+		}
+		return ids
+	}
+
+	It("ensures every instance is running", func() {
+		monitor.CheckAll()
+		Expect(checkedInstances()).To(ConsistOf("crashing", "healthy"))
+	})
+
+	It("skips locked, suspended and failed instances", func() {
+		repo.IsLockedStub = func(id string) (bool, error) { return id == "crashing", nil }
+		monitor.CheckAll()
+		Expect(checkedInstances()).To(Equal([]string{"healthy"}))
+
+		repo.IsLockedReturns(false, nil)
+		repo.IsSuspendedStub = func(id string) (bool, error) { return id == "healthy", nil }
+		repo.IsFailedStub = func(id string) (bool, error) { return id == "crashing", nil }
+		monitor.CheckAll()
+		Expect(checkedInstances()).To(Equal([]string{"healthy"}))
+	})
+
+	It("skips instances that are restarted by their supervisor", func() {
+		owners := new(fakes.FakeInstanceOwners)
+		owners.OwnsStub = func(id string) bool { return id == "crashing" }
+		monitor.Owners = owners
+
+		monitor.CheckAll()
+
+		Expect(checkedInstances()).To(Equal([]string{"healthy"}))
+		Expect(logger).To(gbytes.Say("Skipping instance restarted by its supervisor"))
+	})
+
+	It("does not check anything while paused", func() {
+		monitor.Pause()
+		monitor.CheckAll()
+
+		Expect(controller.EnsureRunningCallCount()).To(Equal(0))
+		Expect(logger).To(gbytes.Say("Skipping instance check"))
+	})
+
+	Describe("concurrency", func() {
+		var instances []*redis.Instance
+
+		BeforeEach(func() {
+			instances = []*redis.Instance{}
+			for i := 0; i < 20; i++ {
+				instances = append(instances, &redis.Instance{ID: fmt.Sprintf("instance-%d", i)})
+			}
+			repo.AllInstancesReturns(instances, nil)
+		})
+
+		It("never runs more checks at once than the configured concurrency", func() {
+			monitor.Configure(brokerconfig.ServiceConfiguration{ProcessCheckConcurrency: 4})
+
+			var running, maxRunning int32
+			controller.EnsureRunningStub = func(*redis.Instance, string, string, string, string) error {
+				current := atomic.AddInt32(&running, 1)
+				for {
+					observed := atomic.LoadInt32(&maxRunning)
+					if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			}
+
+			monitor.CheckAll()
+
+			Expect(controller.EnsureRunningCallCount()).To(Equal(20))
+			Expect(atomic.LoadInt32(&maxRunning)).To(BeNumerically("<=", 4))
+			Expect(atomic.LoadInt32(&maxRunning)).To(BeNumerically(">", 1))
+		})
+
+		Context("when a check hangs", func() {
+			var release chan struct{}
+
+			BeforeEach(func() {
+				hung := make(chan struct{})
+				release = hung
+				monitor.Concurrency = 1
+				monitor.CheckTimeout = 20 * time.Millisecond
+
+				controller.EnsureRunningStub = func(checked *redis.Instance, _, _, _, _ string) error {
+					if checked.ID == "instance-0" {
+						<-hung
+					}
+					return nil
+				}
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("gives up waiting after the check timeout and checks the other instances", func() {
+				monitor.CheckAll()
+
+				Expect(controller.EnsureRunningCallCount()).To(Equal(20))
+				Expect(logger).To(gbytes.Say("Instance check timed out"))
+			})
+
+			It("records that the check timed out", func() {
+				recorder := new(eventfakes.FakeRecorder)
+				monitor.Events = recorder
+
+				monitor.CheckAll()
+
+				Expect(recorder.RecordCallCount()).To(Equal(1))
+				instanceID, eventType, actor, data := recorder.RecordArgsForCall(0)
+				Expect(instanceID).To(Equal("instance-0"))
+				Expect(eventType).To(Equal(events.CheckTimedOut))
+				Expect(actor).To(Equal(events.ActorProcessMonitor))
+				Expect(data).To(Equal(map[string]string{"timeout": "20ms"}))
+			})
+
+			It("checks the hung instance again on the next pass", func() {
+				monitor.CheckAll()
+				Expect(monitor.State().ChecksInFlight).To(BeEmpty())
+
+				monitor.CheckAll()
+
+				Expect(controller.EnsureRunningCallCount()).To(Equal(40))
+			})
+
+			It("does not start a second check while the first one has not timed out", func() {
+				monitor.CheckTimeout = time.Hour
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					monitor.CheckAll()
+				}()
+				DeferCleanup(func() { Eventually(done).Should(BeClosed()) })
+				Eventually(monitor.State).Should(HaveField("ChecksInFlight", ConsistOf("instance-0")))
+
+				monitor.CheckAll()
+
+				Expect(logger).To(gbytes.Say("Previous check of instance still in progress"))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		It("checks the instances every interval until stopped", func() {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				monitor.Run(10*time.Millisecond, stop)
+			}()
+
+			Eventually(controller.EnsureRunningCallCount).Should(BeNumerically(">=", 6))
+
+			close(stop)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("checks straight away when triggered", func() {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				monitor.Run(time.Hour, stop)
+			}()
+
+			Eventually(controller.EnsureRunningCallCount).Should(Equal(2))
+
+			monitor.TriggerCheck()
+			Eventually(controller.EnsureRunningCallCount).Should(Equal(4))
+
+			close(stop)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("when an instance fails to start", func() {
+		BeforeEach(func() {
+			controller.EnsureRunningStub = func(checked *redis.Instance, _, _, _, _ string) error {
+				if checked.ID == "crashing" {
+					return errors.New("redis failed to start")
+				}
+				return nil
+			}
+		})
+
+		It("keeps supervising the other instances", func() {
+			monitor.CheckAll()
+			Expect(checkedInstances()).To(ConsistOf("crashing", "healthy"))
+			Expect(logger).To(gbytes.Say("Error starting instance"))
+		})
+
+		It("backs off exponentially before retrying", func() {
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(1))
+
+			now = now.Add(500 * time.Millisecond)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(1))
+
+			now = now.Add(500 * time.Millisecond)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(2))
+
+			now = now.Add(time.Second)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(2))
+
+			now = now.Add(time.Second)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(3))
+		})
+
+		It("marks the instance as failed once the crash loop threshold is reached", func() {
+			for i := 0; i < 3; i++ {
+				monitor.Check(instance)
+				now = now.Add(time.Minute)
+			}
+
+			Expect(repo.MarkFailedCallCount()).To(Equal(1))
+			Expect(repo.MarkFailedArgsForCall(0)).To(Equal("crashing"))
+			Expect(logger).To(gbytes.Say("Crash loop detected"))
+		})
+	})
+
+	Context("when an instance keeps being restarted", func() {
+		BeforeEach(func() {
+			pid := 100
+			repo.InstancePidStub = func(string) (int, error) {
+				pid++
+				return pid, nil
+			}
+		})
+
+		It("backs off after a restart even when redis-server came up", func() {
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(1))
+
+			now = now.Add(500 * time.Millisecond)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(1))
+
+			now = now.Add(500 * time.Millisecond)
+			monitor.Check(instance)
+			Expect(controller.EnsureRunningCallCount()).To(Equal(2))
+		})
+
+		It("marks the instance as failed when redis-server dies again after every restart", func() {
+			for i := 0; i < 3; i++ {
+				monitor.Check(instance)
+				now = now.Add(time.Minute)
+			}
+
+			Expect(controller.EnsureRunningCallCount()).To(Equal(3))
+			Expect(repo.MarkFailedCallCount()).To(Equal(1))
+			Expect(repo.MarkFailedArgsForCall(0)).To(Equal("crashing"))
+			Expect(logger).To(gbytes.Say("Crash loop detected"))
+		})
+
+		It("counts failed and successful restarts together", func() {
+			controller.EnsureRunningReturnsOnCall(0, errors.New("boom"))
+			controller.EnsureRunningReturnsOnCall(2, errors.New("boom"))
+
+			for i := 0; i < 3; i++ {
+				monitor.Check(instance)
+				now = now.Add(time.Minute)
+			}
+
+			Expect(repo.MarkFailedCallCount()).To(Equal(1))
+		})
+
+		It("forgets restarts that are older than the crash loop window", func() {
+			for i := 0; i < 5; i++ {
+				monitor.Check(instance)
+				now = now.Add(6 * time.Minute)
+			}
+
+			Expect(controller.EnsureRunningCallCount()).To(Equal(5))
+			Expect(repo.MarkFailedCallCount()).To(BeZero())
+		})
+	})
+
+	Context("when an instance recovers", func() {
+		BeforeEach(func() {
+			controller.EnsureRunningReturnsOnCall(0, errors.New("boom"))
+			controller.EnsureRunningReturnsOnCall(1, errors.New("boom"))
+
+			monitor.Check(instance)
+			now = now.Add(time.Minute)
+			monitor.Check(instance)
+			now = now.Add(time.Minute)
+			monitor.Check(instance)
+		})
+
+		It("keeps counting restarts until it has stayed up for the crash loop window", func() {
+			Expect(monitor.State().Failures).To(HaveKeyWithValue("crashing", 2))
+
+			controller.EnsureRunningReturnsOnCall(3, errors.New("boom"))
+			now = now.Add(time.Minute)
+			monitor.Check(instance)
+
+			Expect(repo.MarkFailedCallCount()).To(Equal(1))
+		})
+
+		It("forgets previous restarts once it has stayed up for the crash loop window", func() {
+			now = now.Add(9 * time.Minute)
+			monitor.Check(instance)
+			Expect(monitor.State().Failures).To(BeEmpty())
+
+			controller.EnsureRunningReturnsOnCall(4, errors.New("boom"))
+			controller.EnsureRunningReturnsOnCall(5, errors.New("boom"))
+			now = now.Add(time.Minute)
+			monitor.Check(instance)
+			now = now.Add(time.Minute)
+			monitor.Check(instance)
+
+			Expect(repo.MarkFailedCallCount()).To(BeZero())
+		})
+	})
+
+	Context("when the broker is changing an instance", func() {
+		var locker *fakes.FakeInstanceLocker
+
+		BeforeEach(func() {
+			locker = new(fakes.FakeInstanceLocker)
+			locker.TryLockInstanceStub = func(instanceID string) (func(), bool, error) {
+				return func() {}, instanceID != "crashing", nil
+			}
+			monitor.Locks = locker
+		})
+
+		It("leaves the instance alone", func() {
+			monitor.CheckAll()
+
+			Expect(checkedInstances()).To(ConsistOf("healthy"))
+			Expect(logger).To(gbytes.Say("Skipping instance that is being changed"))
+		})
+
+		It("holds the lock of an instance while checking it", func() {
+			released := false
+			locker.TryLockInstanceReturns(func() { released = true }, true, nil)
+			locker.TryLockInstanceStub = nil
+			controller.EnsureRunningStub = func(*redis.Instance, string, string, string, string) error {
+				Expect(released).To(BeFalse())
+				return nil
+			}
+
+			monitor.Check(instance)
+
+			Expect(controller.EnsureRunningCallCount()).To(Equal(1))
+			Expect(released).To(BeTrue())
+		})
+	})
+
+	Describe("lifecycle events", func() {
+		var recorder *eventfakes.FakeRecorder
+
+		BeforeEach(func() {
+			recorder = new(eventfakes.FakeRecorder)
+			monitor.Events = recorder
+		})
+
+		recordedEvents := func() []string {
+			types := []string{}
+			for i := 0; i < recorder.RecordCallCount(); i++ {
+				recordedID, eventType, actor, _ := recorder.RecordArgsForCall(i)
+				Expect(recordedID).To(Equal("crashing"))
+				Expect(actor).To(Equal(events.ActorProcessMonitor))
+				types = append(types, eventType)
+			}
+			return types
+		}
+
+		It("records nothing while an instance keeps running", func() {
+			monitor.Check(instance)
+			Expect(recorder.RecordCallCount()).To(BeZero())
+		})
+
+		It("records a crash and a restart when the instance was restarted", func() {
+			repo.InstancePidReturnsOnCall(0, 1234, nil)
+			repo.InstancePidReturnsOnCall(1, 4321, nil)
+
+			monitor.Check(instance)
+
+			Expect(recordedEvents()).To(Equal([]string{events.Crashed, events.Restarted}))
+			_, _, _, data := recorder.RecordArgsForCall(1)
+			Expect(data).To(HaveKeyWithValue("pid", "4321"))
+		})
+
+		It("records nothing when a pidfile cannot be read", func() {
+			repo.InstancePidReturnsOnCall(0, 0, errors.New("no pidfile"))
+			repo.InstancePidReturnsOnCall(1, 4321, nil)
+			repo.InstancePidReturnsOnCall(2, 4321, nil)
+			repo.InstancePidReturnsOnCall(3, 0, errors.New("no pidfile"))
+
+			monitor.Check(instance)
+			monitor.Check(instance)
+
+			Expect(recorder.RecordCallCount()).To(BeZero())
+		})
+
+		It("records the failure once the crash loop threshold is reached", func() {
+			controller.EnsureRunningReturns(errors.New("redis failed to start"))
+
+			for i := 0; i < 3; i++ {
+				monitor.Check(instance)
+				now = now.Add(time.Minute)
+			}
+
+			Expect(recordedEvents()).To(Equal([]string{
+				events.Crashed,
+				events.Crashed,
+				events.Crashed,
+				events.Failed,
+			}))
+		})
+	})
+})
@@ -0,0 +1,324 @@
+package redis
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+)
+
+const (
+	defaultChildRestartDelay    = time.Second
+	defaultMaxChildRestartDelay = time.Minute
+	childStableAfter            = time.Minute
+)
+
+// ChildSupervisor runs redis-server in the foreground as a child of the
+// broker. It reaps children that exit and restarts them, backing off while an
+// instance keeps crashing. Instances whose process was started by an earlier
+// broker are stopped through the fallback supervisor.
+//
+// Every instance it starts is recorded in OwnerDirectory together with the
+// broker's pid, so that the process monitor leaves it alone while the broker
+// is running and takes over when the broker is gone.
+type ChildSupervisor struct {
+	Logger          lager.Logger
+	Fallback        Supervisor
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	OwnerDirectory  string
+
+	// Adopt, when set, is called with every restarted child, so that it gets
+	// the identity the controller gave the first one.
+	Adopt func(instance *Instance, pid int) error
+
+	// Cgroups, when set, is where every child is started, see processAttr.
+	Cgroups InstanceCgroups
+
+	mutex    sync.Mutex
+	children map[string]*child
+}
+
+type child struct {
+	cmd       *exec.Cmd
+	startedAt time.Time
+	stopping  bool
+	exited    chan struct{}
+}
+
+func NewChildSupervisor(config brokerconfig.ServiceConfiguration, fallback Supervisor, logger lager.Logger) *ChildSupervisor {
+	supervisor := &ChildSupervisor{
+		Logger:          logger,
+		Fallback:        fallback,
+		RestartDelay:    time.Duration(config.RestartBackoffSeconds) * time.Second,
+		MaxRestartDelay: time.Duration(config.MaxRestartBackoffSeconds) * time.Second,
+		OwnerDirectory:  config.PidfileDirectory,
+		children:        map[string]*child{},
+	}
+
+	if supervisor.RestartDelay <= 0 {
+		supervisor.RestartDelay = defaultChildRestartDelay
+	}
+
+	if supervisor.MaxRestartDelay <= 0 {
+		supervisor.MaxRestartDelay = defaultMaxChildRestartDelay
+	}
+
+	return supervisor
+}
+
+func (supervisor *ChildSupervisor) Start(instance *Instance, executable string, args []string, credential *syscall.Credential) error {
+	args = append(append([]string{}, args...), "--daemonize", "no")
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	if _, ok := supervisor.children[instance.ID]; ok {
+		return nil
+	}
+
+	err := supervisor.writeOwner(instance.ID)
+	if err != nil {
+		return err
+	}
+
+	c, err := supervisor.startChild(instance.ID, executable, args, credential)
+	if err != nil {
+		supervisor.removeOwner(instance.ID)
+		return err
+	}
+
+	supervisor.children[instance.ID] = c
+	go supervisor.reap(instance, c, executable, args, credential)
+
+	return nil
+}
+
+func (supervisor *ChildSupervisor) Stop(instance *Instance) error {
+	supervisor.mutex.Lock()
+	c, ok := supervisor.children[instance.ID]
+	if ok {
+		c.stopping = true
+	}
+	supervisor.mutex.Unlock()
+
+	if !ok {
+		return supervisor.Fallback.Stop(instance)
+	}
+
+	err := c.cmd.Process.Kill()
+	<-c.exited
+
+	supervisor.mutex.Lock()
+	if supervisor.children[instance.ID] == c {
+		delete(supervisor.children, instance.ID)
+		supervisor.removeOwner(instance.ID)
+	}
+	supervisor.mutex.Unlock()
+
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
+
+// Running reports whether the supervisor has a child for the instance.
+func (supervisor *ChildSupervisor) Running(instanceID string) bool {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	_, ok := supervisor.children[instanceID]
+	return ok
+}
+
+// Disown removes the ownership record that an earlier broker left behind for
+// an instance that this supervisor has no child for.
+func (supervisor *ChildSupervisor) Disown(instanceID string) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	if _, ok := supervisor.children[instanceID]; ok {
+		return
+	}
+
+	supervisor.removeOwner(instanceID)
+}
+
+func (supervisor *ChildSupervisor) writeOwner(instanceID string) error {
+	path, err := ChildOwnerPath(supervisor.OwnerDirectory, instanceID)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0640)
+}
+
+func (supervisor *ChildSupervisor) removeOwner(instanceID string) {
+	path, err := ChildOwnerPath(supervisor.OwnerDirectory, instanceID)
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		supervisor.Logger.Error("failed to remove owner of redis-server", err, lager.Data{
+			"instance": instanceID,
+		})
+	}
+}
+
+// ChildOwnerPath is where the child supervisor records that it owns the
+// redis-server of an instance.
+func ChildOwnerPath(directory, instanceID string) (string, error) {
+	return paths.NewResolver(directory).Resolve(instanceID + ".supervisor")
+}
+
+// childOwnerAlive reports whether the broker that recorded itself as the
+// owner of an instance is still running.
+func childOwnerAlive(directory, instanceID string, checker ProcessChecker) bool {
+	path, err := ChildOwnerPath(directory, instanceID)
+	if err != nil {
+		return false
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+
+	return checker.Alive(pid)
+}
+
+func (supervisor *ChildSupervisor) reap(instance *Instance, c *child, executable string, args []string, credential *syscall.Credential) {
+	failures := 0
+
+	for {
+		err := c.cmd.Wait()
+		close(c.exited)
+
+		if time.Since(c.startedAt) > childStableAfter {
+			failures = 0
+		}
+
+		for {
+			failures++
+			delay := supervisor.restartDelay(failures)
+
+			if supervisor.stopping(c) {
+				return
+			}
+
+			supervisor.Logger.Error("redis-server exited", err, lager.Data{
+				"instance":      instance.ID,
+				"restart_delay": delay.String(),
+			})
+			time.Sleep(delay)
+
+			var stopped bool
+			var next *child
+			next, stopped, err = supervisor.restart(instance.ID, c, executable, args, credential)
+			if stopped {
+				return
+			}
+
+			if err == nil {
+				c = next
+				break
+			}
+		}
+
+		supervisor.Logger.Info("restarted redis-server", lager.Data{
+			"instance": instance.ID,
+			"pid":      c.cmd.Process.Pid,
+		})
+
+		supervisor.adopt(instance, c)
+	}
+}
+
+// adopt only logs failures, because the restarted redis-server is already
+// serving its tenant and killing it would only cause another restart.
+func (supervisor *ChildSupervisor) adopt(instance *Instance, c *child) {
+	if supervisor.Adopt == nil {
+		return
+	}
+
+	err := supervisor.Adopt(instance, c.cmd.Process.Pid)
+	if err != nil {
+		supervisor.Logger.Error("failed to adopt restarted redis-server", err, lager.Data{
+			"instance": instance.ID,
+			"pid":      c.cmd.Process.Pid,
+		})
+	}
+}
+
+func (supervisor *ChildSupervisor) stopping(c *child) bool {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	return c.stopping
+}
+
+// restart replaces a child that exited, unless the instance was stopped in
+// the meantime.
+func (supervisor *ChildSupervisor) restart(instanceID string, exited *child, executable string, args []string, credential *syscall.Credential) (*child, bool, error) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	if exited.stopping {
+		return nil, true, nil
+	}
+
+	next, err := supervisor.startChild(instanceID, executable, args, credential)
+	if err != nil {
+		return nil, false, err
+	}
+
+	supervisor.children[instanceID] = next
+	return next, false, nil
+}
+
+func (supervisor *ChildSupervisor) restartDelay(failures int) time.Duration {
+	delay := supervisor.RestartDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= supervisor.MaxRestartDelay {
+			return supervisor.MaxRestartDelay
+		}
+	}
+	return delay
+}
+
+func (supervisor *ChildSupervisor) startChild(instanceID, executable string, args []string, credential *syscall.Credential) (*child, error) {
+	attr, closeCgroup, err := processAttr(supervisor.Cgroups, instanceID, credential)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCgroup()
+
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = attr
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &child{cmd: cmd, startedAt: time.Now(), exited: make(chan struct{})}, nil
+}
@@ -36,6 +36,7 @@ type client struct {
 	port     int
 	password string
 	tls      bool
+	timeout  time.Duration
 	aliases  map[string]string
 
 	connection redisclient.Conn
@@ -69,6 +70,14 @@ func Tls(tls bool) Option {
 	}
 }
 
+// Timeout bounds connecting to redis-server as well as every read and write on
+// the connection. A zero timeout means no timeout.
+func Timeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.timeout = timeout
+	}
+}
+
 func Connect(options ...Option) (Client, error) {
 	c := &client{
 		host:    "0.0.0.0",
@@ -84,7 +93,15 @@ func Connect(options ...Option) (Client, error) {
 	address := fmt.Sprintf("%v:%v", c.host, c.port)
 
 	var err error
-	c.connection, err = redisclient.Dial("tcp", address, redisclient.DialUseTLS(c.tls), redisclient.DialTLSSkipVerify(c.tls))
+	c.connection, err = redisclient.Dial(
+		"tcp",
+		address,
+		redisclient.DialUseTLS(c.tls),
+		redisclient.DialTLSSkipVerify(c.tls),
+		redisclient.DialConnectTimeout(c.timeout),
+		redisclient.DialReadTimeout(c.timeout),
+		redisclient.DialWriteTimeout(c.timeout),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -8,9 +8,11 @@ import (
 	"github.com/pivotal-cf/cf-redis-broker/integration"
 	"github.com/pivotal-cf/cf-redis-broker/redis/client"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 )
 
 var host = "0.0.0.0"
@@ -46,6 +48,33 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Context("when the server does not respond", func() {
+			var listener net.Listener
+
+			BeforeEach(func() {
+				var err error
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				listener.Close()
+			})
+
+			It("gives up after the timeout", func() {
+				start := time.Now()
+				_, err := client.Connect(
+					client.Host("127.0.0.1"),
+					client.Port(listener.Addr().(*net.TCPAddr).Port),
+					client.Password("secret"),
+					client.Timeout(100*time.Millisecond),
+				)
+
+				Ω(err).Should(HaveOccurred())
+				Ω(time.Since(start)).Should(BeNumerically("<", time.Second))
+			})
+		})
+
 		Context("when the server is running", func() {
 			JustBeforeEach(func() {
 				redisRunner = &integration.RedisRunner{}
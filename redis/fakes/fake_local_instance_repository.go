@@ -5,9 +5,32 @@ import (
 	"sync"
 
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
 type FakeLocalInstanceRepository struct {
+	ClearFailedStub        func(string) error
+	clearFailedMutex       sync.RWMutex
+	clearFailedArgsForCall []struct {
+		arg1 string
+	}
+	clearFailedReturns struct {
+		result1 error
+	}
+	clearFailedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ClearSuspendedStub        func(string) error
+	clearSuspendedMutex       sync.RWMutex
+	clearSuspendedArgsForCall []struct {
+		arg1 string
+	}
+	clearSuspendedReturns struct {
+		result1 error
+	}
+	clearSuspendedReturnsOnCall map[int]struct {
+		result1 error
+	}
 	DeleteStub        func(string) error
 	deleteMutex       sync.RWMutex
 	deleteArgsForCall []struct {
@@ -101,10 +124,50 @@ type FakeLocalInstanceRepository struct {
 	instancePidFilePathReturnsOnCall map[int]struct {
 		result1 string
 	}
-	LockStub        func(*redis.Instance) error
+	InstanceStateStub        func(string) (string, error)
+	instanceStateMutex       sync.RWMutex
+	instanceStateArgsForCall []struct {
+		arg1 string
+	}
+	instanceStateReturns struct {
+		result1 string
+		result2 error
+	}
+	instanceStateReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	IsFailedStub        func(string) (bool, error)
+	isFailedMutex       sync.RWMutex
+	isFailedArgsForCall []struct {
+		arg1 string
+	}
+	isFailedReturns struct {
+		result1 bool
+		result2 error
+	}
+	isFailedReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	IsSuspendedStub        func(string) (bool, error)
+	isSuspendedMutex       sync.RWMutex
+	isSuspendedArgsForCall []struct {
+		arg1 string
+	}
+	isSuspendedReturns struct {
+		result1 bool
+		result2 error
+	}
+	isSuspendedReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	LockStub        func(*redis.Instance, string) error
 	lockMutex       sync.RWMutex
 	lockArgsForCall []struct {
 		arg1 *redis.Instance
+		arg2 string
 	}
 	lockReturns struct {
 		result1 error
@@ -112,10 +175,22 @@ type FakeLocalInstanceRepository struct {
 	lockReturnsOnCall map[int]struct {
 		result1 error
 	}
-	SetupStub        func(*redis.Instance) error
+	MarkSuspendedStub        func(string) error
+	markSuspendedMutex       sync.RWMutex
+	markSuspendedArgsForCall []struct {
+		arg1 string
+	}
+	markSuspendedReturns struct {
+		result1 error
+	}
+	markSuspendedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SetupStub        func(*redis.Instance, redisconf.Conf) error
 	setupMutex       sync.RWMutex
 	setupArgsForCall []struct {
 		arg1 *redis.Instance
+		arg2 redisconf.Conf
 	}
 	setupReturns struct {
 		result1 error
@@ -138,21 +213,144 @@ type FakeLocalInstanceRepository struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeLocalInstanceRepository) ClearFailed(arg1 string) error {
+	fake.clearFailedMutex.Lock()
+	ret, specificReturn := fake.clearFailedReturnsOnCall[len(fake.clearFailedArgsForCall)]
+	fake.clearFailedArgsForCall = append(fake.clearFailedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.ClearFailedStub
+	fakeReturns := fake.clearFailedReturns
+	fake.recordInvocation("ClearFailed", []interface{}{arg1})
+	fake.clearFailedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLocalInstanceRepository) ClearFailedCallCount() int {
+	fake.clearFailedMutex.RLock()
+	defer fake.clearFailedMutex.RUnlock()
+	return len(fake.clearFailedArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) ClearFailedCalls(stub func(string) error) {
+	fake.clearFailedMutex.Lock()
+	defer fake.clearFailedMutex.Unlock()
+	fake.ClearFailedStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) ClearFailedArgsForCall(i int) string {
+	fake.clearFailedMutex.RLock()
+	defer fake.clearFailedMutex.RUnlock()
+	argsForCall := fake.clearFailedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) ClearFailedReturns(result1 error) {
+	fake.clearFailedMutex.Lock()
+	defer fake.clearFailedMutex.Unlock()
+	fake.ClearFailedStub = nil
+	fake.clearFailedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLocalInstanceRepository) ClearFailedReturnsOnCall(i int, result1 error) {
+	fake.clearFailedMutex.Lock()
+	defer fake.clearFailedMutex.Unlock()
+	fake.ClearFailedStub = nil
+	if fake.clearFailedReturnsOnCall == nil {
+		fake.clearFailedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.clearFailedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspended(arg1 string) error {
+	fake.clearSuspendedMutex.Lock()
+	ret, specificReturn := fake.clearSuspendedReturnsOnCall[len(fake.clearSuspendedArgsForCall)]
+	fake.clearSuspendedArgsForCall = append(fake.clearSuspendedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.ClearSuspendedStub
+	fakeReturns := fake.clearSuspendedReturns
+	fake.recordInvocation("ClearSuspended", []interface{}{arg1})
+	fake.clearSuspendedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspendedCallCount() int {
+	fake.clearSuspendedMutex.RLock()
+	defer fake.clearSuspendedMutex.RUnlock()
+	return len(fake.clearSuspendedArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspendedCalls(stub func(string) error) {
+	fake.clearSuspendedMutex.Lock()
+	defer fake.clearSuspendedMutex.Unlock()
+	fake.ClearSuspendedStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspendedArgsForCall(i int) string {
+	fake.clearSuspendedMutex.RLock()
+	defer fake.clearSuspendedMutex.RUnlock()
+	argsForCall := fake.clearSuspendedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspendedReturns(result1 error) {
+	fake.clearSuspendedMutex.Lock()
+	defer fake.clearSuspendedMutex.Unlock()
+	fake.ClearSuspendedStub = nil
+	fake.clearSuspendedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLocalInstanceRepository) ClearSuspendedReturnsOnCall(i int, result1 error) {
+	fake.clearSuspendedMutex.Lock()
+	defer fake.clearSuspendedMutex.Unlock()
+	fake.ClearSuspendedStub = nil
+	if fake.clearSuspendedReturnsOnCall == nil {
+		fake.clearSuspendedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.clearSuspendedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeLocalInstanceRepository) Delete(arg1 string) error {
 	fake.deleteMutex.Lock()
 	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
 	fake.recordInvocation("Delete", []interface{}{arg1})
 	fake.deleteMutex.Unlock()
-	if fake.DeleteStub != nil {
-		return fake.DeleteStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.deleteReturns
 	return fakeReturns.result1
 }
 
@@ -204,15 +402,16 @@ func (fake *FakeLocalInstanceRepository) FindByID(arg1 string) (*redis.Instance,
 	fake.findByIDArgsForCall = append(fake.findByIDArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.FindByIDStub
+	fakeReturns := fake.findByIDReturns
 	fake.recordInvocation("FindByID", []interface{}{arg1})
 	fake.findByIDMutex.Unlock()
-	if fake.FindByIDStub != nil {
-		return fake.FindByIDStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.findByIDReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -267,15 +466,16 @@ func (fake *FakeLocalInstanceRepository) InstanceConfigPath(arg1 string) string
 	fake.instanceConfigPathArgsForCall = append(fake.instanceConfigPathArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.InstanceConfigPathStub
+	fakeReturns := fake.instanceConfigPathReturns
 	fake.recordInvocation("InstanceConfigPath", []interface{}{arg1})
 	fake.instanceConfigPathMutex.Unlock()
-	if fake.InstanceConfigPathStub != nil {
-		return fake.InstanceConfigPathStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.instanceConfigPathReturns
 	return fakeReturns.result1
 }
 
@@ -326,15 +526,16 @@ func (fake *FakeLocalInstanceRepository) InstanceCount() (int, []error) {
 	ret, specificReturn := fake.instanceCountReturnsOnCall[len(fake.instanceCountArgsForCall)]
 	fake.instanceCountArgsForCall = append(fake.instanceCountArgsForCall, struct {
 	}{})
+	stub := fake.InstanceCountStub
+	fakeReturns := fake.instanceCountReturns
 	fake.recordInvocation("InstanceCount", []interface{}{})
 	fake.instanceCountMutex.Unlock()
-	if fake.InstanceCountStub != nil {
-		return fake.InstanceCountStub()
+	if stub != nil {
+		return stub()
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.instanceCountReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -382,15 +583,16 @@ func (fake *FakeLocalInstanceRepository) InstanceDataDir(arg1 string) string {
 	fake.instanceDataDirArgsForCall = append(fake.instanceDataDirArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.InstanceDataDirStub
+	fakeReturns := fake.instanceDataDirReturns
 	fake.recordInvocation("InstanceDataDir", []interface{}{arg1})
 	fake.instanceDataDirMutex.Unlock()
-	if fake.InstanceDataDirStub != nil {
-		return fake.InstanceDataDirStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.instanceDataDirReturns
 	return fakeReturns.result1
 }
 
@@ -442,15 +644,16 @@ func (fake *FakeLocalInstanceRepository) InstanceExists(arg1 string) (bool, erro
 	fake.instanceExistsArgsForCall = append(fake.instanceExistsArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.InstanceExistsStub
+	fakeReturns := fake.instanceExistsReturns
 	fake.recordInvocation("InstanceExists", []interface{}{arg1})
 	fake.instanceExistsMutex.Unlock()
-	if fake.InstanceExistsStub != nil {
-		return fake.InstanceExistsStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.instanceExistsReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -505,15 +708,16 @@ func (fake *FakeLocalInstanceRepository) InstanceLogFilePath(arg1 string) string
 	fake.instanceLogFilePathArgsForCall = append(fake.instanceLogFilePathArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.InstanceLogFilePathStub
+	fakeReturns := fake.instanceLogFilePathReturns
 	fake.recordInvocation("InstanceLogFilePath", []interface{}{arg1})
 	fake.instanceLogFilePathMutex.Unlock()
-	if fake.InstanceLogFilePathStub != nil {
-		return fake.InstanceLogFilePathStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.instanceLogFilePathReturns
 	return fakeReturns.result1
 }
 
@@ -565,15 +769,16 @@ func (fake *FakeLocalInstanceRepository) InstancePidFilePath(arg1 string) string
 	fake.instancePidFilePathArgsForCall = append(fake.instancePidFilePathArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.InstancePidFilePathStub
+	fakeReturns := fake.instancePidFilePathReturns
 	fake.recordInvocation("InstancePidFilePath", []interface{}{arg1})
 	fake.instancePidFilePathMutex.Unlock()
-	if fake.InstancePidFilePathStub != nil {
-		return fake.InstancePidFilePathStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.instancePidFilePathReturns
 	return fakeReturns.result1
 }
 
@@ -619,21 +824,215 @@ func (fake *FakeLocalInstanceRepository) InstancePidFilePathReturnsOnCall(i int,
 	}{result1}
 }
 
-func (fake *FakeLocalInstanceRepository) Lock(arg1 *redis.Instance) error {
+func (fake *FakeLocalInstanceRepository) InstanceState(arg1 string) (string, error) {
+	fake.instanceStateMutex.Lock()
+	ret, specificReturn := fake.instanceStateReturnsOnCall[len(fake.instanceStateArgsForCall)]
+	fake.instanceStateArgsForCall = append(fake.instanceStateArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.InstanceStateStub
+	fakeReturns := fake.instanceStateReturns
+	fake.recordInvocation("InstanceState", []interface{}{arg1})
+	fake.instanceStateMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLocalInstanceRepository) InstanceStateCallCount() int {
+	fake.instanceStateMutex.RLock()
+	defer fake.instanceStateMutex.RUnlock()
+	return len(fake.instanceStateArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) InstanceStateCalls(stub func(string) (string, error)) {
+	fake.instanceStateMutex.Lock()
+	defer fake.instanceStateMutex.Unlock()
+	fake.InstanceStateStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) InstanceStateArgsForCall(i int) string {
+	fake.instanceStateMutex.RLock()
+	defer fake.instanceStateMutex.RUnlock()
+	argsForCall := fake.instanceStateArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) InstanceStateReturns(result1 string, result2 error) {
+	fake.instanceStateMutex.Lock()
+	defer fake.instanceStateMutex.Unlock()
+	fake.InstanceStateStub = nil
+	fake.instanceStateReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) InstanceStateReturnsOnCall(i int, result1 string, result2 error) {
+	fake.instanceStateMutex.Lock()
+	defer fake.instanceStateMutex.Unlock()
+	fake.InstanceStateStub = nil
+	if fake.instanceStateReturnsOnCall == nil {
+		fake.instanceStateReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.instanceStateReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailed(arg1 string) (bool, error) {
+	fake.isFailedMutex.Lock()
+	ret, specificReturn := fake.isFailedReturnsOnCall[len(fake.isFailedArgsForCall)]
+	fake.isFailedArgsForCall = append(fake.isFailedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.IsFailedStub
+	fakeReturns := fake.isFailedReturns
+	fake.recordInvocation("IsFailed", []interface{}{arg1})
+	fake.isFailedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailedCallCount() int {
+	fake.isFailedMutex.RLock()
+	defer fake.isFailedMutex.RUnlock()
+	return len(fake.isFailedArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailedCalls(stub func(string) (bool, error)) {
+	fake.isFailedMutex.Lock()
+	defer fake.isFailedMutex.Unlock()
+	fake.IsFailedStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailedArgsForCall(i int) string {
+	fake.isFailedMutex.RLock()
+	defer fake.isFailedMutex.RUnlock()
+	argsForCall := fake.isFailedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailedReturns(result1 bool, result2 error) {
+	fake.isFailedMutex.Lock()
+	defer fake.isFailedMutex.Unlock()
+	fake.IsFailedStub = nil
+	fake.isFailedReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) IsFailedReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.isFailedMutex.Lock()
+	defer fake.isFailedMutex.Unlock()
+	fake.IsFailedStub = nil
+	if fake.isFailedReturnsOnCall == nil {
+		fake.isFailedReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.isFailedReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspended(arg1 string) (bool, error) {
+	fake.isSuspendedMutex.Lock()
+	ret, specificReturn := fake.isSuspendedReturnsOnCall[len(fake.isSuspendedArgsForCall)]
+	fake.isSuspendedArgsForCall = append(fake.isSuspendedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.IsSuspendedStub
+	fakeReturns := fake.isSuspendedReturns
+	fake.recordInvocation("IsSuspended", []interface{}{arg1})
+	fake.isSuspendedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspendedCallCount() int {
+	fake.isSuspendedMutex.RLock()
+	defer fake.isSuspendedMutex.RUnlock()
+	return len(fake.isSuspendedArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspendedCalls(stub func(string) (bool, error)) {
+	fake.isSuspendedMutex.Lock()
+	defer fake.isSuspendedMutex.Unlock()
+	fake.IsSuspendedStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspendedArgsForCall(i int) string {
+	fake.isSuspendedMutex.RLock()
+	defer fake.isSuspendedMutex.RUnlock()
+	argsForCall := fake.isSuspendedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspendedReturns(result1 bool, result2 error) {
+	fake.isSuspendedMutex.Lock()
+	defer fake.isSuspendedMutex.Unlock()
+	fake.IsSuspendedStub = nil
+	fake.isSuspendedReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) IsSuspendedReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.isSuspendedMutex.Lock()
+	defer fake.isSuspendedMutex.Unlock()
+	fake.IsSuspendedStub = nil
+	if fake.isSuspendedReturnsOnCall == nil {
+		fake.isSuspendedReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.isSuspendedReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLocalInstanceRepository) Lock(arg1 *redis.Instance, arg2 string) error {
 	fake.lockMutex.Lock()
 	ret, specificReturn := fake.lockReturnsOnCall[len(fake.lockArgsForCall)]
 	fake.lockArgsForCall = append(fake.lockArgsForCall, struct {
 		arg1 *redis.Instance
-	}{arg1})
-	fake.recordInvocation("Lock", []interface{}{arg1})
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.LockStub
+	fakeReturns := fake.lockReturns
+	fake.recordInvocation("Lock", []interface{}{arg1, arg2})
 	fake.lockMutex.Unlock()
-	if fake.LockStub != nil {
-		return fake.LockStub(arg1)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.lockReturns
 	return fakeReturns.result1
 }
 
@@ -643,17 +1042,17 @@ func (fake *FakeLocalInstanceRepository) LockCallCount() int {
 	return len(fake.lockArgsForCall)
 }
 
-func (fake *FakeLocalInstanceRepository) LockCalls(stub func(*redis.Instance) error) {
+func (fake *FakeLocalInstanceRepository) LockCalls(stub func(*redis.Instance, string) error) {
 	fake.lockMutex.Lock()
 	defer fake.lockMutex.Unlock()
 	fake.LockStub = stub
 }
 
-func (fake *FakeLocalInstanceRepository) LockArgsForCall(i int) *redis.Instance {
+func (fake *FakeLocalInstanceRepository) LockArgsForCall(i int) (*redis.Instance, string) {
 	fake.lockMutex.RLock()
 	defer fake.lockMutex.RUnlock()
 	argsForCall := fake.lockArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeLocalInstanceRepository) LockReturns(result1 error) {
@@ -679,21 +1078,84 @@ func (fake *FakeLocalInstanceRepository) LockReturnsOnCall(i int, result1 error)
 	}{result1}
 }
 
-func (fake *FakeLocalInstanceRepository) Setup(arg1 *redis.Instance) error {
+func (fake *FakeLocalInstanceRepository) MarkSuspended(arg1 string) error {
+	fake.markSuspendedMutex.Lock()
+	ret, specificReturn := fake.markSuspendedReturnsOnCall[len(fake.markSuspendedArgsForCall)]
+	fake.markSuspendedArgsForCall = append(fake.markSuspendedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.MarkSuspendedStub
+	fakeReturns := fake.markSuspendedReturns
+	fake.recordInvocation("MarkSuspended", []interface{}{arg1})
+	fake.markSuspendedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLocalInstanceRepository) MarkSuspendedCallCount() int {
+	fake.markSuspendedMutex.RLock()
+	defer fake.markSuspendedMutex.RUnlock()
+	return len(fake.markSuspendedArgsForCall)
+}
+
+func (fake *FakeLocalInstanceRepository) MarkSuspendedCalls(stub func(string) error) {
+	fake.markSuspendedMutex.Lock()
+	defer fake.markSuspendedMutex.Unlock()
+	fake.MarkSuspendedStub = stub
+}
+
+func (fake *FakeLocalInstanceRepository) MarkSuspendedArgsForCall(i int) string {
+	fake.markSuspendedMutex.RLock()
+	defer fake.markSuspendedMutex.RUnlock()
+	argsForCall := fake.markSuspendedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLocalInstanceRepository) MarkSuspendedReturns(result1 error) {
+	fake.markSuspendedMutex.Lock()
+	defer fake.markSuspendedMutex.Unlock()
+	fake.MarkSuspendedStub = nil
+	fake.markSuspendedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLocalInstanceRepository) MarkSuspendedReturnsOnCall(i int, result1 error) {
+	fake.markSuspendedMutex.Lock()
+	defer fake.markSuspendedMutex.Unlock()
+	fake.MarkSuspendedStub = nil
+	if fake.markSuspendedReturnsOnCall == nil {
+		fake.markSuspendedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.markSuspendedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLocalInstanceRepository) Setup(arg1 *redis.Instance, arg2 redisconf.Conf) error {
 	fake.setupMutex.Lock()
 	ret, specificReturn := fake.setupReturnsOnCall[len(fake.setupArgsForCall)]
 	fake.setupArgsForCall = append(fake.setupArgsForCall, struct {
 		arg1 *redis.Instance
-	}{arg1})
-	fake.recordInvocation("Setup", []interface{}{arg1})
+		arg2 redisconf.Conf
+	}{arg1, arg2})
+	stub := fake.SetupStub
+	fakeReturns := fake.setupReturns
+	fake.recordInvocation("Setup", []interface{}{arg1, arg2})
 	fake.setupMutex.Unlock()
-	if fake.SetupStub != nil {
-		return fake.SetupStub(arg1)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.setupReturns
 	return fakeReturns.result1
 }
 
@@ -703,17 +1165,17 @@ func (fake *FakeLocalInstanceRepository) SetupCallCount() int {
 	return len(fake.setupArgsForCall)
 }
 
-func (fake *FakeLocalInstanceRepository) SetupCalls(stub func(*redis.Instance) error) {
+func (fake *FakeLocalInstanceRepository) SetupCalls(stub func(*redis.Instance, redisconf.Conf) error) {
 	fake.setupMutex.Lock()
 	defer fake.setupMutex.Unlock()
 	fake.SetupStub = stub
 }
 
-func (fake *FakeLocalInstanceRepository) SetupArgsForCall(i int) *redis.Instance {
+func (fake *FakeLocalInstanceRepository) SetupArgsForCall(i int) (*redis.Instance, redisconf.Conf) {
 	fake.setupMutex.RLock()
 	defer fake.setupMutex.RUnlock()
 	argsForCall := fake.setupArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeLocalInstanceRepository) SetupReturns(result1 error) {
@@ -745,15 +1207,16 @@ func (fake *FakeLocalInstanceRepository) Unlock(arg1 *redis.Instance) error {
 	fake.unlockArgsForCall = append(fake.unlockArgsForCall, struct {
 		arg1 *redis.Instance
 	}{arg1})
+	stub := fake.UnlockStub
+	fakeReturns := fake.unlockReturns
 	fake.recordInvocation("Unlock", []interface{}{arg1})
 	fake.unlockMutex.Unlock()
-	if fake.UnlockStub != nil {
-		return fake.UnlockStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.unlockReturns
 	return fakeReturns.result1
 }
 
@@ -802,6 +1265,10 @@ func (fake *FakeLocalInstanceRepository) UnlockReturnsOnCall(i int, result1 erro
 func (fake *FakeLocalInstanceRepository) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.clearFailedMutex.RLock()
+	defer fake.clearFailedMutex.RUnlock()
+	fake.clearSuspendedMutex.RLock()
+	defer fake.clearSuspendedMutex.RUnlock()
 	fake.deleteMutex.RLock()
 	defer fake.deleteMutex.RUnlock()
 	fake.findByIDMutex.RLock()
@@ -818,8 +1285,16 @@ func (fake *FakeLocalInstanceRepository) Invocations() map[string][][]interface{
 	defer fake.instanceLogFilePathMutex.RUnlock()
 	fake.instancePidFilePathMutex.RLock()
 	defer fake.instancePidFilePathMutex.RUnlock()
+	fake.instanceStateMutex.RLock()
+	defer fake.instanceStateMutex.RUnlock()
+	fake.isFailedMutex.RLock()
+	defer fake.isFailedMutex.RUnlock()
+	fake.isSuspendedMutex.RLock()
+	defer fake.isSuspendedMutex.RUnlock()
 	fake.lockMutex.RLock()
 	defer fake.lockMutex.RUnlock()
+	fake.markSuspendedMutex.RLock()
+	defer fake.markSuspendedMutex.RUnlock()
 	fake.setupMutex.RLock()
 	defer fake.setupMutex.RUnlock()
 	fake.unlockMutex.RLock()
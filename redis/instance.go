@@ -1,6 +1,13 @@
 package redis
 
-import "net"
+import (
+	"net"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+)
+
+const connectTimeout = 5 * time.Second
 
 type Instance struct {
 	ID       string
@@ -15,3 +22,19 @@ func (instance Instance) Address() *net.TCPAddr {
 		Port: instance.Port,
 	}
 }
+
+// Connector connects to an instance. aliases holds the commands the
+// instance's redis.conf renames.
+type Connector func(instance *Instance, aliases map[string]string) (client.Client, error)
+
+// Connect connects to an instance, sending the commands in aliases under the
+// names its redis.conf gives them.
+func Connect(instance *Instance, aliases map[string]string) (client.Client, error) {
+	return client.Connect(
+		client.Host(instance.Host),
+		client.Port(instance.Port),
+		client.Password(instance.Password),
+		client.CmdAliases(aliases),
+		client.Timeout(connectTimeout),
+	)
+}
@@ -0,0 +1,308 @@
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	LockPurposeProvision   = "provision"
+	LockPurposeDeprovision = "deprovision"
+
+	defaultLockLease = 10 * time.Minute
+	lockRetryTimeout = time.Second
+)
+
+var ErrInstanceLocked = errors.New("instance is locked by another operation")
+
+// InstanceLock is the lease a broker takes on an instance while provisioning
+// or deprovisioning it. The owning process holds an flock on the lock file for
+// as long as the lease is held, so a lease whose owner has died, or that has
+// outlived its expiry, is stale and no longer stops the process monitor from
+// supervising the instance.
+type InstanceLock struct {
+	InstanceID string    `json:"instance_id"`
+	OwnerPid   int       `json:"owner_pid,omitempty"`
+	OwnerHost  string    `json:"owner_host,omitempty"`
+	Purpose    string    `json:"purpose,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Held       bool      `json:"held"`
+	Stale      bool      `json:"stale"`
+}
+
+func (repo *LocalRepository) Lock(instance *Instance, purpose string) error {
+	file, err := openLockFile(repo.lockFilePath(instance.ID))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	host, _ := os.Hostname()
+	lease := InstanceLock{
+		InstanceID: instance.ID,
+		OwnerPid:   os.Getpid(),
+		OwnerHost:  host,
+		Purpose:    purpose,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(repo.lockLease()),
+	}
+
+	data, err := json.Marshal(lease)
+	if err == nil {
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		_, err = file.WriteAt(data, 0)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	repo.leaseMutex.Lock()
+	repo.leases[instance.ID] = file
+	repo.leaseMutex.Unlock()
+
+	return nil
+}
+
+// Unlock removes the lock file and releases the lease, even when the file is
+// already gone because the lock was released by force. The file is removed
+// while the flock is still held, and only if it is the file the lease was
+// taken on, so that the lock of a later owner is never removed; anyone who
+// was waiting for the flock notices that the file was unlinked and opens the
+// new one instead.
+func (repo *LocalRepository) Unlock(instance *Instance) error {
+	defer repo.releaseLease(instance.ID)
+
+	lockFilePath := repo.lockFilePath(instance.ID)
+
+	repo.leaseMutex.Lock()
+	file, leased := repo.leases[instance.ID]
+	repo.leaseMutex.Unlock()
+
+	if leased && !linkedAt(file, lockFilePath) {
+		return nil
+	}
+
+	err := os.Remove(lockFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// ForceUnlock removes the lock of an instance regardless of who holds it. It
+// is meant for operators recovering instances whose lock was left behind.
+func (repo *LocalRepository) ForceUnlock(instanceID string) error {
+	lock, err := repo.InstanceLock(instanceID)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil {
+		return nil
+	}
+
+	err = os.Remove(repo.lockFilePath(instanceID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	repo.releaseLease(instanceID)
+
+	repo.Logger.Info("force-unlock-instance", lager.Data{
+		"instance_id": instanceID,
+		"lock":        lock,
+	})
+
+	return nil
+}
+
+func (repo *LocalRepository) IsLocked(instanceID string) (bool, error) {
+	lock, err := repo.InstanceLock(instanceID)
+	if err != nil || lock == nil {
+		return false, err
+	}
+
+	if lock.Stale {
+		repo.Logger.Debug("stale-instance-lock", lager.Data{
+			"instance_id": instanceID,
+			"lock":        lock,
+		})
+	}
+
+	return !lock.Stale, nil
+}
+
+// InstanceLock returns the lock of an instance, or nil if it is not locked.
+func (repo *LocalRepository) InstanceLock(instanceID string) (*InstanceLock, error) {
+	lockFilePath := repo.lockFilePath(instanceID)
+
+	file, err := os.Open(lockFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &InstanceLock{}
+	if json.Unmarshal(data, lock) != nil || lock.AcquiredAt.IsZero() {
+		// lock files written by older brokers are empty, so their lease is
+		// taken from when they were created
+		lock = &InstanceLock{
+			AcquiredAt: info.ModTime().UTC(),
+			ExpiresAt:  info.ModTime().UTC().Add(repo.lockLease()),
+		}
+	}
+	lock.InstanceID = instanceID
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	}
+	lock.Held = err != nil
+
+	ownerGone := lock.OwnerPid != 0 && !lock.Held
+	lock.Stale = ownerGone || time.Now().After(lock.ExpiresAt)
+
+	return lock, nil
+}
+
+func (repo *LocalRepository) InstanceLocks() ([]InstanceLock, error) {
+	instanceDirs, err := ioutil.ReadDir(repo.RedisConf.InstanceDataDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	// files that were left in the data directory, or instances whose lock
+	// cannot be read, must not hide the locks of every other instance
+	locks := []InstanceLock{}
+	for _, instanceDir := range instanceDirs {
+		if !instanceDir.IsDir() {
+			continue
+		}
+
+		lock, err := repo.InstanceLock(instanceDir.Name())
+		if err != nil {
+			repo.Logger.Error("read-instance-lock", err, lager.Data{
+				"instance_id": instanceDir.Name(),
+			})
+			continue
+		}
+
+		if lock != nil {
+			locks = append(locks, *lock)
+		}
+	}
+
+	return locks, nil
+}
+
+func (repo *LocalRepository) releaseLease(instanceID string) {
+	repo.leaseMutex.Lock()
+	defer repo.leaseMutex.Unlock()
+
+	file, ok := repo.leases[instanceID]
+	if !ok {
+		return
+	}
+
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	file.Close()
+	delete(repo.leases, instanceID)
+}
+
+func (repo *LocalRepository) lockLease() time.Duration {
+	if repo.RedisConf.LockLeaseSeconds <= 0 {
+		return defaultLockLease
+	}
+
+	return time.Duration(repo.RedisConf.LockLeaseSeconds) * time.Second
+}
+
+func (repo *LocalRepository) lockFilePath(instanceID string) string {
+	return resolvedPath(repo.RedisConf.InstanceDataDirectory, instanceID, "lock")
+}
+
+// openLockFile opens the lock file and takes an exclusive flock on it. A file
+// that was unlinked while waiting for the flock was released by its owner, so
+// the file that replaced it is locked instead.
+func openLockFile(lockFilePath string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, err
+		}
+
+		err = flockWithRetry(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if linkedAt(file, lockFilePath) {
+			return file, nil
+		}
+
+		file.Close()
+	}
+}
+
+// linkedAt reports whether path still refers to the open file.
+func linkedAt(file *os.File, path string) bool {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(openInfo, pathInfo)
+}
+
+// flockWithRetry takes an exclusive flock, allowing for someone briefly
+// inspecting the lock, but failing if the lock is held by another owner.
+func flockWithRetry(file *os.File) error {
+	deadline := time.Now().Add(lockRetryTimeout)
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return ErrInstanceLocked
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
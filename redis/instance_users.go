@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"code.cloudfoundry.org/lager/v3"
+
+	"github.com/pivotal-cf/cf-redis-broker/system"
+)
+
+//go:generate counterfeiter -o fakes/fake_instance_users.go . InstanceUsers
+type InstanceUsers interface {
+	Create(instanceID string) (system.User, error)
+	Remove(instanceID string) error
+}
+
+// InstanceCredential returns the credential that the instance's redis-server
+// runs with, or nil when instances run as the broker's user. It creates the
+// instance's user if needed, so that instances provisioned before users were
+// isolated are moved to their own user when they are next started.
+func (repo *LocalRepository) InstanceCredential(instanceID string) (*syscall.Credential, error) {
+	if repo.Users == nil {
+		return nil, nil
+	}
+
+	user, err := repo.assignInstanceUser(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syscall.Credential{Uid: user.UID, Gid: user.GID}, nil
+}
+
+// assignInstanceUser hands the files that redis-server writes to the
+// instance's user. The instance directory and redis.conf stay owned by the
+// broker and are only readable by the instance's group, because the broker
+// keeps its lock and marker files there.
+func (repo *LocalRepository) assignInstanceUser(instanceID string) (system.User, error) {
+	err := repo.ValidateInstanceID(instanceID)
+	if err != nil {
+		return system.User{}, err
+	}
+
+	user, err := repo.Users.Create(instanceID)
+	if err != nil {
+		return system.User{}, err
+	}
+
+	for _, root := range []string{
+		repo.RedisConf.InstanceDataDirectory,
+		repo.RedisConf.InstanceLogDirectory,
+		repo.RedisConf.PidfileDirectory,
+	} {
+		err = allowTraversal(root)
+		if err != nil {
+			return system.User{}, err
+		}
+	}
+
+	for _, path := range []string{repo.InstanceBaseDir(instanceID), repo.InstanceConfigPath(instanceID)} {
+		err = os.Lchown(path, -1, int(user.GID))
+		if err != nil {
+			return system.User{}, err
+		}
+	}
+
+	err = os.Chmod(repo.InstanceBaseDir(instanceID), 0750)
+	if err != nil {
+		return system.User{}, err
+	}
+
+	err = os.Chmod(repo.InstanceConfigPath(instanceID), 0640)
+	if err != nil {
+		return system.User{}, err
+	}
+
+	for _, dir := range []string{repo.InstanceDataDir(instanceID), repo.InstanceLogDir(instanceID)} {
+		err = chownTree(dir, user)
+		if err != nil {
+			return system.User{}, err
+		}
+	}
+
+	// redis-server cannot create its pidfile in the shared pidfile directory,
+	// so an empty one is created for it
+	pidfile, err := os.OpenFile(repo.InstancePidFilePath(instanceID), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return system.User{}, err
+	}
+	pidfile.Close()
+
+	err = os.Lchown(repo.InstancePidFilePath(instanceID), int(user.UID), int(user.GID))
+	if err != nil {
+		return system.User{}, err
+	}
+
+	return user, nil
+}
+
+func (repo *LocalRepository) removeInstanceUser(instanceID string) {
+	if repo.Users == nil {
+		return
+	}
+
+	err := repo.Users.Remove(instanceID)
+	if err != nil {
+		repo.Logger.Error("remove-instance-user", err, lager.Data{
+			"instance_id": instanceID,
+		})
+	}
+}
+
+// chownTree does not follow symlinks, which redis-server could have created.
+func chownTree(root string, user system.User) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return os.Lchown(path, int(user.UID), int(user.GID))
+	})
+}
+
+// allowTraversal lets every user reach the instance directories below dir
+// without being able to list them.
+func allowTraversal(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm()&0001 != 0 {
+		return nil
+	}
+
+	return os.Chmod(dir, info.Mode().Perm()|0001)
+}
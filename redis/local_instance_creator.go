@@ -3,11 +3,13 @@ package redis
 import (
 	"errors"
 	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+	"os"
 	"time"
 
 	"github.com/pborman/uuid"
 
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
 //go:generate counterfeiter -o fakes/fake_process_controller.go . ProcessController
@@ -20,25 +22,41 @@ type ProcessController interface {
 type LocalInstanceRepository interface {
 	FindByID(instanceID string) (*Instance, error)
 	InstanceExists(instanceID string) (bool, error)
-	Setup(instance *Instance) error
+	Setup(instance *Instance, config redisconf.Conf) error
 	Delete(instanceID string) error
 	InstanceDataDir(instanceID string) string
 	InstanceConfigPath(instanceID string) string
 	InstanceLogFilePath(instanceID string) string
 	InstancePidFilePath(instanceID string) string
 	InstanceCount() (int, []error)
-	Lock(instance *Instance) error
+	Lock(instance *Instance, purpose string) error
 	Unlock(instance *Instance) error
+	MarkSuspended(instanceID string) error
+	ClearSuspended(instanceID string) error
+	IsSuspended(instanceID string) (bool, error)
+	ClearFailed(instanceID string) error
+	IsFailed(instanceID string) (bool, error)
+	InstanceState(instanceID string) (string, error)
 }
 
+//go:generate counterfeiter -o fakes/fake_port_allocator.go . PortAllocator
+type PortAllocator interface {
+	Reserve(instanceID string) (int, error)
+	Release(instanceID string) error
+}
+
+var ErrInstanceNotResumable = errors.New("instance is neither suspended nor failed")
+
 type LocalInstanceCreator struct {
 	LocalInstanceRepository
-	FindFreePort       func() (int, error)
+	PortAllocator      PortAllocator
 	ProcessController  ProcessController
 	RedisConfiguration brokerconfig.ServiceConfiguration
 }
 
-func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) error {
+// Create provisions an instance whose redis.conf sets the directives in config
+// on top of the template and the plan config.
+func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string, config redisconf.Conf) error {
 	instanceCount, errs := localInstanceCreator.InstanceCount()
 	if len(errs) > 0 {
 		return errors.New("Failed to determine current instance count, view broker logs for details")
@@ -48,11 +66,16 @@ func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) erro
 		return brokerapiresponses.ErrInstanceLimitMet
 	}
 
-	port, err := localInstanceCreator.FindFreePort()
+	port, err := localInstanceCreator.PortAllocator.Reserve(instanceID)
 	if err != nil {
 		return err
 	}
 
+	steps := rollbackSteps{}
+	steps.add("release port", func() error {
+		return localInstanceCreator.PortAllocator.Release(instanceID)
+	})
+
 	instance := &Instance{
 		ID:       instanceID,
 		Port:     port,
@@ -60,19 +83,31 @@ func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) erro
 		Password: uuid.NewRandom().String(),
 	}
 
-	err = localInstanceCreator.Setup(instance)
+	// Setup can fail half way, so the files are removed whether or not it
+	// succeeded
+	err = localInstanceCreator.Setup(instance, config)
+	steps.add("remove instance files", func() error {
+		return localInstanceCreator.Delete(instanceID)
+	})
 	if err != nil {
-		return err
+		return steps.rollback(instanceID, "set up instance", err)
 	}
 
 	err = localInstanceCreator.startLocalInstance(instance)
-	if err != nil {
+	steps.add("stop redis-server", func() error {
+		err := localInstanceCreator.ProcessController.Kill(instance)
+		if processGone(err) {
+			return nil
+		}
 		return err
+	})
+	if err != nil {
+		return steps.rollback(instanceID, "start redis-server", err)
 	}
 
 	err = localInstanceCreator.Unlock(instance)
 	if err != nil {
-		return err
+		return steps.rollback(instanceID, "unlock instance", err)
 	}
 
 	return nil
@@ -84,17 +119,93 @@ func (localInstanceCreator *LocalInstanceCreator) Destroy(instanceID string) err
 		return err
 	}
 
-	err = localInstanceCreator.Lock(instance)
+	err = localInstanceCreator.Lock(instance, LockPurposeDeprovision)
 	if err != nil {
 		return err
 	}
 
+	// a pidfile that is missing, points at a dead process or at some other
+	// process is left over from an instance that is no longer running, such
+	// as one that crashed or was suspended
 	err = localInstanceCreator.ProcessController.Kill(instance)
+	if err != nil && !processGone(err) {
+		return errors.Join(err, localInstanceCreator.Unlock(instance))
+	}
+
+	// the lock is removed along with the instance files, so it only has to be
+	// released when they could not all be removed
+	err = localInstanceCreator.Delete(instanceID)
+	if err != nil {
+		return errors.Join(err, localInstanceCreator.Unlock(instance))
+	}
+
+	return localInstanceCreator.PortAllocator.Release(instanceID)
+}
+
+// Suspend stops the redis-server process of an instance while keeping its data
+// and configuration. The instance is marked as suspended before the process is
+// killed so that the process monitor does not restart it in between, and the
+// mark is cleared again if the process could not be killed.
+func (localInstanceCreator *LocalInstanceCreator) Suspend(instanceID string) error {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	err = localInstanceCreator.MarkSuspended(instanceID)
+	if err != nil {
+		return err
+	}
+
+	err = localInstanceCreator.ProcessController.Kill(instance)
+	if err != nil && !processGone(err) {
+		return errors.Join(err, localInstanceCreator.ClearSuspended(instanceID))
+	}
+
+	// the pidfile would otherwise point at a pid that may be reused before
+	// the instance is resumed or deprovisioned
+	err = os.Remove(localInstanceCreator.InstancePidFilePath(instanceID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Resume starts a suspended or failed instance again and hands it back to the
+// process monitor. The suspended and failed states are only cleared once
+// redis-server is accepting connections.
+func (localInstanceCreator *LocalInstanceCreator) Resume(instanceID string) error {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	suspended, err := localInstanceCreator.IsSuspended(instanceID)
+	if err != nil {
+		return err
+	}
+
+	failed, err := localInstanceCreator.IsFailed(instanceID)
+	if err != nil {
+		return err
+	}
+
+	if !suspended && !failed {
+		return ErrInstanceNotResumable
+	}
+
+	err = localInstanceCreator.startLocalInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	err = localInstanceCreator.ClearFailed(instanceID)
 	if err != nil {
 		return err
 	}
 
-	return localInstanceCreator.Delete(instanceID)
+	return localInstanceCreator.ClearSuspended(instanceID)
 }
 
 func (localInstanceCreator *LocalInstanceCreator) startLocalInstance(instance *Instance) error {
@@ -2,28 +2,26 @@ package redis_test
 
 import (
 	"errors"
+	"os"
+	"syscall"
+
 	brokerapiresponses "github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/pborman/uuid"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/process"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
 	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
 )
 
-var freePortsFound int
-
-func fakeFreePortFinder() (int, error) {
-	freePortsFound++
-	return 8080, nil
-}
-
 var _ = Describe("Local Redis Creator", func() {
 	var (
 		instanceID            string
 		fakeProcessController *fakes.FakeProcessController
 		fakeLocalRepository   *fakes.FakeLocalRepository
+		fakePortAllocator     *fakes.FakePortAllocator
 		localInstanceCreator  *redis.LocalInstanceCreator
 	)
 
@@ -31,9 +29,11 @@ var _ = Describe("Local Redis Creator", func() {
 		instanceID = uuid.NewRandom().String()
 		fakeProcessController = new(fakes.FakeProcessController)
 		fakeLocalRepository = new(fakes.FakeLocalRepository)
+		fakePortAllocator = new(fakes.FakePortAllocator)
+		fakePortAllocator.ReserveReturns(8080, nil)
 
 		localInstanceCreator = &redis.LocalInstanceCreator{
-			FindFreePort:            fakeFreePortFinder,
+			PortAllocator:           fakePortAllocator,
 			ProcessController:       fakeProcessController,
 			LocalInstanceRepository: fakeLocalRepository,
 			RedisConfiguration: brokerconfig.ServiceConfiguration{
@@ -49,22 +49,25 @@ var _ = Describe("Local Redis Creator", func() {
 			})
 
 			It("should return an error if unable to retrieve instance count", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, nil)
 				Expect(err).To(HaveOccurred())
 			})
 		})
 
 		Context("when the service instance limit has not been met", func() {
-			BeforeEach(func() {
-				freePortsFound = 0
-			})
-
 			It("starts a redis instance", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, nil)
 				Expect(err).NotTo(HaveOccurred())
 
-				By("finding a free port", func() {
-					Expect(freePortsFound).To(Equal(1))
+				By("reserving a port for the instance", func() {
+					Expect(fakePortAllocator.ReserveCallCount()).To(Equal(1))
+					Expect(fakePortAllocator.ReserveArgsForCall(0)).To(Equal(instanceID))
+				})
+
+				By("setting up the instance on the reserved port", func() {
+					Expect(fakeLocalRepository.SetupCallCount()).To(Equal(1))
+					setupInstance, _ := fakeLocalRepository.SetupArgsForCall(0)
+					Expect(setupInstance.Port).To(Equal(8080))
 				})
 
 				By("starting a new redis instance with the correct ID", func() {
@@ -81,24 +84,127 @@ var _ = Describe("Local Redis Creator", func() {
 
 			Context("when there is not a free port available", func() {
 				BeforeEach(func() {
-					localInstanceCreator.FindFreePort = func() (int, error) { return 0, errors.New("port not found") }
+					fakePortAllocator.ReserveReturns(0, errors.New("port not found"))
 				})
 
 				It("returns an error", func() {
-					err := localInstanceCreator.Create(instanceID)
+					err := localInstanceCreator.Create(instanceID, nil)
 					Expect(err).To(MatchError("port not found"))
 				})
 			})
 
 		})
 
+		Context("when a provisioning step fails", func() {
+			var rollbackOrder []string
+
+			BeforeEach(func() {
+				rollbackOrder = []string{}
+				fakeProcessController.KillStub = func(*redis.Instance) error {
+					rollbackOrder = append(rollbackOrder, "kill")
+					return nil
+				}
+				fakeLocalRepository.DeleteStub = func(string) error {
+					rollbackOrder = append(rollbackOrder, "delete")
+					return nil
+				}
+				fakePortAllocator.ReleaseStub = func(string) error {
+					rollbackOrder = append(rollbackOrder, "release")
+					return nil
+				}
+			})
+
+			Context("when redis-server does not become ready", func() {
+				BeforeEach(func() {
+					fakeProcessController.StartAndWaitUntilReadyReturns(errors.New("timed out"))
+				})
+
+				It("stops the process, removes the instance files and releases the port", func() {
+					err := localInstanceCreator.Create(instanceID, nil)
+					Expect(err).To(HaveOccurred())
+
+					Expect(rollbackOrder).To(Equal([]string{"kill", "delete", "release"}))
+					Expect(fakeProcessController.KillArgsForCall(0).ID).To(Equal(instanceID))
+					Expect(fakeLocalRepository.DeleteArgsForCall(0)).To(Equal(instanceID))
+					Expect(fakePortAllocator.ReleaseArgsForCall(0)).To(Equal(instanceID))
+				})
+
+				It("returns an error describing the failed step", func() {
+					err := localInstanceCreator.Create(instanceID, nil)
+
+					var provisioningErr *redis.ProvisioningError
+					Expect(errors.As(err, &provisioningErr)).To(BeTrue())
+					Expect(provisioningErr.Step).To(Equal("start redis-server"))
+					Expect(err).To(MatchError(ContainSubstring("failed to start redis-server: timed out")))
+				})
+
+				It("does not unlock the instance", func() {
+					localInstanceCreator.Create(instanceID, nil)
+					Expect(fakeLocalRepository.UnlockCallCount()).To(BeZero())
+				})
+
+				Context("and the process was never started", func() {
+					BeforeEach(func() {
+						fakeProcessController.KillStub = nil
+						fakeProcessController.KillReturns(&os.PathError{Op: "open", Path: "pidfile", Err: os.ErrNotExist})
+					})
+
+					It("still rolls back the rest", func() {
+						err := localInstanceCreator.Create(instanceID, nil)
+						Expect(err).NotTo(MatchError(ContainSubstring("rollback incomplete")))
+						Expect(rollbackOrder).To(Equal([]string{"delete", "release"}))
+					})
+				})
+
+				Context("and rolling back fails", func() {
+					BeforeEach(func() {
+						fakeLocalRepository.DeleteStub = nil
+						fakeLocalRepository.DeleteReturns(errors.New("device busy"))
+					})
+
+					It("reports what could not be undone", func() {
+						err := localInstanceCreator.Create(instanceID, nil)
+						Expect(err).To(MatchError(ContainSubstring("rollback incomplete: remove instance files: device busy")))
+						Expect(rollbackOrder).To(Equal([]string{"kill", "release"}))
+					})
+				})
+			})
+
+			Context("when setting up the instance fails", func() {
+				BeforeEach(func() {
+					fakeLocalRepository.SetupReturns(errors.New("disk full"))
+				})
+
+				It("removes whatever was set up and releases the port", func() {
+					err := localInstanceCreator.Create(instanceID, nil)
+					Expect(err).To(MatchError(ContainSubstring("failed to set up instance: disk full")))
+
+					Expect(rollbackOrder).To(Equal([]string{"delete", "release"}))
+					Expect(fakeProcessController.StartAndWaitUntilReadyCallCount()).To(BeZero())
+				})
+			})
+
+			Context("when unlocking the instance fails", func() {
+				BeforeEach(func() {
+					fakeLocalRepository.UnlockReturns(errors.New("permission denied"))
+				})
+
+				It("rolls back the started instance", func() {
+					err := localInstanceCreator.Create(instanceID, nil)
+					Expect(err).To(MatchError(ContainSubstring("failed to unlock instance")))
+
+					Expect(rollbackOrder).To(Equal([]string{"kill", "delete", "release"}))
+				})
+			})
+		})
+
 		Context("when the service instance limit has been met", func() {
 			BeforeEach(func() {
 				fakeLocalRepository.InstanceCountReturns(1, []error{})
 			})
 
 			It("does not start a new Redis instance", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, nil)
 				Expect(err).To(MatchError(brokerapiresponses.ErrInstanceLimitMet))
 
 				Expect(fakeProcessController.StartAndWaitUntilReadyCallCount()).To(Equal(0))
@@ -123,7 +229,9 @@ var _ = Describe("Local Redis Creator", func() {
 
 				By("calling lock before stopping redis", func() {
 					Expect(fakeLocalRepository.LockCallCount()).To(Equal(1))
-					Expect(fakeLocalRepository.LockArgsForCall(0).ID).To(Equal(instanceID))
+					lockedInstance, purpose := fakeLocalRepository.LockArgsForCall(0)
+					Expect(lockedInstance.ID).To(Equal(instanceID))
+					Expect(purpose).To(Equal(redis.LockPurposeDeprovision))
 				})
 
 				By("killing the instance", func() {
@@ -135,6 +243,113 @@ var _ = Describe("Local Redis Creator", func() {
 					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
 					Expect(fakeLocalRepository.DeleteArgsForCall(0)).To(Equal(instanceID))
 				})
+
+				By("releasing the port of the instance", func() {
+					Expect(fakePortAllocator.ReleaseCallCount()).To(Equal(1))
+					Expect(fakePortAllocator.ReleaseArgsForCall(0)).To(Equal(instanceID))
+				})
+			})
+
+			Context("and its pidfile points at another process", func() {
+				BeforeEach(func() {
+					fakeProcessController.KillReturns(process.ErrUnexpectedProcess)
+				})
+
+				It("still deletes the instance", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("and its pidfile points at a process that is gone", func() {
+				BeforeEach(func() {
+					fakeProcessController.KillReturns(&os.PathError{Op: "open", Path: "/proc/12345/comm", Err: syscall.ENOENT})
+				})
+
+				It("still deletes the instance and releases its port", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
+					Expect(fakePortAllocator.ReleaseCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("and its process exited while it was being stopped", func() {
+				BeforeEach(func() {
+					fakeProcessController.KillReturns(os.ErrProcessDone)
+				})
+
+				It("still deletes the instance", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("and it was suspended", func() {
+				BeforeEach(func() {
+					Expect(localInstanceCreator.Suspend(instanceID)).To(Succeed())
+					fakeProcessController.KillReturns(&os.PathError{Op: "open", Path: "pidfile", Err: os.ErrNotExist})
+				})
+
+				It("still deletes the instance", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when stopping the process fails", func() {
+				BeforeEach(func() {
+					fakeProcessController.KillReturns(errors.New("operation not permitted"))
+				})
+
+				It("keeps the instance", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).To(MatchError("operation not permitted"))
+					Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(0))
+				})
+
+				It("releases the lock", func() {
+					localInstanceCreator.Destroy(instanceID)
+
+					Expect(fakeLocalRepository.UnlockCallCount()).To(Equal(1))
+					Expect(fakeLocalRepository.UnlockArgsForCall(0).ID).To(Equal(instanceID))
+				})
+
+				Context("and releasing the lock fails too", func() {
+					BeforeEach(func() {
+						fakeLocalRepository.UnlockReturns(errors.New("read-only file system"))
+					})
+
+					It("reports both errors", func() {
+						err := localInstanceCreator.Destroy(instanceID)
+						Expect(err).To(MatchError(ContainSubstring("operation not permitted")))
+						Expect(err).To(MatchError(ContainSubstring("read-only file system")))
+					})
+				})
+			})
+
+			Context("when deleting the instance fails", func() {
+				BeforeEach(func() {
+					fakeLocalRepository.DeleteReturns(errors.New("device busy"))
+				})
+
+				It("releases the lock and keeps the port", func() {
+					err := localInstanceCreator.Destroy(instanceID)
+					Expect(err).To(MatchError("device busy"))
+
+					Expect(fakeLocalRepository.UnlockCallCount()).To(Equal(1))
+					Expect(fakePortAllocator.ReleaseCallCount()).To(Equal(0))
+				})
+			})
+
+			It("does not release the lock once the instance is deleted", func() {
+				err := localInstanceCreator.Destroy(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeLocalRepository.UnlockCallCount()).To(Equal(0))
 			})
 		})
 
@@ -152,4 +367,168 @@ var _ = Describe("Local Redis Creator", func() {
 			})
 		})
 	})
+
+	Describe("Suspend", func() {
+		var pidfilePath string
+
+		BeforeEach(func() {
+			fakeLocalRepository.FindByIDReturns(&redis.Instance{ID: instanceID}, nil)
+
+			pidfile, err := os.CreateTemp("", "suspend-pidfile")
+			Expect(err).NotTo(HaveOccurred())
+			pidfile.Close()
+			pidfilePath = pidfile.Name()
+			DeferCleanup(os.RemoveAll, pidfilePath)
+			fakeLocalRepository.InstancePidFilePathReturns(pidfilePath)
+		})
+
+		It("removes the pidfile once the process is killed", func() {
+			err := localInstanceCreator.Suspend(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLocalRepository.InstancePidFilePathArgsForCall(0)).To(Equal(instanceID))
+			Expect(pidfilePath).NotTo(BeAnExistingFile())
+		})
+
+		It("keeps the pidfile when the process cannot be killed", func() {
+			fakeProcessController.KillReturns(errors.New("operation not permitted"))
+
+			err := localInstanceCreator.Suspend(instanceID)
+			Expect(err).To(MatchError("operation not permitted"))
+			Expect(pidfilePath).To(BeAnExistingFile())
+		})
+
+		It("clears the suspended mark when the process cannot be killed", func() {
+			fakeProcessController.KillReturns(errors.New("operation not permitted"))
+
+			err := localInstanceCreator.Suspend(instanceID)
+			Expect(err).To(MatchError("operation not permitted"))
+
+			Expect(fakeLocalRepository.MarkSuspendedCallCount()).To(Equal(1))
+			Expect(fakeLocalRepository.ClearSuspendedCallCount()).To(Equal(1))
+			Expect(fakeLocalRepository.ClearSuspendedArgsForCall(0)).To(Equal(instanceID))
+		})
+
+		It("does not clear the suspended mark once the process is killed", func() {
+			Expect(localInstanceCreator.Suspend(instanceID)).To(Succeed())
+
+			Expect(fakeLocalRepository.ClearSuspendedCallCount()).To(Equal(0))
+		})
+
+		It("can be deprovisioned afterwards", func() {
+			Expect(localInstanceCreator.Suspend(instanceID)).To(Succeed())
+
+			// with its pidfile gone, stopping the instance finds no pidfile
+			fakeProcessController.KillReturns(&os.PathError{Op: "open", Path: pidfilePath, Err: os.ErrNotExist})
+
+			err := localInstanceCreator.Destroy(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(1))
+			Expect(fakePortAllocator.ReleaseCallCount()).To(Equal(1))
+		})
+
+		It("marks the instance as suspended before killing it", func() {
+			fakeLocalRepository.MarkSuspendedStub = func(string) error {
+				Expect(fakeProcessController.KillCallCount()).To(Equal(0))
+				return nil
+			}
+
+			err := localInstanceCreator.Suspend(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLocalRepository.MarkSuspendedCallCount()).To(Equal(1))
+			Expect(fakeLocalRepository.MarkSuspendedArgsForCall(0)).To(Equal(instanceID))
+			Expect(fakeProcessController.KillCallCount()).To(Equal(1))
+			Expect(fakeProcessController.KillArgsForCall(0).ID).To(Equal(instanceID))
+		})
+
+		It("does not delete any instance data", func() {
+			err := localInstanceCreator.Suspend(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLocalRepository.DeleteCallCount()).To(Equal(0))
+		})
+
+		Context("when the instance is not running", func() {
+			BeforeEach(func() {
+				fakeProcessController.KillReturns(os.ErrNotExist)
+			})
+
+			It("still suspends the instance", func() {
+				err := localInstanceCreator.Suspend(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the instance cannot be marked as suspended", func() {
+			BeforeEach(func() {
+				fakeLocalRepository.MarkSuspendedReturns(errors.New("disk full"))
+			})
+
+			It("returns the error and leaves the process running", func() {
+				err := localInstanceCreator.Suspend(instanceID)
+				Expect(err).To(MatchError("disk full"))
+
+				Expect(fakeProcessController.KillCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Resume", func() {
+		BeforeEach(func() {
+			fakeLocalRepository.FindByIDReturns(&redis.Instance{ID: instanceID}, nil)
+		})
+
+		Context("when the instance is suspended", func() {
+			BeforeEach(func() {
+				fakeLocalRepository.IsSuspendedReturns(true, nil)
+			})
+
+			It("starts the instance and clears the suspended state", func() {
+				err := localInstanceCreator.Resume(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeProcessController.StartAndWaitUntilReadyCallCount()).To(Equal(1))
+				Expect(fakeLocalRepository.ClearSuspendedCallCount()).To(Equal(1))
+				Expect(fakeLocalRepository.ClearSuspendedArgsForCall(0)).To(Equal(instanceID))
+			})
+
+			Context("when the instance fails to start", func() {
+				BeforeEach(func() {
+					fakeProcessController.StartAndWaitUntilReadyReturns(errors.New("timeout"))
+				})
+
+				It("keeps the instance suspended", func() {
+					err := localInstanceCreator.Resume(instanceID)
+					Expect(err).To(MatchError("timeout"))
+
+					Expect(fakeLocalRepository.ClearSuspendedCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the instance has been marked as failed", func() {
+			BeforeEach(func() {
+				fakeLocalRepository.IsFailedReturns(true, nil)
+			})
+
+			It("starts the instance and clears the failed state", func() {
+				err := localInstanceCreator.Resume(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeProcessController.StartAndWaitUntilReadyCallCount()).To(Equal(1))
+				Expect(fakeLocalRepository.ClearFailedCallCount()).To(Equal(1))
+				Expect(fakeLocalRepository.ClearFailedArgsForCall(0)).To(Equal(instanceID))
+			})
+		})
+
+		Context("when the instance is neither suspended nor failed", func() {
+			It("returns an error", func() {
+				err := localInstanceCreator.Resume(instanceID)
+				Expect(err).To(Equal(redis.ErrInstanceNotResumable))
+
+				Expect(fakeProcessController.StartAndWaitUntilReadyCallCount()).To(Equal(0))
+			})
+		})
+	})
 })
@@ -1,36 +1,78 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"code.cloudfoundry.org/lager/v3"
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/statestore"
 )
 
 type LocalRepository struct {
 	RedisConf brokerconfig.ServiceConfiguration
 	Logger    lager.Logger
+
+	// State indexes instances and their bindings. Without it, instances are
+	// found by reading every redis.conf in the instance data directory.
+	State *statestore.Store
+
+	// Users, when set, gives every instance its own unprivileged user that
+	// owns the instance's data and logs.
+	Users InstanceUsers
+
+	// RedisVersion is the version of redis-server the instances run. Config
+	// values are only checked against it when it is set.
+	RedisVersion redisconf.Version
+
+	leaseMutex sync.Mutex
+	leases     map[string]*os.File
 }
 
 func NewLocalRepository(redisConf brokerconfig.ServiceConfiguration, logger lager.Logger) *LocalRepository {
 	if redisConf.PidfileDirectory == "" {
 		redisConf.PidfileDirectory = "/var/vcap/sys/run/shared-instance-pidfiles"
 	}
+	if redisConf.EventDirectory == "" {
+		redisConf.EventDirectory = path.Join(path.Dir(redisConf.InstanceDataDirectory), "events")
+	}
+	if redisConf.LockDirectory == "" {
+		redisConf.LockDirectory = path.Join(path.Dir(redisConf.InstanceDataDirectory), "locks")
+	}
+	if redisConf.StateFile == "" {
+		redisConf.StateFile = path.Join(path.Dir(redisConf.InstanceDataDirectory), "state.json")
+	}
 	return &LocalRepository{
 		RedisConf: redisConf,
 		Logger:    logger,
+		leases:    map[string]*os.File{},
 	}
 }
 
 func (repo *LocalRepository) FindByID(instanceID string) (*Instance, error) {
+	if repo.State != nil {
+		record, err := repo.State.Instance(instanceID)
+		if err == nil {
+			return instanceFromRecord(record), nil
+		}
+		if err != statestore.ErrInstanceNotFound {
+			return nil, err
+		}
+	}
+
+	return repo.findByConfig(instanceID)
+}
+
+func (repo *LocalRepository) findByConfig(instanceID string) (*Instance, error) {
 	conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
 	if err != nil {
 		return nil, err
@@ -52,6 +94,16 @@ func (repo *LocalRepository) FindByID(instanceID string) (*Instance, error) {
 }
 
 func (repo *LocalRepository) InstanceExists(instanceID string) (bool, error) {
+	if repo.State != nil {
+		_, err := repo.State.Instance(instanceID)
+		if err == nil {
+			return true, nil
+		}
+		if err != statestore.ErrInstanceNotFound {
+			return false, err
+		}
+	}
+
 	if _, err := os.Stat(repo.InstanceBaseDir(instanceID)); os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
@@ -64,8 +116,18 @@ func (repo *LocalRepository) InstanceExists(instanceID string) (bool, error) {
 // Eventually: make lock the first thing to be called
 // EnsureDirectoriesExist -> EnsureLogDirectoryExists
 
-func (repo *LocalRepository) Setup(instance *Instance) error {
-	err := repo.EnsureDirectoriesExist(instance)
+// Setup creates the instance's directories and redis.conf. config holds the
+// directives the tenant asked for, which become the instance's own layer.
+func (repo *LocalRepository) Setup(instance *Instance, config redisconf.Conf) error {
+	err := repo.ValidateInstanceID(instance.ID)
+	if err != nil {
+		repo.Logger.Error("validate-instance-id", err, lager.Data{
+			"instance_id": instance.ID,
+		})
+		return err
+	}
+
+	err = repo.EnsureDirectoriesExist(instance)
 	if err != nil {
 		repo.Logger.Error("ensure-dirs-exist", err, lager.Data{
 			"instance_id": instance.ID,
@@ -73,7 +135,7 @@ func (repo *LocalRepository) Setup(instance *Instance) error {
 		return err
 	}
 
-	err = repo.Lock(instance)
+	err = repo.Lock(instance, LockPurposeProvision)
 	if err != nil {
 		repo.Logger.Error("lock-shared-instance", err, lager.Data{
 			"instance_id": instance.ID,
@@ -81,6 +143,14 @@ func (repo *LocalRepository) Setup(instance *Instance) error {
 		return err
 	}
 
+	err = repo.writeInstanceLayer(instance.ID, config)
+	if err != nil {
+		repo.Logger.Error("write-instance-config", err, lager.Data{
+			"instance_id": instance.ID,
+		})
+		return err
+	}
+
 	err = repo.WriteConfigFile(instance)
 	if err != nil {
 		repo.Logger.Error("write-config-file", err, lager.Data{
@@ -89,6 +159,24 @@ func (repo *LocalRepository) Setup(instance *Instance) error {
 		return err
 	}
 
+	if repo.Users != nil {
+		_, err = repo.assignInstanceUser(instance.ID)
+		if err != nil {
+			repo.Logger.Error("assign-instance-user", err, lager.Data{
+				"instance_id": instance.ID,
+			})
+			return err
+		}
+	}
+
+	err = repo.saveState(instance)
+	if err != nil {
+		repo.Logger.Error("save-instance-state", err, lager.Data{
+			"instance_id": instance.ID,
+		})
+		return err
+	}
+
 	repo.Logger.Info("provision-instance", lager.Data{
 		"instance_id": instance.ID,
 		"plan":        "shared-vm",
@@ -98,32 +186,174 @@ func (repo *LocalRepository) Setup(instance *Instance) error {
 	return nil
 }
 
-func (repo *LocalRepository) Lock(instance *Instance) error {
-	lockFilePath := repo.lockFilePath(instance)
-	lockFile, err := os.Create(lockFilePath)
+// MarkSuspended records in the instance directory that the instance has been
+// suspended by an operator. Suspended instances keep their data but are not
+// restarted by the process monitor and cannot be bound.
+func (repo *LocalRepository) MarkSuspended(instanceID string) error {
+	err := repo.writeMarker(instanceID, "suspended")
+	if err != nil {
+		return err
+	}
+
+	repo.Logger.Info("suspend-instance", lager.Data{
+		"instance_id": instanceID,
+		"plan":        "shared-vm",
+		"message":     "Marked Redis instance as suspended",
+	})
+
+	return nil
+}
+
+func (repo *LocalRepository) ClearSuspended(instanceID string) error {
+	err := repo.removeMarker(instanceID, "suspended")
+	if err != nil {
+		return err
+	}
+
+	repo.Logger.Info("resume-instance", lager.Data{
+		"instance_id": instanceID,
+		"plan":        "shared-vm",
+		"message":     "Cleared suspended state of Redis instance",
+	})
+
+	return nil
+}
+
+func (repo *LocalRepository) IsSuspended(instanceID string) (bool, error) {
+	return repo.hasMarker(instanceID, "suspended")
+}
+
+// MarkFailed records that the process monitor gave up restarting an instance
+// because it kept crashing. Failed instances are skipped by the process monitor
+// until an operator resumes them.
+func (repo *LocalRepository) MarkFailed(instanceID string) error {
+	err := repo.writeMarker(instanceID, "failed")
 	if err != nil {
 		return err
 	}
-	lockFile.Close()
+
+	repo.Logger.Info("fail-instance", lager.Data{
+		"instance_id": instanceID,
+		"plan":        "shared-vm",
+		"message":     "Marked Redis instance as failed",
+	})
 
 	return nil
 }
 
-func (repo *LocalRepository) Unlock(instance *Instance) error {
-	lockFilePath := repo.lockFilePath(instance)
-	err := os.Remove(lockFilePath)
+func (repo *LocalRepository) ClearFailed(instanceID string) error {
+	return repo.removeMarker(instanceID, "failed")
+}
+
+func (repo *LocalRepository) IsFailed(instanceID string) (bool, error) {
+	return repo.hasMarker(instanceID, "failed")
+}
+
+func (repo *LocalRepository) InstanceState(instanceID string) (string, error) {
+	suspended, err := repo.IsSuspended(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	if suspended {
+		return broker.InstanceStateSuspended, nil
+	}
+
+	failed, err := repo.IsFailed(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	if failed {
+		return broker.InstanceStateFailed, nil
+	}
+
+	return broker.InstanceStateRunning, nil
+}
+
+func (repo *LocalRepository) writeMarker(instanceID, marker string) error {
+	path, err := repo.markerPath(instanceID, marker)
+	if err != nil {
+		return err
+	}
+
+	markerFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	return markerFile.Close()
+}
+
+func (repo *LocalRepository) removeMarker(instanceID, marker string) error {
+	path, err := repo.markerPath(instanceID, marker)
 	if err != nil {
 		return err
 	}
 
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	return nil
 }
 
-func (repo *LocalRepository) lockFilePath(instance *Instance) string {
-	return filepath.Join(repo.InstanceBaseDir(instance.ID), "lock")
+func (repo *LocalRepository) hasMarker(instanceID, marker string) (bool, error) {
+	path, err := repo.markerPath(instanceID, marker)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// markerPath returns an error rather than an empty path for invalid instance
+// IDs, which would otherwise put the marker in the working directory.
+func (repo *LocalRepository) markerPath(instanceID, marker string) (string, error) {
+	return paths.NewResolver(repo.RedisConf.InstanceDataDirectory).Resolve(instanceID, marker)
 }
 
 func (repo *LocalRepository) allInstances(verbose bool) ([]*Instance, []error) {
+	if repo.State != nil {
+		return repo.storedInstances(verbose)
+	}
+
+	return repo.scanInstances(verbose)
+}
+
+func (repo *LocalRepository) storedInstances(verbose bool) ([]*Instance, []error) {
+	instances := []*Instance{}
+
+	records, err := repo.State.Instances()
+	if err != nil {
+		repo.Logger.Error("all-instances", err, lager.Data{
+			"message":    "Error reading shared instances from the state store",
+			"state-file": repo.State.Path,
+		})
+		return instances, []error{err}
+	}
+
+	for _, record := range records {
+		instances = append(instances, instanceFromRecord(record))
+	}
+
+	if verbose {
+		repo.Logger.Info("all-instances", lager.Data{
+			"message": fmt.Sprintf("%d shared Redis instances found in state store: %s", len(instances), repo.State.Path),
+		})
+	}
+
+	return instances, []error{}
+}
+
+func (repo *LocalRepository) scanInstances(verbose bool) ([]*Instance, []error) {
 	if verbose {
 		repo.Logger.Info("all-instances", lager.Data{
 			"message": fmt.Sprintf("Starting shared instance lookup in data directory: %s", repo.RedisConf.InstanceDataDirectory),
@@ -158,7 +388,7 @@ func (repo *LocalRepository) allInstances(verbose bool) ([]*Instance, []error) {
 
 	for _, instanceDir := range instanceDirs {
 
-		instance, err := repo.FindByID(instanceDir.Name())
+		instance, err := repo.findByConfig(instanceDir.Name())
 
 		if err != nil {
 			repo.Logger.Error("all-instances", err, lager.Data{
@@ -194,11 +424,102 @@ func (repo *LocalRepository) InstanceCount() (int, []error) {
 	return len(instances), errs
 }
 
+// OpenState opens the state store and imports the existing instances into it
+// the first time it is used.
+func (repo *LocalRepository) OpenState() error {
+	state, err := statestore.Open(repo.RedisConf.StateFile)
+	if err != nil {
+		return err
+	}
+
+	repo.State = state
+
+	_, err = repo.ImportState()
+	return err
+}
+
+// ImportState fills an empty state store from the instances found in the
+// instance data directory. It is a no-op once the store has been written to.
+func (repo *LocalRepository) ImportState() (int, error) {
+	empty, err := repo.State.Empty()
+	if err != nil || !empty {
+		return 0, err
+	}
+
+	// an instance that cannot be read must not keep the others out of the
+	// store, or the broker and the process monitor would refuse to start
+	instances, errs := repo.scanInstances(false)
+	for _, err := range errs {
+		repo.Logger.Error("import-state", err, lager.Data{
+			"message": "Skipping shared Redis instance that could not be read",
+		})
+	}
+
+	for _, instance := range instances {
+		err := repo.saveState(instance)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	repo.Logger.Info("import-state", lager.Data{
+		"message":    fmt.Sprintf("Imported %d shared Redis instances into the state store", len(instances)),
+		"state-file": repo.State.Path,
+	})
+
+	return len(instances), nil
+}
+
+// SaveInstanceDetails records what the platform provisioned an instance with.
+func (repo *LocalRepository) SaveInstanceDetails(instanceID string, details broker.InstanceDetails) error {
+	if repo.State == nil {
+		return nil
+	}
+
+	return repo.State.UpdateInstance(instanceID, func(record *statestore.Instance) {
+		record.PlanID = details.PlanID
+		record.OrganizationGUID = details.OrganizationGUID
+		record.SpaceGUID = details.SpaceGUID
+		record.Parameters = details.Parameters
+		record.Context = details.Context
+	})
+}
+
+func (repo *LocalRepository) saveState(instance *Instance) error {
+	if repo.State == nil {
+		return nil
+	}
+
+	return repo.State.PutInstance(&statestore.Instance{
+		ID:       instance.ID,
+		Host:     instance.Host,
+		Port:     instance.Port,
+		Password: instance.Password,
+	})
+}
+
+func instanceFromRecord(record *statestore.Instance) *Instance {
+	return &Instance{
+		ID:       record.ID,
+		Host:     record.Host,
+		Port:     record.Port,
+		Password: record.Password,
+	}
+}
+
 func (repo *LocalRepository) Bind(instanceID string, bindingID string) (broker.InstanceCredentials, error) {
 	instance, err := repo.FindByID(instanceID)
 	if err != nil {
 		return broker.InstanceCredentials{}, err
 	}
+
+	if repo.State != nil {
+		err = repo.State.PutBinding(instanceID, bindingID)
+		if err != nil {
+			return broker.InstanceCredentials{}, err
+		}
+	}
+
 	return broker.InstanceCredentials{
 		Host:     instance.Host,
 		Port:     instance.Port,
@@ -207,11 +528,33 @@ func (repo *LocalRepository) Bind(instanceID string, bindingID string) (broker.I
 }
 
 func (repo *LocalRepository) Unbind(instanceID string, bindingID string) error {
-	return nil
+	if repo.State == nil {
+		return nil
+	}
+
+	err := repo.State.DeleteBinding(instanceID, bindingID)
+	if err == statestore.ErrInstanceNotFound {
+		return nil
+	}
+	return err
 }
 
 func (repo *LocalRepository) Delete(instanceID string) error {
-	err := os.RemoveAll(repo.InstanceBaseDir(instanceID))
+	err := repo.ValidateInstanceID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	repo.releaseLease(instanceID)
+
+	if repo.State != nil {
+		err = repo.State.DeleteInstance(instanceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.RemoveAll(repo.InstanceBaseDir(instanceID))
 	if err != nil {
 		return err
 	}
@@ -230,6 +573,8 @@ func (repo *LocalRepository) Delete(instanceID string) error {
 		})
 	}
 
+	repo.removeInstanceUser(instanceID)
+
 	repo.Logger.Info("deprovision-instance", lager.Data{
 		"instance_id": instanceID,
 		"plan":        "shared-vm",
@@ -258,40 +603,240 @@ func (repo *LocalRepository) EnsureDirectoriesExist(instance *Instance) error {
 	return nil
 }
 
+// WriteConfigFile regenerates the instance's redis.conf from its layers: the
+// operator's template, the shared-vm plan config, the instance's own config
+// and finally the directives the broker manages. Each layer overrides the
+// directives it sets in the layers before it, so changes to the template
+// reach every instance without losing what was set for a single instance.
 func (repo *LocalRepository) WriteConfigFile(instance *Instance) error {
-	return redisconf.CopyWithInstanceAdditions(
-		repo.RedisConf.DefaultConfigPath,
+	template, err := redisconf.Load(repo.RedisConf.DefaultConfigPath)
+	if err != nil {
+		return err
+	}
+
+	plan, err := redisconf.Parse(repo.RedisConf.SharedVMConfig...)
+	if err != nil {
+		return fmt.Errorf("invalid shared-vm plan config: %s", err)
+	}
+
+	overrides, err := redisconf.Load(repo.InstanceConfigOverridesPath(instance.ID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return redisconf.WriteLayered(
 		repo.InstanceConfigPath(instance.ID),
-		instance.ID,
-		strconv.Itoa(instance.Port),
-		instance.Password,
-		repo.RedisConf.PidfileDirectory,
+		template,
+		plan,
+		overrides,
+		redisconf.InstanceAdditions(
+			instance.ID,
+			strconv.Itoa(instance.Port),
+			instance.Password,
+			repo.RedisConf.PidfileDirectory,
+		),
 	)
 }
 
+// ValidateParameters rejects the directives of config that a tenant may not
+// set, or that redis-server would refuse.
+func (repo *LocalRepository) ValidateParameters(config redisconf.Conf) error {
+	return config.ValidateParameters(repo.RedisVersion)
+}
+
+// writeInstanceLayer starts the instance's layer with the directives the
+// tenant asked for. Directives a tenant may not set, or that redis-server
+// would refuse, are rejected.
+func (repo *LocalRepository) writeInstanceLayer(instanceID string, config redisconf.Conf) error {
+	err := repo.ValidateParameters(config)
+	if err != nil {
+		return err
+	}
+
+	return config.Save(repo.InstanceConfigOverridesPath(instanceID))
+}
+
+// MigrateInstanceConfig gives an instance that was created before instances
+// had their own layer one, holding the directives its redis.conf sets
+// differently from the template and the shared-vm plan config. Without it,
+// the first WriteConfigFile after an upgrade would drop them. Only
+// redisconf.Tunable directives are kept; the others are left to the template
+// and the broker. Instances that already have a layer are left alone.
+func (repo *LocalRepository) MigrateInstanceConfig(instanceID string) error {
+	overridesPath := repo.InstanceConfigOverridesPath(instanceID)
+	if overridesPath == "" {
+		return paths.ErrOutsideRoot
+	}
+
+	_, err := os.Stat(overridesPath)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	template, err := redisconf.Load(repo.RedisConf.DefaultConfigPath)
+	if err != nil {
+		return err
+	}
+
+	plan, err := redisconf.Parse(repo.RedisConf.SharedVMConfig...)
+	if err != nil {
+		return fmt.Errorf("invalid shared-vm plan config: %s", err)
+	}
+
+	overrides := redisconf.Conf{}
+	for _, param := range redisconf.Diff(conf, redisconf.Merge(template, plan)) {
+		if redisconf.IsTunable(param.Key) {
+			overrides = append(overrides, param)
+		}
+	}
+
+	err = overrides.Save(overridesPath)
+	if err != nil {
+		return err
+	}
+
+	repo.Logger.Info("migrate-instance-config", lager.Data{
+		"instance_id": instanceID,
+		"directives":  len(overrides),
+	})
+
+	return nil
+}
+
+// ValidateTemplate returns an error for every directive in the operator's
+// template and the shared-vm plan config that redis-server would refuse.
+// Directives it does not know are only logged, since redis-server may.
+func (repo *LocalRepository) ValidateTemplate() error {
+	template, err := redisconf.LoadWithIncludes(repo.RedisConf.DefaultConfigPath)
+	if err != nil {
+		return err
+	}
+
+	err = template.Validate(repo.RedisVersion)
+	if err != nil {
+		return fmt.Errorf("invalid redis.conf template %s: %s", repo.RedisConf.DefaultConfigPath, err)
+	}
+	repo.logUnknownDirectives(template, repo.RedisConf.DefaultConfigPath)
+
+	plan, err := redisconf.Parse(repo.RedisConf.SharedVMConfig...)
+	if err == nil {
+		err = plan.Validate(repo.RedisVersion)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid shared-vm plan config: %s", err)
+	}
+	repo.logUnknownDirectives(plan, "shared_vm_config")
+
+	return nil
+}
+
+func (repo *LocalRepository) logUnknownDirectives(conf redisconf.Conf, source string) {
+	for _, directive := range conf.UnknownDirectives() {
+		repo.Logger.Info("validate-redis-config", lager.Data{
+			"message":   "Unknown redis.conf directive, redis-server may refuse to start",
+			"directive": directive,
+			"source":    source,
+		})
+	}
+}
+
+// PersistConfigValue sets key in the instance's redis.conf and records it in
+// the instance's layer, so that the value survives the regeneration of
+// redis.conf by WriteConfigFile. Values redis-server would refuse are not
+// written. Directives that are not in redisconf.Directives are written as
+// they are.
+func (repo *LocalRepository) PersistConfigValue(instanceID, key string, values ...string) error {
+	for _, value := range values {
+		err := redisconf.ValidateDirective(key, value, repo.RedisVersion)
+		if err != nil && !errors.Is(err, redisconf.ErrUnknownDirective) {
+			return err
+		}
+	}
+
+	err := repo.MigrateInstanceConfig(instanceID)
+	if err != nil {
+		return err
+	}
+
+	overridesPath := repo.InstanceConfigOverridesPath(instanceID)
+	overrides, err := redisconf.Load(overridesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	overrides.Replace(key, values...)
+	err = overrides.Save(overridesPath)
+	if err != nil {
+		return err
+	}
+
+	conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+	if err != nil {
+		return err
+	}
+
+	conf.Replace(key, values...)
+	return conf.Save(repo.InstanceConfigPath(instanceID))
+}
+
+// ValidateInstanceID returns an error for instance IDs that cannot be used as
+// the name of the instance directory.
+func (repo *LocalRepository) ValidateInstanceID(instanceID string) error {
+	_, err := paths.NewResolver(repo.RedisConf.InstanceDataDirectory).Resolve(instanceID)
+	return err
+}
+
+// The paths of an instance are empty when the instance ID would resolve
+// outside of the operator's directories. Every file operation rejects or
+// ignores an empty path.
+
 func (repo *LocalRepository) InstanceBaseDir(instanceID string) string {
-	return path.Join(repo.RedisConf.InstanceDataDirectory, instanceID)
+	return resolvedPath(repo.RedisConf.InstanceDataDirectory, instanceID)
 }
 
 func (repo *LocalRepository) InstanceDataDir(instanceID string) string {
-	InstanceBaseDir := repo.InstanceBaseDir(instanceID)
-	return path.Join(InstanceBaseDir, "db")
+	return resolvedPath(repo.RedisConf.InstanceDataDirectory, instanceID, "db")
 }
 
 func (repo *LocalRepository) InstanceLogDir(instanceID string) string {
-	return path.Join(repo.RedisConf.InstanceLogDirectory, instanceID)
+	return resolvedPath(repo.RedisConf.InstanceLogDirectory, instanceID)
 }
 
 func (repo *LocalRepository) InstanceLogFilePath(instanceID string) string {
-	return path.Join(repo.InstanceLogDir(instanceID), "redis-server.log")
+	return resolvedPath(repo.RedisConf.InstanceLogDirectory, instanceID, "redis-server.log")
 }
 
 func (repo *LocalRepository) InstanceConfigPath(instanceID string) string {
-	return path.Join(repo.InstanceBaseDir(instanceID), "redis.conf")
+	return resolvedPath(repo.RedisConf.InstanceDataDirectory, instanceID, "redis.conf")
+}
+
+func (repo *LocalRepository) InstanceConfigOverridesPath(instanceID string) string {
+	return resolvedPath(repo.RedisConf.InstanceDataDirectory, instanceID, "config-overrides.conf")
 }
 
 func (repo *LocalRepository) InstancePidFilePath(instanceID string) string {
-	return path.Join(repo.RedisConf.PidfileDirectory, instanceID+".pid")
+	if repo.ValidateInstanceID(instanceID) != nil {
+		return ""
+	}
+
+	return resolvedPath(repo.RedisConf.PidfileDirectory, instanceID+".pid")
+}
+
+func resolvedPath(root string, names ...string) string {
+	resolved, err := paths.NewResolver(root).Resolve(names...)
+	if err != nil {
+		return ""
+	}
+
+	return resolved
 }
 
 func (repo *LocalRepository) InstancePid(instanceID string) (pid int, err error) {
@@ -304,6 +849,12 @@ func (repo *LocalRepository) InstancePid(instanceID string) (pid int, err error)
 
 	pidValue := strings.TrimSpace(string(fileContent))
 
+	// an empty pidfile is prepared for redis-servers that run as their own
+	// user, and has no pid until redis-server writes one
+	if pidValue == "" {
+		return pid, &os.PathError{Op: "read", Path: pidFilePath, Err: os.ErrNotExist}
+	}
+
 	parsedPid, parseErr := strconv.ParseInt(pidValue, 10, 32)
 	if parseErr != nil {
 		return pid, parseErr
@@ -1,18 +1,25 @@
 package redis_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"github.com/pborman/uuid"
 
+	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/system"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -342,6 +349,737 @@ var _ = Describe("Local Repository", func() {
 		})
 	})
 
+	Describe("suspension", func() {
+		BeforeEach(func() {
+			newTestInstance(instanceID, repo)
+		})
+
+		It("is not suspended by default", func() {
+			suspended, err := repo.IsSuspended(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(suspended).To(BeFalse())
+
+			state, err := repo.InstanceState(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(broker.InstanceStateRunning))
+		})
+
+		Context("when the instance has been marked as suspended", func() {
+			BeforeEach(func() {
+				err := repo.MarkSuspended(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("writes a marker to the instance directory", func() {
+				Expect(path.Join(tmpInstanceDataDir, instanceID, "suspended")).To(BeAnExistingFile())
+			})
+
+			It("reports the instance as suspended", func() {
+				suspended, err := repo.IsSuspended(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(suspended).To(BeTrue())
+
+				state, err := repo.InstanceState(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state).To(Equal(broker.InstanceStateSuspended))
+			})
+
+			It("no longer reports the instance as suspended once cleared", func() {
+				err := repo.ClearSuspended(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+
+				suspended, err := repo.IsSuspended(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(suspended).To(BeFalse())
+			})
+		})
+
+		It("does not error when clearing an instance that is not suspended", func() {
+			err := repo.ClearSuspended(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("persisted config values", func() {
+		var instance *redis.Instance
+
+		BeforeEach(func() {
+			instance = newTestInstance(instanceID, repo)
+		})
+
+		It("sets the value in the instance's redis.conf", func() {
+			Expect(repo.PersistConfigValue(instanceID, "maxmemory-policy", "allkeys-lru")).To(Succeed())
+
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+			Expect(conf.Get("daemonize")).To(Equal("yes"))
+		})
+
+		It("does not write values redis-server would refuse", func() {
+			err := repo.PersistConfigValue(instanceID, "maxmemory-policy", "evict-everything")
+			Expect(err).To(MatchError(ContainSubstring(`maxmemory-policy: "evict-everything" is not one of`)))
+
+			Expect(repo.InstanceConfigOverridesPath(instanceID)).NotTo(BeAnExistingFile())
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.HasKey("maxmemory-policy")).To(BeFalse())
+		})
+
+		It("does not write directives the installed redis-server does not support", func() {
+			repo.RedisVersion = redisconf.Version{Major: 6, Minor: 2}
+
+			err := repo.PersistConfigValue(instanceID, "latency-tracking", "yes")
+			Expect(err).To(MatchError("latency-tracking: requires redis 7.0.0, but redis 6.2.0 is installed"))
+		})
+
+		It("writes directives it does not know", func() {
+			Expect(repo.PersistConfigValue(instanceID, "future-directive", "on")).To(Succeed())
+
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Get("future-directive")).To(Equal("on"))
+		})
+
+		It("keeps the value when redis.conf is regenerated", func() {
+			Expect(repo.PersistConfigValue(instanceID, "save", "3600 1", "60 10000")).To(Succeed())
+			Expect(repo.PersistConfigValue(instanceID, "maxmemory-policy", "allkeys-lru")).To(Succeed())
+
+			Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.GetAll("save")).To(Equal([]string{"3600 1", "60 10000"}))
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+			Expect(conf.Get("port")).To(Equal("8080"))
+		})
+	})
+
+	Describe("layered config", func() {
+		var instance *redis.Instance
+
+		loadConf := func() redisconf.Conf {
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Expect(err).NotTo(HaveOccurred())
+			return conf
+		}
+
+		BeforeEach(func() {
+			template := "daemonize yes\n" +
+				"maxmemory-policy noeviction\n" +
+				"save 900 1\n" +
+				"rename-command CONFIG config-alias\n" +
+				"rename-command KEYS keys-alias\n" +
+				"port 6379\n"
+			Expect(os.WriteFile(defaultConfigFilePath, []byte(template), 0644)).To(Succeed())
+
+			repo.RedisConf.SharedVMConfig = []string{
+				"maxmemory-policy allkeys-lru",
+				`rename-command KEYS ""`,
+				"appendonly yes",
+			}
+			instance = newTestInstance(instanceID, repo)
+		})
+
+		It("applies the plan config on top of the template", func() {
+			conf := loadConf()
+			Expect(conf.Get("daemonize")).To(Equal("yes"))
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+			Expect(conf.Get("appendonly")).To(Equal("yes"))
+			Expect(conf.CommandAliases()).To(Equal(map[string]string{
+				"CONFIG": "config-alias",
+				"KEYS":   "",
+			}))
+		})
+
+		It("applies the instance's config on top of the plan config", func() {
+			Expect(repo.PersistConfigValue(instanceID, "appendonly", "no")).To(Succeed())
+			Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+			conf := loadConf()
+			Expect(conf.Get("appendonly")).To(Equal("no"))
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+		})
+
+		It("rolls out template changes without losing the instance's config", func() {
+			Expect(repo.PersistConfigValue(instanceID, "save", "3600 1")).To(Succeed())
+			Expect(os.WriteFile(defaultConfigFilePath, []byte("daemonize yes\nsave 900 1\ntimeout 300\n"), 0644)).To(Succeed())
+
+			Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+			conf := loadConf()
+			Expect(conf.Get("timeout")).To(Equal("300"))
+			Expect(conf.GetAll("save")).To(Equal([]string{"3600 1"}))
+		})
+
+		It("does not let any layer change the directives the broker manages", func() {
+			repo.RedisConf.SharedVMConfig = append(repo.RedisConf.SharedVMConfig, "port 7000")
+			Expect(repo.PersistConfigValue(instanceID, "requirepass", "chosen-by-tenant")).To(Succeed())
+
+			Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+			conf := loadConf()
+			Expect(conf.GetAll("port")).To(Equal([]string{"8080"}))
+			Expect(conf.GetAll("requirepass")).To(Equal([]string{""}))
+		})
+
+		It("keeps the directives a tenant provisioned the instance with", func() {
+			Expect(os.RemoveAll(repo.InstanceBaseDir(instanceID))).To(Succeed())
+			config, err := redisconf.ParseParameters([]byte(`{"appendonly": false, "timeout": 300}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(repo.Setup(instance, config)).To(Succeed())
+			Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+			conf := loadConf()
+			Expect(conf.Get("appendonly")).To(Equal("no"))
+			Expect(conf.Get("timeout")).To(Equal("300"))
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+		})
+
+		It("does not set up instances with directives a tenant may not set", func() {
+			Expect(os.RemoveAll(repo.InstanceBaseDir(instanceID))).To(Succeed())
+
+			err := repo.Setup(instance, redisconf.New(redisconf.Param{Key: "dir", Value: "/etc"}))
+
+			Expect(err).To(MatchError("dir: cannot be set for an instance"))
+			Expect(repo.InstanceConfigPath(instanceID)).NotTo(BeAnExistingFile())
+		})
+
+		It("validates parameters before anything is set up", func() {
+			Expect(repo.ValidateParameters(redisconf.New(redisconf.Param{Key: "timeout", Value: "300"}))).To(Succeed())
+			Expect(repo.ValidateParameters(redisconf.New(redisconf.Param{Key: "no-such-directive", Value: "yes"}))).NotTo(Succeed())
+			Expect(repo.ValidateParameters(redisconf.New(redisconf.Param{Key: "dir", Value: "/etc"}))).To(MatchError("dir: cannot be set for an instance"))
+		})
+
+		Describe("migrating instances created before they had their own config", func() {
+			BeforeEach(func() {
+				conf := loadConf()
+				conf.Set("appendonly", "no")
+				conf.Set("timeout", "300")
+				conf.Set("maxmemory", "1gb")
+				Expect(conf.Save(repo.InstanceConfigPath(instanceID))).To(Succeed())
+			})
+
+			It("keeps what redis.conf sets differently from the template and the plan config", func() {
+				Expect(repo.MigrateInstanceConfig(instanceID)).To(Succeed())
+				Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+				conf := loadConf()
+				Expect(conf.Get("appendonly")).To(Equal("no"))
+				Expect(conf.Get("timeout")).To(Equal("300"))
+				Expect(conf.HasKey("maxmemory")).To(BeFalse())
+				Expect(conf.Get("port")).To(Equal("8080"))
+			})
+
+			It("only migrates once", func() {
+				Expect(repo.MigrateInstanceConfig(instanceID)).To(Succeed())
+				conf := loadConf()
+				conf.Set("maxclients", "10")
+				Expect(conf.Save(repo.InstanceConfigPath(instanceID))).To(Succeed())
+
+				Expect(repo.MigrateInstanceConfig(instanceID)).To(Succeed())
+
+				overrides, err := redisconf.Load(repo.InstanceConfigOverridesPath(instanceID))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(overrides.HasKey("maxclients")).To(BeFalse())
+			})
+
+			It("migrates before the first value is persisted", func() {
+				Expect(repo.PersistConfigValue(instanceID, "maxclients", "10")).To(Succeed())
+				Expect(repo.WriteConfigFile(instance)).To(Succeed())
+
+				conf := loadConf()
+				Expect(conf.Get("timeout")).To(Equal("300"))
+				Expect(conf.Get("maxclients")).To(Equal("10"))
+			})
+		})
+
+		It("returns an error when the plan config is invalid", func() {
+			repo.RedisConf.SharedVMConfig = []string{"appendonly"}
+
+			err := repo.WriteConfigFile(instance)
+			Expect(err).To(MatchError(ContainSubstring("invalid shared-vm plan config")))
+		})
+
+		It("validates the template and the plan config", func() {
+			Expect(repo.ValidateTemplate()).To(Succeed())
+
+			repo.RedisConf.SharedVMConfig = []string{"appendonly sometimes"}
+			Expect(repo.ValidateTemplate()).To(MatchError(`invalid shared-vm plan config: appendonly: "sometimes" is not yes or no`))
+
+			repo.RedisConf.SharedVMConfig = nil
+			Expect(os.WriteFile(defaultConfigFilePath, []byte("daemonize yes\nmaxmemory lots\n"), 0644)).To(Succeed())
+			Expect(repo.ValidateTemplate()).To(MatchError(ContainSubstring(`invalid redis.conf template /tmp/default_config_path: maxmemory: "lots" is not a memory size`)))
+		})
+
+		It("only logs directives it does not know", func() {
+			Expect(os.WriteFile(defaultConfigFilePath, []byte("daemonize yes\nfuture-directive on\n"), 0644)).To(Succeed())
+			repo.RedisConf.SharedVMConfig = []string{"another-directive 1"}
+
+			Expect(repo.ValidateTemplate()).To(Succeed())
+			Expect(logger).To(gbytes.Say(`"directive":"future-directive".*"source":"/tmp/default_config_path"`))
+			Expect(logger).To(gbytes.Say(`"directive":"another-directive".*"source":"shared_vm_config"`))
+		})
+	})
+
+	Describe("failure marking", func() {
+		BeforeEach(func() {
+			newTestInstance(instanceID, repo)
+		})
+
+		It("reports the failed state once marked", func() {
+			err := repo.MarkFailed(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+
+			failed, err := repo.IsFailed(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(failed).To(BeTrue())
+
+			state, err := repo.InstanceState(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(broker.InstanceStateFailed))
+		})
+
+		It("reports suspension over failure", func() {
+			Expect(repo.MarkFailed(instanceID)).To(Succeed())
+			Expect(repo.MarkSuspended(instanceID)).To(Succeed())
+
+			state, err := repo.InstanceState(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(broker.InstanceStateSuspended))
+		})
+
+		It("clears the failed state", func() {
+			Expect(repo.MarkFailed(instanceID)).To(Succeed())
+			Expect(repo.ClearFailed(instanceID)).To(Succeed())
+
+			failed, err := repo.IsFailed(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(failed).To(BeFalse())
+		})
+	})
+
+	Describe("instance locks", func() {
+		var instance *redis.Instance
+
+		BeforeEach(func() {
+			newTestInstance(instanceID, repo)
+			instance = &redis.Instance{ID: instanceID}
+		})
+
+		It("reports whether the instance is locked", func() {
+			locked, err := repo.IsLocked(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locked).To(BeFalse())
+
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			locked, err = repo.IsLocked(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locked).To(BeTrue())
+
+			Expect(repo.Unlock(instance)).To(Succeed())
+
+			locked, err = repo.IsLocked(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locked).To(BeFalse())
+		})
+
+		It("records the owner and purpose of the lock", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			lock, err := repo.InstanceLock(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.InstanceID).To(Equal(instanceID))
+			Expect(lock.OwnerPid).To(Equal(os.Getpid()))
+			Expect(lock.Purpose).To(Equal(redis.LockPurposeProvision))
+			Expect(lock.AcquiredAt).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(lock.ExpiresAt).To(Equal(lock.AcquiredAt.Add(10 * time.Minute)))
+			Expect(lock.Held).To(BeTrue())
+			Expect(lock.Stale).To(BeFalse())
+
+			locks, err := repo.InstanceLocks()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locks).To(ConsistOf(*lock))
+		})
+
+		It("lists the locks of the other instances when the data directory has stray entries", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(repo.RedisConf.InstanceDataDirectory, "stray-file"), []byte("x"), 0640)).To(Succeed())
+			Expect(os.MkdirAll(path.Join(repo.RedisConf.InstanceDataDirectory, "unreadable-lock", "lock"), 0755)).To(Succeed())
+
+			locks, err := repo.InstanceLocks()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locks).To(HaveLen(1))
+			Expect(locks[0].InstanceID).To(Equal(instanceID))
+		})
+
+		It("cannot be taken while another owner holds it", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			otherBroker := redis.NewLocalRepository(repo.RedisConf, logger)
+			Expect(otherBroker.Lock(instance, redis.LockPurposeDeprovision)).To(Equal(redis.ErrInstanceLocked))
+		})
+
+		It("is stale once its owner no longer holds it", func() {
+			lease := fmt.Sprintf(
+				`{"owner_pid":%d,"purpose":"provision","acquired_at":"%s","expires_at":"%s"}`,
+				os.Getpid(),
+				time.Now().UTC().Format(time.RFC3339),
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			)
+			Expect(ioutil.WriteFile(path.Join(repo.InstanceBaseDir(instanceID), "lock"), []byte(lease), 0640)).To(Succeed())
+
+			lock, err := repo.InstanceLock(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Held).To(BeFalse())
+			Expect(lock.Stale).To(BeTrue())
+
+			locked, err := repo.IsLocked(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(locked).To(BeFalse())
+
+			Expect(repo.Lock(instance, redis.LockPurposeDeprovision)).To(Succeed())
+		})
+
+		Context("when the lock file was written without a lease", func() {
+			var lockFilePath string
+
+			BeforeEach(func() {
+				lockFilePath = path.Join(repo.InstanceBaseDir(instanceID), "lock")
+				Expect(ioutil.WriteFile(lockFilePath, []byte{}, 0640)).To(Succeed())
+			})
+
+			It("is locked until the lease has passed since the file was created", func() {
+				locked, err := repo.IsLocked(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(locked).To(BeTrue())
+
+				anHourAgo := time.Now().Add(-time.Hour)
+				Expect(os.Chtimes(lockFilePath, anHourAgo, anHourAgo)).To(Succeed())
+
+				locked, err = repo.IsLocked(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(locked).To(BeFalse())
+			})
+		})
+
+		It("can be released by force", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			Expect(repo.ForceUnlock(instanceID)).To(Succeed())
+			Expect(logger).To(gbytes.Say("force-unlock-instance"))
+
+			lock, err := repo.InstanceLock(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock).To(BeNil())
+
+			Expect(repo.Lock(instance, redis.LockPurposeDeprovision)).To(Succeed())
+		})
+
+		It("releases its lease without removing a later owner's lock after it was released by force", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			otherBroker := redis.NewLocalRepository(repo.RedisConf, logger)
+			Expect(otherBroker.ForceUnlock(instanceID)).To(Succeed())
+			Expect(otherBroker.Lock(instance, redis.LockPurposeDeprovision)).To(Succeed())
+
+			Expect(repo.Unlock(instance)).To(Succeed())
+
+			lock, err := repo.InstanceLock(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Purpose).To(Equal(redis.LockPurposeDeprovision))
+			Expect(lock.Held).To(BeTrue())
+
+			Expect(otherBroker.Unlock(instance)).To(Succeed())
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+		})
+
+		It("hands the lock to an owner that was waiting for it", func() {
+			Expect(repo.Lock(instance, redis.LockPurposeProvision)).To(Succeed())
+
+			otherBroker := redis.NewLocalRepository(repo.RedisConf, logger)
+			locked := make(chan error)
+			go func() {
+				locked <- otherBroker.Lock(instance, redis.LockPurposeDeprovision)
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			Expect(repo.Unlock(instance)).To(Succeed())
+			Eventually(locked).Should(Receive(BeNil()))
+
+			lock, err := repo.InstanceLock(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock).NotTo(BeNil())
+			Expect(lock.Purpose).To(Equal(redis.LockPurposeDeprovision))
+			Expect(lock.Held).To(BeTrue())
+		})
+	})
+
+	Describe("instance IDs that would leave the operator directories", func() {
+		var victimDir string
+
+		BeforeEach(func() {
+			victimDir = filepath.Join(filepath.Dir(tmpInstanceDataDir), "victim")
+			Ω(os.MkdirAll(victimDir, 0750)).To(Succeed())
+			Ω(os.MkdirAll(tmpInstanceDataDir, 0750)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(victimDir)).To(Succeed())
+		})
+
+		It("does not resolve their paths", func() {
+			Ω(repo.InstanceBaseDir("../victim")).To(BeEmpty())
+			Ω(repo.InstanceConfigPath("..")).To(BeEmpty())
+			Ω(repo.InstanceLogDir("")).To(BeEmpty())
+			Ω(repo.InstancePidFilePath("../victim")).To(BeEmpty())
+		})
+
+		It("refuses to delete them", func() {
+			err := repo.Delete("../victim")
+			Ω(err).To(MatchError(paths.ErrOutsideRoot))
+
+			_, err = os.Stat(victimDir)
+			Ω(err).ToNot(HaveOccurred())
+
+			Ω(repo.Delete("")).To(MatchError(paths.ErrOutsideRoot))
+			_, err = os.Stat(tmpInstanceDataDir)
+			Ω(err).ToNot(HaveOccurred())
+		})
+
+		It("refuses to set them up", func() {
+			err := repo.Setup(&redis.Instance{ID: "../victim", Port: 6380}, nil)
+			Ω(err).To(MatchError(paths.ErrOutsideRoot))
+
+			_, err = os.Stat(filepath.Join(victimDir, "redis.conf"))
+			Ω(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("refuses to mark them", func() {
+			Ω(repo.MarkSuspended("")).To(MatchError(paths.ErrOutsideRoot))
+			Ω(repo.MarkFailed("../victim")).To(MatchError(paths.ErrOutsideRoot))
+			Ω(repo.ClearSuspended("..")).To(MatchError(paths.ErrOutsideRoot))
+
+			_, err := os.Stat("suspended")
+			Ω(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Stat(filepath.Join(victimDir, "failed"))
+			Ω(os.IsNotExist(err)).To(BeTrue())
+
+			_, err = repo.InstanceState("")
+			Ω(err).To(MatchError(paths.ErrOutsideRoot))
+		})
+	})
+
+	Describe("state store", func() {
+		var stateDir string
+
+		BeforeEach(func() {
+			var err error
+			stateDir, err = os.MkdirTemp("", "repo-state")
+			Ω(err).ToNot(HaveOccurred())
+
+			err = os.MkdirAll(tmpInstanceDataDir, 0750)
+			Ω(err).ToNot(HaveOccurred())
+
+			repo.RedisConf.StateFile = filepath.Join(stateDir, "state.json")
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(stateDir)).To(Succeed())
+		})
+
+		It("imports the instances that already exist the first time it is opened", func() {
+			newTestInstance(instanceID, repo)
+
+			Ω(repo.OpenState()).To(Succeed())
+			Expect(logger).To(gbytes.Say("Imported 1 shared Redis instances into the state store"))
+
+			Ω(os.RemoveAll(repo.InstanceConfigPath(instanceID))).To(Succeed())
+
+			instance, err := repo.FindByID(instanceID)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(instance.Port).To(Equal(8080))
+
+			instances, errs := repo.AllInstances()
+			Ω(errs).To(BeEmpty())
+			Ω(instances).To(HaveLen(1))
+		})
+
+		It("imports the other instances when one of them cannot be read", func() {
+			newTestInstance(instanceID, repo)
+			Ω(os.MkdirAll(filepath.Join(repo.RedisConf.InstanceDataDirectory, "broken-instance"), 0755)).To(Succeed())
+
+			Ω(repo.OpenState()).To(Succeed())
+			Expect(logger).To(gbytes.Say("Skipping shared Redis instance that could not be read"))
+			Expect(logger).To(gbytes.Say("Imported 1 shared Redis instances into the state store"))
+
+			exists, err := repo.InstanceExists(instanceID)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(exists).To(BeTrue())
+
+			_, err = repo.State.Instance("broken-instance")
+			Ω(err).To(HaveOccurred())
+		})
+
+		It("does not import again once the store has been written to", func() {
+			Ω(repo.OpenState()).To(Succeed())
+			Ω(repo.Setup(&redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 6380, Password: "secret"}, nil)).To(Succeed())
+
+			newTestInstance("unindexed-instance", repo)
+
+			imported, err := repo.ImportState()
+			Ω(err).ToNot(HaveOccurred())
+			Ω(imported).To(BeZero())
+
+			count, errs := repo.InstanceCount()
+			Ω(errs).To(BeEmpty())
+			Ω(count).To(Equal(1))
+		})
+
+		Context("when the store is open", func() {
+			BeforeEach(func() {
+				Ω(repo.OpenState()).To(Succeed())
+				Ω(repo.Setup(&redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 6380, Password: "secret"}, nil)).To(Succeed())
+			})
+
+			It("indexes instances when they are set up", func() {
+				record, err := repo.State.Instance(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(record.Port).To(Equal(6380))
+				Ω(record.Password).To(Equal("secret"))
+
+				exists, err := repo.InstanceExists(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(exists).To(BeTrue())
+			})
+
+			It("records the details the instance was provisioned with", func() {
+				err := repo.SaveInstanceDetails(instanceID, broker.InstanceDetails{
+					PlanID:           "shared-plan",
+					OrganizationGUID: "org-guid",
+					SpaceGUID:        "space-guid",
+					Parameters:       []byte(`{"maxmemory":"64mb"}`),
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				record, err := repo.State.Instance(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(record.PlanID).To(Equal("shared-plan"))
+				Ω(record.OrganizationGUID).To(Equal("org-guid"))
+				Ω(record.SpaceGUID).To(Equal("space-guid"))
+				Ω(string(record.Parameters)).To(MatchJSON(`{"maxmemory":"64mb"}`))
+			})
+
+			It("records bindings", func() {
+				_, err := repo.Bind(instanceID, "a-binding")
+				Ω(err).ToNot(HaveOccurred())
+
+				record, err := repo.State.Instance(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(record.Bindings).To(HaveKey("a-binding"))
+
+				Ω(repo.Unbind(instanceID, "a-binding")).To(Succeed())
+
+				record, err = repo.State.Instance(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(record.Bindings).To(BeEmpty())
+			})
+
+			It("removes instances when they are deleted", func() {
+				Ω(repo.Delete(instanceID)).To(Succeed())
+
+				exists, err := repo.InstanceExists(instanceID)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(exists).To(BeFalse())
+
+				count, errs := repo.InstanceCount()
+				Ω(errs).To(BeEmpty())
+				Ω(count).To(BeZero())
+			})
+		})
+	})
+
+	Describe("instance users", func() {
+		var users *fakes.FakeInstanceUsers
+
+		instanceUser := system.User{
+			Name: "redis-an-instance",
+			UID:  uint32(os.Getuid()),
+			GID:  uint32(os.Getgid()),
+		}
+
+		BeforeEach(func() {
+			users = new(fakes.FakeInstanceUsers)
+			users.CreateReturns(instanceUser, nil)
+			repo.Users = users
+
+			Ω(repo.Setup(&redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 6380, Password: "secret"}, nil)).To(Succeed())
+		})
+
+		It("creates a user for the instance when it is set up", func() {
+			Ω(users.CreateCallCount()).To(Equal(1))
+			Ω(users.CreateArgsForCall(0)).To(Equal(instanceID))
+		})
+
+		It("keeps redis.conf out of reach of other users", func() {
+			info, err := os.Stat(repo.InstanceBaseDir(instanceID))
+			Ω(err).ToNot(HaveOccurred())
+			Ω(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+
+			info, err = os.Stat(repo.InstanceConfigPath(instanceID))
+			Ω(err).ToNot(HaveOccurred())
+			Ω(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		})
+
+		It("lets the instance's user reach its directories", func() {
+			for _, dir := range []string{tmpInstanceDataDir, tmpInstanceLogDir, tmpPidFileDir} {
+				info, err := os.Stat(dir)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.Mode().Perm() & 0001).ToNot(BeZero())
+			}
+		})
+
+		It("prepares an empty pidfile that is not mistaken for a pid", func() {
+			contents, err := os.ReadFile(repo.InstancePidFilePath(instanceID))
+			Ω(err).ToNot(HaveOccurred())
+			Ω(contents).To(BeEmpty())
+
+			_, err = repo.InstancePid(instanceID)
+			Ω(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("returns the credential to start redis-server with", func() {
+			credential, err := repo.InstanceCredential(instanceID)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(credential.Uid).To(Equal(instanceUser.UID))
+			Ω(credential.Gid).To(Equal(instanceUser.GID))
+		})
+
+		It("does not start redis-server when the user cannot be created", func() {
+			users.CreateReturns(system.User{}, errors.New("useradd failed"))
+
+			_, err := repo.InstanceCredential(instanceID)
+			Ω(err).To(MatchError("useradd failed"))
+		})
+
+		It("removes the instance's user when the instance is deleted", func() {
+			Ω(repo.Delete(instanceID)).To(Succeed())
+
+			Ω(users.RemoveCallCount()).To(Equal(1))
+			Ω(users.RemoveArgsForCall(0)).To(Equal(instanceID))
+		})
+
+		It("starts instances as the broker's user when users are not isolated", func() {
+			repo.Users = nil
+
+			credential, err := repo.InstanceCredential(instanceID)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(credential).To(BeNil())
+		})
+	})
+
 	Describe("InstanceCount", func() {
 		Context("when there are no instances", func() {
 			BeforeEach(func() {
@@ -716,7 +1454,7 @@ var _ = Describe("Setup", func() {
 			Expect(tmpInstanceDataDir).NotTo(BeADirectory())
 			Expect(tmpInstanceLogDir).NotTo(BeADirectory())
 
-			err := repo.Setup(&instance)
+			err := repo.Setup(&instance, nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(tmpInstanceDataDir).To(BeADirectory())
@@ -724,7 +1462,7 @@ var _ = Describe("Setup", func() {
 		})
 
 		It("creates a lock file", func() {
-			err := repo.Setup(&instance)
+			err := repo.Setup(&instance, nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			lockFilePath := path.Join(tmpDataDir, instanceID, "lock")
@@ -732,7 +1470,7 @@ var _ = Describe("Setup", func() {
 		})
 
 		It("writes the config file", func() {
-			err := repo.Setup(&instance)
+			err := repo.Setup(&instance, nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			configFilePath := path.Join(tmpDataDir, instanceID, "redis.conf")
@@ -745,7 +1483,7 @@ var _ = Describe("Setup", func() {
 		})
 
 		It("logs that the instance was provisioned", func() {
-			err := repo.Setup(&instance)
+			err := repo.Setup(&instance, nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(logger).To(gbytes.Say("provision-instance"))
@@ -766,12 +1504,12 @@ var _ = Describe("Setup", func() {
 			})
 
 			It("returns an error", func() {
-				err := repo.Setup(&instance)
+				err := repo.Setup(&instance, nil)
 				Expect(err).To(HaveOccurred())
 			})
 
 			It("logs the error", func() {
-				_ = repo.Setup(&instance)
+				_ = repo.Setup(&instance, nil)
 
 				Expect(logger).To(gbytes.Say("local-repo-setup.ensure-dirs-exist"))
 				Expect(logger).To(gbytes.Say("permission denied"))
@@ -802,7 +1540,7 @@ var _ = Describe("Setup", func() {
 			})
 
 			It("returns an error", func() {
-				err := repo.Setup(&instance)
+				err := repo.Setup(&instance, nil)
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/lager/v3"
@@ -16,6 +17,8 @@ import (
 )
 
 const redisStartTimeout time.Duration = 10 * time.Second
+const pingTimeout time.Duration = 5 * time.Second
+const pidfileTimeout time.Duration = 2 * time.Second
 
 //go:generate counterfeiter -o fakes/fake_process_checker.go . ProcessChecker
 type ProcessChecker interface {
@@ -32,6 +35,22 @@ type InstanceInformer interface {
 	InstancePid(string) (int, error)
 }
 
+// InstanceCgroups isolates the resources of each instance's redis-server.
+// Open is used to start redis-server inside its cgroup, and Place to move a
+// redis-server that was started some other way into it.
+//
+//go:generate counterfeiter -o fakes/fake_instance_cgroups.go . InstanceCgroups
+type InstanceCgroups interface {
+	Open(instanceID string) (*os.File, error)
+	Place(instanceID string, pid int) error
+	Remove(instanceID string) error
+}
+
+//go:generate counterfeiter -o fakes/fake_instance_credentials.go . InstanceCredentials
+type InstanceCredentials interface {
+	InstanceCredential(instanceID string) (*syscall.Credential, error)
+}
+
 type OSProcessController struct {
 	Logger                    lager.Logger
 	InstanceInformer          InstanceInformer
@@ -41,6 +60,23 @@ type OSProcessController struct {
 	WaitUntilConnectableFunc  WaitUntilConnectableFunc
 	RedisServerExecutablePath string
 
+	// Identities, when set, is used to check that the process behind a
+	// pidfile is the instance's redis-server before it is trusted or killed.
+	Identities ProcessIdentities
+
+	// Supervisor starts and stops redis-server. The pidfile supervisor is
+	// used when it is not set.
+	Supervisor Supervisor
+
+	// Cgroups, when set, isolates the resources of each redis-server it
+	// starts. The pidfile and child supervisors start redis-server inside its
+	// cgroup, so that loading its data is already limited.
+	Cgroups InstanceCgroups
+
+	// Credentials, when set, provides the user that each redis-server is
+	// started as. redis-server runs as the controller's user otherwise.
+	Credentials InstanceCredentials
+
 	Exec iexec.Exec
 }
 
@@ -70,10 +106,12 @@ func PingServer(instance *Instance) error {
 		client.Host(instance.Host),
 		client.Port(instance.Port),
 		client.Password(instance.Password),
+		client.Timeout(pingTimeout),
 	)
 	if err != nil {
 		return err
 	}
+	defer client.Disconnect()
 
 	return client.Ping()
 }
@@ -96,34 +134,54 @@ func (controller *OSProcessController) StartAndWaitUntilReadyWithConfig(instance
 		executable = controller.RedisServerExecutablePath
 	}
 
-	err := controller.Exec.Command(executable, instanceCommandArgs...).Run()
+	credential, err := controller.credential(instance)
+	if err != nil {
+		return fmt.Errorf("redis failed to start: %s", err)
+	}
+
+	err = controller.supervisor().Start(instance, executable, instanceCommandArgs, credential)
 	if err != nil {
 		return fmt.Errorf("redis failed to start: %s", err)
 	}
 
-	return controller.WaitUntilConnectableFunc(instance.Address(), timeout)
+	err = controller.WaitUntilConnectableFunc(instance.Address(), timeout)
+	if err != nil {
+		return err
+	}
+
+	return controller.adoptProcess(instance)
 }
 
 func (controller *OSProcessController) Kill(instance *Instance) error {
-	pid, err := controller.InstanceInformer.InstancePid(instance.ID)
+	err := controller.supervisor().Stop(instance)
 	if err != nil {
-		controller.Logger.Error(
-			"redis instance has no pidfile",
-			err,
-			lager.Data{
-				"instance": instance.ID,
-			},
-		)
 		return err
 	}
 
-	return controller.ProcessKiller.Kill(pid)
+	controller.removeCgroup(instance)
+	return nil
 }
 
 func (controller *OSProcessController) EnsureRunning(instance *Instance, configPath, instanceDataDir, pidfilePath, logfilePath string) error {
 	pid, err := controller.InstanceInformer.InstancePid(instance.ID)
 
 	if err == nil && controller.ProcessChecker.Alive(pid) {
+		identityErr := controller.verifyIdentity(instance, pid)
+		if identityErr != nil {
+			controller.Logger.Error(
+				"pidfile belongs to another process",
+				identityErr,
+				lager.Data{"instance": instance.ID, "pid": pid},
+			)
+
+			deleteErr := os.Remove(pidfilePath)
+			if deleteErr != nil && !os.IsNotExist(deleteErr) {
+				return deleteErr
+			}
+
+			return controller.StartAndWaitUntilReady(instance, configPath, instanceDataDir, logfilePath, redisStartTimeout)
+		}
+
 		pingErr := controller.PingFunc(instance)
 		if pingErr == nil {
 			controller.Logger.Info(
@@ -176,6 +234,149 @@ func (controller *OSProcessController) EnsureRunning(instance *Instance, configP
 	return controller.StartAndWaitUntilReady(instance, configPath, instanceDataDir, logfilePath, redisStartTimeout)
 }
 
+func (controller *OSProcessController) supervisor() Supervisor {
+	if controller.Supervisor != nil {
+		return controller.Supervisor
+	}
+
+	return controller.pidfileSupervisor()
+}
+
+func (controller *OSProcessController) pidfileSupervisor() *PidfileSupervisor {
+	return &PidfileSupervisor{
+		Logger:           controller.Logger,
+		InstanceInformer: controller.InstanceInformer,
+		ProcessKiller:    controller.ProcessKiller,
+		Identities:       controller.Identities,
+		Cgroups:          controller.Cgroups,
+		Exec:             controller.Exec,
+	}
+}
+
+func (controller *OSProcessController) credential(instance *Instance) (*syscall.Credential, error) {
+	if controller.Credentials == nil {
+		return nil, nil
+	}
+
+	return controller.Credentials.InstanceCredential(instance.ID)
+}
+
+func (controller *OSProcessController) verifyIdentity(instance *Instance, pid int) error {
+	if controller.Identities == nil {
+		return nil
+	}
+
+	return controller.Identities.Verify(instance.ID, pid)
+}
+
+// AdoptRunning takes over a redis-server that was started before the
+// controller, such as one left running by an earlier broker, once its pidfile
+// has been checked to point at the instance's redis-server.
+func (controller *OSProcessController) AdoptRunning(instance *Instance) error {
+	pid, err := controller.InstanceInformer.InstancePid(instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if !controller.ProcessChecker.Alive(pid) {
+		return fmt.Errorf("redis-server with pid %d is not running", pid)
+	}
+
+	err = controller.verifyIdentity(instance, pid)
+	if err != nil {
+		return err
+	}
+
+	return controller.adopt(instance, pid)
+}
+
+// adoptProcess records the identity of a redis-server that has just started
+// and makes sure it is in its cgroup. A redis-server that cannot be adopted
+// is killed rather than left running unconfined.
+func (controller *OSProcessController) adoptProcess(instance *Instance) error {
+	if controller.Identities == nil && controller.Cgroups == nil {
+		return nil
+	}
+
+	pid, err := controller.waitForPid(instance)
+	if err != nil {
+		return err
+	}
+
+	err = controller.adopt(instance, pid)
+	if err != nil {
+		killErr := controller.Kill(instance)
+		if killErr != nil {
+			controller.Logger.Error(
+				"failed to kill redis-server that could not be adopted",
+				killErr,
+				lager.Data{"instance": instance.ID, "pid": pid},
+			)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (controller *OSProcessController) adopt(instance *Instance, pid int) error {
+	if controller.Identities != nil {
+		err := controller.Identities.Record(instance.ID, pid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if controller.Cgroups != nil {
+		err := controller.Cgroups.Place(instance.ID, pid)
+		if err != nil {
+			controller.Logger.Error(
+				"failed to place redis-server in its cgroup",
+				err,
+				lager.Data{"instance": instance.ID, "pid": pid},
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForPid retries reading the pidfile because redis may accept connections
+// just before it writes it.
+func (controller *OSProcessController) waitForPid(instance *Instance) (int, error) {
+	deadline := time.Now().Add(pidfileTimeout)
+	for {
+		pid, err := controller.InstanceInformer.InstancePid(instance.ID)
+		if err == nil {
+			return pid, nil
+		}
+
+		if time.Now().After(deadline) {
+			return 0, err
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// removeCgroup is best effort: the kernel refuses to remove a cgroup until
+// the killed process has exited, and a cgroup that is left behind is reused
+// when the instance is started again.
+func (controller *OSProcessController) removeCgroup(instance *Instance) {
+	if controller.Cgroups == nil {
+		return
+	}
+
+	err := controller.Cgroups.Remove(instance.ID)
+	if err != nil {
+		controller.Logger.Info(
+			"could not remove cgroup",
+			lager.Data{"instance": instance.ID, "error": err.Error()},
+		)
+	}
+}
+
 func getRedisPort(name string) (int, error) {
 	regex, err := regexp.Compile("\\d+$")
 	if err != nil {
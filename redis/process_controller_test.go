@@ -15,6 +15,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/lager/v3/lagertest"
+	"github.com/pivotal-cf/cf-redis-broker/process"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
 	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
 )
@@ -112,6 +113,171 @@ var _ = Describe("Redis Process Controller", func() {
 		})
 	})
 
+	Context("when process identities are checked", func() {
+		var identities *fakes.FakeProcessIdentities
+
+		BeforeEach(func() {
+			identities = new(fakes.FakeProcessIdentities)
+			instance.ID = "an-instance"
+		})
+
+		JustBeforeEach(func() {
+			processController.Identities = identities
+		})
+
+		It("records the identity of the redis-server it started", func() {
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(identities.RecordCallCount()).To(Equal(1))
+			instanceID, pid := identities.RecordArgsForCall(0)
+			Expect(instanceID).To(Equal("an-instance"))
+			Expect(pid).To(Equal(123))
+		})
+
+		It("kills the instance's redis-server", func() {
+			err = processController.Kill(instance)
+			Expect(err).NotTo(HaveOccurred())
+
+			instanceID, pid := identities.VerifyArgsForCall(0)
+			Expect(instanceID).To(Equal("an-instance"))
+			Expect(pid).To(Equal(123))
+			Expect(processKiller.KillCallCount()).To(Equal(1))
+		})
+
+		It("adopts a running redis-server without restarting it", func() {
+			processChecker.AliveReturns(true)
+
+			err = processController.AdoptRunning(instance)
+			Expect(err).NotTo(HaveOccurred())
+
+			instanceID, pid := identities.VerifyArgsForCall(0)
+			Expect(instanceID).To(Equal("an-instance"))
+			Expect(pid).To(Equal(123))
+			Expect(identities.RecordCallCount()).To(Equal(1))
+			Expect(processKiller.KillCallCount()).To(BeZero())
+			Expect(exec.Exec.CommandCallCount()).To(BeZero())
+		})
+
+		It("does not adopt a redis-server that is not running", func() {
+			err = processController.AdoptRunning(instance)
+			Expect(err).To(MatchError("redis-server with pid 123 is not running"))
+			Expect(identities.RecordCallCount()).To(BeZero())
+		})
+
+		Context("when the pidfile points at another process", func() {
+			BeforeEach(func() {
+				identities.VerifyReturns(process.ErrUnexpectedProcess)
+				processChecker.AliveReturns(true)
+			})
+
+			It("does not kill it", func() {
+				err = processController.Kill(instance)
+				Expect(err).To(MatchError(process.ErrUnexpectedProcess))
+				Expect(processKiller.KillCallCount()).To(BeZero())
+				Eventually(log).Should(gbytes.Say("refusing to kill process that is not the instance's redis-server"))
+			})
+
+			It("does not adopt it", func() {
+				err = processController.AdoptRunning(instance)
+				Expect(err).To(MatchError(process.ErrUnexpectedProcess))
+				Expect(identities.RecordCallCount()).To(BeZero())
+			})
+
+			It("does not trust it to be the running instance", func() {
+				file, err := ioutil.TempFile("", "brokerTest")
+				Expect(err).NotTo(HaveOccurred())
+
+				err = processController.EnsureRunning(instance, "configFilePath", "instanceDataDir", file.Name(), "logFilePath")
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(log).Should(gbytes.Say("pidfile belongs to another process"))
+
+				_, err = os.Stat(file.Name())
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				itStartsARedisProcess("redis-server")
+			})
+		})
+	})
+
+	Context("when instances are isolated in cgroups", func() {
+		var instanceCgroups *fakes.FakeInstanceCgroups
+
+		BeforeEach(func() {
+			instanceCgroups = new(fakes.FakeInstanceCgroups)
+			instanceCgroups.OpenStub = func(string) (*os.File, error) {
+				return os.Open(os.TempDir())
+			}
+			instance.ID = "an-instance"
+		})
+
+		JustBeforeEach(func() {
+			processController.Cgroups = instanceCgroups
+		})
+
+		It("starts redis-server inside the instance's cgroup", func() {
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(instanceCgroups.OpenCallCount()).To(Equal(1))
+			Expect(instanceCgroups.OpenArgsForCall(0)).To(Equal("an-instance"))
+			Expect(exec.Cmd.SetSysProcAttrCallCount()).To(Equal(1))
+			Expect(exec.Cmd.SetSysProcAttrArgsForCall(0).UseCgroupFD).To(BeTrue())
+		})
+
+		It("does not start redis-server when its cgroup cannot be opened", func() {
+			instanceCgroups.OpenReturns(nil, errors.New("read-only file system"))
+
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).To(MatchError("redis failed to start: failed to open cgroup: read-only file system"))
+			Expect(exec.Exec.CommandCallCount()).To(Equal(0))
+		})
+
+		It("places the redis-server it started in the instance's cgroup", func() {
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(instanceCgroups.PlaceCallCount()).To(Equal(1))
+			instanceID, pid := instanceCgroups.PlaceArgsForCall(0)
+			Expect(instanceID).To(Equal("an-instance"))
+			Expect(pid).To(Equal(123))
+		})
+
+		It("returns an error when the redis-server cannot be placed", func() {
+			instanceCgroups.PlaceReturns(errors.New("read-only file system"))
+
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).To(MatchError("read-only file system"))
+			Eventually(log).Should(gbytes.Say("failed to place redis-server in its cgroup"))
+		})
+
+		It("kills the redis-server when it cannot be placed", func() {
+			instanceCgroups.PlaceReturns(errors.New("read-only file system"))
+
+			err = processController.StartAndWaitUntilReady(instance, "configFilePath", "instanceDataDir", "logFilePath", time.Second)
+			Expect(err).To(HaveOccurred())
+
+			Expect(processKiller.KillCallCount()).To(Equal(1))
+			Expect(processKiller.KillArgsForCall(0)).To(Equal(123))
+			Expect(instanceCgroups.RemoveCallCount()).To(Equal(1))
+		})
+
+		It("removes the instance's cgroup when it is killed", func() {
+			err = processController.Kill(instance)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(instanceCgroups.RemoveCallCount()).To(Equal(1))
+			Expect(instanceCgroups.RemoveArgsForCall(0)).To(Equal("an-instance"))
+		})
+
+		It("does not fail the kill when the cgroup cannot be removed yet", func() {
+			instanceCgroups.RemoveReturns(errors.New("device or resource busy"))
+
+			err = processController.Kill(instance)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(log).Should(gbytes.Say("could not remove cgroup"))
+		})
+	})
+
 	Describe("StartAndWaitUntilReadyWithConfig", func() {
 		Context("When using a custom redis-server executable", func() {
 			It("runs the right command to start redis", func() {
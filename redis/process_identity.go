@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-broker/process"
+)
+
+const processStartTimeMarker = "process-start-time"
+
+//go:generate counterfeiter -o fakes/fake_process_identities.go . ProcessIdentities
+type ProcessIdentities interface {
+	Verify(instanceID string, pid int) error
+	Record(instanceID string, pid int) error
+}
+
+type IdentityChecker interface {
+	Verify(pid int, expected process.Identity) error
+	StartTime(pid int) (uint64, error)
+}
+
+// InstanceProcessIdentities remembers which process was started for each
+// instance, so that the process behind an instance's pidfile can be checked
+// before it is trusted or killed.
+type InstanceProcessIdentities struct {
+	Repository *LocalRepository
+	Checker    IdentityChecker
+}
+
+func NewInstanceProcessIdentities(repo *LocalRepository, checker IdentityChecker) *InstanceProcessIdentities {
+	return &InstanceProcessIdentities{
+		Repository: repo,
+		Checker:    checker,
+	}
+}
+
+func (identities *InstanceProcessIdentities) Verify(instanceID string, pid int) error {
+	startTime, err := identities.startTime(instanceID)
+	if err != nil {
+		return err
+	}
+
+	return identities.Checker.Verify(pid, process.Identity{
+		ConfigPath: identities.Repository.InstanceConfigPath(instanceID),
+		DataDir:    identities.Repository.InstanceDataDir(instanceID),
+		StartTime:  startTime,
+	})
+}
+
+// Record stores the start time of the process that was just started for an
+// instance.
+func (identities *InstanceProcessIdentities) Record(instanceID string, pid int) error {
+	startTime, err := identities.Checker.StartTime(pid)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		identities.markerPath(instanceID),
+		[]byte(strconv.FormatUint(startTime, 10)),
+		0640,
+	)
+}
+
+// startTime is zero for instances started before start times were recorded.
+func (identities *InstanceProcessIdentities) startTime(instanceID string) (uint64, error) {
+	contents, err := ioutil.ReadFile(identities.markerPath(instanceID))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+}
+
+func (identities *InstanceProcessIdentities) markerPath(instanceID string) string {
+	baseDir := identities.Repository.InstanceBaseDir(instanceID)
+	if baseDir == "" {
+		return ""
+	}
+
+	return filepath.Join(baseDir, processStartTimeMarker)
+}
+
+// processGone reports whether an error means that the instance has no
+// redis-server left to stop.
+func processGone(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrProcessDone) || errors.Is(err, process.ErrUnexpectedProcess)
+}
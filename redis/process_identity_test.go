@@ -0,0 +1,71 @@
+package redis_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/process"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeIdentityChecker struct {
+	startTime uint64
+	verified  []process.Identity
+}
+
+func (checker *fakeIdentityChecker) Verify(pid int, expected process.Identity) error {
+	checker.verified = append(checker.verified, expected)
+	return nil
+}
+
+func (checker *fakeIdentityChecker) StartTime(pid int) (uint64, error) {
+	return checker.startTime, nil
+}
+
+var _ = Describe("InstanceProcessIdentities", func() {
+	var (
+		dataDir    string
+		repo       *redis.LocalRepository
+		checker    *fakeIdentityChecker
+		identities *redis.InstanceProcessIdentities
+	)
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "identities")
+		Expect(err).NotTo(HaveOccurred())
+
+		repo = redis.NewLocalRepository(brokerconfig.ServiceConfiguration{
+			InstanceDataDirectory: dataDir,
+		}, lagertest.NewTestLogger("identities"))
+		Expect(os.MkdirAll(repo.InstanceBaseDir("an-instance"), 0750)).To(Succeed())
+
+		checker = &fakeIdentityChecker{startTime: 987654}
+		identities = redis.NewInstanceProcessIdentities(repo, checker)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("expects the instance's config and data directory", func() {
+		Expect(identities.Verify("an-instance", 123)).To(Succeed())
+		Expect(checker.verified).To(Equal([]process.Identity{{
+			ConfigPath: filepath.Join(dataDir, "an-instance", "redis.conf"),
+			DataDir:    filepath.Join(dataDir, "an-instance", "db"),
+		}}))
+	})
+
+	It("expects the start time of the process it recorded", func() {
+		Expect(identities.Record("an-instance", 123)).To(Succeed())
+		Expect(identities.Verify("an-instance", 123)).To(Succeed())
+
+		Expect(checker.verified[0].StartTime).To(Equal(uint64(987654)))
+	})
+})
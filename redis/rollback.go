@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProvisioningError describes which step of creating an instance failed, and
+// whether everything done up to that point could be undone.
+type ProvisioningError struct {
+	InstanceID     string
+	Step           string
+	Err            error
+	RollbackErrors []error
+}
+
+func (err *ProvisioningError) Error() string {
+	message := fmt.Sprintf("provisioning instance %s failed to %s: %s", err.InstanceID, err.Step, err.Err)
+	if len(err.RollbackErrors) == 0 {
+		return message
+	}
+
+	rollbackMessages := []string{}
+	for _, rollbackErr := range err.RollbackErrors {
+		rollbackMessages = append(rollbackMessages, rollbackErr.Error())
+	}
+
+	return message + "; rollback incomplete: " + strings.Join(rollbackMessages, ", ")
+}
+
+func (err *ProvisioningError) Unwrap() error {
+	return err.Err
+}
+
+type rollbackStep struct {
+	description string
+	undo        func() error
+}
+
+// rollbackSteps undoes the steps of a provisioning in the reverse order they
+// were completed in.
+type rollbackSteps []rollbackStep
+
+func (steps *rollbackSteps) add(description string, undo func() error) {
+	*steps = append(*steps, rollbackStep{description, undo})
+}
+
+func (steps rollbackSteps) rollback(instanceID, failedStep string, cause error) error {
+	provisioningErr := &ProvisioningError{
+		InstanceID: instanceID,
+		Step:       failedStep,
+		Err:        cause,
+	}
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		err := steps[i].undo()
+		if err != nil {
+			provisioningErr.RollbackErrors = append(
+				provisioningErr.RollbackErrors,
+				fmt.Errorf("%s: %s", steps[i].description, err),
+			)
+		}
+	}
+
+	return provisioningErr
+}
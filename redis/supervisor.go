@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"fmt"
+	"syscall"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/BooleanCat/igo/ios/iexec"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+const (
+	SupervisorPidfile = "pidfile"
+	SupervisorChild   = "child"
+	SupervisorSystemd = "systemd"
+)
+
+// Supervisor runs the redis-server of shared instances. A nil credential
+// starts redis-server as the broker's user.
+//
+//go:generate counterfeiter -o fakes/fake_supervisor.go . Supervisor
+type Supervisor interface {
+	Start(instance *Instance, executable string, args []string, credential *syscall.Credential) error
+	Stop(instance *Instance) error
+}
+
+// NewSupervisor returns the supervisor selected in the broker config. The
+// pidfile supervisor is used when none is selected.
+func NewSupervisor(config brokerconfig.ServiceConfiguration, controller *OSProcessController) (Supervisor, error) {
+	switch config.Supervisor {
+	case "", SupervisorPidfile:
+		return controller.pidfileSupervisor(), nil
+	case SupervisorChild:
+		supervisor := NewChildSupervisor(config, controller.pidfileSupervisor(), controller.Logger.Session("child-supervisor"))
+		supervisor.Adopt = controller.adopt
+		supervisor.Cgroups = controller.Cgroups
+		return supervisor, nil
+	case SupervisorSystemd:
+		return NewSystemdSupervisor(config, controller.Logger.Session("systemd-supervisor")), nil
+	default:
+		return nil, fmt.Errorf("unknown supervisor %q", config.Supervisor)
+	}
+}
+
+// SupervisorOwners reports the instances whose redis-server is restarted by
+// the configured supervisor. The process monitor supervises all others,
+// including instances that were started before the supervisor was configured
+// and have not been restarted since.
+type SupervisorOwners struct {
+	Config         brokerconfig.ServiceConfiguration
+	ProcessChecker ProcessChecker
+	Exec           iexec.Exec
+}
+
+func NewSupervisorOwners(config brokerconfig.ServiceConfiguration, processChecker ProcessChecker) *SupervisorOwners {
+	return &SupervisorOwners{Config: config, ProcessChecker: processChecker, Exec: iexec.New()}
+}
+
+// Owns reports whether the instance's redis-server is restarted by the
+// supervisor. The child supervisor only owns instances while the broker that
+// started them is running, and systemd only owns instances whose unit is
+// active; the process monitor starts the others again.
+func (owners *SupervisorOwners) Owns(instanceID string) bool {
+	switch owners.Config.Supervisor {
+	case SupervisorChild:
+		return childOwnerAlive(owners.Config.PidfileDirectory, instanceID, owners.ProcessChecker)
+	case SupervisorSystemd:
+		supervisor := NewSystemdSupervisor(owners.Config, nil)
+		supervisor.Exec = owners.Exec
+		return supervisor.Active(instanceID)
+	default:
+		return false
+	}
+}
+
+// PidfileSupervisor starts redis-server daemonized and stops it through the
+// pidfile it writes. Crashed instances are restarted by the process monitor,
+// which polls the pidfiles.
+type PidfileSupervisor struct {
+	Logger           lager.Logger
+	InstanceInformer InstanceInformer
+	ProcessKiller    ProcessKiller
+	Identities       ProcessIdentities
+	Cgroups          InstanceCgroups
+	Exec             iexec.Exec
+}
+
+func (supervisor *PidfileSupervisor) Start(instance *Instance, executable string, args []string, credential *syscall.Credential) error {
+	attr, closeCgroup, err := processAttr(supervisor.Cgroups, instance.ID, credential)
+	if err != nil {
+		return err
+	}
+	defer closeCgroup()
+
+	cmd := supervisor.Exec.Command(executable, args...)
+	if attr != nil {
+		cmd.SetSysProcAttr(attr)
+	}
+
+	return cmd.Run()
+}
+
+func (supervisor *PidfileSupervisor) Stop(instance *Instance) error {
+	pid, err := supervisor.InstanceInformer.InstancePid(instance.ID)
+	if err != nil {
+		supervisor.Logger.Error(
+			"redis instance has no pidfile",
+			err,
+			lager.Data{
+				"instance": instance.ID,
+			},
+		)
+		return err
+	}
+
+	if supervisor.Identities != nil {
+		err = supervisor.Identities.Verify(instance.ID, pid)
+		if err != nil {
+			supervisor.Logger.Error(
+				"refusing to kill process that is not the instance's redis-server",
+				err,
+				lager.Data{
+					"instance": instance.ID,
+					"pid":      pid,
+				},
+			)
+			return err
+		}
+	}
+
+	return supervisor.ProcessKiller.Kill(pid)
+}
+
+// processAttr starts redis-server as credential and, when cgroups are set,
+// inside the instance's cgroup, so that it is limited from the start rather
+// than once it has loaded its data. The returned function closes the cgroup
+// after the process has started. A nil attr starts redis-server as the
+// broker's user in the broker's cgroup.
+func processAttr(cgroups InstanceCgroups, instanceID string, credential *syscall.Credential) (*syscall.SysProcAttr, func(), error) {
+	if cgroups == nil {
+		if credential == nil {
+			return nil, func() {}, nil
+		}
+		return &syscall.SysProcAttr{Credential: credential}, func() {}, nil
+	}
+
+	cgroup, err := cgroups.Open(instanceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open cgroup: %s", err)
+	}
+
+	attr := &syscall.SysProcAttr{
+		Credential:  credential,
+		UseCgroupFD: true,
+		CgroupFD:    int(cgroup.Fd()),
+	}
+	return attr, func() { cgroup.Close() }, nil
+}
@@ -0,0 +1,379 @@
+package redis_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"github.com/BooleanCat/igo/ios/iexec"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisors", func() {
+	var (
+		logger     *lagertest.TestLogger
+		controller *redis.OSProcessController
+		instance   *redis.Instance
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("supervisor")
+		controller = redis.NewOSProcessController(logger, new(fakes.FakeInstanceInformer), new(fakes.FakeProcessChecker), new(fakes.FakeProcessKiller), nil, nil, "")
+		instance = &redis.Instance{ID: "an-instance", Host: "127.0.0.1", Port: 6380}
+	})
+
+	Describe("NewSupervisor", func() {
+		It("defaults to the pidfile supervisor", func() {
+			supervisor, err := redis.NewSupervisor(brokerconfig.ServiceConfiguration{}, controller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supervisor).To(BeAssignableToTypeOf(&redis.PidfileSupervisor{}))
+		})
+
+		It("selects the configured supervisor", func() {
+			supervisor, err := redis.NewSupervisor(brokerconfig.ServiceConfiguration{Supervisor: redis.SupervisorChild}, controller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supervisor).To(BeAssignableToTypeOf(&redis.ChildSupervisor{}))
+			Expect(supervisor.(*redis.ChildSupervisor).Adopt).NotTo(BeNil())
+
+			supervisor, err = redis.NewSupervisor(brokerconfig.ServiceConfiguration{Supervisor: redis.SupervisorSystemd}, controller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supervisor).To(BeAssignableToTypeOf(&redis.SystemdSupervisor{}))
+		})
+
+		It("starts children in the controller's cgroups", func() {
+			instanceCgroups := new(fakes.FakeInstanceCgroups)
+			controller.Cgroups = instanceCgroups
+
+			supervisor, err := redis.NewSupervisor(brokerconfig.ServiceConfiguration{Supervisor: redis.SupervisorChild}, controller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supervisor.(*redis.ChildSupervisor).Cgroups).To(BeIdenticalTo(instanceCgroups))
+		})
+
+		It("rejects unknown supervisors", func() {
+			_, err := redis.NewSupervisor(brokerconfig.ServiceConfiguration{Supervisor: "monit"}, controller)
+			Expect(err).To(MatchError(`unknown supervisor "monit"`))
+		})
+	})
+
+	Describe("OSProcessController", func() {
+		It("starts and stops redis-server through its supervisor", func() {
+			supervisor := new(fakes.FakeSupervisor)
+			controller.Supervisor = supervisor
+			controller.WaitUntilConnectableFunc = func(*net.TCPAddr, time.Duration) error { return nil }
+
+			Expect(controller.StartAndWaitUntilReady(instance, "redis.conf", "db", "redis.log", time.Second)).To(Succeed())
+			startedInstance, executable, args, credential := supervisor.StartArgsForCall(0)
+			Expect(startedInstance).To(Equal(instance))
+			Expect(executable).To(Equal("redis-server"))
+			Expect(args).To(Equal([]string{"redis.conf", "--dir", "db", "--logfile", "redis.log"}))
+			Expect(credential).To(BeNil())
+
+			Expect(controller.Kill(instance)).To(Succeed())
+			Expect(supervisor.StopArgsForCall(0)).To(Equal(instance))
+		})
+
+		It("starts redis-server as the instance's user", func() {
+			supervisor := new(fakes.FakeSupervisor)
+			credentials := new(fakes.FakeInstanceCredentials)
+			credentials.InstanceCredentialReturns(&syscall.Credential{Uid: 998, Gid: 997}, nil)
+			controller.Supervisor = supervisor
+			controller.Credentials = credentials
+			controller.WaitUntilConnectableFunc = func(*net.TCPAddr, time.Duration) error { return nil }
+
+			Expect(controller.StartAndWaitUntilReady(instance, "redis.conf", "db", "redis.log", time.Second)).To(Succeed())
+			Expect(credentials.InstanceCredentialArgsForCall(0)).To(Equal(instance.ID))
+			_, _, _, credential := supervisor.StartArgsForCall(0)
+			Expect(credential).To(Equal(&syscall.Credential{Uid: 998, Gid: 997}))
+		})
+
+		It("does not start redis-server when the instance's user cannot be set up", func() {
+			supervisor := new(fakes.FakeSupervisor)
+			credentials := new(fakes.FakeInstanceCredentials)
+			credentials.InstanceCredentialReturns(nil, errors.New("useradd failed"))
+			controller.Supervisor = supervisor
+			controller.Credentials = credentials
+
+			err := controller.StartAndWaitUntilReady(instance, "redis.conf", "db", "redis.log", time.Second)
+			Expect(err).To(MatchError(ContainSubstring("useradd failed")))
+			Expect(supervisor.StartCallCount()).To(BeZero())
+		})
+	})
+
+	Describe("ChildSupervisor", func() {
+		var (
+			scriptDir  string
+			startsFile string
+			fallback   *fakes.FakeSupervisor
+			supervisor *redis.ChildSupervisor
+		)
+
+		writeScript := func(body string) string {
+			script := filepath.Join(scriptDir, "redis-server")
+			Expect(os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n%s\n", startsFile, body)), 0755)).To(Succeed())
+			return script
+		}
+
+		starts := func() []string {
+			contents, err := os.ReadFile(startsFile)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return strings.Split(strings.TrimSpace(string(contents)), "\n")
+		}
+
+		BeforeEach(func() {
+			var err error
+			scriptDir, err = os.MkdirTemp("", "child-supervisor")
+			Expect(err).NotTo(HaveOccurred())
+			startsFile = filepath.Join(scriptDir, "starts")
+
+			fallback = new(fakes.FakeSupervisor)
+			supervisor = redis.NewChildSupervisor(brokerconfig.ServiceConfiguration{PidfileDirectory: scriptDir}, fallback, logger)
+			supervisor.RestartDelay = 10 * time.Millisecond
+			supervisor.MaxRestartDelay = 20 * time.Millisecond
+		})
+
+		AfterEach(func() {
+			supervisor.Stop(instance)
+			Expect(os.RemoveAll(scriptDir)).To(Succeed())
+		})
+
+		It("runs redis-server in the foreground", func() {
+			script := writeScript("exec sleep 60")
+
+			Expect(supervisor.Start(instance, script, []string{"redis.conf"}, nil)).To(Succeed())
+
+			Eventually(starts).Should(Equal([]string{"redis.conf --daemonize no"}))
+			Expect(supervisor.Running(instance.ID)).To(BeTrue())
+		})
+
+		It("restarts redis-server when it exits", func() {
+			script := writeScript("exit 1")
+
+			Expect(supervisor.Start(instance, script, []string{"redis.conf"}, nil)).To(Succeed())
+
+			Eventually(starts).Should(HaveLen(3))
+			Eventually(logger).Should(gbytes.Say("redis-server exited"))
+		})
+
+		It("adopts every restarted redis-server", func() {
+			adopted := make(chan string, 10)
+			supervisor.Adopt = func(adoptedInstance *redis.Instance, pid int) error {
+				adopted <- adoptedInstance.ID
+				return nil
+			}
+			script := writeScript("exit 1")
+
+			Expect(supervisor.Start(instance, script, nil, nil)).To(Succeed())
+
+			Eventually(adopted).Should(Receive(Equal(instance.ID)))
+			Eventually(adopted).Should(Receive(Equal(instance.ID)))
+		})
+
+		It("logs restarted redis-servers that cannot be adopted", func() {
+			supervisor.Adopt = func(*redis.Instance, int) error {
+				return errors.New("cgroup gone")
+			}
+			script := writeScript("exit 1")
+
+			Expect(supervisor.Start(instance, script, nil, nil)).To(Succeed())
+
+			Eventually(logger).Should(gbytes.Say("failed to adopt restarted redis-server"))
+			Eventually(starts).Should(HaveLen(3))
+		})
+
+		It("does not restart redis-server once it is stopped", func() {
+			script := writeScript("exec sleep 60")
+			Expect(supervisor.Start(instance, script, nil, nil)).To(Succeed())
+			Eventually(starts).Should(HaveLen(1))
+
+			Expect(supervisor.Stop(instance)).To(Succeed())
+
+			Expect(supervisor.Running(instance.ID)).To(BeFalse())
+			Consistently(starts, 100*time.Millisecond).Should(HaveLen(1))
+			Expect(fallback.StopCallCount()).To(BeZero())
+		})
+
+		It("stops instances that it did not start through the fallback supervisor", func() {
+			Expect(supervisor.Stop(instance)).To(Succeed())
+			Expect(fallback.StopArgsForCall(0)).To(Equal(instance))
+		})
+
+		Describe("ownership", func() {
+			var (
+				checker *fakes.FakeProcessChecker
+				owners  *redis.SupervisorOwners
+			)
+
+			BeforeEach(func() {
+				checker = new(fakes.FakeProcessChecker)
+				checker.AliveReturns(true)
+				owners = redis.NewSupervisorOwners(brokerconfig.ServiceConfiguration{
+					Supervisor:       redis.SupervisorChild,
+					PidfileDirectory: scriptDir,
+				}, checker)
+			})
+
+			It("owns the instances it started while the broker is running", func() {
+				Expect(owners.Owns(instance.ID)).To(BeFalse())
+
+				Expect(supervisor.Start(instance, writeScript("exec sleep 60"), nil, nil)).To(Succeed())
+				Expect(owners.Owns(instance.ID)).To(BeTrue())
+				Expect(checker.AliveArgsForCall(0)).To(Equal(os.Getpid()))
+
+				checker.AliveReturns(false)
+				Expect(owners.Owns(instance.ID)).To(BeFalse())
+			})
+
+			It("gives up ownership when the instance is stopped", func() {
+				Expect(supervisor.Start(instance, writeScript("exec sleep 60"), nil, nil)).To(Succeed())
+
+				Expect(supervisor.Stop(instance)).To(Succeed())
+
+				Expect(owners.Owns(instance.ID)).To(BeFalse())
+			})
+
+			It("disowns instances that an earlier broker started", func() {
+				path, err := redis.ChildOwnerPath(scriptDir, instance.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(path, []byte("4321"), 0640)).To(Succeed())
+				Expect(owners.Owns(instance.ID)).To(BeTrue())
+
+				supervisor.Disown(instance.ID)
+
+				Expect(owners.Owns(instance.ID)).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("SystemdSupervisor", func() {
+		var (
+			unitDir    string
+			exec       *iexec.NestedCommandFake
+			supervisor *redis.SystemdSupervisor
+		)
+
+		systemctlCalls := func() []string {
+			calls := []string{}
+			for i := 0; i < exec.Exec.CommandCallCount(); i++ {
+				command, args := exec.Exec.CommandArgsForCall(i)
+				calls = append(calls, command+" "+strings.Join(args, " "))
+			}
+			return calls
+		}
+
+		BeforeEach(func() {
+			var err error
+			unitDir, err = os.MkdirTemp("", "systemd")
+			Expect(err).NotTo(HaveOccurred())
+
+			exec = iexec.NewNestedCommandFake()
+			supervisor = redis.NewSystemdSupervisor(brokerconfig.ServiceConfiguration{
+				SystemdUnitDirectory:  unitDir,
+				RestartBackoffSeconds: 3,
+			}, logger)
+			supervisor.Exec = exec.Exec
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(unitDir)).To(Succeed())
+		})
+
+		It("generates a unit for the instance, enables it and starts it", func() {
+			err := supervisor.Start(instance, "/usr/bin/redis-server", []string{"/data/an instance/redis.conf", "--dir", "/data/db"}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			unit, err := os.ReadFile(filepath.Join(unitDir, "redis-instance-an-instance.service"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(unit)).To(ContainSubstring(`ExecStart=/usr/bin/redis-server "/data/an instance/redis.conf" --dir /data/db --daemonize no`))
+			Expect(string(unit)).To(ContainSubstring("Restart=always"))
+			Expect(string(unit)).To(ContainSubstring("RestartSec=3"))
+			Expect(string(unit)).To(ContainSubstring("WantedBy=multi-user.target"))
+
+			Expect(systemctlCalls()).To(Equal([]string{
+				"systemctl daemon-reload",
+				"systemctl enable redis-instance-an-instance.service",
+				"systemctl start redis-instance-an-instance.service",
+			}))
+		})
+
+		It("runs the unit as the instance's user", func() {
+			err := supervisor.Start(instance, "redis-server", nil, &syscall.Credential{Uid: 998, Gid: 997})
+			Expect(err).NotTo(HaveOccurred())
+
+			unit, err := os.ReadFile(filepath.Join(unitDir, "redis-instance-an-instance.service"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(unit)).To(ContainSubstring("User=998\nGroup=997\n"))
+		})
+
+		It("stops the unit, disables it and removes it", func() {
+			Expect(supervisor.Start(instance, "redis-server", nil, nil)).To(Succeed())
+
+			Expect(supervisor.Stop(instance)).To(Succeed())
+
+			_, err := os.Stat(filepath.Join(unitDir, "redis-instance-an-instance.service"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(systemctlCalls()[3:]).To(Equal([]string{
+				"systemctl stop redis-instance-an-instance.service",
+				"systemctl disable redis-instance-an-instance.service",
+				"systemctl daemon-reload",
+			}))
+		})
+
+		It("reports instances without a unit as not running", func() {
+			err := supervisor.Stop(instance)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("owns the instances whose unit is active or about to be restarted", func() {
+			owners := redis.NewSupervisorOwners(brokerconfig.ServiceConfiguration{
+				Supervisor:           redis.SupervisorSystemd,
+				SystemdUnitDirectory: unitDir,
+			}, new(fakes.FakeProcessChecker))
+			owners.Exec = exec.Exec
+			Expect(supervisor.Start(instance, "redis-server", nil, nil)).To(Succeed())
+
+			for state, owned := range map[string]bool{
+				"active":     true,
+				"activating": true,
+				"reloading":  true,
+				"inactive":   false,
+				"failed":     false,
+				"":           false,
+			} {
+				exec.Cmd.OutputReturns([]byte(state+"\n"), nil)
+				Expect(owners.Owns(instance.ID)).To(Equal(owned), state)
+			}
+
+			command, args := exec.Exec.CommandArgsForCall(exec.Exec.CommandCallCount() - 1)
+			Expect(command).To(Equal("systemctl"))
+			Expect(args).To(Equal([]string{"is-active", "redis-instance-an-instance.service"}))
+		})
+
+		It("leaves instances whose unit has stopped to the process monitor", func() {
+			owners := redis.NewSupervisorOwners(brokerconfig.ServiceConfiguration{
+				Supervisor:           redis.SupervisorSystemd,
+				SystemdUnitDirectory: unitDir,
+			}, new(fakes.FakeProcessChecker))
+			owners.Exec = exec.Exec
+			Expect(supervisor.Start(instance, "redis-server", nil, nil)).To(Succeed())
+
+			exec.Cmd.OutputReturns([]byte("inactive\n"), errors.New("exit status 3"))
+			Expect(owners.Owns(instance.ID)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,176 @@
+package redis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/BooleanCat/igo/ios/iexec"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
+)
+
+const defaultSystemdUnitDirectory = "/etc/systemd/system"
+
+// SystemdSupervisor generates a systemd unit for each instance and leaves
+// restarting crashed instances to systemd. Units are enabled, so that the
+// instances are started again when the VM reboots, and are restarted whenever
+// redis-server exits, not only when it fails.
+type SystemdSupervisor struct {
+	UnitDirectory string
+	RestartDelay  int
+	Logger        lager.Logger
+	Exec          iexec.Exec
+}
+
+func NewSystemdSupervisor(config brokerconfig.ServiceConfiguration, logger lager.Logger) *SystemdSupervisor {
+	supervisor := &SystemdSupervisor{
+		UnitDirectory: config.SystemdUnitDirectory,
+		RestartDelay:  config.RestartBackoffSeconds,
+		Logger:        logger,
+		Exec:          iexec.New(),
+	}
+
+	if supervisor.UnitDirectory == "" {
+		supervisor.UnitDirectory = defaultSystemdUnitDirectory
+	}
+
+	if supervisor.RestartDelay <= 0 {
+		supervisor.RestartDelay = 1
+	}
+
+	return supervisor
+}
+
+func (supervisor *SystemdSupervisor) Start(instance *Instance, executable string, args []string, credential *syscall.Credential) error {
+	unitPath, err := supervisor.UnitPath(instance.ID)
+	if err != nil {
+		return err
+	}
+
+	args = append(append([]string{}, args...), "--daemonize", "no")
+
+	err = ioutil.WriteFile(unitPath, []byte(supervisor.unit(instance, executable, args, credential)), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = supervisor.systemctl("daemon-reload")
+	if err != nil {
+		return err
+	}
+
+	err = supervisor.systemctl("enable", UnitName(instance.ID))
+	if err != nil {
+		return err
+	}
+
+	return supervisor.systemctl("start", UnitName(instance.ID))
+}
+
+func (supervisor *SystemdSupervisor) Stop(instance *Instance) error {
+	unitPath, err := supervisor.UnitPath(instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(unitPath); err != nil {
+		return err
+	}
+
+	err = supervisor.systemctl("stop", UnitName(instance.ID))
+	if err != nil {
+		return err
+	}
+
+	err = supervisor.systemctl("disable", UnitName(instance.ID))
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(unitPath)
+	if err != nil {
+		return err
+	}
+
+	return supervisor.systemctl("daemon-reload")
+}
+
+// Active reports whether systemd is running the instance's unit or about to
+// restart it. Units that have failed, for example because they hit systemd's
+// start limit, or that are not loaded are not active.
+func (supervisor *SystemdSupervisor) Active(instanceID string) bool {
+	output, _ := supervisor.Exec.Command("systemctl", "is-active", UnitName(instanceID)).Output()
+
+	switch strings.TrimSpace(string(output)) {
+	case "active", "activating", "reloading":
+		return true
+	default:
+		return false
+	}
+}
+
+func (supervisor *SystemdSupervisor) UnitPath(instanceID string) (string, error) {
+	return paths.NewResolver(supervisor.UnitDirectory).Resolve(UnitName(instanceID))
+}
+
+func UnitName(instanceID string) string {
+	return "redis-instance-" + instanceID + ".service"
+}
+
+func (supervisor *SystemdSupervisor) unit(instance *Instance, executable string, args []string, credential *syscall.Credential) string {
+	command := []string{systemdQuote(executable)}
+	for _, arg := range args {
+		command = append(command, systemdQuote(arg))
+	}
+
+	user := ""
+	if credential != nil {
+		user = fmt.Sprintf("User=%d\nGroup=%d\n", credential.Uid, credential.Gid)
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=Redis shared instance %s
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=%s
+%sRestart=always
+RestartSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, instance.ID, strings.Join(command, " "), user, supervisor.RestartDelay)
+}
+
+func (supervisor *SystemdSupervisor) systemctl(args ...string) error {
+	output, err := supervisor.Exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		supervisor.Logger.Error("systemctl", err, lager.Data{
+			"args":   args,
+			"output": string(output),
+		})
+		return fmt.Errorf("systemctl %s failed: %s", strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+// systemdQuote quotes a command line argument for ExecStart, which splits on
+// whitespace and expands specifiers and variables.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
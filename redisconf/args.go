@@ -0,0 +1,165 @@
+package redisconf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errUnbalancedQuotes = errors.New("unbalanced quotes in configuration line")
+
+// SplitArgs splits a line into arguments the way redis-server does: arguments
+// are separated by whitespace and may be quoted. Double quoted arguments
+// support the escapes \n, \r, \t, \b, \a, \xHH and escaped characters; single
+// quoted arguments only support \'.
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+
+	p := 0
+	for {
+		for p < len(line) && isSpace(line[p]) {
+			p++
+		}
+		if p == len(line) {
+			return args, nil
+		}
+
+		var (
+			inQuotes       bool
+			inSingleQuotes bool
+			done           bool
+			current        []byte
+		)
+
+		for !done {
+			switch {
+			case inQuotes:
+				switch {
+				case p+3 < len(line) && line[p] == '\\' && line[p+1] == 'x' && isHex(line[p+2]) && isHex(line[p+3]):
+					value, _ := strconv.ParseUint(line[p+2:p+4], 16, 8)
+					current = append(current, byte(value))
+					p += 3
+				case p+1 < len(line) && line[p] == '\\':
+					p++
+					current = append(current, unescape(line[p]))
+				case p < len(line) && line[p] == '"':
+					// the closing quote must be followed by a space or
+					// nothing at all
+					if p+1 < len(line) && !isSpace(line[p+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				case p == len(line):
+					return nil, errUnbalancedQuotes
+				default:
+					current = append(current, line[p])
+				}
+
+			case inSingleQuotes:
+				switch {
+				case p+1 < len(line) && line[p] == '\\' && line[p+1] == '\'':
+					p++
+					current = append(current, '\'')
+				case p < len(line) && line[p] == '\'':
+					if p+1 < len(line) && !isSpace(line[p+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				case p == len(line):
+					return nil, errUnbalancedQuotes
+				default:
+					current = append(current, line[p])
+				}
+
+			default:
+				switch {
+				case p == len(line) || isSpace(line[p]) || line[p] == 0:
+					done = true
+				case line[p] == '"':
+					inQuotes = true
+				case line[p] == '\'':
+					inSingleQuotes = true
+				default:
+					current = append(current, line[p])
+				}
+			}
+
+			if p < len(line) {
+				p++
+			}
+		}
+
+		args = append(args, string(current))
+	}
+}
+
+// Quote returns arg in a form SplitArgs reads back as a single argument.
+// Arguments that need no quoting are returned as they are.
+func Quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"'\\") && isPrintable(arg) {
+		return arg
+	}
+
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\', '"':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case '\n':
+			quoted.WriteString(`\n`)
+		case '\r':
+			quoted.WriteString(`\r`)
+		case '\t':
+			quoted.WriteString(`\t`)
+		case '\a':
+			quoted.WriteString(`\a`)
+		case '\b':
+			quoted.WriteString(`\b`)
+		default:
+			if c < 0x20 || c > 0x7e {
+				fmt.Fprintf(&quoted, `\x%02x`, c)
+			} else {
+				quoted.WriteByte(c)
+			}
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isPrintable(arg string) bool {
+	for i := 0; i < len(arg); i++ {
+		if arg[i] < 0x20 || arg[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,523 @@
+package redisconf
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownDirective is returned for directives that are not in Directives.
+var ErrUnknownDirective = errors.New("unknown directive")
+
+var (
+	versionPattern       = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?$`)
+	serverVersionPattern = regexp.MustCompile(`\bv=(\d+\.\d+(?:\.\d+)?)\b`)
+	memoryPattern        = regexp.MustCompile(`(?i)^(\d+)(b|k|kb|m|mb|g|gb)?$`)
+)
+
+// Version is a redis-server version. The zero Version stands for an unknown
+// version, for which every directive is accepted.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func ParseVersion(version string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return Version{}, fmt.Errorf("invalid redis version %q", version)
+	}
+
+	parsed := Version{}
+	parsed.Major, _ = strconv.Atoi(match[1])
+	parsed.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		parsed.Patch, _ = strconv.Atoi(match[3])
+	}
+	return parsed, nil
+}
+
+// ServerVersion asks the redis-server executable for its version. An empty
+// executable runs redis-server from the PATH.
+func ServerVersion(executable string) (Version, error) {
+	if executable == "" {
+		executable = "redis-server"
+	}
+
+	output, err := exec.Command(executable, "--version").Output()
+	if err != nil {
+		return Version{}, err
+	}
+
+	match := serverVersionPattern.FindStringSubmatch(string(output))
+	if match == nil {
+		return Version{}, fmt.Errorf("no version in the output of %s --version: %s", executable, strings.TrimSpace(string(output)))
+	}
+	return ParseVersion(match[1])
+}
+
+func (version Version) IsZero() bool {
+	return version == Version{}
+}
+
+func (version Version) Less(other Version) bool {
+	if version.Major != other.Major {
+		return version.Major < other.Major
+	}
+	if version.Minor != other.Minor {
+		return version.Minor < other.Minor
+	}
+	return version.Patch < other.Patch
+}
+
+func (version Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+}
+
+type DirectiveType int
+
+const (
+	// TypeString takes a single argument.
+	TypeString DirectiveType = iota
+	// TypeBool takes yes or no.
+	TypeBool
+	// TypeInt takes an integer between Min and Max.
+	TypeInt
+	// TypeOctal takes an octal integer between Min and Max, such as file
+	// permissions.
+	TypeOctal
+	// TypeMemory takes a size in bytes, optionally with a unit such as mb,
+	// of at least Min and at most Max.
+	TypeMemory
+	// TypeEnum takes one of Values.
+	TypeEnum
+	// TypeArgs takes Args arguments, or at least one when Args is 0.
+	TypeArgs
+	// TypeSave takes pairs of seconds and changes, or "" to disable
+	// snapshots.
+	TypeSave
+	// TypeClientOutputBufferLimit takes a client class and three limits.
+	TypeClientOutputBufferLimit
+)
+
+// Directive describes the arguments a redis.conf directive takes and the
+// redis-server version that introduced it. A Max of 0 leaves a range open.
+type Directive struct {
+	Type   DirectiveType
+	Min    int64
+	Max    int64
+	Values []string
+	Args   int
+	Since  Version
+}
+
+var (
+	v4_0 = Version{Major: 4}
+	v5_0 = Version{Major: 5}
+	v6_0 = Version{Major: 6}
+	v6_2 = Version{Major: 6, Minor: 2}
+	v7_0 = Version{Major: 7}
+	v7_2 = Version{Major: 7, Minor: 2}
+)
+
+// Directives holds the directives that can be validated, by lower case name.
+var Directives = map[string]Directive{
+	// general
+	"include":                  {Type: TypeArgs, Args: 1},
+	"loadmodule":               {Type: TypeArgs},
+	"daemonize":                {Type: TypeBool},
+	"supervised":               {Type: TypeEnum, Values: []string{"upstart", "systemd", "auto", "no"}},
+	"pidfile":                  {Type: TypeString},
+	"loglevel":                 {Type: TypeEnum, Values: []string{"debug", "verbose", "notice", "warning"}},
+	"logfile":                  {Type: TypeString},
+	"syslog-enabled":           {Type: TypeBool},
+	"syslog-ident":             {Type: TypeString},
+	"syslog-facility":          {Type: TypeEnum, Values: []string{"user", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}},
+	"crash-log-enabled":        {Type: TypeBool, Since: v7_0},
+	"crash-memcheck-enabled":   {Type: TypeBool, Since: v7_0},
+	"databases":                {Type: TypeInt, Min: 1},
+	"always-show-logo":         {Type: TypeBool},
+	"set-proc-title":           {Type: TypeBool, Since: v6_2},
+	"proc-title-template":      {Type: TypeString, Since: v6_2},
+	"enable-protected-configs": {Type: TypeEnum, Values: []string{"yes", "no", "local"}, Since: v7_0},
+	"enable-debug-command":     {Type: TypeEnum, Values: []string{"yes", "no", "local"}, Since: v7_0},
+	"enable-module-command":    {Type: TypeEnum, Values: []string{"yes", "no", "local"}, Since: v7_0},
+
+	// network
+	"bind":                      {Type: TypeArgs},
+	"bind-source-addr":          {Type: TypeString, Since: v7_0},
+	"protected-mode":            {Type: TypeBool},
+	"port":                      {Type: TypeInt, Min: 0, Max: 65535},
+	"tcp-backlog":               {Type: TypeInt, Min: 0},
+	"unixsocket":                {Type: TypeString},
+	"unixsocketperm":            {Type: TypeOctal, Min: 0, Max: 0777},
+	"timeout":                   {Type: TypeInt, Min: 0},
+	"tcp-keepalive":             {Type: TypeInt, Min: 0},
+	"socket-mark-id":            {Type: TypeInt, Min: 0, Since: v7_0},
+	"tls-port":                  {Type: TypeInt, Min: 0, Max: 65535, Since: v6_0},
+	"tls-cert-file":             {Type: TypeString, Since: v6_0},
+	"tls-key-file":              {Type: TypeString, Since: v6_0},
+	"tls-key-file-pass":         {Type: TypeString, Since: v6_2},
+	"tls-client-cert-file":      {Type: TypeString, Since: v6_2},
+	"tls-client-key-file":       {Type: TypeString, Since: v6_2},
+	"tls-dh-params-file":        {Type: TypeString, Since: v6_0},
+	"tls-ca-cert-file":          {Type: TypeString, Since: v6_0},
+	"tls-ca-cert-dir":           {Type: TypeString, Since: v6_0},
+	"tls-auth-clients":          {Type: TypeEnum, Values: []string{"yes", "no", "optional"}, Since: v6_0},
+	"tls-replication":           {Type: TypeBool, Since: v6_0},
+	"tls-cluster":               {Type: TypeBool, Since: v6_0},
+	"tls-protocols":             {Type: TypeString, Since: v6_0},
+	"tls-ciphers":               {Type: TypeString, Since: v6_0},
+	"tls-ciphersuites":          {Type: TypeString, Since: v6_0},
+	"tls-prefer-server-ciphers": {Type: TypeBool, Since: v6_0},
+	"tls-session-caching":       {Type: TypeBool, Since: v6_0},
+	"tls-session-cache-size":    {Type: TypeInt, Min: 0, Since: v6_0},
+	"tls-session-cache-timeout": {Type: TypeInt, Min: 0, Since: v6_0},
+
+	// snapshotting
+	"save":                        {Type: TypeSave},
+	"stop-writes-on-bgsave-error": {Type: TypeBool},
+	"rdbcompression":              {Type: TypeBool},
+	"rdbchecksum":                 {Type: TypeBool},
+	"sanitize-dump-payload":       {Type: TypeEnum, Values: []string{"no", "yes", "clients"}, Since: v6_2},
+	"dbfilename":                  {Type: TypeString},
+	"rdb-del-sync-files":          {Type: TypeBool, Since: v6_0},
+	"rdb-save-incremental-fsync":  {Type: TypeBool},
+	"dir":                         {Type: TypeString},
+
+	// replication
+	"replicaof":                       {Type: TypeArgs, Args: 2, Since: v5_0},
+	"slaveof":                         {Type: TypeArgs, Args: 2},
+	"masterauth":                      {Type: TypeString},
+	"masteruser":                      {Type: TypeString, Since: v6_0},
+	"replica-serve-stale-data":        {Type: TypeBool, Since: v5_0},
+	"slave-serve-stale-data":          {Type: TypeBool},
+	"replica-read-only":               {Type: TypeBool, Since: v5_0},
+	"slave-read-only":                 {Type: TypeBool},
+	"repl-diskless-sync":              {Type: TypeBool},
+	"repl-diskless-sync-delay":        {Type: TypeInt, Min: 0},
+	"repl-diskless-sync-max-replicas": {Type: TypeInt, Min: 0, Since: v7_0},
+	"repl-diskless-load":              {Type: TypeEnum, Values: []string{"disabled", "on-empty-db", "swapdb"}, Since: v6_0},
+	"repl-ping-replica-period":        {Type: TypeInt, Min: 1, Since: v5_0},
+	"repl-timeout":                    {Type: TypeInt, Min: 1},
+	"repl-disable-tcp-nodelay":        {Type: TypeBool},
+	"repl-backlog-size":               {Type: TypeMemory, Min: 1},
+	"repl-backlog-ttl":                {Type: TypeInt, Min: 0},
+	"replica-priority":                {Type: TypeInt, Min: 0, Since: v5_0},
+	"slave-priority":                  {Type: TypeInt, Min: 0},
+	"replica-announced":               {Type: TypeBool, Since: v6_2},
+	"min-replicas-to-write":           {Type: TypeInt, Min: 0, Since: v5_0},
+	"min-replicas-max-lag":            {Type: TypeInt, Min: 0, Since: v5_0},
+	"replica-announce-ip":             {Type: TypeString, Since: v5_0},
+	"replica-announce-port":           {Type: TypeInt, Min: 0, Max: 65535, Since: v5_0},
+	"replica-ignore-maxmemory":        {Type: TypeBool, Since: v5_0},
+	"replica-lazy-flush":              {Type: TypeBool, Since: v5_0},
+	"slave-lazy-flush":                {Type: TypeBool, Since: v4_0},
+	"repl-ping-slave-period":          {Type: TypeInt, Min: 1},
+	"min-slaves-to-write":             {Type: TypeInt, Min: 0},
+	"min-slaves-max-lag":              {Type: TypeInt, Min: 0},
+	"slave-announce-ip":               {Type: TypeString},
+	"slave-announce-port":             {Type: TypeInt, Min: 0, Max: 65535},
+	"slave-ignore-maxmemory":          {Type: TypeBool, Since: v5_0},
+
+	// security
+	"requirepass":        {Type: TypeString},
+	"user":               {Type: TypeArgs, Since: v6_0},
+	"aclfile":            {Type: TypeString, Since: v6_0},
+	"acllog-max-len":     {Type: TypeInt, Min: 0, Since: v6_0},
+	"acl-pubsub-default": {Type: TypeEnum, Values: []string{"allchannels", "resetchannels"}, Since: v6_2},
+	"rename-command":     {Type: TypeArgs, Args: 2},
+
+	// clients and memory
+	"maxclients":                  {Type: TypeInt, Min: 1},
+	"maxmemory":                   {Type: TypeMemory},
+	"maxmemory-policy":            {Type: TypeEnum, Values: []string{"volatile-lru", "allkeys-lru", "volatile-lfu", "allkeys-lfu", "volatile-random", "allkeys-random", "volatile-ttl", "noeviction"}},
+	"maxmemory-samples":           {Type: TypeInt, Min: 1, Max: 64},
+	"maxmemory-eviction-tenacity": {Type: TypeInt, Min: 0, Max: 100, Since: v6_2},
+	"maxmemory-clients":           {Type: TypeString, Since: v7_0},
+	"active-expire-effort":        {Type: TypeInt, Min: 1, Max: 10, Since: v6_0},
+	"lazyfree-lazy-eviction":      {Type: TypeBool, Since: v4_0},
+	"lazyfree-lazy-expire":        {Type: TypeBool, Since: v4_0},
+	"lazyfree-lazy-server-del":    {Type: TypeBool, Since: v4_0},
+	"lazyfree-lazy-user-del":      {Type: TypeBool, Since: v6_0},
+	"lazyfree-lazy-user-flush":    {Type: TypeBool, Since: v6_2},
+	"io-threads":                  {Type: TypeInt, Min: 1, Max: 128, Since: v6_0},
+	"io-threads-do-reads":         {Type: TypeBool, Since: v6_0},
+	"oom-score-adj":               {Type: TypeEnum, Values: []string{"no", "yes", "relative", "absolute"}, Since: v6_2},
+	"oom-score-adj-values":        {Type: TypeArgs, Args: 3, Since: v6_2},
+	"disable-thp":                 {Type: TypeBool, Since: v7_0},
+	"client-output-buffer-limit":  {Type: TypeClientOutputBufferLimit},
+	"client-query-buffer-limit":   {Type: TypeMemory, Min: 1024 * 1024, Since: v4_0},
+	"proto-max-bulk-len":          {Type: TypeMemory, Min: 1024 * 1024, Since: v4_0},
+	"tracking-table-max-keys":     {Type: TypeInt, Min: 0, Since: v6_0},
+
+	// append only file
+	"appendonly":                    {Type: TypeBool},
+	"appendfilename":                {Type: TypeString},
+	"appenddirname":                 {Type: TypeString, Since: v7_0},
+	"appendfsync":                   {Type: TypeEnum, Values: []string{"always", "everysec", "no"}},
+	"no-appendfsync-on-rewrite":     {Type: TypeBool},
+	"auto-aof-rewrite-percentage":   {Type: TypeInt, Min: 0},
+	"auto-aof-rewrite-min-size":     {Type: TypeMemory},
+	"aof-load-truncated":            {Type: TypeBool},
+	"aof-use-rdb-preamble":          {Type: TypeBool, Since: v4_0},
+	"aof-timestamp-enabled":         {Type: TypeBool, Since: v7_0},
+	"aof-rewrite-incremental-fsync": {Type: TypeBool},
+
+	// scripting, cluster and latency
+	"lua-time-limit":                      {Type: TypeInt, Min: 0},
+	"lua-replicate-commands":              {Type: TypeBool},
+	"busy-reply-threshold":                {Type: TypeInt, Min: 0, Since: v7_0},
+	"cluster-enabled":                     {Type: TypeBool},
+	"cluster-config-file":                 {Type: TypeString},
+	"cluster-node-timeout":                {Type: TypeInt, Min: 1},
+	"cluster-port":                        {Type: TypeInt, Min: 0, Max: 65535, Since: v7_0},
+	"cluster-replica-validity-factor":     {Type: TypeInt, Min: 0, Since: v5_0},
+	"cluster-slave-validity-factor":       {Type: TypeInt, Min: 0},
+	"cluster-migration-barrier":           {Type: TypeInt, Min: 0},
+	"cluster-allow-replica-migration":     {Type: TypeBool, Since: v6_2},
+	"cluster-require-full-coverage":       {Type: TypeBool},
+	"cluster-replica-no-failover":         {Type: TypeBool, Since: v5_0},
+	"cluster-slave-no-failover":           {Type: TypeBool, Since: v4_0},
+	"cluster-allow-reads-when-down":       {Type: TypeBool, Since: v6_0},
+	"cluster-allow-pubsubshard-when-down": {Type: TypeBool, Since: v7_0},
+	"cluster-link-sendbuf-limit":          {Type: TypeMemory, Since: v7_0},
+	"cluster-announce-ip":                 {Type: TypeString, Since: v4_0},
+	"cluster-announce-port":               {Type: TypeInt, Min: 0, Max: 65535, Since: v4_0},
+	"cluster-announce-bus-port":           {Type: TypeInt, Min: 0, Max: 65535, Since: v4_0},
+	"cluster-announce-tls-port":           {Type: TypeInt, Min: 0, Max: 65535, Since: v6_0},
+	"cluster-announce-hostname":           {Type: TypeString, Since: v7_0},
+	"cluster-announce-human-nodename":     {Type: TypeString, Since: v7_2},
+	"cluster-preferred-endpoint-type":     {Type: TypeEnum, Values: []string{"ip", "hostname", "unknown-endpoint"}, Since: v7_0},
+	"shutdown-timeout":                    {Type: TypeInt, Min: 0, Since: v7_0},
+	"shutdown-on-sigint":                  {Type: TypeArgs, Since: v7_0},
+	"shutdown-on-sigterm":                 {Type: TypeArgs, Since: v7_0},
+	"slowlog-log-slower-than":             {Type: TypeInt, Min: -1},
+	"slowlog-max-len":                     {Type: TypeInt, Min: 0},
+	"latency-monitor-threshold":           {Type: TypeInt, Min: 0},
+	"latency-tracking":                    {Type: TypeBool, Since: v7_0},
+	"latency-tracking-info-percentiles":   {Type: TypeArgs, Since: v7_0},
+	"notify-keyspace-events":              {Type: TypeString},
+
+	// data structures
+	"hash-max-ziplist-entries":  {Type: TypeInt, Min: 0},
+	"hash-max-ziplist-value":    {Type: TypeInt, Min: 0},
+	"hash-max-listpack-entries": {Type: TypeInt, Min: 0, Since: v7_0},
+	"hash-max-listpack-value":   {Type: TypeInt, Min: 0, Since: v7_0},
+	"list-max-ziplist-size":     {Type: TypeInt, Min: -5},
+	"list-max-listpack-size":    {Type: TypeInt, Min: -5, Since: v7_0},
+	"list-max-ziplist-entries":  {Type: TypeInt, Min: 0},
+	"list-max-ziplist-value":    {Type: TypeInt, Min: 0},
+	"list-compress-depth":       {Type: TypeInt, Min: 0},
+	"set-max-intset-entries":    {Type: TypeInt, Min: 0},
+	"set-max-listpack-entries":  {Type: TypeInt, Min: 0, Since: v7_2},
+	"set-max-listpack-value":    {Type: TypeInt, Min: 0, Since: v7_2},
+	"zset-max-ziplist-entries":  {Type: TypeInt, Min: 0},
+	"zset-max-ziplist-value":    {Type: TypeInt, Min: 0},
+	"zset-max-listpack-entries": {Type: TypeInt, Min: 0, Since: v7_0},
+	"zset-max-listpack-value":   {Type: TypeInt, Min: 0, Since: v7_0},
+	"hll-sparse-max-bytes":      {Type: TypeMemory},
+	"stream-node-max-bytes":     {Type: TypeMemory, Since: v5_0},
+	"stream-node-max-entries":   {Type: TypeInt, Min: 0, Since: v5_0},
+	"activerehashing":           {Type: TypeBool},
+	"hz":                        {Type: TypeInt, Min: 1}, // values above 500 are lowered to 500
+	"dynamic-hz":                {Type: TypeBool, Since: v5_0},
+	"lfu-log-factor":            {Type: TypeInt, Min: 0, Since: v4_0},
+	"lfu-decay-time":            {Type: TypeInt, Min: 0, Since: v4_0},
+
+	// defragmentation
+	"activedefrag":                  {Type: TypeBool, Since: v4_0},
+	"active-defrag-ignore-bytes":    {Type: TypeMemory, Since: v4_0},
+	"active-defrag-threshold-lower": {Type: TypeInt, Min: 0, Max: 1000, Since: v4_0},
+	"active-defrag-threshold-upper": {Type: TypeInt, Min: 0, Max: 1000, Since: v4_0},
+	"active-defrag-cycle-min":       {Type: TypeInt, Min: 1, Max: 99, Since: v4_0},
+	"active-defrag-cycle-max":       {Type: TypeInt, Min: 1, Max: 99, Since: v4_0},
+	"active-defrag-max-scan-fields": {Type: TypeInt, Min: 1, Since: v5_0},
+	"jemalloc-bg-thread":            {Type: TypeBool, Since: v6_0},
+}
+
+// ValidateDirective returns an error when redis-server of the given version
+// would not accept value for the directive key. Unknown directives are
+// rejected with ErrUnknownDirective.
+func ValidateDirective(key, value string, version Version) error {
+	directive, ok := Directives[strings.ToLower(key)]
+	if !ok {
+		return fmt.Errorf("%s: %w", key, ErrUnknownDirective)
+	}
+
+	if !version.IsZero() && version.Less(directive.Since) {
+		return fmt.Errorf("%s: requires redis %s, but redis %s is installed", key, directive.Since, version)
+	}
+
+	args, err := SplitArgs(value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+
+	err = directive.validate(args)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	return nil
+}
+
+// Validate validates every directive of conf that is in Directives, see
+// ValidateDirective. Unknown directives are left to UnknownDirectives, since
+// the table may lag behind redis-server.
+func (conf Conf) Validate(version Version) error {
+	errs := []error{}
+	for _, param := range conf.directives() {
+		err := ValidateDirective(param.Key, param.Value, version)
+		if err != nil && !errors.Is(err, ErrUnknownDirective) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// UnknownDirectives returns the directives of conf that are not in
+// Directives, once each.
+func (conf Conf) UnknownDirectives() []string {
+	unknown := []string{}
+	seen := map[string]bool{}
+	for _, param := range conf.directives() {
+		key := strings.ToLower(param.Key)
+		if _, ok := Directives[key]; ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unknown = append(unknown, param.Key)
+	}
+	return unknown
+}
+
+func (directive Directive) validate(args []string) error {
+	switch directive.Type {
+	case TypeArgs:
+		if directive.Args > 0 && len(args) != directive.Args {
+			return fmt.Errorf("takes %d arguments, got %d", directive.Args, len(args))
+		}
+		if len(args) == 0 {
+			return errors.New("takes at least one argument")
+		}
+		return nil
+
+	case TypeSave:
+		if len(args) == 1 && args[0] == "" {
+			return nil
+		}
+		if len(args) == 0 || len(args)%2 != 0 {
+			return errors.New(`takes pairs of seconds and changes, or ""`)
+		}
+		for _, arg := range args {
+			if _, err := parseInt(arg, 0, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case TypeClientOutputBufferLimit:
+		if len(args) != 4 {
+			return fmt.Errorf("takes 4 arguments, got %d", len(args))
+		}
+		if !oneOf(args[0], "normal", "replica", "slave", "pubsub") {
+			return fmt.Errorf("invalid client class %q", args[0])
+		}
+		for _, arg := range args[1:3] {
+			if _, err := parseMemory(arg, 0, 0); err != nil {
+				return err
+			}
+		}
+		_, err := parseInt(args[3], 0, 0)
+		return err
+	}
+
+	if len(args) != 1 {
+		return fmt.Errorf("takes 1 argument, got %d", len(args))
+	}
+	arg := args[0]
+
+	switch directive.Type {
+	case TypeBool:
+		if !oneOf(arg, "yes", "no") {
+			return fmt.Errorf("%q is not yes or no", arg)
+		}
+	case TypeInt:
+		_, err := parseInt(arg, directive.Min, directive.Max)
+		return err
+	case TypeOctal:
+		value, err := strconv.ParseInt(arg, 8, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an octal integer", arg)
+		}
+		if value < directive.Min || value > directive.Max {
+			return fmt.Errorf("%s is not between %o and %o", arg, directive.Min, directive.Max)
+		}
+	case TypeMemory:
+		_, err := parseMemory(arg, directive.Min, directive.Max)
+		return err
+	case TypeEnum:
+		if !oneOf(arg, directive.Values...) {
+			return fmt.Errorf("%q is not one of %s", arg, strings.Join(directive.Values, ", "))
+		}
+	}
+	return nil
+}
+
+func parseInt(arg string, min, max int64) (int64, error) {
+	value, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an integer", arg)
+	}
+	return value, checkRange(arg, value, min, max)
+}
+
+func parseMemory(arg string, min, max int64) (int64, error) {
+	match := memoryPattern.FindStringSubmatch(arg)
+	if match == nil {
+		return 0, fmt.Errorf("%q is not a memory size", arg)
+	}
+
+	value, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a memory size", arg)
+	}
+
+	unit := strings.ToLower(match[2])
+	if unit != "" && unit != "b" {
+		value *= memoryUnits[unit]
+	}
+	return value, checkRange(arg, value, min, max)
+}
+
+var memoryUnits = map[string]int64{
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+func checkRange(arg string, value, min, max int64) error {
+	if value < min || max != 0 && value > max {
+		if max == 0 {
+			return fmt.Errorf("%s is less than %d", arg, min)
+		}
+		return fmt.Errorf("%s is not between %d and %d", arg, min, max)
+	}
+	return nil
+}
+
+func oneOf(arg string, values ...string) bool {
+	for _, value := range values {
+		if strings.EqualFold(arg, value) {
+			return true
+		}
+	}
+	return false
+}
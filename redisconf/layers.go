@@ -0,0 +1,151 @@
+package redisconf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// keyedByArgument directives may appear once for each value of their first
+// argument, such as once per renamed command. The value is whether that
+// argument is case insensitive.
+var keyedByArgument = map[string]bool{
+	"rename-command":             true,
+	"client-output-buffer-limit": true,
+	"user":                       false,
+	"loadmodule":                 false,
+	"include":                    false,
+}
+
+// Parse decodes directives given one per line, as operators list them in the
+// broker's config.
+func Parse(lines ...string) (Conf, error) {
+	return decode([]byte(strings.Join(lines, "\n")))
+}
+
+// Merge layers configs on top of each other, such as the operator's template,
+// plan overrides, instance overrides and the broker's instance additions.
+//
+// A directive set by a layer replaces every line of that directive in the
+// layers below it, where the first of those lines was; directives that are
+// new are appended in the order the layer sets them. Directives that may be
+// given once per first argument, such as rename-command, are replaced per
+// argument. The result therefore only depends on the layers and their order.
+// Comments stay with their directives, and the comments at the end of each
+// layer end up at the end of the result.
+func Merge(layers ...Conf) Conf {
+	merged := Conf{}
+	var footer []string
+
+	for _, layer := range layers {
+		replacements := map[string][]Param{}
+		order := []string{}
+		for _, param := range layer {
+			if !param.isDirective() {
+				footer = append(footer, param.Comments...)
+				continue
+			}
+
+			id := directiveID(param)
+			if _, ok := replacements[id]; !ok {
+				order = append(order, id)
+			}
+			replacements[id] = append(replacements[id], param)
+		}
+
+		for _, id := range order {
+			merged.replace(sameDirective(replacements[id][0]), replacements[id]...)
+		}
+	}
+
+	if len(footer) > 0 {
+		merged = append(merged, Param{Comments: footer})
+	}
+
+	return merged
+}
+
+// Diff returns the directives of conf that base does not set to the same
+// arguments, such as those set for a single instance on top of the template
+// its redis.conf was generated from. Directives are compared the way Merge
+// replaces them, so that merging the result on top of base gives conf's
+// values back.
+func Diff(conf, base Conf) Conf {
+	baseArgs := map[string][]string{}
+	for _, param := range base.directives() {
+		id := directiveID(param)
+		baseArgs[id] = append(baseArgs[id], normalizedArgs(param))
+	}
+
+	params := map[string][]Param{}
+	order := []string{}
+	for _, param := range conf.directives() {
+		id := directiveID(param)
+		if _, ok := params[id]; !ok {
+			order = append(order, id)
+		}
+		params[id] = append(params[id], Param{Key: param.Key, Value: param.Value})
+	}
+
+	diff := Conf{}
+	for _, id := range order {
+		args := []string{}
+		for _, param := range params[id] {
+			args = append(args, normalizedArgs(param))
+		}
+
+		if strings.Join(args, "\n") != strings.Join(baseArgs[id], "\n") {
+			diff = append(diff, params[id]...)
+		}
+	}
+
+	return diff
+}
+
+// normalizedArgs ignores how the arguments of a directive are quoted.
+func normalizedArgs(param Param) string {
+	args, err := param.Args()
+	if err != nil {
+		return param.Value
+	}
+
+	return strings.Join(args, "\x00")
+}
+
+// InstanceAdditions are the directives the broker sets for every instance.
+// They are merged last, so that no other layer can change them.
+func InstanceAdditions(instanceID, port, password, pidDir string) Conf {
+	return New(
+		Param{Key: "syslog-enabled", Value: "yes"},
+		Param{Key: "syslog-ident", Value: fmt.Sprintf("redis-server-%s", instanceID)},
+		Param{Key: "syslog-facility", Value: "local0"},
+		Param{Key: "port", Value: port},
+		Param{Key: "requirepass", Value: password},
+		Param{Key: "pidfile", Value: filepath.Join(pidDir, instanceID+".pid")},
+	)
+}
+
+func sameDirective(param Param) func(Param) bool {
+	id := directiveID(param)
+	return func(other Param) bool {
+		return directiveID(other) == id
+	}
+}
+
+func directiveID(param Param) string {
+	key := strings.ToLower(param.Key)
+	caseInsensitive, keyed := keyedByArgument[key]
+	if !keyed {
+		return key
+	}
+
+	argument := strings.SplitN(strings.TrimSpace(param.Value), " ", 2)[0]
+	if args, err := param.Args(); err == nil && len(args) > 0 {
+		argument = args[0]
+	}
+
+	if caseInsensitive {
+		argument = strings.ToLower(argument)
+	}
+	return key + " " + argument
+}
@@ -0,0 +1,160 @@
+package redisconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tunable directives only change how an instance treats its own data and
+// clients. They are the only directives tenants can set, and the only ones
+// whose values changed on a running server are kept. Everything else is
+// managed by the broker, limits the resources of the plan, or reaches files,
+// modules or other instances on the VM.
+var Tunable = map[string]bool{
+	"timeout":                           true,
+	"tcp-keepalive":                     true,
+	"loglevel":                          true,
+	"save":                              true,
+	"stop-writes-on-bgsave-error":       true,
+	"rdbcompression":                    true,
+	"rdbchecksum":                       true,
+	"acllog-max-len":                    true,
+	"acl-pubsub-default":                true,
+	"maxmemory-samples":                 true,
+	"maxmemory-eviction-tenacity":       true,
+	"active-expire-effort":              true,
+	"lazyfree-lazy-eviction":            true,
+	"lazyfree-lazy-expire":              true,
+	"lazyfree-lazy-server-del":          true,
+	"lazyfree-lazy-user-del":            true,
+	"lazyfree-lazy-user-flush":          true,
+	"tracking-table-max-keys":           true,
+	"appendonly":                        true,
+	"appendfsync":                       true,
+	"no-appendfsync-on-rewrite":         true,
+	"auto-aof-rewrite-percentage":       true,
+	"auto-aof-rewrite-min-size":         true,
+	"aof-load-truncated":                true,
+	"aof-use-rdb-preamble":              true,
+	"aof-timestamp-enabled":             true,
+	"lua-time-limit":                    true,
+	"busy-reply-threshold":              true,
+	"slowlog-log-slower-than":           true,
+	"slowlog-max-len":                   true,
+	"latency-monitor-threshold":         true,
+	"latency-tracking":                  true,
+	"latency-tracking-info-percentiles": true,
+	"notify-keyspace-events":            true,
+	"hash-max-ziplist-entries":          true,
+	"hash-max-ziplist-value":            true,
+	"hash-max-listpack-entries":         true,
+	"hash-max-listpack-value":           true,
+	"list-max-ziplist-size":             true,
+	"list-max-listpack-size":            true,
+	"list-max-ziplist-entries":          true,
+	"list-max-ziplist-value":            true,
+	"list-compress-depth":               true,
+	"set-max-intset-entries":            true,
+	"set-max-listpack-entries":          true,
+	"set-max-listpack-value":            true,
+	"zset-max-ziplist-entries":          true,
+	"zset-max-ziplist-value":            true,
+	"zset-max-listpack-entries":         true,
+	"zset-max-listpack-value":           true,
+	"hll-sparse-max-bytes":              true,
+	"stream-node-max-bytes":             true,
+	"stream-node-max-entries":           true,
+	"activerehashing":                   true,
+	"lfu-log-factor":                    true,
+	"lfu-decay-time":                    true,
+	"activedefrag":                      true,
+	"active-defrag-ignore-bytes":        true,
+	"active-defrag-threshold-lower":     true,
+	"active-defrag-threshold-upper":     true,
+}
+
+func IsTunable(key string) bool {
+	return Tunable[strings.ToLower(key)]
+}
+
+// ParseParameters decodes the redis.conf directives a tenant passes as the
+// parameters of an instance: a JSON object of directive names and their
+// arguments, such as {"maxmemory-policy": "volatile-lru"}. Numbers and
+// booleans are accepted for directives that take them. The directives are
+// sorted by name. No parameters decode to an empty Conf.
+func ParseParameters(raw json.RawMessage) (Conf, error) {
+	conf := Conf{}
+	if len(bytes.TrimSpace(raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return conf, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	parameters := map[string]interface{}{}
+	err := decoder.Decode(&parameters)
+	if err != nil {
+		return nil, fmt.Errorf("parameters must be a JSON object of redis.conf directives: %s", err)
+	}
+
+	keys := []string{}
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := parameterValue(parameters[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+
+		conf = append(conf, Param{Key: key, Value: value})
+	}
+
+	return conf, nil
+}
+
+// ValidateParameters returns an error for every directive of conf that a
+// tenant may not set, see Tunable, or that redis-server of the given version
+// would refuse.
+func (conf Conf) ValidateParameters(version Version) error {
+	errs := []error{}
+	for _, param := range conf.directives() {
+		if strings.ContainsAny(param.Key, " \t\r\n") || strings.ContainsAny(param.Value, "\r\n") {
+			errs = append(errs, fmt.Errorf("%q: invalid directive", param.Key))
+			continue
+		}
+
+		if !IsTunable(param.Key) {
+			errs = append(errs, fmt.Errorf("%s: cannot be set for an instance", param.Key))
+			continue
+		}
+
+		err := ValidateDirective(param.Key, param.Value, version)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parameterValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		if value {
+			return "yes", nil
+		}
+		return "no", nil
+	default:
+		return "", errors.New("value must be a string, a number or a boolean")
+	}
+}
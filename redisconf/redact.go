@@ -0,0 +1,67 @@
+package redisconf
+
+import (
+	"regexp"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+// secretDirectives match the values of the directives that hold passwords,
+// which redis-server echoes when it fails to load its config file. Empty
+// passwords are left alone.
+var secretDirectives = regexp.MustCompile(`(?i)\b(requirepass|masterauth)([ \t]+)("[^"]+"|'[^']+'|[^\s"']\S*)`)
+
+// renamedCommands match the new names of renamed commands, which are as
+// good as passwords for commands such as CONFIG. Disabled commands are left
+// alone.
+var renamedCommands = regexp.MustCompile(`(?i)\b(rename-command[ \t]+\S+[ \t]+)("[^"]+"|'[^']+'|[^\s"']\S*)`)
+
+// aclUsers match the rules of ACL users, as given by the user directive, in
+// aclfiles, by ACL LIST and to ACL SETUSER.
+var aclUsers = regexp.MustCompile(`(?i)\b(?:set)?user[ \t]+[^\r\n]*`)
+
+// aclPasswords match the rules of an ACL user that hold a password or the
+// SHA-256 hash of one: >password, <password, #hash and !hash.
+var aclPasswords = regexp.MustCompile(`(^|[ \t])("[<>#!][^"]*"|'[<>#!][^']*'|[<>#!]\S*)`)
+
+// Redact replaces the given secrets, as well as the values of password
+// directives, the passwords of ACL users and the names of renamed commands,
+// in text with [REDACTED].
+func Redact(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, Redacted)
+		}
+	}
+
+	text = secretDirectives.ReplaceAllString(text, "${1}${2}"+Redacted)
+	text = aclUsers.ReplaceAllStringFunc(text, redactACLPasswords)
+	return renamedCommands.ReplaceAllString(text, "${1}"+Redacted)
+}
+
+// NewRedactor returns a function that redacts text the way Redact does, and
+// also replaces the given secrets and the names conf renames commands to.
+// Redis echoes both in its log, such as for failed AUTH attempts and unknown
+// commands.
+func NewRedactor(conf Conf, secrets ...string) func(string) string {
+	for _, alias := range conf.CommandAliases() {
+		secrets = append(secrets, alias)
+	}
+
+	return func(text string) string {
+		return Redact(text, secrets...)
+	}
+}
+
+// redactACLPasswords keeps whether a rule adds or removes a password, and
+// whether it is given as a hash.
+func redactACLPasswords(rules string) string {
+	return aclPasswords.ReplaceAllStringFunc(rules, func(rule string) string {
+		separator := strings.TrimLeft(rule, " \t")
+		separator = rule[:len(rule)-len(separator)]
+
+		kind := strings.TrimLeft(strings.TrimSpace(rule), `"'`)[:1]
+		return separator + kind + Redacted
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -17,9 +18,29 @@ import (
 	"github.com/cloudfoundry/gosigar"
 )
 
+// Param is a directive of a redis.conf. Value holds the directive's arguments
+// as they are written in the file, quotes included; Args parses them.
+//
+// Comments holds the comment and blank lines that precede the directive, so
+// that they are written back where they were. A Param without a Key only
+// holds the comments at the end of a file.
 type Param struct {
-	Key   string
-	Value string
+	Key      string
+	Value    string
+	Comments []string
+
+	// line is the directive as it was read, when that differs from how
+	// Encode would write it, such as when it is indented.
+	line string
+}
+
+// Args parses the directive's arguments the way redis-server does.
+func (param Param) Args() ([]string, error) {
+	return SplitArgs(param.Value)
+}
+
+func (param Param) isDirective() bool {
+	return param.Key != ""
 }
 
 const (
@@ -28,12 +49,16 @@ const (
 	DefaultTLSPort = 16379
 )
 
+const maxIncludeDepth = 16
+
 type Conf []Param
 
 func New(params ...Param) Conf {
 	return Conf(params)
 }
 
+// Load reads the directives of a redis.conf as they are written. Included
+// files are not read, so that saving the result leaves them in place.
 func Load(path string) (Conf, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -43,11 +68,70 @@ func Load(path string) (Conf, error) {
 	return decode(data)
 }
 
+// LoadWithIncludes reads a redis.conf and replaces every include directive
+// with the directives of the files it includes, which is how redis-server
+// reads them. Relative include paths are resolved from the directory of the
+// including file, and patterns are expanded in lexical order.
+func LoadWithIncludes(path string) (Conf, error) {
+	return loadWithIncludes(path, 0)
+}
+
+func loadWithIncludes(path string, depth int) (Conf, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: includes are nested more than %d levels deep", path, maxIncludeDepth)
+	}
+
+	conf, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := Conf{}
+	for _, param := range conf {
+		if !strings.EqualFold(param.Key, "include") {
+			resolved = append(resolved, param)
+			continue
+		}
+
+		args, err := param.Args()
+		if err != nil || len(args) != 1 {
+			return nil, fmt.Errorf("%s: invalid include directive: include %s", path, param.Value)
+		}
+
+		pattern := args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+
+		includedPaths := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			includedPaths, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(includedPaths)
+		}
+
+		for _, includedPath := range includedPaths {
+			included, err := loadWithIncludes(includedPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, included.directives()...)
+		}
+	}
+
+	return resolved, nil
+}
+
 func (conf Conf) Save(path string) error {
 	data := conf.Encode()
 	return ioutil.WriteFile(path, data, 0644)
 }
 
+// decode keeps comments and blank lines with the directive that follows them
+// and reads directives the way redis-server does: leading whitespace is
+// ignored and directive names may be given in any case.
 func decode(data []byte) (Conf, error) {
 	conf := []Param{}
 
@@ -55,32 +139,42 @@ func decode(data []byte) (Conf, error) {
 
 	scanner.Split(bufio.ScanLines)
 
+	var comments []string
+	lineNumber := 0
 	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) == 0 {
-			continue
-		}
+		line := strings.TrimRight(scanner.Text(), "\r")
+		lineNumber++
 
-		switch line[:1] {
-		case "#":
-			continue
-		case " ":
-			continue
-		case "\t":
-			continue
-		case "\n":
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			comments = append(comments, line)
 			continue
 		}
 
-		param, err := parseParam(line)
+		param, err := parseParam(trimmed)
 		if err != nil {
 			return nil, err
 		}
 
+		_, err = param.Args()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %s", lineNumber, err, line)
+		}
+
+		if line != param.render() {
+			param.line = line
+		}
+
+		param.Comments = comments
+		comments = nil
 		conf = append(conf, param)
 	}
 
-	return conf, nil
+	if len(comments) > 0 {
+		conf = append(conf, Param{Comments: comments})
+	}
+
+	return conf, scanner.Err()
 }
 
 func (conf Conf) Host() string {
@@ -112,87 +206,240 @@ func (conf Conf) Tls() bool {
 }
 
 func (conf Conf) Password() string {
-	return conf.Get("requirepass")
+	args := conf.Args("requirepass")
+	if len(args) < 1 {
+		return ""
+	}
+	return args[0]
 }
 
+// Get returns the value of key. When a key is set more than once, the last
+// value is returned, since that is the one redis-server uses.
 func (conf Conf) Get(key string) string {
 	params := conf.getAll(key)
 	if len(params) < 1 {
 		return ""
 	}
-	return params[0].Value
+	return params[len(params)-1].Value
+}
+
+// Args returns the parsed arguments of the value Get returns.
+func (conf Conf) Args(key string) []string {
+	params := conf.getAll(key)
+	if len(params) < 1 {
+		return nil
+	}
+
+	args, err := params[len(params)-1].Args()
+	if err != nil {
+		return nil
+	}
+	return args
 }
 
 func (conf Conf) HasKey(key string) bool {
-	for _, param := range conf {
-		if key == param.Key {
-			return true
-		}
+	return len(conf.getAll(key)) > 0
+}
+
+// GetAll returns the values of every occurrence of key, such as the
+// snapshot rules of the save directive.
+func (conf Conf) GetAll(key string) []string {
+	values := []string{}
+	for _, param := range conf.getAll(key) {
+		values = append(values, param.Value)
 	}
-	return false
+	return values
 }
 
 func (conf Conf) getAll(key string) []Param {
 	params := []Param{}
 	for _, param := range conf {
-		if key == param.Key {
+		if param.isDirective() && strings.EqualFold(key, param.Key) {
 			params = append(params, param)
 		}
 	}
 	return params
 }
 
+// directives returns the params that are directives, without the comments at
+// the end of the file.
+func (conf Conf) directives() Conf {
+	directives := Conf{}
+	for _, param := range conf {
+		if param.isDirective() {
+			directives = append(directives, param)
+		}
+	}
+	return directives
+}
+
 func (conf *Conf) CommandAliases() map[string]string {
 	renamedCommands := conf.getAll("rename-command")
 	commandAliases := make(map[string]string)
 	for _, param := range renamedCommands {
-		args := strings.Split(param.Value, " ")
-		original := args[0]
-		alias := strings.Replace(args[1], "\"", "", -1)
-		commandAliases[original] = alias
+		args, err := param.Args()
+		if err != nil || len(args) != 2 {
+			continue
+		}
+		commandAliases[args[0]] = args[1]
 	}
 	return commandAliases
 }
 
+// Set sets a directive to value. Every line of the directive is replaced
+// where its first line was, so that setting save replaces all snapshot rules.
+// Directives that are set once per first argument, such as rename-command or
+// loadmodule, only replace the line with the same first argument.
 func (conf *Conf) Set(key string, value string) {
-	newParam := Param{
-		Key:   key,
-		Value: value,
-	}
+	newParam := Param{Key: key, Value: value}
+	conf.replace(sameDirective(newParam), newParam)
+}
 
-	// update
-	for index, param := range *conf {
-		if key == param.Key {
-			(*conf)[index] = newParam
+// Add adds another line for a directive that may be given more than once,
+// such as a snapshot rule, after the directive's last line.
+func (conf *Conf) Add(key string, value string) {
+	newParam := Param{Key: key, Value: value}
+
+	for index := len(*conf) - 1; index >= 0; index-- {
+		if (*conf)[index].isDirective() && strings.EqualFold((*conf)[index].Key, key) {
+			*conf = append((*conf)[:index+1], append(Conf{newParam}, (*conf)[index+1:]...)...)
 			return
 		}
 	}
 
-	// insert
-	*conf = append(*conf, newParam)
+	conf.insert(newParam)
+}
+
+// Replace replaces every occurrence of key with one line per value, where the
+// first occurrence was, or at the end when there was none.
+func (conf *Conf) Replace(key string, values ...string) {
+	params := []Param{}
+	for _, value := range values {
+		params = append(params, Param{Key: key, Value: value})
+	}
+
+	conf.replace(func(param Param) bool {
+		return strings.EqualFold(param.Key, key)
+	}, params...)
+}
+
+// replace replaces every directive that matches with params, keeping the
+// comments of the replaced lines with the first of the new ones.
+func (conf *Conf) replace(matches func(Param) bool, params ...Param) {
+	replaced := Conf{}
+	var comments []string
+	first := -1
+	for _, param := range *conf {
+		if !param.isDirective() || !matches(param) {
+			replaced = append(replaced, param)
+			continue
+		}
+
+		comments = append(comments, param.Comments...)
+		if first < 0 {
+			first = len(replaced)
+		}
+	}
+
+	if first < 0 {
+		*conf = replaced
+		conf.insert(params...)
+		return
+	}
+
+	if len(params) == 0 {
+		if len(comments) > 0 {
+			replaced = append(replaced[:first], append(Conf{{Comments: comments}}, replaced[first:]...)...)
+		}
+		*conf = replaced.joinComments()
+		return
+	}
+
+	params = append([]Param{}, params...)
+	params[0].Comments = append(comments, params[0].Comments...)
+	*conf = append(replaced[:first], append(Conf(params), replaced[first:]...)...)
+}
+
+// insert appends params before the comments at the end of the file.
+func (conf *Conf) insert(params ...Param) {
+	last := len(*conf) - 1
+	if last < 0 || (*conf)[last].isDirective() {
+		*conf = append(*conf, params...)
+		return
+	}
+
+	footer := (*conf)[last]
+	*conf = append(append((*conf)[:last], params...), footer)
+}
+
+// joinComments attaches the comments of params without a key to the
+// directive that follows them.
+func (conf Conf) joinComments() Conf {
+	joined := Conf{}
+	var comments []string
+	for _, param := range conf {
+		comments = append(comments, param.Comments...)
+		if !param.isDirective() {
+			continue
+		}
+
+		param.Comments = comments
+		comments = nil
+		joined = append(joined, param)
+	}
+
+	if len(comments) > 0 {
+		joined = append(joined, Param{Comments: comments})
+	}
+	return joined
 }
 
+// Encode writes the directives with their comments. Directives that are
+// unchanged since they were read are written as they were; others are written
+// with a single space between the name and the arguments.
 func (conf Conf) Encode() []byte {
 	output := []byte{}
 
 	for _, param := range conf {
-		line := param.Key + " " + param.Value + "\n"
-		output = append(output, []byte(line)...)
+		for _, comment := range param.Comments {
+			output = append(output, []byte(comment+"\n")...)
+		}
+
+		if param.isDirective() {
+			output = append(output, []byte(param.encode()+"\n")...)
+		}
 	}
 
 	return output
 }
 
+func (param Param) encode() string {
+	if param.line != "" {
+		read, err := parseParam(strings.TrimLeft(param.line, " \t"))
+		if err == nil && read.Key == param.Key && read.Value == param.Value {
+			return param.line
+		}
+	}
+
+	return param.render()
+}
+
+func (param Param) render() string {
+	return param.Key + " " + param.Value
+}
+
 func parseParam(line string) (Param, error) {
-	words := strings.SplitN(line, " ", 2)
-	if len(words) != 2 {
+	separator := strings.IndexAny(line, " \t")
+	if separator < 0 {
 		msg := fmt.Sprintf("Unable to split redis.conf parameter into key/value pair: %s", line)
 		return Param{}, errors.New(msg)
 	}
 
+	// the whitespace between the name and the arguments is kept in the
+	// param's line, not in its value
 	return Param{
-		Key:   words[0],
-		Value: words[1],
+		Key:   line[:separator],
+		Value: strings.TrimLeft(line[separator+1:], " \t"),
 	}, nil
 }
 
@@ -202,17 +449,14 @@ func CopyWithInstanceAdditions(fromPath, toPath, instanceID, port, password, pid
 		return err
 	}
 
-	defaultConfig.Set("syslog-enabled", "yes")
-	defaultConfig.Set("syslog-ident", fmt.Sprintf("redis-server-%s", instanceID))
-	defaultConfig.Set("syslog-facility", "local0")
-
-	defaultConfig.Set("port", port)
-	defaultConfig.Set("requirepass", password)
-
-	defaultConfig.Set("pidfile", filepath.Join(pidDir, instanceID+".pid"))
+	return WriteLayered(toPath, defaultConfig, InstanceAdditions(instanceID, port, password, pidDir))
+}
 
-	err = defaultConfig.Save(toPath)
-	os.Chmod(toPath, 0640)
+// WriteLayered merges the layers and saves the result to path, readable only
+// by its owner and group.
+func WriteLayered(path string, layers ...Conf) error {
+	err := Merge(layers...).Save(path)
+	os.Chmod(path, 0640)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package redisconf_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -21,14 +22,17 @@ var _ = Describe("redisconf", func() {
 			input, err := redisconf.Load(path)
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedOutput := "daemonize no\n" +
+			expectedOutput := "# A comment\n" +
+				"daemonize no\n" +
 				"pidfile /var/run/redis.pid\n" +
 				"port 6379\n" +
+				"# Another comment\n" +
 				"appendonly yes\n" +
 				"client-output-buffer-limit normal 0 0 0\n" +
 				"save 900 1\n" +
 				"save 300 10\n" +
-				"bind 0.0.0.0\n"
+				"bind 0.0.0.0\n" +
+				"# A final comment\n"
 
 			Expect(string(input.Encode())).To(Equal(expectedOutput))
 		})
@@ -39,14 +43,18 @@ var _ = Describe("redisconf", func() {
 			input, err := redisconf.Load(path)
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedOutput := "daemonize no\n" +
+			expectedOutput := "# A comment\n" +
+				"daemonize no\n" +
 				"pidfile /var/run/redis.pid\n" +
 				"port 0\n" +
+				"# Another comment\n" +
 				"appendonly yes\n" +
 				"client-output-buffer-limit normal 0 0 0\n" +
 				"save 900 1\n" +
 				"save 300 10\n" +
 				"bind 0.0.0.0\n" +
+				"# A final comment\n" +
+				"\n" +
 				"tls-port 16379\n"
 
 			Expect(string(input.Encode())).To(Equal(expectedOutput))
@@ -79,6 +87,79 @@ var _ = Describe("redisconf", func() {
 		})
 	})
 
+	Describe("GetAll and Replace", func() {
+		var conf redisconf.Conf
+
+		BeforeEach(func() {
+			conf = redisconf.New(
+				redisconf.Param{Key: "port", Value: "6379"},
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "maxmemory", Value: "100mb"},
+				redisconf.Param{Key: "save", Value: "300 10"},
+			)
+		})
+
+		It("returns every value of a key", func() {
+			Expect(conf.GetAll("save")).To(Equal([]string{"900 1", "300 10"}))
+			Expect(conf.GetAll("missing")).To(BeEmpty())
+		})
+
+		It("replaces every occurrence of a key where the first one was", func() {
+			conf.Replace("save", "3600 1", "60 10000")
+
+			Expect(conf).To(Equal(redisconf.New(
+				redisconf.Param{Key: "port", Value: "6379"},
+				redisconf.Param{Key: "save", Value: "3600 1"},
+				redisconf.Param{Key: "save", Value: "60 10000"},
+				redisconf.Param{Key: "maxmemory", Value: "100mb"},
+			)))
+		})
+
+		It("appends keys that are not set", func() {
+			conf.Replace("maxmemory-policy", "allkeys-lru")
+			Expect(conf.Get("maxmemory-policy")).To(Equal("allkeys-lru"))
+			Expect(conf).To(HaveLen(5))
+		})
+	})
+
+	Describe("Redact", func() {
+		It("replaces the given secrets", func() {
+			Expect(redisconf.Redact("AUTH s3cret failed", "s3cret", "")).To(Equal("AUTH [REDACTED] failed"))
+		})
+
+		It("replaces the values of password directives", func() {
+			text := "requirepass \"s3cret\"\nmasterauth other-s3cret\nmasterauth \"\"\nport 6379"
+
+			Expect(redisconf.Redact(text)).To(Equal(
+				"requirepass [REDACTED]\nmasterauth [REDACTED]\nmasterauth \"\"\nport 6379",
+			))
+		})
+
+		It("replaces the names of renamed commands but not disabled ones", func() {
+			text := "rename-command CONFIG abc-def\nrename-command SAVE \"123-345\"\nrename-command BGSAVE \"\""
+
+			Expect(redisconf.Redact(text)).To(Equal(
+				"rename-command CONFIG [REDACTED]\nrename-command SAVE [REDACTED]\nrename-command BGSAVE \"\"",
+			))
+		})
+
+		It("replaces the passwords and password hashes of ACL users", func() {
+			text := "user alice on >s3cret \">two words\" <old-s3cret ~cache:* +get\n" +
+				"user default on #5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8 !0bad ~* &* +@all\n" +
+				"user worker on nopass ~jobs:* +@list"
+
+			Expect(redisconf.Redact(text)).To(Equal(
+				"user alice on >[REDACTED] >[REDACTED] <[REDACTED] ~cache:* +get\n" +
+					"user default on #[REDACTED] ![REDACTED] ~* &* +@all\n" +
+					"user worker on nopass ~jobs:* +@list",
+			))
+		})
+
+		It("replaces the passwords given to ACL SETUSER", func() {
+			Expect(redisconf.Redact("command=ACL SETUSER alice on >s3cret +get")).To(Equal("command=ACL SETUSER alice on >[REDACTED] +get"))
+		})
+	})
+
 	Describe("Save", func() {
 		conf := redisconf.New(
 			redisconf.Param{Key: "client-output-buffer-limit", Value: "normal 0 0 0"},
@@ -183,6 +264,461 @@ var _ = Describe("redisconf", func() {
 		})
 	})
 
+	Describe("round trips", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = tempDir("", "redisconf-test")
+			DeferCleanup(os.RemoveAll, dir)
+		})
+
+		writeFile := func(name, contents string) string {
+			path := filepath.Join(dir, name)
+			Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+			return path
+		}
+
+		It("writes back comments, blank lines and ordering unchanged", func() {
+			contents := "# Snapshotting\n" +
+				"\n" +
+				"save 900 1\n" +
+				"save 300 10\n" +
+				"  # indented comment\n" +
+				"rename-command CONFIG \"\"\n" +
+				"requirepass \"a pass\\\"word\"\n" +
+				"\n" +
+				"# the end\n"
+
+			conf, err := redisconf.Load(writeFile("redis.conf", contents))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(conf.Encode())).To(Equal(contents))
+		})
+
+		It("writes back the indentation and separators of unchanged directives", func() {
+			conf, err := redisconf.Load(writeFile("redis.conf", "  maxmemory 100mb\nport\t7000\nsave 900 1\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(conf.Encode())).To(Equal("  maxmemory 100mb\nport\t7000\nsave 900 1\n"))
+
+			conf.Set("port", "7001")
+			conf[0].Value = "200mb"
+			Expect(string(conf.Encode())).To(Equal("maxmemory 200mb\nport 7001\nsave 900 1\n"))
+		})
+
+		It("reads indented directives and directive names in any case", func() {
+			conf, err := redisconf.Load(writeFile("redis.conf", "  MaxMemory 100mb\n\tport\t7000\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Get("maxmemory")).To(Equal("100mb"))
+			Expect(conf.Get("port")).To(Equal("7000"))
+			Expect(conf.HasKey("MAXMEMORY")).To(BeTrue())
+		})
+
+		It("does not include the whitespace after the directive name in its value", func() {
+			conf, err := redisconf.Load(writeFile("redis.conf", "port  7000\nbind \t 10.0.0.1\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Get("port")).To(Equal("7000"))
+			Expect(conf.Port()).To(Equal(7000))
+			Expect(conf.Host()).To(Equal("10.0.0.1"))
+			Expect(string(conf.Encode())).To(Equal("port  7000\nbind \t 10.0.0.1\n"))
+		})
+
+		It("returns an error for unbalanced quotes", func() {
+			_, err := redisconf.Load(writeFile("redis.conf", "port 7000\nrequirepass \"secret\n"))
+			Expect(err).To(MatchError(ContainSubstring("line 2: unbalanced quotes")))
+		})
+
+		It("uses the last value of a directive that is set twice, as redis-server does", func() {
+			conf := redisconf.New(
+				redisconf.Param{Key: "maxmemory", Value: "100mb"},
+				redisconf.Param{Key: "maxmemory", Value: "200mb"},
+			)
+			Expect(conf.Get("maxmemory")).To(Equal("200mb"))
+		})
+
+		It("unquotes the password", func() {
+			conf := redisconf.New(redisconf.Param{Key: "requirepass", Value: `"a pass\"word"`})
+			Expect(conf.Password()).To(Equal(`a pass"word`))
+		})
+
+		Describe("Set", func() {
+			var conf redisconf.Conf
+
+			BeforeEach(func() {
+				var err error
+				conf, err = redisconf.Parse(
+					"# snapshots",
+					"save 900 1",
+					"save 300 10",
+					"rename-command CONFIG config-alias",
+					"rename-command KEYS keys-alias",
+					"# the end",
+				)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("replaces every line of a list directive and keeps its comments", func() {
+				conf.Set("save", "3600 1")
+
+				Expect(string(conf.Encode())).To(Equal("# snapshots\n" +
+					"save 3600 1\n" +
+					"rename-command CONFIG config-alias\n" +
+					"rename-command KEYS keys-alias\n" +
+					"# the end\n"))
+			})
+
+			It("replaces renamed commands one command at a time", func() {
+				conf.Set("rename-command", `keys ""`)
+
+				Expect(conf.CommandAliases()).To(Equal(map[string]string{
+					"CONFIG": "config-alias",
+					"keys":   "",
+				}))
+			})
+
+			It("adds new directives before the comments at the end", func() {
+				conf.Set("appendonly", "yes")
+				conf.Add("save", "60 10000")
+
+				Expect(string(conf.Encode())).To(Equal("# snapshots\n" +
+					"save 900 1\n" +
+					"save 300 10\n" +
+					"save 60 10000\n" +
+					"rename-command CONFIG config-alias\n" +
+					"rename-command KEYS keys-alias\n" +
+					"appendonly yes\n" +
+					"# the end\n"))
+			})
+		})
+
+		Describe("LoadWithIncludes", func() {
+			It("reads included files where they are included", func() {
+				Expect(os.Mkdir(filepath.Join(dir, "conf.d"), 0755)).To(Succeed())
+				writeFile("conf.d/b.conf", "maxmemory 200mb\n")
+				writeFile("conf.d/a.conf", "rename-command CONFIG config-alias\n")
+				writeFile("local.conf", "# local settings\nmaxmemory 300mb\n")
+				path := writeFile("redis.conf", "maxmemory 100mb\ninclude conf.d/*.conf\ninclude \""+filepath.Join(dir, "local.conf")+"\"\n")
+
+				conf, err := redisconf.LoadWithIncludes(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.GetAll("maxmemory")).To(Equal([]string{"100mb", "200mb", "300mb"}))
+				Expect(conf.Get("maxmemory")).To(Equal("300mb"))
+				Expect(conf.CommandAliases()).To(HaveKeyWithValue("CONFIG", "config-alias"))
+				Expect(conf.HasKey("include")).To(BeFalse())
+
+				literal, err := redisconf.Load(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(literal.GetAll("include")).To(HaveLen(2))
+			})
+
+			It("returns an error when an included file is missing", func() {
+				path := writeFile("redis.conf", "include missing.conf\n")
+
+				_, err := redisconf.LoadWithIncludes(path)
+				Expect(err).To(MatchError(ContainSubstring("missing.conf")))
+			})
+
+			It("returns an error when files include each other", func() {
+				path := writeFile("redis.conf", "include redis.conf\n")
+
+				_, err := redisconf.LoadWithIncludes(path)
+				Expect(err).To(MatchError(ContainSubstring("nested more than")))
+			})
+		})
+	})
+
+	Describe("SplitArgs", func() {
+		It("splits arguments the way redis-server does", func() {
+			args, err := redisconf.SplitArgs(`  plain "double \"quoted\"\n\x41" 'single \'quoted\'' ""  mid"dle" `)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(args).To(Equal([]string{"plain", "double \"quoted\"\nA", "single 'quoted'", "", "middle"}))
+		})
+
+		It("returns an error for unbalanced quotes", func() {
+			_, err := redisconf.SplitArgs(`"open`)
+			Expect(err).To(HaveOccurred())
+
+			_, err = redisconf.SplitArgs(`"closed"but-continued`)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("reads back what Quote writes", func() {
+			for _, arg := range []string{"plain", "", "with space", `with "quotes" and \`, "tab\tand\x01"} {
+				args, err := redisconf.SplitArgs(redisconf.Quote(arg))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(args).To(Equal([]string{arg}))
+			}
+			Expect(redisconf.Quote("plain")).To(Equal("plain"))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts the directives redis-server accepts", func() {
+			conf, err := redisconf.Parse(
+				"daemonize YES",
+				"port 6379",
+				"maxmemory 2gb",
+				"maxmemory-policy allkeys-lru",
+				`save ""`,
+				"save 900 1 300 10",
+				"client-output-buffer-limit pubsub 32mb 8mb 60",
+				`rename-command CONFIG ""`,
+				`notify-keyspace-events ""`,
+				"slowlog-log-slower-than -1",
+				"unixsocketperm 700",
+				"hz 1000",
+				"slave-lazy-flush yes",
+				"cluster-require-full-coverage no",
+				"lua-replicate-commands yes",
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Validate(redisconf.Version{Major: 7, Minor: 2})).To(Succeed())
+		})
+
+		DescribeTable("rejects values redis-server refuses",
+			func(key, value, message string) {
+				err := redisconf.ValidateDirective(key, value, redisconf.Version{})
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("booleans", "appendonly", "true", `"true" is not yes or no`),
+			Entry("integers", "databases", "many", `"many" is not an integer`),
+			Entry("ranges", "maxmemory-samples", "65", "65 is not between 1 and 64"),
+			Entry("lower bounds", "maxclients", "0", "0 is less than 1"),
+			Entry("memory sizes", "maxmemory", "2 gigabytes", "takes 1 argument, got 2"),
+			Entry("memory units", "maxmemory", "2tb", `"2tb" is not a memory size`),
+			Entry("enums", "appendfsync", "sometimes", `"sometimes" is not one of always, everysec, no`),
+			Entry("snapshot rules", "save", "900", `takes pairs of seconds and changes, or ""`),
+			Entry("client classes", "client-output-buffer-limit", "admin 0 0 0", `invalid client class "admin"`),
+			Entry("argument counts", "rename-command", "CONFIG", "takes 2 arguments, got 1"),
+			Entry("quoting", "requirepass", `"secret`, "unbalanced quotes"),
+			Entry("octal integers", "unixsocketperm", "778", `"778" is not an octal integer`),
+			Entry("octal ranges", "unixsocketperm", "1777", "1777 is not between 0 and 777"),
+		)
+
+		It("rejects unknown directives", func() {
+			err := redisconf.ValidateDirective("maxmemroy", "100mb", redisconf.Version{})
+			Expect(errors.Is(err, redisconf.ErrUnknownDirective)).To(BeTrue())
+			Expect(err).To(MatchError("maxmemroy: unknown directive"))
+		})
+
+		It("rejects directives that the installed version does not support", func() {
+			err := redisconf.ValidateDirective("latency-tracking", "yes", redisconf.Version{Major: 6, Minor: 2, Patch: 14})
+			Expect(err).To(MatchError("latency-tracking: requires redis 7.0.0, but redis 6.2.14 is installed"))
+
+			Expect(redisconf.ValidateDirective("latency-tracking", "yes", redisconf.Version{Major: 7})).To(Succeed())
+			Expect(redisconf.ValidateDirective("latency-tracking", "yes", redisconf.Version{})).To(Succeed())
+		})
+
+		It("reports every invalid directive", func() {
+			conf, err := redisconf.Parse("appendonly maybe", "port 7000", "hz 0")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = conf.Validate(redisconf.Version{})
+			Expect(err).To(MatchError(ContainSubstring(`appendonly: "maybe" is not yes or no`)))
+			Expect(err).To(MatchError(ContainSubstring("hz: 0 is less than 1")))
+		})
+
+		It("leaves unknown directives to UnknownDirectives", func() {
+			conf, err := redisconf.Parse("maxmemroy 100mb", "port 7000", "MAXMEMROY 200mb", "new-directive yes")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(conf.Validate(redisconf.Version{})).To(Succeed())
+			Expect(conf.UnknownDirectives()).To(Equal([]string{"maxmemroy", "new-directive"}))
+		})
+
+		It("parses versions", func() {
+			Expect(redisconf.ParseVersion("7.2.4")).To(Equal(redisconf.Version{Major: 7, Minor: 2, Patch: 4}))
+			Expect(redisconf.ParseVersion("6.0")).To(Equal(redisconf.Version{Major: 6}))
+
+			_, err := redisconf.ParseVersion("seven")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Merge", func() {
+		It("replaces the directives a layer sets where they were first set", func() {
+			merged := redisconf.Merge(
+				redisconf.New(
+					redisconf.Param{Key: "daemonize", Value: "yes"},
+					redisconf.Param{Key: "save", Value: "900 1"},
+					redisconf.Param{Key: "appendonly", Value: "no"},
+					redisconf.Param{Key: "save", Value: "300 10"},
+				),
+				redisconf.New(
+					redisconf.Param{Key: "timeout", Value: "300"},
+					redisconf.Param{Key: "save", Value: "3600 1"},
+					redisconf.Param{Key: "maxclients", Value: "100"},
+				),
+			)
+
+			Expect(merged).To(Equal(redisconf.New(
+				redisconf.Param{Key: "daemonize", Value: "yes"},
+				redisconf.Param{Key: "save", Value: "3600 1"},
+				redisconf.Param{Key: "appendonly", Value: "no"},
+				redisconf.Param{Key: "timeout", Value: "300"},
+				redisconf.Param{Key: "maxclients", Value: "100"},
+			)))
+		})
+
+		It("lets later layers win", func() {
+			merged := redisconf.Merge(
+				redisconf.New(redisconf.Param{Key: "maxmemory-policy", Value: "noeviction"}),
+				redisconf.New(redisconf.Param{Key: "maxmemory-policy", Value: "allkeys-lru"}),
+				redisconf.New(redisconf.Param{Key: "maxmemory-policy", Value: "volatile-lru"}),
+			)
+
+			Expect(merged.GetAll("maxmemory-policy")).To(Equal([]string{"volatile-lru"}))
+		})
+
+		It("replaces renamed commands one command at a time", func() {
+			merged := redisconf.Merge(
+				redisconf.New(
+					redisconf.Param{Key: "rename-command", Value: "CONFIG config-alias"},
+					redisconf.Param{Key: "rename-command", Value: "KEYS keys-alias"},
+				),
+				redisconf.New(
+					redisconf.Param{Key: "rename-command", Value: `keys ""`},
+					redisconf.Param{Key: "rename-command", Value: "FLUSHALL flushall-alias"},
+				),
+			)
+
+			Expect(merged.GetAll("rename-command")).To(Equal([]string{
+				"CONFIG config-alias",
+				`keys ""`,
+				"FLUSHALL flushall-alias",
+			}))
+		})
+	})
+
+	Describe("Parse", func() {
+		It("parses one directive per line", func() {
+			conf, err := redisconf.Parse("maxmemory-policy allkeys-lru", "# a comment", `rename-command KEYS ""`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf).To(Equal(redisconf.New(
+				redisconf.Param{Key: "maxmemory-policy", Value: "allkeys-lru"},
+				redisconf.Param{Key: "rename-command", Value: `KEYS ""`, Comments: []string{"# a comment"}},
+			)))
+		})
+
+		It("returns an error for directives without a value", func() {
+			_, err := redisconf.Parse("appendonly")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Diff", func() {
+		It("returns the directives that differ from the base", func() {
+			base := redisconf.New(
+				redisconf.Param{Key: "daemonize", Value: "yes"},
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "rename-command", Value: "CONFIG config-alias"},
+				redisconf.Param{Key: "timeout", Value: "0"},
+			)
+			conf := redisconf.New(
+				redisconf.Param{Key: "daemonize", Value: `"yes"`},
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "save", Value: "60 10000"},
+				redisconf.Param{Key: "rename-command", Value: "CONFIG config-alias"},
+				redisconf.Param{Key: "rename-command", Value: "KEYS keys-alias"},
+				redisconf.Param{Key: "timeout", Value: "300", Comments: []string{"# set by hand"}},
+			)
+
+			Expect(redisconf.Diff(conf, base)).To(Equal(redisconf.New(
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "save", Value: "60 10000"},
+				redisconf.Param{Key: "rename-command", Value: "KEYS keys-alias"},
+				redisconf.Param{Key: "timeout", Value: "300"},
+			)))
+		})
+
+		It("gives conf's values back when merged on top of the base", func() {
+			base, err := redisconf.Parse("save 900 1", "appendonly no", "timeout 0")
+			Expect(err).NotTo(HaveOccurred())
+			conf, err := redisconf.Parse("save 3600 1", "appendonly no", "timeout 0", "maxclients 100")
+			Expect(err).NotTo(HaveOccurred())
+
+			merged := redisconf.Merge(base, redisconf.Diff(conf, base))
+
+			Expect(merged.GetAll("save")).To(Equal([]string{"3600 1"}))
+			Expect(merged.Get("maxclients")).To(Equal("100"))
+		})
+	})
+
+	Describe("ParseParameters", func() {
+		It("decodes a JSON object of directives sorted by name", func() {
+			conf, err := redisconf.ParseParameters([]byte(`{"timeout": 300, "maxmemory-policy": "volatile-lru", "appendonly": true}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf).To(Equal(redisconf.New(
+				redisconf.Param{Key: "appendonly", Value: "yes"},
+				redisconf.Param{Key: "maxmemory-policy", Value: "volatile-lru"},
+				redisconf.Param{Key: "timeout", Value: "300"},
+			)))
+		})
+
+		It("decodes no parameters to an empty config", func() {
+			for _, raw := range []string{"", "null", "{}"} {
+				conf, err := redisconf.ParseParameters([]byte(raw))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf).To(BeEmpty())
+			}
+		})
+
+		It("returns an error for parameters that are not directives", func() {
+			_, err := redisconf.ParseParameters([]byte(`["timeout"]`))
+			Expect(err).To(MatchError(ContainSubstring("parameters must be a JSON object of redis.conf directives")))
+
+			_, err = redisconf.ParseParameters([]byte(`{"save": ["900 1"]}`))
+			Expect(err).To(MatchError("save: value must be a string, a number or a boolean"))
+		})
+	})
+
+	Describe("ValidateParameters", func() {
+		It("accepts directives tenants may set", func() {
+			conf, err := redisconf.Parse("timeout 300", "notify-keyspace-events Ex")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.ValidateParameters(redisconf.Version{})).To(Succeed())
+		})
+
+		It("rejects directives that are not tunable, and invalid ones", func() {
+			conf := redisconf.New(
+				redisconf.Param{Key: "maxmemory", Value: "10gb"},
+				redisconf.Param{Key: "Dir", Value: "/etc"},
+				redisconf.Param{Key: "future-directive", Value: "on"},
+				redisconf.Param{Key: "appendonly", Value: "sometimes"},
+				redisconf.Param{Key: "timeout", Value: "300\ninclude /etc/shadow"},
+			)
+
+			err := conf.ValidateParameters(redisconf.Version{})
+			Expect(err).To(MatchError(ContainSubstring("maxmemory: cannot be set for an instance")))
+			Expect(err).To(MatchError(ContainSubstring("future-directive: cannot be set for an instance")))
+			Expect(err).To(MatchError(ContainSubstring("Dir: cannot be set for an instance")))
+			Expect(err).To(MatchError(ContainSubstring(`appendonly: "sometimes" is not yes or no`)))
+			Expect(err).To(MatchError(ContainSubstring(`"timeout": invalid directive`)))
+		})
+
+		It("only accepts directives that are tunable, whatever their case", func() {
+			conf := redisconf.New(redisconf.Param{Key: "Maxmemory-Samples", Value: "10"}, redisconf.Param{Key: "APPENDONLY", Value: "yes"})
+			Expect(conf.ValidateParameters(redisconf.Version{})).To(Succeed())
+
+			for _, param := range []redisconf.Param{
+				{Key: "enable-module-command", Value: "yes"},
+				{Key: "enable-debug-command", Value: "yes"},
+				{Key: "enable-protected-configs", Value: "yes"},
+				{Key: "cluster-enabled", Value: "yes"},
+				{Key: "cluster-config-file", Value: "/var/vcap/jobs/redis/config/redis.conf"},
+				{Key: "tls-key-file", Value: "/etc/shadow"},
+				{Key: "tls-ca-cert-dir", Value: "/etc"},
+				{Key: "maxclients", Value: "100000"},
+				{Key: "io-threads", Value: "128"},
+				{Key: "databases", Value: "100000"},
+				{Key: "oom-score-adj-values", Value: "-1000 -1000 -1000"},
+				{Key: "supervised", Value: "systemd"},
+				{Key: "MasterUser", Value: "default"},
+			} {
+				err := redisconf.New(param).ValidateParameters(redisconf.Version{})
+				Expect(err).To(MatchError(param.Key+": cannot be set for an instance"), param.Key)
+			}
+		})
+	})
+
 	Describe("CopyWithInstanceAdditions", func() {
 		var (
 			copyErr       error
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pivotal-cf/cf-redis-broker/paths"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 	"github.com/pivotal-cf/redisutils/monit"
 	"github.com/pivotal-cf/redisutils/redis"
@@ -25,6 +26,10 @@ type Resetter struct {
 	timeout         time.Duration
 	Monit           monit.Monit
 	redis           redis.Redis
+
+	// DataDir is where redis keeps its persistence files. It defaults to the
+	// dir of the live config, and to the working directory if that has none.
+	DataDir string
 }
 
 //New is the correct way to instantiate a Resetter
@@ -126,14 +131,44 @@ func (resetter *Resetter) startRedis() error {
 }
 
 func (resetter *Resetter) deleteData() error {
-	if err := os.Remove("appendonly.aof"); err != nil {
+	dir, err := resetter.dataDir()
+	if err != nil {
+		return err
+	}
+
+	dataDir := paths.NewResolver(dir)
+
+	aofPath, err := dataDir.Resolve("appendonly.aof")
+	if err != nil {
+		return err
+	}
+
+	rdbPath, err := dataDir.Resolve("dump.rdb")
+	if err != nil {
 		return err
 	}
 
-	os.Remove("dump.rdb")
+	if err := os.Remove(aofPath); err != nil {
+		return err
+	}
+
+	os.Remove(rdbPath)
 	return nil
 }
 
+func (resetter *Resetter) dataDir() (string, error) {
+	if resetter.DataDir != "" {
+		return resetter.DataDir, nil
+	}
+
+	liveConf, err := redisconf.Load(resetter.liveConfPath)
+	if err != nil {
+		return "", err
+	}
+
+	return liveConf.Get("dir"), nil
+}
+
 func (resetter *Resetter) resetConfigWithNewPassword() error {
 	conf, err := redisconf.Load(resetter.defaultConfPath)
 	if err != nil {
@@ -246,6 +246,31 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Context("when the live config sets the data directory", func() {
+			var dataDir string
+
+			BeforeEach(func() {
+				var err error
+				dataDir, err = os.MkdirTemp("", "resetter-data")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(os.RemoveAll, dataDir)
+
+				conf.Set("dir", dataDir)
+				Expect(conf.Save(confPath)).To(Succeed())
+
+				for _, name := range []string{"appendonly.aof", "dump.rdb"} {
+					Expect(os.WriteFile(filepath.Join(dataDir, name), nil, 0644)).To(Succeed())
+				}
+			})
+
+			It("deletes the persistence files in that directory", func() {
+				Expect(resetErr).NotTo(HaveOccurred())
+				Expect(filepath.Join(dataDir, "appendonly.aof")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(dataDir, "dump.rdb")).NotTo(BeAnExistingFile())
+				Expect(aofPath).To(BeAnExistingFile())
+			})
+		})
+
 		Context("when the AOF file cannot be removed", func() {
 			BeforeEach(func() {
 				err := os.Remove(aofPath)
@@ -0,0 +1,334 @@
+package slowlog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	redisclient "github.com/gomodule/redigo/redis"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const (
+	defaultInterval = time.Minute
+
+	// maxEntries is larger than any slowlog-max-len we configure, so that
+	// every entry is drained.
+	maxEntries = 1024
+)
+
+type InstanceLister interface {
+	AllInstances() ([]*redis.Instance, []error)
+	InstanceConfigPath(instanceID string) string
+}
+
+// SlowCommand is an entry of an instance's slowlog.
+type SlowCommand struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	Command  string
+	Args     int
+	Client   string
+	Name     string
+}
+
+// LatencyEvent is the latest spike of one of the latency events an instance
+// monitors.
+type LatencyEvent struct {
+	Event  string
+	Time   time.Time
+	Latest time.Duration
+	Max    time.Duration
+}
+
+// Drainer periodically moves the slowlog and latency spikes of every shared
+// instance into the process monitor's log, where they survive restarts of
+// redis-server and can be searched across instances to find noisy
+// neighbours. Every entry is logged as its own slow-command or latency-spike
+// event with the instance's ID.
+//
+// The slowlog is read and reset in a single transaction, so that no entry is
+// lost or logged twice. Latency spikes are only reported by redis-server when
+// latency-monitor-threshold is set; they are not reset, so that LATENCY
+// DOCTOR keeps working. Instead, each spike is logged once by every run of the
+// process monitor.
+//
+// Only the command name and the number of arguments of slow commands are
+// logged, since the arguments are the tenant's data.
+type Drainer struct {
+	Instances InstanceLister
+	Connect   redis.Connector
+	Logger    lager.Logger
+
+	// latestSpikes remembers the time of the last spike logged for each
+	// instance and event.
+	latestSpikes map[string]map[string]time.Time
+}
+
+func NewDrainer(instances InstanceLister, logger lager.Logger) *Drainer {
+	return &Drainer{
+		Instances:    instances,
+		Connect:      redis.Connect,
+		Logger:       logger,
+		latestSpikes: map[string]map[string]time.Time{},
+	}
+}
+
+// Interval returns how often the instances should be drained.
+func Interval(config brokerconfig.ServiceConfiguration) time.Duration {
+	if config.SlowlogIntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(config.SlowlogIntervalSeconds) * time.Second
+}
+
+// Run drains every instance every interval until stop is closed.
+func (drainer *Drainer) Run(interval time.Duration, stop <-chan struct{}) {
+	utils.Every(interval, stop, drainer.DrainAll)
+}
+
+// DrainAll drains every instance. Instances that cannot be reached, such as
+// suspended ones, are skipped.
+func (drainer *Drainer) DrainAll() {
+	instances, errs := drainer.Instances.AllInstances()
+	for _, err := range errs {
+		drainer.Logger.Error("list-instances", err)
+	}
+
+	existing := map[string]bool{}
+	for _, instance := range instances {
+		existing[instance.ID] = true
+		drainer.Drain(instance)
+	}
+
+	for instanceID := range drainer.latestSpikes {
+		if !existing[instanceID] {
+			delete(drainer.latestSpikes, instanceID)
+		}
+	}
+}
+
+// Drain logs and removes the slowlog entries of the instance and logs its
+// new latency spikes.
+func (drainer *Drainer) Drain(instance *redis.Instance) {
+	aliases := map[string]string{}
+	conf, err := redisconf.LoadWithIncludes(drainer.Instances.InstanceConfigPath(instance.ID))
+	if err == nil {
+		for name, alias := range conf.CommandAliases() {
+			aliases[strings.ToUpper(name)] = alias
+		}
+	}
+
+	redisClient, err := drainer.Connect(instance, aliases)
+	if err != nil {
+		drainer.Logger.Debug("instance-unreachable", lager.Data{
+			"instance_id": instance.ID,
+			"error":       err.Error(),
+		})
+		return
+	}
+	defer redisClient.Disconnect()
+
+	commands, err := drainSlowlog(redisClient, aliases)
+	if err != nil {
+		drainer.Logger.Error("drain-slowlog", err, lager.Data{"instance_id": instance.ID})
+	}
+
+	for _, slow := range commands {
+		drainer.Logger.Info("slow-command", lager.Data{
+			"instance_id": instance.ID,
+			"id":          slow.ID,
+			"time":        slow.Time.Format(time.RFC3339),
+			"duration_us": slow.Duration.Microseconds(),
+			"command":     slow.Command,
+			"args":        slow.Args,
+			"client":      slow.Client,
+			"client_name": slow.Name,
+		})
+	}
+
+	spikes, err := latestLatency(redisClient, aliases)
+	if err != nil {
+		drainer.Logger.Error("read-latency", err, lager.Data{"instance_id": instance.ID})
+	}
+
+	drainer.logNewSpikes(instance.ID, spikes)
+}
+
+func (drainer *Drainer) logNewSpikes(instanceID string, spikes []LatencyEvent) {
+	if drainer.latestSpikes[instanceID] == nil {
+		drainer.latestSpikes[instanceID] = map[string]time.Time{}
+	}
+	logged := drainer.latestSpikes[instanceID]
+
+	for _, spike := range spikes {
+		if !spike.Time.After(logged[spike.Event]) {
+			continue
+		}
+		logged[spike.Event] = spike.Time
+
+		drainer.Logger.Info("latency-spike", lager.Data{
+			"instance_id": instanceID,
+			"event":       spike.Event,
+			"time":        spike.Time.Format(time.RFC3339),
+			"latest_ms":   spike.Latest.Milliseconds(),
+			"max_ms":      spike.Max.Milliseconds(),
+		})
+	}
+}
+
+// command returns the name the instance knows a command by, or an error when
+// the instance has disabled it.
+func command(aliases map[string]string, name string) (string, error) {
+	alias, renamed := aliases[name]
+	if !renamed {
+		return name, nil
+	}
+
+	if alias == "" {
+		return "", fmt.Errorf("%s is disabled on this instance", name)
+	}
+
+	return alias, nil
+}
+
+func drainSlowlog(redisClient client.Client, aliases map[string]string) ([]SlowCommand, error) {
+	slowlog, err := command(aliases, "SLOWLOG")
+	if err != nil {
+		return nil, err
+	}
+
+	multi, err := command(aliases, "MULTI")
+	if err != nil {
+		return nil, err
+	}
+
+	exec, err := command(aliases, "EXEC")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := redisClient.Exec(multi); err != nil {
+		return nil, err
+	}
+
+	_, err = redisClient.Exec(slowlog, "GET", maxEntries)
+	if err == nil {
+		_, err = redisClient.Exec(slowlog, "RESET")
+	}
+
+	if err != nil {
+		discard(redisClient, aliases)
+		return nil, err
+	}
+
+	replies, err := redisclient.Values(redisClient.Exec(exec))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(replies) != 2 {
+		return nil, fmt.Errorf("unexpected reply to SLOWLOG GET and RESET: %v", replies)
+	}
+
+	return parseSlowlog(replies[0])
+}
+
+// discard abandons a transaction that could not be queued, so that the
+// connection can still be used.
+func discard(redisClient client.Client, aliases map[string]string) {
+	if name, err := command(aliases, "DISCARD"); err == nil {
+		redisClient.Exec(name)
+	}
+}
+
+// parseSlowlog parses the reply to SLOWLOG GET. The client address and name
+// are only reported by redis 4.0 and later.
+func parseSlowlog(reply interface{}) ([]SlowCommand, error) {
+	entries, err := redisclient.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := []SlowCommand{}
+	for _, entry := range entries {
+		fields, err := redisclient.Values(entry, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("unexpected slowlog entry with %d fields", len(fields))
+		}
+
+		id, _ := redisclient.Int64(fields[0], nil)
+		timestamp, _ := redisclient.Int64(fields[1], nil)
+		duration, _ := redisclient.Int64(fields[2], nil)
+		args, _ := redisclient.Strings(fields[3], nil)
+
+		command := SlowCommand{
+			ID:       id,
+			Time:     time.Unix(timestamp, 0).UTC(),
+			Duration: time.Duration(duration) * time.Microsecond,
+		}
+
+		if len(args) > 0 {
+			command.Command = strings.ToUpper(args[0])
+			command.Args = len(args) - 1
+		}
+
+		if len(fields) >= 6 {
+			command.Client, _ = redisclient.String(fields[4], nil)
+			command.Name, _ = redisclient.String(fields[5], nil)
+		}
+
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+func latestLatency(redisClient client.Client, aliases map[string]string) ([]LatencyEvent, error) {
+	latency, err := command(aliases, "LATENCY")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := redisclient.Values(redisClient.Exec(latency, "LATEST"))
+	if err != nil {
+		return nil, err
+	}
+
+	spikes := []LatencyEvent{}
+	for _, entry := range entries {
+		fields, err := redisclient.Values(entry, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("unexpected latency event with %d fields", len(fields))
+		}
+
+		event, _ := redisclient.String(fields[0], nil)
+		timestamp, _ := redisclient.Int64(fields[1], nil)
+		latest, _ := redisclient.Int64(fields[2], nil)
+		max, _ := redisclient.Int64(fields[3], nil)
+
+		spikes = append(spikes, LatencyEvent{
+			Event:  event,
+			Time:   time.Unix(timestamp, 0).UTC(),
+			Latest: time.Duration(latest) * time.Millisecond,
+			Max:    time.Duration(max) * time.Millisecond,
+		})
+	}
+
+	return spikes, nil
+}
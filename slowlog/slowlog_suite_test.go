@@ -0,0 +1,13 @@
+package slowlog_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSlowlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Slowlog Suite")
+}
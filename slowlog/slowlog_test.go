@@ -0,0 +1,232 @@
+package slowlog_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	redisclient "github.com/gomodule/redigo/redis"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/slowlog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInstances struct {
+	root      string
+	instances []*redis.Instance
+}
+
+func (fake *fakeInstances) AllInstances() ([]*redis.Instance, []error) {
+	return fake.instances, nil
+}
+
+func (fake *fakeInstances) InstanceConfigPath(instanceID string) string {
+	return filepath.Join(fake.root, instanceID, "redis.conf")
+}
+
+// fakeRedis answers the commands the drainer sends like a redis-server with
+// a slowlog and latency spikes would.
+type fakeRedis struct {
+	slowlog  []interface{}
+	latency  []interface{}
+	queued   []string
+	inMulti  bool
+	commands []string
+}
+
+func (fake *fakeRedis) exec(command string, args ...interface{}) (interface{}, error) {
+	fake.commands = append(fake.commands, command)
+
+	switch {
+	case command == "MULTI":
+		fake.inMulti = true
+		return "OK", nil
+	case command == "EXEC":
+		fake.inMulti = false
+		replies := []interface{}{}
+		for _, queued := range fake.queued {
+			switch queued {
+			case "GET":
+				replies = append(replies, fake.slowlog)
+			case "RESET":
+				fake.slowlog = []interface{}{}
+				replies = append(replies, "OK")
+			}
+		}
+		fake.queued = nil
+		return replies, nil
+	case command == "DISCARD":
+		fake.inMulti = false
+		fake.queued = nil
+		return "OK", nil
+	case command == "SLOWLOG" || command == "slowlog-alias":
+		Expect(fake.inMulti).To(BeTrue())
+		fake.queued = append(fake.queued, args[0].(string))
+		return "QUEUED", nil
+	case command == "LATENCY":
+		Expect(fake.inMulti).To(BeFalse())
+		return fake.latency, nil
+	}
+
+	return nil, redisclient.Error("ERR unknown command '" + command + "'")
+}
+
+func slowlogEntry(id, timestamp, duration int64, args ...string) interface{} {
+	argv := []interface{}{}
+	for _, arg := range args {
+		argv = append(argv, []byte(arg))
+	}
+	return []interface{}{id, timestamp, duration, argv, []byte("10.0.0.1:50000"), []byte("worker")}
+}
+
+func latencyEvent(event string, timestamp, latest, max int64) interface{} {
+	return []interface{}{[]byte(event), timestamp, latest, max}
+}
+
+var _ = Describe("Drainer", func() {
+	var (
+		instances *fakeInstances
+		server    *fakeRedis
+		aliases   map[string]string
+		logger    *lagertest.TestLogger
+		drainer   *slowlog.Drainer
+	)
+
+	BeforeEach(func() {
+		root, err := os.MkdirTemp("", "slowlog")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		instances = &fakeInstances{
+			root:      root,
+			instances: []*redis.Instance{{ID: "an-instance", Port: 7000, Password: "secret"}},
+		}
+
+		server = &fakeRedis{
+			slowlog: []interface{}{
+				slowlogEntry(8, 1792396380, 25000, "KEYS", "customer:*"),
+				slowlogEntry(7, 1792396320, 1500, "set", "customer:42", "private-value"),
+			},
+			latency: []interface{}{
+				latencyEvent("command", 1792396320, 250, 400),
+			},
+		}
+
+		logger = lagertest.NewTestLogger("slowlog")
+		drainer = slowlog.NewDrainer(instances, logger)
+		drainer.Connect = func(instance *redis.Instance, instanceAliases map[string]string) (client.Client, error) {
+			aliases = instanceAliases
+			fakeClient := new(fakes.FakeClient)
+			fakeClient.ExecStub = server.exec
+			return fakeClient, nil
+		}
+	})
+
+	It("logs every slowlog entry with the instance's ID", func() {
+		drainer.DrainAll()
+
+		Expect(logger).To(gbytes.Say(`"message":"slowlog.slow-command".*"args":1,"client":"10.0.0.1:50000","client_name":"worker","command":"KEYS","duration_us":25000,"id":8,"instance_id":"an-instance","time":"2026-10-19T07:53:00Z"`))
+		Expect(logger).To(gbytes.Say(`"message":"slowlog.slow-command".*"args":2,.*"command":"SET","duration_us":1500,"id":7,"instance_id":"an-instance"`))
+	})
+
+	It("does not log the arguments of slow commands", func() {
+		drainer.DrainAll()
+
+		Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("customer:"))
+		Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("private-value"))
+	})
+
+	It("reads and resets the slowlog in a single transaction", func() {
+		drainer.DrainAll()
+
+		Expect(server.commands[:4]).To(Equal([]string{"MULTI", "SLOWLOG", "SLOWLOG", "EXEC"}))
+		Expect(server.slowlog).To(BeEmpty())
+
+		drainer.DrainAll()
+		Expect(logger.LogMessages()).To(HaveLen(3))
+	})
+
+	It("logs each latency spike once", func() {
+		drainer.DrainAll()
+		Expect(logger).To(gbytes.Say(`"message":"slowlog.latency-spike".*"event":"command","instance_id":"an-instance","latest_ms":250,"max_ms":400,"time":"2026-10-19T07:52:00Z"`))
+
+		drainer.DrainAll()
+		Expect(logger).NotTo(gbytes.Say("latency-spike"))
+
+		server.latency = []interface{}{latencyEvent("command", 1792396440, 300, 400)}
+		drainer.DrainAll()
+		Expect(logger).To(gbytes.Say(`"message":"slowlog.latency-spike".*"latest_ms":300`))
+	})
+
+	Context("when the instance renames commands", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(instances.root, "an-instance"), 0755)).To(Succeed())
+			Expect(os.WriteFile(
+				instances.InstanceConfigPath("an-instance"),
+				[]byte("rename-command slowlog slowlog-alias\nrename-command LATENCY \"\"\n"),
+				0644,
+			)).To(Succeed())
+		})
+
+		It("uses the new names", func() {
+			drainer.DrainAll()
+
+			Expect(aliases).To(HaveKeyWithValue("SLOWLOG", "slowlog-alias"))
+			Expect(server.commands).To(ContainElement("slowlog-alias"))
+			Expect(logger).To(gbytes.Say("slow-command"))
+		})
+
+		It("skips disabled commands", func() {
+			drainer.DrainAll()
+
+			Expect(server.commands).NotTo(ContainElement("LATENCY"))
+			Expect(logger).To(gbytes.Say("LATENCY is disabled on this instance"))
+		})
+	})
+
+	It("abandons the transaction when the slowlog cannot be read", func() {
+		server.slowlog = nil
+		drainer.Connect = func(instance *redis.Instance, _ map[string]string) (client.Client, error) {
+			fakeClient := new(fakes.FakeClient)
+			fakeClient.ExecStub = func(command string, args ...interface{}) (interface{}, error) {
+				if command == "SLOWLOG" {
+					server.commands = append(server.commands, command)
+					return nil, redisclient.Error("NOPERM this user has no permissions")
+				}
+				return server.exec(command, args...)
+			}
+			return fakeClient, nil
+		}
+
+		drainer.DrainAll()
+
+		Expect(server.commands).To(Equal([]string{"MULTI", "SLOWLOG", "DISCARD", "LATENCY"}))
+		Expect(logger).To(gbytes.Say("drain-slowlog"))
+		Expect(logger).To(gbytes.Say("latency-spike"))
+	})
+
+	It("skips instances that cannot be reached", func() {
+		drainer.Connect = func(*redis.Instance, map[string]string) (client.Client, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		drainer.DrainAll()
+
+		Expect(logger).To(gbytes.Say("instance-unreachable"))
+		Expect(logger).NotTo(gbytes.Say("slow-command"))
+	})
+
+	It("drains every minute by default", func() {
+		Expect(slowlog.Interval(brokerconfig.ServiceConfiguration{})).To(Equal(time.Minute))
+		Expect(slowlog.Interval(brokerconfig.ServiceConfiguration{SlowlogIntervalSeconds: 120})).To(Equal(2 * time.Minute))
+	})
+})
@@ -0,0 +1,475 @@
+package statestore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/utils"
+)
+
+const defaultCompactAfter = 1000
+
+var ErrInstanceNotFound = errors.New("instance not found in state store")
+
+type Instance struct {
+	ID               string              `json:"id"`
+	Host             string              `json:"host"`
+	Port             int                 `json:"port"`
+	Password         string              `json:"password"`
+	PlanID           string              `json:"plan_id,omitempty"`
+	OrganizationGUID string              `json:"organization_guid,omitempty"`
+	SpaceGUID        string              `json:"space_guid,omitempty"`
+	Parameters       json.RawMessage     `json:"parameters,omitempty"`
+	Context          json.RawMessage     `json:"context,omitempty"`
+	Bindings         map[string]*Binding `json:"bindings"`
+	CreatedAt        time.Time           `json:"created_at"`
+}
+
+type Binding struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type entry struct {
+	Op         string    `json:"op"`
+	InstanceID string    `json:"instance_id"`
+	Instance   *Instance `json:"instance,omitempty"`
+}
+
+const (
+	opPutInstance    = "put-instance"
+	opDeleteInstance = "delete-instance"
+)
+
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+// Store keeps the state of every instance in a snapshot file plus a journal of
+// the changes made since the snapshot was written. Every change is appended to
+// the journal and synced before it is applied, so a crash loses at most the
+// change that was being written. What was written of that change is cut off
+// before the next change is appended. The journal is folded into a new snapshot
+// once it grows long.
+//
+// Several processes can use the same store: changes are made under an
+// exclusive flock, and a store reloads the files whenever another process has
+// changed them.
+type Store struct {
+	Path string
+	// CompactAfter is the number of journal entries after which the journal is
+	// folded into the snapshot.
+	CompactAfter int
+
+	mutex     sync.Mutex
+	instances map[string]*Instance
+	entries   int
+	snapshot  fileVersion
+	journal   fileVersion
+}
+
+func Open(path string) (*Store, error) {
+	store := &Store{
+		Path:         path,
+		CompactAfter: defaultCompactAfter,
+		instances:    map[string]*Instance{},
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err = store.withFileLock(syscall.LOCK_SH, store.load)
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Empty reports whether the store has never been written to, which is when
+// existing instances need to be imported into it.
+func (store *Store) Empty() (bool, error) {
+	_, snapshotErr := os.Stat(store.Path)
+	_, journalErr := os.Stat(store.journalPath())
+
+	if snapshotErr != nil && !os.IsNotExist(snapshotErr) {
+		return false, snapshotErr
+	}
+
+	if journalErr != nil && !os.IsNotExist(journalErr) {
+		return false, journalErr
+	}
+
+	return os.IsNotExist(snapshotErr) && os.IsNotExist(journalErr), nil
+}
+
+func (store *Store) Instance(instanceID string) (*Instance, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := store.instances[instanceID]
+	if !ok {
+		return nil, ErrInstanceNotFound
+	}
+
+	return copyInstance(instance), nil
+}
+
+// Instances returns every instance ordered by ID.
+func (store *Store) Instances() ([]*Instance, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*Instance{}
+	for _, instance := range store.instances {
+		instances = append(instances, copyInstance(instance))
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+
+	return instances, nil
+}
+
+func (store *Store) Count() (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.refresh()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(store.instances), nil
+}
+
+func (store *Store) PutInstance(instance *Instance) error {
+	return store.update(func() (*entry, error) {
+		record := copyInstance(instance)
+		if existing, ok := store.instances[instance.ID]; ok && record.Bindings == nil {
+			record.Bindings = existing.Bindings
+		}
+		if record.Bindings == nil {
+			record.Bindings = map[string]*Binding{}
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now().UTC()
+		}
+
+		return &entry{Op: opPutInstance, InstanceID: instance.ID, Instance: record}, nil
+	})
+}
+
+// UpdateInstance changes the record of an existing instance.
+func (store *Store) UpdateInstance(instanceID string, change func(*Instance)) error {
+	return store.update(func() (*entry, error) {
+		existing, ok := store.instances[instanceID]
+		if !ok {
+			return nil, ErrInstanceNotFound
+		}
+
+		record := copyInstance(existing)
+		change(record)
+		record.ID = instanceID
+
+		return &entry{Op: opPutInstance, InstanceID: instanceID, Instance: record}, nil
+	})
+}
+
+func (store *Store) DeleteInstance(instanceID string) error {
+	return store.update(func() (*entry, error) {
+		if _, ok := store.instances[instanceID]; !ok {
+			return nil, nil
+		}
+
+		return &entry{Op: opDeleteInstance, InstanceID: instanceID}, nil
+	})
+}
+
+func (store *Store) PutBinding(instanceID, bindingID string) error {
+	return store.UpdateInstance(instanceID, func(instance *Instance) {
+		if _, ok := instance.Bindings[bindingID]; ok {
+			return
+		}
+
+		instance.Bindings[bindingID] = &Binding{
+			ID:        bindingID,
+			CreatedAt: time.Now().UTC(),
+		}
+	})
+}
+
+func (store *Store) DeleteBinding(instanceID, bindingID string) error {
+	return store.UpdateInstance(instanceID, func(instance *Instance) {
+		delete(instance.Bindings, bindingID)
+	})
+}
+
+func (store *Store) update(change func() (*entry, error)) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.withFileLock(syscall.LOCK_EX, func() error {
+		err := store.refreshLocked()
+		if err != nil {
+			return err
+		}
+
+		e, err := change()
+		if err != nil || e == nil {
+			return err
+		}
+
+		err = store.appendEntry(e)
+		if err != nil {
+			return err
+		}
+
+		store.apply(e)
+
+		if store.entries >= store.CompactAfter {
+			return store.compact()
+		}
+
+		return store.recordVersions()
+	})
+}
+
+func (store *Store) refresh() error {
+	changed, err := store.changed()
+	if err != nil || !changed {
+		return err
+	}
+
+	return store.withFileLock(syscall.LOCK_SH, store.load)
+}
+
+func (store *Store) refreshLocked() error {
+	changed, err := store.changed()
+	if err != nil || !changed {
+		return err
+	}
+
+	return store.load()
+}
+
+func (store *Store) changed() (bool, error) {
+	snapshot, err := versionOf(store.Path)
+	if err != nil {
+		return false, err
+	}
+
+	journal, err := versionOf(store.journalPath())
+	if err != nil {
+		return false, err
+	}
+
+	return snapshot != store.snapshot || journal != store.journal, nil
+}
+
+func (store *Store) load() error {
+	instances := map[string]*Instance{}
+
+	data, err := ioutil.ReadFile(store.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &instances)
+		if err != nil {
+			return err
+		}
+	}
+
+	store.instances = instances
+	store.entries = 0
+
+	journal, err := ioutil.ReadFile(store.journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(journal))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			// a torn final entry from a crash mid-write was never applied
+			continue
+		}
+
+		store.apply(&e)
+		store.entries++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return store.recordVersions()
+}
+
+func (store *Store) apply(e *entry) {
+	switch e.Op {
+	case opPutInstance:
+		store.instances[e.InstanceID] = e.Instance
+	case opDeleteInstance:
+		delete(store.instances, e.InstanceID)
+	}
+}
+
+func (store *Store) appendEntry(e *entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(store.journalPath(), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = utils.TruncateTornLine(file)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	store.entries++
+	return nil
+}
+
+// compact writes a new snapshot and empties the journal. The snapshot is
+// replaced atomically, so a crash in between leaves a snapshot and a journal
+// whose entries are already part of it, and replaying them again is harmless.
+func (store *Store) compact() error {
+	data, err := json.Marshal(store.instances)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := store.Path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, store.Path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Truncate(store.journalPath(), 0)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	store.entries = 0
+	return store.recordVersions()
+}
+
+func (store *Store) recordVersions() error {
+	snapshot, err := versionOf(store.Path)
+	if err != nil {
+		return err
+	}
+
+	journal, err := versionOf(store.journalPath())
+	if err != nil {
+		return err
+	}
+
+	store.snapshot = snapshot
+	store.journal = journal
+	return nil
+}
+
+func (store *Store) withFileLock(how int, do func() error) error {
+	lockFile, err := os.OpenFile(store.Path+".lock", os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	err = syscall.Flock(int(lockFile.Fd()), how)
+	if err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	return do()
+}
+
+func (store *Store) journalPath() string {
+	return store.Path + ".journal"
+}
+
+func versionOf(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fileVersion{}, nil
+	}
+	if err != nil {
+		return fileVersion{}, err
+	}
+
+	return fileVersion{size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+func copyInstance(instance *Instance) *Instance {
+	copied := *instance
+	if instance.Bindings != nil {
+		copied.Bindings = map[string]*Binding{}
+		for id, binding := range instance.Bindings {
+			bindingCopy := *binding
+			copied.Bindings[id] = &bindingCopy
+		}
+	}
+	return &copied
+}
@@ -0,0 +1,13 @@
+package statestore_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStatestore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Statestore Suite")
+}
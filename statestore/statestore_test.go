@@ -0,0 +1,210 @@
+package statestore_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/cf-redis-broker/statestore"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		stateDir  string
+		statePath string
+		store     *statestore.Store
+	)
+
+	instance := func(id string, port int) *statestore.Instance {
+		return &statestore.Instance{
+			ID:       id,
+			Host:     "localhost",
+			Port:     port,
+			Password: "secret-" + id,
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		stateDir, err = os.MkdirTemp("", "statestore")
+		Expect(err).NotTo(HaveOccurred())
+
+		statePath = filepath.Join(stateDir, "state", "state.json")
+		store, err = statestore.Open(statePath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(stateDir)).To(Succeed())
+	})
+
+	It("is empty until it has been written to", func() {
+		Expect(store.Empty()).To(BeTrue())
+
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+
+		Expect(store.Empty()).To(BeFalse())
+	})
+
+	It("returns the instances that were put", func() {
+		Expect(store.PutInstance(instance("b-instance", 6381))).To(Succeed())
+		Expect(store.PutInstance(instance("a-instance", 6380))).To(Succeed())
+
+		found, err := store.Instance("a-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Port).To(Equal(6380))
+		Expect(found.Password).To(Equal("secret-a-instance"))
+		Expect(found.CreatedAt).NotTo(BeZero())
+
+		all, err := store.Instances()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(2))
+		Expect(all[0].ID).To(Equal("a-instance"))
+		Expect(all[1].ID).To(Equal("b-instance"))
+
+		Expect(store.Count()).To(Equal(2))
+	})
+
+	It("returns ErrInstanceNotFound for unknown instances", func() {
+		_, err := store.Instance("unknown")
+		Expect(err).To(Equal(statestore.ErrInstanceNotFound))
+
+		err = store.PutBinding("unknown", "a-binding")
+		Expect(err).To(Equal(statestore.ErrInstanceNotFound))
+	})
+
+	It("deletes instances", func() {
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+		Expect(store.DeleteInstance("an-instance")).To(Succeed())
+		Expect(store.DeleteInstance("an-instance")).To(Succeed())
+
+		Expect(store.Count()).To(BeZero())
+	})
+
+	It("records bindings and provisioning details", func() {
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+		Expect(store.PutBinding("an-instance", "first-binding")).To(Succeed())
+		Expect(store.PutBinding("an-instance", "second-binding")).To(Succeed())
+		Expect(store.DeleteBinding("an-instance", "first-binding")).To(Succeed())
+		Expect(store.UpdateInstance("an-instance", func(record *statestore.Instance) {
+			record.PlanID = "shared-plan"
+			record.Parameters = json.RawMessage(`{"maxmemory":"64mb"}`)
+		})).To(Succeed())
+
+		found, err := store.Instance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Bindings).To(HaveLen(1))
+		Expect(found.Bindings).To(HaveKey("second-binding"))
+		Expect(found.PlanID).To(Equal("shared-plan"))
+		Expect(string(found.Parameters)).To(MatchJSON(`{"maxmemory":"64mb"}`))
+	})
+
+	It("does not let callers change stored records", func() {
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+
+		found, err := store.Instance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		found.Port = 1
+		found.Bindings["sneaky"] = &statestore.Binding{ID: "sneaky"}
+
+		found, err = store.Instance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Port).To(Equal(6380))
+		Expect(found.Bindings).To(BeEmpty())
+	})
+
+	It("keeps bindings when an instance is put again", func() {
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+		Expect(store.PutBinding("an-instance", "a-binding")).To(Succeed())
+
+		Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+
+		found, err := store.Instance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Bindings).To(HaveKey("a-binding"))
+	})
+
+	Describe("reopening", func() {
+		BeforeEach(func() {
+			Expect(store.PutInstance(instance("an-instance", 6380))).To(Succeed())
+			Expect(store.PutInstance(instance("another-instance", 6381))).To(Succeed())
+			Expect(store.PutBinding("an-instance", "a-binding")).To(Succeed())
+			Expect(store.DeleteInstance("another-instance")).To(Succeed())
+		})
+
+		It("replays the journal", func() {
+			reopened, err := statestore.Open(statePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			all, err := reopened.Instances()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(all).To(HaveLen(1))
+			Expect(all[0].ID).To(Equal("an-instance"))
+			Expect(all[0].Bindings).To(HaveKey("a-binding"))
+		})
+
+		It("ignores an entry that was torn by a crash", func() {
+			journal, err := os.OpenFile(statePath+".journal", os.O_WRONLY|os.O_APPEND, 0640)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = journal.WriteString(`{"op":"delete-instance","instance_id":"an-ins`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Close()).To(Succeed())
+
+			reopened, err := statestore.Open(statePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reopened.Count()).To(Equal(1))
+		})
+
+		It("keeps the changes made after an entry was torn", func() {
+			journal, err := os.OpenFile(statePath+".journal", os.O_WRONLY|os.O_APPEND, 0640)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = journal.WriteString(`{"op":"delete-instance","instance_id":"an-ins`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Close()).To(Succeed())
+
+			reopened, err := statestore.Open(statePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reopened.PutInstance(instance("another-instance", 6380))).To(Succeed())
+
+			reopened, err = statestore.Open(statePath)
+			Expect(err).NotTo(HaveOccurred())
+			all, err := reopened.Instances()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(all).To(HaveLen(2))
+			Expect(all[1].ID).To(Equal("another-instance"))
+		})
+
+		It("compacts the journal into the snapshot", func() {
+			store.CompactAfter = 1
+			Expect(store.PutBinding("an-instance", "another-binding")).To(Succeed())
+
+			journal, err := os.Stat(statePath + ".journal")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Size()).To(BeZero())
+
+			reopened, err := statestore.Open(statePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			found, err := reopened.Instance("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found.Bindings).To(HaveLen(2))
+			Expect(reopened.Count()).To(Equal(1))
+		})
+	})
+
+	It("sees changes made through another store", func() {
+		other, err := statestore.Open(statePath)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(other.PutInstance(instance("an-instance", 6380))).To(Succeed())
+		Expect(store.Count()).To(Equal(1))
+
+		Expect(store.PutBinding("an-instance", "a-binding")).To(Succeed())
+		found, err := other.Instance("an-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Bindings).To(HaveKey("a-binding"))
+	})
+})
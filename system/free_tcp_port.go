@@ -7,7 +7,10 @@ import (
 )
 
 func FindFreePort() (int, error) {
-	l, _ := net.Listen("tcp", ":0")
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return -1, err
+	}
 	defer l.Close()
 
 	parsedPort, parseErr := getPortFromAddr(l.Addr())
@@ -0,0 +1,212 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+const (
+	defaultPortRangeStart = 6380
+	defaultPortRangeEnd   = 7379
+)
+
+var ErrNoPortsAvailable = errors.New("no ports available in the configured range")
+
+type reservations struct {
+	Ports map[string]int `json:"ports"`
+}
+
+// PortAllocator hands out ports to instances from an operator-defined range.
+// Reservations are persisted, so an instance keeps its port while it is
+// stopped, and the reservation file is locked while it is changed so that
+// concurrent provisioning in the same or another process never hands out the
+// same port twice.
+type PortAllocator struct {
+	RangeStart       int
+	RangeEnd         int
+	Excluded         map[int]bool
+	ReservationsPath string
+
+	// PortAvailable reports whether nothing else is listening on a port.
+	PortAvailable func(port int) bool
+
+	mutex sync.Mutex
+}
+
+func NewPortAllocator(config brokerconfig.ServiceConfiguration) *PortAllocator {
+	allocator := &PortAllocator{
+		RangeStart:       config.PortRangeStart,
+		RangeEnd:         config.PortRangeEnd,
+		Excluded:         map[int]bool{},
+		ReservationsPath: config.PortReservationsFile,
+		PortAvailable:    PortAvailable,
+	}
+
+	if allocator.RangeStart <= 0 {
+		allocator.RangeStart = defaultPortRangeStart
+	}
+
+	if allocator.RangeEnd <= 0 {
+		allocator.RangeEnd = defaultPortRangeEnd
+	}
+
+	if allocator.ReservationsPath == "" {
+		allocator.ReservationsPath = filepath.Join(filepath.Dir(config.InstanceDataDirectory), "port-reservations.json")
+	}
+
+	for _, port := range config.ExcludedPorts {
+		allocator.Excluded[port] = true
+	}
+
+	return allocator
+}
+
+// Reserve returns the port reserved for an instance, reserving the lowest
+// free port in the range if it does not have one yet.
+func (allocator *PortAllocator) Reserve(instanceID string) (int, error) {
+	var reserved int
+
+	err := allocator.update(func(current *reservations) error {
+		if port, ok := current.Ports[instanceID]; ok {
+			reserved = port
+			return nil
+		}
+
+		taken := map[int]bool{}
+		for _, port := range current.Ports {
+			taken[port] = true
+		}
+
+		for port := allocator.RangeStart; port <= allocator.RangeEnd; port++ {
+			if taken[port] || allocator.Excluded[port] || !allocator.PortAvailable(port) {
+				continue
+			}
+
+			current.Ports[instanceID] = port
+			reserved = port
+			return nil
+		}
+
+		return ErrNoPortsAvailable
+	})
+
+	return reserved, err
+}
+
+// Adopt records the port of an instance that was created before its port was
+// reserved, so that it is never handed out to another instance.
+func (allocator *PortAllocator) Adopt(instanceID string, port int) error {
+	return allocator.update(func(current *reservations) error {
+		current.Ports[instanceID] = port
+		return nil
+	})
+}
+
+func (allocator *PortAllocator) Release(instanceID string) error {
+	return allocator.update(func(current *reservations) error {
+		delete(current.Ports, instanceID)
+		return nil
+	})
+}
+
+func (allocator *PortAllocator) Reservations() (map[string]int, error) {
+	var ports map[string]int
+
+	err := allocator.update(func(current *reservations) error {
+		ports = current.Ports
+		return nil
+	})
+
+	return ports, err
+}
+
+func (allocator *PortAllocator) update(change func(*reservations) error) error {
+	allocator.mutex.Lock()
+	defer allocator.mutex.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(allocator.ReservationsPath), 0750)
+	if err != nil {
+		return err
+	}
+
+	lockFile, err := os.OpenFile(allocator.ReservationsPath+".lock", os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	current, err := allocator.load()
+	if err != nil {
+		return err
+	}
+
+	err = change(current)
+	if err != nil {
+		return err
+	}
+
+	return allocator.save(current)
+}
+
+func (allocator *PortAllocator) load() (*reservations, error) {
+	current := &reservations{Ports: map[string]int{}}
+
+	data, err := ioutil.ReadFile(allocator.ReservationsPath)
+	if os.IsNotExist(err) {
+		return current, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, current)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Ports == nil {
+		current.Ports = map[string]int{}
+	}
+
+	return current, nil
+}
+
+func (allocator *PortAllocator) save(current *reservations) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := allocator.ReservationsPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0640)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, allocator.ReservationsPath)
+}
+
+func PortAvailable(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+
+	listener.Close()
+	return true
+}
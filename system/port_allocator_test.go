@@ -0,0 +1,121 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+var _ = Describe("PortAllocator", func() {
+	var (
+		tmpDir    string
+		allocator *PortAllocator
+		inUse     map[int]bool
+	)
+
+	newAllocator := func() *PortAllocator {
+		allocator := NewPortAllocator(brokerconfig.ServiceConfiguration{
+			InstanceDataDirectory: filepath.Join(tmpDir, "data"),
+			PortRangeStart:        7000,
+			PortRangeEnd:          7004,
+			ExcludedPorts:         []int{7001},
+		})
+		allocator.PortAvailable = func(port int) bool { return !inUse[port] }
+		return allocator
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "port-allocator")
+		Expect(err).NotTo(HaveOccurred())
+
+		inUse = map[int]bool{}
+		allocator = newAllocator()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("uses defaults when nothing is configured", func() {
+		allocator := NewPortAllocator(brokerconfig.ServiceConfiguration{
+			InstanceDataDirectory: "/var/vcap/store/redis",
+		})
+
+		Expect(allocator.RangeStart).To(Equal(6380))
+		Expect(allocator.RangeEnd).To(Equal(7379))
+		Expect(allocator.ReservationsPath).To(Equal("/var/vcap/store/port-reservations.json"))
+	})
+
+	It("hands out ports from the range, skipping excluded ports and ports in use", func() {
+		inUse[7002] = true
+
+		Expect(allocator.Reserve("first")).To(Equal(7000))
+		Expect(allocator.Reserve("second")).To(Equal(7003))
+		Expect(allocator.Reserve("third")).To(Equal(7004))
+	})
+
+	It("returns the existing reservation of an instance", func() {
+		Expect(allocator.Reserve("first")).To(Equal(7000))
+		inUse[7000] = true
+
+		Expect(allocator.Reserve("first")).To(Equal(7000))
+	})
+
+	It("returns an error when the range is exhausted", func() {
+		for _, instanceID := range []string{"a", "b", "c", "d"} {
+			_, err := allocator.Reserve(instanceID)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		_, err := allocator.Reserve("e")
+		Expect(err).To(Equal(ErrNoPortsAvailable))
+	})
+
+	It("persists reservations", func() {
+		Expect(allocator.Reserve("first")).To(Equal(7000))
+		Expect(allocator.Adopt("legacy", 7002)).To(Succeed())
+
+		reopened := newAllocator()
+		Expect(reopened.Reservations()).To(Equal(map[string]int{"first": 7000, "legacy": 7002}))
+		Expect(reopened.Reserve("second")).To(Equal(7003))
+	})
+
+	It("makes released ports available again", func() {
+		Expect(allocator.Reserve("first")).To(Equal(7000))
+		Expect(allocator.Release("first")).To(Succeed())
+
+		Expect(allocator.Reserve("second")).To(Equal(7000))
+	})
+
+	It("never hands out the same port twice when reserving concurrently", func() {
+		allocators := []*PortAllocator{allocator, newAllocator()}
+		ports := make(chan int, 4)
+
+		wg := sync.WaitGroup{}
+		for i, instanceID := range []string{"a", "b", "c", "d"} {
+			wg.Add(1)
+			go func(allocator *PortAllocator, instanceID string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				port, err := allocator.Reserve(instanceID)
+				Expect(err).NotTo(HaveOccurred())
+				ports <- port
+			}(allocators[i%2], instanceID)
+		}
+		wg.Wait()
+		close(ports)
+
+		reserved := []int{}
+		for port := range ports {
+			reserved = append(reserved, port)
+		}
+		Expect(reserved).To(ConsistOf(7000, 7002, 7003, 7004))
+	})
+})
@@ -0,0 +1,136 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/BooleanCat/igo/ios/iexec"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+const defaultInstanceUserPrefix = "redis-"
+
+// User is the unprivileged account an instance's redis-server runs as.
+type User struct {
+	Name string
+	UID  uint32
+	GID  uint32
+}
+
+// UserManager keeps one system user, with a group of the same name, for each
+// shared instance. User names are derived from a hash of the instance ID
+// because instance IDs are usually GUIDs, which are too long for useradd.
+type UserManager struct {
+	Prefix string
+	Exec   iexec.Exec
+
+	// LookupUser finds a user by name. It defaults to os/user.Lookup.
+	LookupUser func(name string) (*user.User, error)
+}
+
+func NewUserManager(config brokerconfig.ServiceConfiguration) *UserManager {
+	manager := &UserManager{
+		Prefix:     config.InstanceUserPrefix,
+		Exec:       iexec.New(),
+		LookupUser: user.Lookup,
+	}
+
+	if manager.Prefix == "" {
+		manager.Prefix = defaultInstanceUserPrefix
+	}
+
+	return manager
+}
+
+// UserName returns the name of the instance's user.
+func (manager *UserManager) UserName(instanceID string) string {
+	sum := sha256.Sum256([]byte(instanceID))
+	return manager.Prefix + hex.EncodeToString(sum[:8])
+}
+
+// Create adds the instance's user unless it already exists. The user has no
+// home directory and cannot log in.
+func (manager *UserManager) Create(instanceID string) (User, error) {
+	existing, err := manager.Lookup(instanceID)
+	if err == nil {
+		return existing, nil
+	}
+
+	if !isUnknownUser(err) {
+		return User{}, err
+	}
+
+	err = manager.run(
+		"useradd",
+		"--system",
+		"--user-group",
+		"--no-create-home",
+		"--home-dir", "/nonexistent",
+		"--shell", "/usr/sbin/nologin",
+		"--comment", "redis instance "+instanceID,
+		manager.UserName(instanceID),
+	)
+	if err != nil {
+		return User{}, err
+	}
+
+	return manager.Lookup(instanceID)
+}
+
+// Lookup returns the instance's user. The error is a user.UnknownUserError
+// when the user does not exist.
+func (manager *UserManager) Lookup(instanceID string) (User, error) {
+	name := manager.UserName(instanceID)
+
+	found, err := manager.LookupUser(name)
+	if err != nil {
+		return User{}, err
+	}
+
+	uid, err := strconv.ParseUint(found.Uid, 10, 32)
+	if err != nil {
+		return User{}, fmt.Errorf("user %s has a non-numeric uid %q", name, found.Uid)
+	}
+
+	gid, err := strconv.ParseUint(found.Gid, 10, 32)
+	if err != nil {
+		return User{}, fmt.Errorf("user %s has a non-numeric gid %q", name, found.Gid)
+	}
+
+	return User{Name: name, UID: uint32(uid), GID: uint32(gid)}, nil
+}
+
+// Remove deletes the instance's user and its group. Removing a user that does
+// not exist is not an error.
+func (manager *UserManager) Remove(instanceID string) error {
+	_, err := manager.Lookup(instanceID)
+	if isUnknownUser(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return manager.run("userdel", manager.UserName(instanceID))
+}
+
+func (manager *UserManager) run(command string, args ...string) error {
+	output, err := manager.Exec.Command(command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %s: %s", command, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func isUnknownUser(err error) bool {
+	var unknown user.UnknownUserError
+	return errors.As(err, &unknown)
+}
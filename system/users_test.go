@@ -0,0 +1,109 @@
+package system
+
+import (
+	"errors"
+	"os/user"
+	"strings"
+
+	"github.com/BooleanCat/igo/ios/iexec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+var _ = Describe("UserManager", func() {
+	var (
+		manager *UserManager
+		exec    *iexec.NestedCommandFake
+		users   map[string]*user.User
+	)
+
+	commands := func() []string {
+		calls := []string{}
+		for i := 0; i < exec.Exec.CommandCallCount(); i++ {
+			command, args := exec.Exec.CommandArgsForCall(i)
+			calls = append(calls, command+" "+strings.Join(args, " "))
+		}
+		return calls
+	}
+
+	BeforeEach(func() {
+		users = map[string]*user.User{}
+		exec = iexec.NewNestedCommandFake()
+
+		manager = NewUserManager(brokerconfig.ServiceConfiguration{})
+		manager.Exec = exec.Exec
+		manager.LookupUser = func(name string) (*user.User, error) {
+			found, ok := users[name]
+			if !ok {
+				return nil, user.UnknownUserError(name)
+			}
+			return found, nil
+		}
+	})
+
+	It("derives a short, stable user name from the instance ID", func() {
+		name := manager.UserName("5a9ce5b4-0b8f-4a4b-9bd5-6f9c1cbd4b57")
+
+		Expect(name).To(HavePrefix("redis-"))
+		Expect(len(name)).To(BeNumerically("<=", 32))
+		Expect(manager.UserName("5a9ce5b4-0b8f-4a4b-9bd5-6f9c1cbd4b57")).To(Equal(name))
+		Expect(manager.UserName("another-instance")).NotTo(Equal(name))
+	})
+
+	It("uses the configured prefix", func() {
+		manager = NewUserManager(brokerconfig.ServiceConfiguration{InstanceUserPrefix: "tenant-"})
+		Expect(manager.UserName("an-instance")).To(HavePrefix("tenant-"))
+	})
+
+	Describe("Create", func() {
+		It("adds a system user that cannot log in", func() {
+			name := manager.UserName("an-instance")
+			exec.Cmd.CombinedOutputStub = func() ([]byte, error) {
+				users[name] = &user.User{Username: name, Uid: "998", Gid: "997"}
+				return nil, nil
+			}
+
+			created, err := manager.Create("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created).To(Equal(User{Name: name, UID: 998, GID: 997}))
+
+			Expect(commands()).To(ConsistOf(
+				"useradd --system --user-group --no-create-home --home-dir /nonexistent --shell /usr/sbin/nologin --comment redis instance an-instance " + name,
+			))
+		})
+
+		It("reuses an existing user", func() {
+			name := manager.UserName("an-instance")
+			users[name] = &user.User{Username: name, Uid: "998", Gid: "997"}
+
+			created, err := manager.Create("an-instance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.UID).To(Equal(uint32(998)))
+			Expect(exec.Exec.CommandCallCount()).To(BeZero())
+		})
+
+		It("returns the output of useradd when it fails", func() {
+			exec.Cmd.CombinedOutputReturns([]byte("useradd: Permission denied.\n"), errors.New("exit status 1"))
+
+			_, err := manager.Create("an-instance")
+			Expect(err).To(MatchError("useradd failed: exit status 1: useradd: Permission denied."))
+		})
+	})
+
+	Describe("Remove", func() {
+		It("deletes the instance's user", func() {
+			name := manager.UserName("an-instance")
+			users[name] = &user.User{Username: name, Uid: "998", Gid: "997"}
+
+			Expect(manager.Remove("an-instance")).To(Succeed())
+			Expect(commands()).To(ConsistOf("userdel " + name))
+		})
+
+		It("does nothing when the user does not exist", func() {
+			Expect(manager.Remove("an-instance")).To(Succeed())
+			Expect(exec.Exec.CommandCallCount()).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,20 @@
+package utils
+
+import "time"
+
+// Every calls run straight away and then every interval until stop is
+// closed.
+func Every(interval time.Duration, stop <-chan struct{}, run func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
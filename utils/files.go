@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"io"
 	"os"
 )
@@ -30,3 +31,32 @@ func MoveFile(source, destination string) error {
 	}
 	return nil
 }
+
+// TruncateTornLine cuts a file of newline terminated lines back to its last
+// complete line. A line torn by a crash mid-write would otherwise be continued
+// by the next append, and the appended line would be unreadable too. The file
+// must be open for reading and writing.
+func TruncateTornLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+	_, err = file.ReadAt(last, info.Size()-1)
+	if err != nil {
+		return err
+	}
+
+	if last[0] == '\n' {
+		return nil
+	}
+
+	data := make([]byte, info.Size())
+	_, err = file.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return file.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+}